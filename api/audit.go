@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/token"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const auditEntryKey = "audit_entry"
+
+// audited returns the context a handler makes its change with. On the routes covered by
+// auditMiddleware, it carries the audit entry of action, which the store writes in the
+// transaction of the change: the change is never committed without its entry.
+func audited(ctx *gin.Context, action string) context.Context {
+	value, exists := ctx.Get(auditEntryKey)
+	if !exists {
+		return ctx
+	}
+	entry := value.(db.AuditEntry)
+	entry.Action = action
+	return db.WithAuditEntry(ctx, entry)
+}
+
+// auditMiddleware records the authenticated actor and the origin of the request for the
+// changes the handler makes through audited.
+func auditMiddleware(server *Server) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		data, _ := ctx.Get(server.config.GetConfig().AuthorizationPayloadKey)
+		payload, _ := data.(*token.Payload)
+
+		ctx.Set(auditEntryKey, db.AuditEntry{
+			ActorUsername: payload.Username,
+			ActorRole:     payload.Role.Name,
+			ClientIP:      ctx.ClientIP(),
+			RequestID:     requestID(ctx),
+		})
+		ctx.Next()
+	}
+}
+
+func (server *Server) getAuditLog(ctx *gin.Context) {
+	var request struct {
+		Limit         int32     `form:"limit" binding:"required,gte=1"`
+		Offset        int32     `form:"offset" binding:"min=0"`
+		Actor         string    `form:"actor" binding:"omitempty,alphanum"`
+		Action        string    `form:"action" binding:"omitempty"`
+		TargetType    string    `form:"target_type" binding:"omitempty,alpha"`
+		TargetID      string    `form:"target_id" binding:"omitempty"`
+		CreatedAfter  time.Time `form:"created_after" binding:"omitempty"`
+		CreatedBefore time.Time `form:"created_before" binding:"omitempty"`
+	}
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	arg := db.ListAuditLogParams{
+		LimitOffset: db.LimitOffset{
+			Limit:  request.Limit,
+			Offset: request.Offset,
+		},
+		ActorUsername: sql.NullString{String: request.Actor, Valid: len(request.Actor) > 0},
+		Action:        sql.NullString{String: request.Action, Valid: len(strings.TrimSpace(request.Action)) > 0},
+		TargetType:    sql.NullString{String: request.TargetType, Valid: len(request.TargetType) > 0},
+		TargetID:      sql.NullString{String: request.TargetID, Valid: len(strings.TrimSpace(request.TargetID)) > 0},
+		CreatedAfter:  sql.NullTime{Time: request.CreatedAfter, Valid: !request.CreatedAfter.IsZero()},
+		CreatedBefore: sql.NullTime{Time: request.CreatedBefore, Valid: !request.CreatedBefore.IsZero()},
+	}
+
+	entries, err := server.store.ListAuditLog(ctx, arg)
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// auditedAs matches the context of a change audited as action.
+func auditedAs(action string) any {
+	return mock.MatchedBy(func(ctx context.Context) bool {
+		entry, ok := db.AuditEntryFrom(ctx)
+		return ok && entry.Action == action
+	})
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	adminUser := createRandomUser(db.RoleAdmin, false)
+	property := createRandomProperty()
+
+	testCases := []struct {
+		name     string
+		mock     func(querier *mocker.TestMocker)
+		response func(t *testing.T, recorder *httptest.ResponseRecorder, querier *mocker.TestMocker)
+	}{
+		{
+			name: "RecordsActorAndRequest",
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("DeleteProperty", mock.MatchedBy(func(ctx context.Context) bool {
+						entry, ok := db.AuditEntryFrom(ctx)
+						return ok &&
+							entry.ActorUsername == adminUser.Username &&
+							entry.ActorRole == db.RoleAdmin &&
+							entry.Action == "property.delete" &&
+							entry.RequestID == "req-42"
+					}), property.ExternalID, mock.Anything, sql.NullInt64{}).
+					Times(1).
+					Return(property, nil)
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder, querier *mocker.TestMocker) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				querier.AssertExpectations(t)
+			},
+		},
+		{
+			name: "AuditFailureFailsChange",
+			mock: func(querier *mocker.TestMocker) {
+				// the store rolls the change back when its audit entry cannot be written
+				querier.
+					On("DeleteProperty", auditedAs("property.delete"), property.ExternalID, mock.Anything, sql.NullInt64{}).
+					Times(1).
+					Return(nil, sql.ErrConnDone)
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder, querier *mocker.TestMocker) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			server := newTestServer(querier, "test")
+			querier.
+				On("GetUser", mock.Anything, adminUser.Username).
+				Times(1).
+				Return(adminUser, nil)
+			tc.mock(querier)
+
+			request, err := http.NewRequest(http.MethodDelete, "/api/v1/auth/admin/property/"+property.ExternalID, nil)
+			require.NoError(t, err)
+			// any version, the version checks are covered by the If-Match cases
+			request.Header.Set(ifMatchHeaderKey, "*")
+			request.Header.Set(requestIDHeaderKey, "req-42")
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, adminUser.Username, adminUser.Role, time.Minute)
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			tc.response(t, recorder, querier)
+		})
+	}
+}
+
+func TestGetAuditLog(t *testing.T) {
+	superUser := createRandomUser(db.RoleSuperUser, false)
+	adminUser := createRandomUser(db.RoleAdmin, false)
+	entries := []*db.AuditLog{
+		{
+			ID:            1,
+			ActorUsername: adminUser.Username,
+			ActorRole:     db.RoleAdmin,
+			Action:        "role.create",
+			TargetType:    "role",
+			TargetID:      "ROL101",
+			After:         json.RawMessage(`{"name":"manager"}`),
+			CreatedAt:     time.Now(),
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		query    string
+		mock     func(querier *mocker.TestMocker)
+		response func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: "?limit=10&offset=0&actor=" + adminUser.Username + "&target_type=role",
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("ListAuditLog", mock.Anything, db.ListAuditLogParams{
+						LimitOffset:   db.LimitOffset{Limit: 10, Offset: 0},
+						ActorUsername: sql.NullString{String: adminUser.Username, Valid: true},
+						TargetType:    sql.NullString{String: "role", Valid: true},
+					}).
+					Times(1).
+					Return(entries, nil)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var response []db.AuditLog
+				err := json.Unmarshal(recorder.Body.Bytes(), &response)
+				require.NoError(t, err)
+				require.Len(t, response, 1)
+				require.Equal(t, "role.create", response[0].Action)
+				require.JSONEq(t, `{"name":"manager"}`, string(response[0].After))
+			},
+		},
+		{
+			name:  "BadRequest",
+			query: "?offset=0",
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("ListAuditLog", mock.Anything, mock.Anything).
+					Times(0)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "InternalServerError",
+			query: "?limit=10",
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("ListAuditLog", mock.Anything, mock.Anything).
+					Times(1).
+					Return(nil, sql.ErrConnDone)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			server := newTestServer(querier, "test")
+			querier.
+				On("GetUser", mock.Anything, superUser.Username).
+				Times(1).
+				Return(superUser, nil)
+			tc.mock(querier)
+
+			request, err := http.NewRequest(http.MethodGet, "/api/v1/auth/su/audit"+tc.query, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, superUser.Username, superUser.Role, time.Minute)
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			tc.response(recorder)
+		})
+	}
+}
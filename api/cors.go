@@ -0,0 +1,97 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	originHeaderKey           = "Origin"
+	varyHeaderKey             = "Vary"
+	allowOriginHeaderKey      = "Access-Control-Allow-Origin"
+	allowCredentialsHeaderKey = "Access-Control-Allow-Credentials"
+	allowHeadersHeaderKey     = "Access-Control-Allow-Headers"
+	allowMethodsHeaderKey     = "Access-Control-Allow-Methods"
+	exposeHeadersHeaderKey    = "Access-Control-Expose-Headers"
+	maxAgeHeaderKey           = "Access-Control-Max-Age"
+	anyOrigin                 = "*"
+	originWildcard            = "*."
+)
+
+// CORSMiddleware lets the origins of access_control_allow_origins call the API. The origin of
+// the request is echoed back when it matches one of them, so that several front ends can be
+// allowed along with credentials, and the response then varies by origin. Preflight requests
+// are answered right away.
+func CORSMiddleware(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		config := server.config.GetConfig()
+		header := c.Writer.Header()
+
+		origin := allowedOrigin(config.AccessControlAllowOrigins, c.GetHeader(originHeaderKey))
+		if origin != anyOrigin {
+			header.Add(varyHeaderKey, originHeaderKey)
+		}
+
+		if origin != "" {
+			header.Set(allowOriginHeaderKey, origin)
+			if config.AccessControlAllowCredentials {
+				header.Set(allowCredentialsHeaderKey, "true")
+			}
+			if config.AccessControlExposeHeaders != "" {
+				header.Set(exposeHeadersHeaderKey, config.AccessControlExposeHeaders)
+			}
+
+			if c.Request.Method == http.MethodOptions {
+				header.Set(allowHeadersHeaderKey, config.AccessControlAllowHeaders)
+				header.Set(allowMethodsHeaderKey, config.AccessControlAllowMethods)
+				if config.AccessControlMaxAge > 0 {
+					header.Set(maxAgeHeaderKey, strconv.Itoa(int(config.AccessControlMaxAge.Seconds())))
+				}
+			}
+		}
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin of a request from origin: * when any
+// origin is allowed, origin when it matches one of the comma separated patterns, and an empty
+// string otherwise.
+func allowedOrigin(patterns string, origin string) string {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == anyOrigin {
+			return anyOrigin
+		}
+		if origin != "" && matchOrigin(pattern, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// matchOrigin tells whether origin is the pattern, or one of its subdomains when the host of
+// the pattern starts with *.
+func matchOrigin(pattern string, origin string) bool {
+	prefix, suffix, wildcard := strings.Cut(strings.ToLower(pattern), originWildcard)
+	origin = strings.ToLower(origin)
+	if !wildcard {
+		return origin == prefix
+	}
+
+	suffix = "." + suffix
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	// the wildcard stands for labels of the host alone, so https://*.example.com matches
+	// neither https://example.com nor https://evil.com/.example.com
+	subdomain := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(subdomain, "/:@?#")
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	testCases := []struct {
+		name     string
+		method   string
+		origin   string
+		config   func(config *configuration.Config)
+		response func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "AllowedOrigin",
+			method: http.MethodGet,
+			origin: "https://booking.posada.example",
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "https://booking.posada.example", recorder.Header().Get(allowOriginHeaderKey))
+				require.Equal(t, "true", recorder.Header().Get(allowCredentialsHeaderKey))
+				require.Equal(t, "ETag, X-Request-ID", recorder.Header().Get(exposeHeadersHeaderKey))
+				require.Equal(t, []string{originHeaderKey}, recorder.Header().Values(varyHeaderKey))
+				// only the preflight requests get them
+				require.Empty(t, recorder.Header().Get(allowMethodsHeaderKey))
+				require.Empty(t, recorder.Header().Get(maxAgeHeaderKey))
+			},
+		},
+		{
+			name:   "WildcardSubdomain",
+			method: http.MethodGet,
+			origin: "https://staff.eu.posada.example",
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, "https://staff.eu.posada.example", recorder.Header().Get(allowOriginHeaderKey))
+			},
+		},
+		{
+			name:   "WildcardParentDomain",
+			method: http.MethodGet,
+			origin: "https://posada.example",
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Empty(t, recorder.Header().Get(allowOriginHeaderKey))
+				require.Equal(t, originHeaderKey, recorder.Header().Get(varyHeaderKey))
+			},
+		},
+		{
+			name:   "WildcardOtherScheme",
+			method: http.MethodGet,
+			origin: "http://staff.posada.example",
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Empty(t, recorder.Header().Get(allowOriginHeaderKey))
+			},
+		},
+		{
+			name:   "DisallowedOrigin",
+			method: http.MethodGet,
+			origin: "https://evil.example",
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Empty(t, recorder.Header().Get(allowOriginHeaderKey))
+				require.Empty(t, recorder.Header().Get(allowCredentialsHeaderKey))
+				require.Empty(t, recorder.Header().Get(exposeHeadersHeaderKey))
+				require.Equal(t, originHeaderKey, recorder.Header().Get(varyHeaderKey))
+			},
+		},
+		{
+			name:   "NoOrigin",
+			method: http.MethodGet,
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Empty(t, recorder.Header().Get(allowOriginHeaderKey))
+			},
+		},
+		{
+			name:   "Preflight",
+			method: http.MethodOptions,
+			origin: "http://localhost:5173",
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+				require.Equal(t, "http://localhost:5173", recorder.Header().Get(allowOriginHeaderKey))
+				require.Equal(t, "GET, POST", recorder.Header().Get(allowMethodsHeaderKey))
+				require.Equal(t, "Content-Type, Authorization", recorder.Header().Get(allowHeadersHeaderKey))
+				require.Equal(t, "600", recorder.Header().Get(maxAgeHeaderKey))
+			},
+		},
+		{
+			name:   "PreflightDisallowedOrigin",
+			method: http.MethodOptions,
+			origin: "https://evil.example",
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+				require.Empty(t, recorder.Header().Get(allowOriginHeaderKey))
+				require.Empty(t, recorder.Header().Get(allowMethodsHeaderKey))
+			},
+		},
+		{
+			name:   "AnyOrigin",
+			method: http.MethodGet,
+			origin: "https://evil.example",
+			config: func(config *configuration.Config) {
+				config.AccessControlAllowOrigins = "*"
+				config.AccessControlAllowCredentials = false
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, anyOrigin, recorder.Header().Get(allowOriginHeaderKey))
+				require.Empty(t, recorder.Header().Get(allowCredentialsHeaderKey))
+				// the response is the same for every origin
+				require.Empty(t, recorder.Header().Get(varyHeaderKey))
+			},
+		},
+		{
+			name:   "NoMaxAge",
+			method: http.MethodOptions,
+			origin: "http://localhost:5173",
+			config: func(config *configuration.Config) {
+				config.AccessControlMaxAge = 0
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, "http://localhost:5173", recorder.Header().Get(allowOriginHeaderKey))
+				require.Empty(t, recorder.Header().Get(maxAgeHeaderKey))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(new(mocker.TestMocker), "test")
+			config := server.config.GetConfig()
+			config.AccessControlAllowOrigins = "http://localhost:5173, https://booking.posada.example, https://*.posada.example"
+			config.AccessControlAllowCredentials = true
+			config.AccessControlAllowHeaders = "Content-Type, Authorization"
+			config.AccessControlAllowMethods = "GET, POST"
+			config.AccessControlExposeHeaders = "ETag, X-Request-ID"
+			config.AccessControlMaxAge = 10 * time.Minute
+			if tc.config != nil {
+				tc.config(config)
+			}
+
+			request, err := http.NewRequest(tc.method, "/healthz", nil)
+			require.NoError(t, err)
+			if tc.origin != "" {
+				request.Header.Set(originHeaderKey, tc.origin)
+			}
+
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			tc.response(t, recorder)
+		})
+	}
+}
+
+func TestMatchOrigin(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		origin  string
+		matches bool
+	}{
+		{pattern: "https://posada.example", origin: "https://posada.example", matches: true},
+		{pattern: "https://posada.example", origin: "HTTPS://Posada.Example", matches: true},
+		{pattern: "https://posada.example", origin: "https://posada.example:8443", matches: false},
+		{pattern: "https://*.posada.example", origin: "https://a.b.posada.example", matches: true},
+		{pattern: "https://*.posada.example", origin: "https://.posada.example", matches: false},
+		{pattern: "https://*.posada.example", origin: "https://evil.example/.posada.example", matches: false},
+		{pattern: "https://*.posada.example", origin: "https://evilposada.example", matches: false},
+		{pattern: "http://*.localhost:5173", origin: "http://app.localhost:5173", matches: true},
+		{pattern: "http://*.localhost:5173", origin: "http://app.localhost:5174", matches: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.origin, func(t *testing.T) {
+			require.Equal(t, tc.matches, matchOrigin(tc.pattern, tc.origin))
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	_ "embed"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// openAPIDocument describes every route of setupRouter. TestOpenAPIDocument fails when a route
+// is added without its entry.
+//
+//go:embed docs/openapi.json
+var openAPIDocument []byte
+
+// swaggerUI renders openAPIDocument. The page is served next to the document so that it can
+// load it through a relative url.
+//
+//go:embed docs/swagger.html
+var swaggerUI []byte
+
+// swaggerUIStyle and swaggerUIScript are the assets of swaggerUI, served from the binary rather
+// than a CDN, see docs/swagger-ui/NOTICE.
+var (
+	//go:embed docs/swagger-ui/swagger-ui.css
+	swaggerUIStyle []byte
+	//go:embed docs/swagger-ui/swagger-ui-bundle.js
+	swaggerUIScript []byte
+)
+
+func (server *Server) getOpenAPIDocument(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "application/json; charset=utf-8", openAPIDocument)
+}
+
+func (server *Server) getSwaggerUI(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", swaggerUI)
+}
+
+func (server *Server) getSwaggerUIStyle(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "text/css; charset=utf-8", swaggerUIStyle)
+}
+
+func (server *Server) getSwaggerUIScript(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "text/javascript; charset=utf-8", swaggerUIScript)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// ginPathParam matches the :name parameters of a gin route.
+var ginPathParam = regexp.MustCompile(`:([^/]+)`)
+
+func TestOpenAPIDocument(t *testing.T) {
+	server := newTestServer(new(mocker.TestMocker), "test")
+
+	var document struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(openAPIDocument, &document))
+	require.True(t, strings.HasPrefix(document.OpenAPI, "3."))
+
+	registered := map[string]bool{}
+	for _, route := range server.router.Routes() {
+		path := ginPathParam.ReplaceAllString(route.Path, "{$1}")
+		method := strings.ToLower(route.Method)
+		registered[method+" "+path] = true
+
+		_, ok := document.Paths[path][method]
+		require.Truef(t, ok, "%s %s has no entry in docs/openapi.json", route.Method, route.Path)
+	}
+
+	for path, operations := range document.Paths {
+		for method := range operations {
+			require.Truef(t, registered[method+" "+path], "docs/openapi.json documents %s %s which is not routed", method, path)
+		}
+	}
+}
+
+func TestServeOpenAPIDocument(t *testing.T) {
+	testCases := []struct {
+		name        string
+		url         string
+		contentType string
+		body        []byte
+	}{
+		{
+			name:        "Document",
+			url:         "/api/v1/openapi.json",
+			contentType: "application/json; charset=utf-8",
+			body:        openAPIDocument,
+		},
+		{
+			name:        "SwaggerUI",
+			url:         "/api/v1/docs",
+			contentType: "text/html; charset=utf-8",
+			body:        swaggerUI,
+		},
+		{
+			name:        "SwaggerUIStyle",
+			url:         "/api/v1/docs/swagger-ui.css",
+			contentType: "text/css; charset=utf-8",
+			body:        swaggerUIStyle,
+		},
+		{
+			name:        "SwaggerUIScript",
+			url:         "/api/v1/docs/swagger-ui-bundle.js",
+			contentType: "text/javascript; charset=utf-8",
+			body:        swaggerUIScript,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(new(mocker.TestMocker), "test")
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, tc.url, nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			require.Equal(t, tc.contentType, recorder.Header().Get("Content-Type"))
+			require.Equal(t, tc.body, recorder.Body.Bytes())
+		})
+	}
+}
+
+func TestSwaggerUIIsSelfContained(t *testing.T) {
+	// the page only loads the assets served by the API itself
+	require.NotRegexp(t, `(src|href)="(https?:)?//`, string(swaggerUI))
+}
@@ -2,58 +2,133 @@ package api
 
 import (
 	"errors"
-	"fmt"
+	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+// problemContentType is the media type of the error responses, see RFC 7807.
+const problemContentType = "application/problem+json"
+
+// problemTypePrefix turns the code of an APIError into the type of its problem document.
+const problemTypePrefix = "urn:posada:problem:"
+
+// APIError is an error reported to the client. Code is a stable, machine-readable identifier
+// clients may rely on, while the message is meant for humans and may change.
+type APIError struct {
+	Status int
+	Code   string
+	msg    string
+}
+
+// apiErrors lists every APIError so that their messages can be translated.
+var apiErrors []*APIError
+
+func newAPIError(status int, code string, msg string) *APIError {
+	err := &APIError{Status: status, Code: code, msg: msg}
+	apiErrors = append(apiErrors, err)
+	return err
+}
+
+func (e *APIError) Error() string {
+	return e.msg
+}
+
+var (
+	ErrUniqueViolation   = newAPIError(http.StatusConflict, "unique_violation", "identifier must be unique")
+	ErrInternalServer    = newAPIError(http.StatusInternalServerError, "internal_error", "an error occurs")
+	ErrNoRow             = newAPIError(http.StatusNotFound, "not_found", "no row was returned")
+	ErrShouldBindUri     = newAPIError(http.StatusBadRequest, "invalid_uri", "uri could not bind with the struct")
+	ErrPasswordMistMach  = newAPIError(http.StatusUnauthorized, "invalid_credentials", "password miss match")
+	ErrVerifyToken       = newAPIError(http.StatusUnauthorized, "invalid_token", "could not verify the token")
+	ErrSession           = newAPIError(http.StatusInternalServerError, "session_not_created", "session could not be created")
+	ErrBlockedSession    = newAPIError(http.StatusUnauthorized, "session_blocked", "blocked session")
+	ErrWrongUserSession  = newAPIError(http.StatusUnauthorized, "session_user_mismatch", "incorrect user's session")
+	ErrWrongSessionToken = newAPIError(http.StatusUnauthorized, "session_token_mismatch", "mismatched session token")
+	ErrExpiredSession    = newAPIError(http.StatusUnauthorized, "session_expired", "session has expired")
+	ErrTokenCreation     = newAPIError(http.StatusInternalServerError, "token_not_created", "an issued occurs when creating token")
+	ErrNoRole            = newAPIError(http.StatusNotFound, "role_not_found", "role not found")
+	ErrRoleNotAllowed    = newAPIError(http.StatusForbidden, "role_not_allowed", "the role cannot be searched by the caller")
+	ErrRoleInUse         = newAPIError(http.StatusConflict, "role_in_use", "the role still has users assigned")
+	ErrInvalidIfMatch    = newAPIError(http.StatusBadRequest, "invalid_if_match", "the If-Match header is not a valid entity tag")
+	ErrVersionMismatch   = newAPIError(http.StatusPreconditionFailed, "version_mismatch", "the resource was modified by another request")
+	ErrIfMatchRequired   = newAPIError(http.StatusPreconditionRequired, "if_match_required", "the If-Match header is required")
+
+	ErrAuthHeaderNotProvided   = newAPIError(http.StatusUnauthorized, "authorization_missing", "authorization header is not provided")
+	ErrInvalidAuthHeaderFormat = newAPIError(http.StatusUnauthorized, "authorization_malformed", "invalid authorization header format")
+	ErrUnsupportedAuthType     = newAPIError(http.StatusUnauthorized, "authorization_type_unsupported", "unsupported authorization type")
+	ErrUnknownTokenUser        = newAPIError(http.StatusUnauthorized, "token_user_unknown", "token is invalid. User does not exists")
+	ErrAuthRequired            = newAPIError(http.StatusUnauthorized, "authentication_required", "authentication data is required")
+	ErrForbiddenRole           = newAPIError(http.StatusForbidden, "role_forbidden", "the role of the caller is not allowed")
+
+	ErrInvalidIdempotencyKey    = newAPIError(http.StatusBadRequest, "idempotency_key_invalid", "the Idempotency-Key header is too long")
+	ErrIdempotencyKeyReused     = newAPIError(http.StatusUnprocessableEntity, "idempotency_key_reused", "the idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = newAPIError(http.StatusConflict, "idempotency_key_in_progress", "a request with the same idempotency key is still being processed")
+
+	ErrInvalidWebhookURL = newAPIError(http.StatusBadRequest, "webhook_url_invalid", "the webhook url must be an absolute http or https url")
+	ErrUnknownEventType  = newAPIError(http.StatusBadRequest, "event_type_unknown", "the event type is unknown")
+
+	ErrInvalidLastEventID = newAPIError(http.StatusBadRequest, "last_event_id_invalid", "the last event id must be a positive integer")
 )
 
 var (
-	ErrUniqueViolation   = errors.New("identifier must be unique")
-	ErrInternalServer    = errors.New("an error occurs")
-	ErrNoRow             = errors.New("no row was returned")
-	ErrShouldBindUri     = errors.New("uri could not bind with the struct")
-	ErrPasswordMistMach  = errors.New("password miss match")
-	ErrVerifyToken       = errors.New("could not verify the token")
-	ErrSession           = errors.New("session could not be created")
-	ErrBlockedSession    = errors.New("blocked session")
-	ErrWrongUserSession  = errors.New("incorrect user's session")
-	ErrWrongSessionToken = errors.New("mismatched session token")
-	ErrExpiredSession    = errors.New("session has expired")
-	ErrTokenCreation     = errors.New("an issued occurs when creating token")
-	ErrNoRole            = errors.New("role not found")
-	ErrNoCustomerFound   = errors.New("no customer found")
+	// errValidation reports a request whose fields failed their binding rules.
+	errValidation = newAPIError(http.StatusBadRequest, "validation_failed", "the request has invalid fields")
+
+	// errBadRequest reports any other error that is not an APIError, such as a malformed body.
+	errBadRequest = newAPIError(http.StatusBadRequest, "bad_request", "the request is invalid")
 )
 
-func msgForTag(fe validator.FieldError) string {
-	switch fe.Tag() {
-	case "required":
-		return fmt.Sprintf("the %s field is required", fe.Field())
-	case "email":
-		return fmt.Sprintf("the %s field is invalid", fe.Field())
-	case "alphanum":
-		return fmt.Sprintf("the %s field must be of type alphanumeric", fe.Field())
-	case "min":
-		return fmt.Sprintf("the %s field must has a minimum value of %s", fe.Field(), fe.Param())
-	case "gte":
-		return fmt.Sprintf("the %s field value must be greater or equal to one", fe.Field())
-	}
-	return ""
+// fieldError describes one invalid field of a request.
+type fieldError struct {
+	Field string `json:"field"`
+	Msg   string `json:"msg"`
 }
 
-type response struct {
-	Field string `json:"field" binding:"omitempty"`
-	Msg   string `json:"msg"`
+// problem is an RFC 7807 problem document.
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail"`
+	Instance  string       `json:"instance"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []fieldError `json:"errors,omitempty"`
+
+	// language is the language the document is written in.
+	language string
 }
 
-func validateFieldError(err error) *[]response {
-	var out []response
+// newProblem describes err for the client in the language it prefers. An error that does not
+// wrap an APIError is a bad request, and the rules broken by an invalid request are listed
+// field by field.
+func newProblem(ctx *gin.Context, err error) *problem {
+	trans := translator(ctx)
+
+	var apiErr *APIError
 	var ve validator.ValidationErrors
+	var fields []fieldError
 	switch {
+	case errors.As(err, &apiErr):
 	case errors.As(err, &ve):
+		apiErr = errValidation
 		for _, fe := range ve {
-			out = append(out, response{fe.Field(), msgForTag(fe)})
+			fields = append(fields, fieldError{fe.Field(), fe.Translate(trans)})
 		}
 	default:
-		out = append(out, response{Msg: err.Error()})
+		apiErr = errBadRequest
+	}
+
+	return &problem{
+		Type:      problemTypePrefix + apiErr.Code,
+		Title:     http.StatusText(apiErr.Status),
+		Status:    apiErr.Status,
+		Detail:    apiErr.translate(trans),
+		Instance:  ctx.Request.URL.Path,
+		Code:      apiErr.Code,
+		RequestID: requestID(ctx),
+		Errors:    fields,
+		language:  trans.Locale(),
 	}
-	return &out
 }
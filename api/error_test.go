@@ -0,0 +1,235 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProblemResponse(t *testing.T) {
+	adminUser := createRandomUser(db.RoleAdmin, false)
+	customerUser := createRandomUser(db.RoleCustomer, false)
+
+	testCases := []struct {
+		name      string
+		language  string
+		method    string
+		url       string
+		body      gin.H
+		setupAuth func(t *testing.T, request *http.Request, server *Server)
+		mock      func(querier *mocker.TestMocker)
+		status    int
+		code      string
+		detail    string
+		fields    []fieldError
+	}{
+		{
+			name:      "ValidationFailed",
+			method:    http.MethodPost,
+			url:       "/api/v1/users",
+			body:      gin.H{"username": "lexy", "password": "123"},
+			setupAuth: func(t *testing.T, request *http.Request, server *Server) {},
+			mock:      func(querier *mocker.TestMocker) {},
+			status:    http.StatusBadRequest,
+			code:      "validation_failed",
+			detail:    errValidation.Error(),
+			fields: []fieldError{
+				{Field: "password", Msg: "password must be at least 6 characters in length"},
+				{Field: "full_name", Msg: "full_name is a required field"},
+				{Field: "email", Msg: "email is a required field"},
+			},
+		},
+		{
+			name:      "ValidationFailedInSpanish",
+			language:  "es-VE,es;q=0.9,en;q=0.8",
+			method:    http.MethodPost,
+			url:       "/api/v1/users",
+			body:      gin.H{"username": "lexy", "password": "123"},
+			setupAuth: func(t *testing.T, request *http.Request, server *Server) {},
+			mock:      func(querier *mocker.TestMocker) {},
+			status:    http.StatusBadRequest,
+			code:      "validation_failed",
+			detail:    "la petición tiene campos inválidos",
+			fields: []fieldError{
+				{Field: "password", Msg: "password debe tener al menos 6 caracteres de longitud"},
+				{Field: "full_name", Msg: "full_name es un campo requerido"},
+				{Field: "email", Msg: "email es un campo requerido"},
+			},
+		},
+		{
+			name:      "MalformedBody",
+			method:    http.MethodPost,
+			url:       "/api/v1/users/get_full_name",
+			setupAuth: func(t *testing.T, request *http.Request, server *Server) {},
+			mock:      func(querier *mocker.TestMocker) {},
+			status:    http.StatusBadRequest,
+			code:      "bad_request",
+			detail:    errBadRequest.Error(),
+		},
+		{
+			name:   "NotFound",
+			method: http.MethodGet,
+			url:    "/api/v1/auth/admin/property/a1b2",
+			setupAuth: func(t *testing.T, request *http.Request, server *Server) {
+				addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, adminUser.Username, adminUser.Role, time.Minute)
+			},
+			mock: func(querier *mocker.TestMocker) {
+				querier.On("GetUser", mock.Anything, adminUser.Username).Return(adminUser, nil)
+				querier.On("GetProperty", mock.Anything, "a1b2").Return(nil, sql.ErrNoRows)
+			},
+			status: http.StatusNotFound,
+			code:   "not_found",
+			detail: ErrNoRow.Error(),
+		},
+		{
+			name:   "ForbiddenRole",
+			method: http.MethodGet,
+			url:    "/api/v1/auth/admin/property/a1b2",
+			setupAuth: func(t *testing.T, request *http.Request, server *Server) {
+				addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, customerUser.Username, customerUser.Role, time.Minute)
+			},
+			mock: func(querier *mocker.TestMocker) {
+				querier.On("GetUser", mock.Anything, customerUser.Username).Return(customerUser, nil)
+			},
+			status: http.StatusForbidden,
+			code:   "role_forbidden",
+			detail: ErrForbiddenRole.Error(),
+		},
+		{
+			name:      "NoAuthorization",
+			method:    http.MethodGet,
+			url:       "/api/v1/auth/admin/property/a1b2",
+			setupAuth: func(t *testing.T, request *http.Request, server *Server) {},
+			mock:      func(querier *mocker.TestMocker) {},
+			status:    http.StatusUnauthorized,
+			code:      "authorization_missing",
+			detail:    ErrAuthHeaderNotProvided.Error(),
+		},
+		{
+			name:      "UnsupportedLanguage",
+			language:  "fr-CA,fr;q=0.9",
+			method:    http.MethodGet,
+			url:       "/api/v1/auth/admin/property/a1b2",
+			setupAuth: func(t *testing.T, request *http.Request, server *Server) {},
+			mock:      func(querier *mocker.TestMocker) {},
+			status:    http.StatusUnauthorized,
+			code:      "authorization_missing",
+			detail:    ErrAuthHeaderNotProvided.Error(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			tc.mock(querier)
+
+			server := newTestServer(querier, "test")
+			recorder := httptest.NewRecorder()
+
+			var body []byte
+			if tc.body != nil {
+				var err error
+				body, err = json.Marshal(tc.body)
+				require.NoError(t, err)
+			}
+			request, err := http.NewRequest(tc.method, tc.url, bytes.NewReader(body))
+			require.NoError(t, err)
+			request.Header.Set(requestIDHeaderKey, "req-"+tc.name)
+			request.Header.Set(acceptLanguageHeaderKey, tc.language)
+			tc.setupAuth(t, request, server)
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, tc.status, recorder.Code)
+			require.Equal(t, problemContentType, recorder.Header().Get("Content-Type"))
+			if strings.HasPrefix(tc.language, "es") {
+				require.Equal(t, "es", recorder.Header().Get(contentLanguageHeaderKey))
+			} else {
+				require.Equal(t, "en", recorder.Header().Get(contentLanguageHeaderKey))
+			}
+
+			var got problem
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+			require.Equal(t, problem{
+				Type:      problemTypePrefix + tc.code,
+				Title:     http.StatusText(tc.status),
+				Status:    tc.status,
+				Detail:    tc.detail,
+				Instance:  tc.url,
+				Code:      tc.code,
+				RequestID: "req-" + tc.name,
+				Errors:    tc.fields,
+			}, got)
+			querier.AssertExpectations(t)
+		})
+	}
+}
+
+func TestTranslations(t *testing.T) {
+	for _, apiErr := range apiErrors {
+		require.NotEmptyf(t, spanishMessages[apiErr.Code], "%s has no Spanish message", apiErr.Code)
+	}
+
+	// one struct per validation tag used by the requests of the API
+	requests := []any{
+		struct {
+			Value string `json:"value" binding:"required"`
+		}{},
+		struct {
+			Value string `json:"value" binding:"alphanum"`
+		}{Value: "a-b"},
+		struct {
+			Value string `json:"value" binding:"alpha"`
+		}{Value: "a1"},
+		struct {
+			Value string `json:"value" binding:"email"`
+		}{Value: "lexy"},
+		struct {
+			Value string `json:"value" binding:"e164"`
+		}{Value: "555"},
+		struct {
+			Value string `json:"value" binding:"min=6"`
+		}{Value: "123"},
+		struct {
+			Value string `json:"value" binding:"password"`
+		}{Value: "123"},
+		struct {
+			Value []string `json:"value" binding:"min=1"`
+		}{Value: []string{}},
+		struct {
+			Value int32 `json:"value" binding:"gte=1"`
+		}{},
+		struct {
+			Value int32 `json:"value" binding:"min=0"`
+		}{Value: -1},
+		struct {
+			Value string `json:"value" binding:"oneof=asc desc"`
+		}{Value: "up"},
+	}
+
+	for _, locale := range []string{"en", "es"} {
+		trans, found := universalTranslator.GetTranslator(locale)
+		require.True(t, found)
+
+		for _, request := range requests {
+			err := binding.Validator.ValidateStruct(request)
+			var ve validator.ValidationErrors
+			require.ErrorAs(t, err, &ve)
+
+			msg := ve[0].Translate(trans)
+			require.NotEqualf(t, ve[0].Error(), msg, "the %s tag has no %s translation", ve[0].Tag(), locale)
+			require.True(t, strings.HasPrefix(msg, "value "), msg)
+		}
+	}
+}
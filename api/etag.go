@@ -0,0 +1,44 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"strings"
+)
+
+const (
+	etagHeaderKey    = "ETag"
+	ifMatchHeaderKey = "If-Match"
+)
+
+// setETag exposes the version of the returned row, to be sent back through If-Match when the
+// client changes it.
+func setETag(ctx *gin.Context, version int64) {
+	ctx.Header(etagHeaderKey, fmt.Sprintf(`"%d"`, version))
+}
+
+// ifMatchVersion reads the version the client based its change on. The header is required so
+// that no change silently overwrites another one: a client that means to overwrite whatever
+// the current version is sends the "*" wildcard, which is not checked.
+func ifMatchVersion(ctx *gin.Context) (sql.NullInt64, error) {
+	header := strings.TrimSpace(ctx.GetHeader(ifMatchHeaderKey))
+	if header == "" {
+		return sql.NullInt64{}, ErrIfMatchRequired
+	}
+	if header == "*" {
+		return sql.NullInt64{}, nil
+	}
+
+	tag := strings.TrimPrefix(header, "W/")
+	if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return sql.NullInt64{}, ErrInvalidIfMatch
+	}
+
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil {
+		return sql.NullInt64{}, ErrInvalidIfMatch
+	}
+	return sql.NullInt64{Int64: version, Valid: true}, nil
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/token"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	lastEventIDHeaderKey = "Last-Event-ID"
+
+	// lastEventIDQueryKey lets a client resume from the first request, since browsers only
+	// send the Last-Event-ID header when EventSource reconnects on its own.
+	lastEventIDQueryKey = "last_event_id"
+
+	// laggedEventName tells the client it fell behind and should reconnect to catch up.
+	laggedEventName = "lagged"
+
+	// eventReplayOverlap is how many ids before the last event id of the client the replay
+	// starts. The outbox ids are taken before the transactions commit, so an event can be
+	// committed after one with a higher id, which the client already got.
+	eventReplayOverlap = 100
+
+	// sentEventsSize bounds the ids a stream remembers to drop the events it already sent,
+	// which the outbox delivers at least once.
+	sentEventsSize = 1024
+)
+
+// streamedEventTypes lists the events pushed to the admin dashboards.
+var streamedEventTypes = []string{
+	db.EventPropertyCreated,
+	db.EventPropertyUpdated,
+	db.EventPropertyActivated,
+	db.EventPropertyDeactivated,
+	db.EventPropertyDeleted,
+	db.EventPropertyRestored,
+	db.EventUserCreated,
+	db.EventUserUpdated,
+	db.EventUserDeleted,
+	db.EventUserRestored,
+}
+
+// HandleEvent implements event.Handler and forwards the events of the bus to the open
+// event streams.
+func (server *Server) HandleEvent(ctx context.Context, evt *db.Event) error {
+	return server.broker.Handle(ctx, evt)
+}
+
+// streamEvents pushes the changes to the properties and users the caller is in charge of as
+// Server-Sent Events. A client that reconnects with the id of the last event it received first
+// gets the events it missed, read back from the outbox, and then the live ones. The ids do not
+// follow the commit order, so the replay overlaps the events before the last one and a client
+// may receive an event twice across reconnections: it has to ignore the ids it already got.
+func (server *Server) streamEvents(ctx *gin.Context) {
+	lastEventID, err := parseLastEventID(ctx)
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	payload := ctx.MustGet(server.config.GetConfig().AuthorizationPayloadKey).(*token.Payload)
+	scope, err := server.newEventScope(ctx, payload)
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	// subscribe before replaying so that no event falls between the replay and the live stream
+	subscriber := server.broker.Subscribe()
+	defer server.broker.Unsubscribe(subscriber)
+
+	// the stream outlives the write timeout of the server, which only suits regular requests
+	_ = http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{})
+
+	header := ctx.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+
+	stream := newEventStream(ctx, scope, lastEventID)
+	if err = server.replayEvents(stream); err != nil {
+		requestLogger(ctx).Info().Err(err).Msg("event stream closed during replay")
+		return
+	}
+
+	heartbeat := time.NewTicker(server.config.GetConfig().EventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if err = stream.heartbeat(); err != nil {
+				return
+			}
+		case evt, ok := <-subscriber.Events():
+			if !ok {
+				if subscriber.Lagged() {
+					_ = stream.lagged()
+				}
+				return
+			}
+			if err = stream.send(evt); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// replayEvents sends the events recorded after the last event id of stream, page by page,
+// starting eventReplayOverlap ids earlier to catch the events committed late. Only the events
+// of the last event_stream_replay_window are replayed.
+func (server *Server) replayEvents(stream *eventStream) error {
+	if stream.lastEventID == 0 {
+		return nil
+	}
+
+	config := server.config.GetConfig()
+	afterID := max(stream.lastEventID-eventReplayOverlap, 0)
+	createdAfter := time.Now().Add(-config.EventStreamReplayWindow)
+	for {
+		events, err := server.store.ListEvents(stream.ctx, db.ListEventsParams{
+			AfterID:      afterID,
+			Types:        streamedEventTypes,
+			CreatedAfter: createdAfter,
+			Limit:        config.EventStreamReplayLimit,
+		})
+		if err != nil {
+			return err
+		}
+		for _, evt := range events {
+			if err = stream.send(evt); err != nil {
+				return err
+			}
+			afterID = evt.ID
+		}
+		if len(events) < int(config.EventStreamReplayLimit) {
+			return nil
+		}
+	}
+}
+
+func parseLastEventID(ctx *gin.Context) (int64, error) {
+	raw := ctx.GetHeader(lastEventIDHeaderKey)
+	if len(raw) == 0 {
+		raw = ctx.Query(lastEventIDQueryKey)
+	}
+	if len(raw) == 0 {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 0 {
+		return 0, ErrInvalidLastEventID
+	}
+	return id, nil
+}
+
+type eventStream struct {
+	ctx   *gin.Context
+	scope *eventScope
+	// lastEventID is the highest id sent, which the client resumes from
+	lastEventID int64
+	// sent holds the ids of the last sentEventsSize events, oldest first in sentOrder
+	sent      map[int64]bool
+	sentOrder []int64
+}
+
+func newEventStream(ctx *gin.Context, scope *eventScope, lastEventID int64) *eventStream {
+	return &eventStream{ctx: ctx, scope: scope, lastEventID: lastEventID, sent: make(map[int64]bool)}
+}
+
+// send writes evt unless the stream already sent it or the client is not allowed to see it.
+func (stream *eventStream) send(evt *db.Event) error {
+	if stream.sent[evt.ID] || !slices.Contains(streamedEventTypes, evt.Type) {
+		return nil
+	}
+	// the event counts as sent even when it is out of scope, so that it is not checked again
+	stream.remember(evt.ID)
+	if !stream.scope.allows(stream.ctx, evt) {
+		return nil
+	}
+
+	return stream.write(sse.Event{Id: strconv.FormatInt(evt.ID, 10), Event: evt.Type, Data: evt.Payload})
+}
+
+func (stream *eventStream) remember(id int64) {
+	stream.sent[id] = true
+	stream.sentOrder = append(stream.sentOrder, id)
+	if len(stream.sentOrder) > sentEventsSize {
+		delete(stream.sent, stream.sentOrder[0])
+		stream.sentOrder = stream.sentOrder[1:]
+	}
+	stream.lastEventID = max(stream.lastEventID, id)
+}
+
+func (stream *eventStream) heartbeat() error {
+	if _, err := stream.ctx.Writer.WriteString(": heartbeat\n\n"); err != nil {
+		return err
+	}
+	stream.ctx.Writer.Flush()
+	return nil
+}
+
+func (stream *eventStream) lagged() error {
+	return stream.write(sse.Event{Event: laggedEventName, Data: strconv.FormatInt(stream.lastEventID, 10)})
+}
+
+func (stream *eventStream) write(event sse.Event) error {
+	if err := sse.Encode(stream.ctx.Writer, event); err != nil {
+		return err
+	}
+	stream.ctx.Writer.Flush()
+	return nil
+}
+
+// eventScope decides which events a caller may see. Super users see everything, while
+// admins only see their own properties and the users assigned to them.
+type eventScope struct {
+	store       db.Store
+	username    string
+	all         bool
+	propertyIDs []string
+}
+
+func (server *Server) newEventScope(ctx context.Context, payload *token.Payload) (*eventScope, error) {
+	scope := &eventScope{store: server.store, username: payload.Username, all: payload.Role.Name == db.RoleSuperUser}
+	if scope.all {
+		return scope, nil
+	}
+
+	propertyIDs, err := server.store.ListUserPropertyIDs(ctx, payload.Username)
+	if err != nil {
+		return nil, err
+	}
+	scope.propertyIDs = propertyIDs
+	return scope, nil
+}
+
+func (scope *eventScope) allows(ctx context.Context, evt *db.Event) bool {
+	if scope.all {
+		return true
+	}
+
+	switch evt.AggregateType {
+	case db.AggregateProperty:
+		return slices.Contains(scope.propertyIDs, evt.AggregateID)
+	case db.AggregateUser:
+		if evt.AggregateID == scope.username {
+			return true
+		}
+		shares, err := scope.store.UserSharesProperty(ctx, scope.username, evt.AggregateID)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Error().Err(err).Int64("event_id", evt.ID).Msg("cannot check the scope of an event")
+		}
+		return shares
+	}
+	return false
+}
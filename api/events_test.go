@@ -0,0 +1,198 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readSSE returns the next event of the stream as a map of its fields, skipping comments.
+func readSSE(t *testing.T, reader *bufio.Reader) map[string]string {
+	fields := map[string]string{}
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		if len(line) == 0 {
+			if len(fields) > 0 {
+				return fields
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, ":")
+		fields[key] = value
+	}
+}
+
+// openEventStream connects to the event stream of server. The returned function closes the
+// stream and waits for the handler to return.
+func openEventStream(t *testing.T, server *Server, user *db.User, path string, lastEventID string) (*http.Response, func()) {
+	ts := httptest.NewServer(server.router)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+path, nil)
+	require.NoError(t, err)
+	if len(lastEventID) > 0 {
+		request.Header.Set(lastEventIDHeaderKey, lastEventID)
+	}
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	return response, func() {
+		cancel()
+		_ = response.Body.Close()
+		ts.Close()
+	}
+}
+
+func TestStreamEvents_ReplayAndScope(t *testing.T) {
+	adminUser := createRandomUser(db.RoleAdmin, false)
+	querier := new(mocker.TestMocker)
+	server := newTestServer(querier, "test")
+
+	querier.
+		On("GetUser", mock.Anything, adminUser.Username).
+		Times(1).
+		Return(adminUser, nil)
+	querier.
+		On("ListUserPropertyIDs", mock.Anything, adminUser.Username).
+		Times(1).
+		Return([]string{"PRO101"}, nil)
+	querier.
+		On("ListEvents", mock.Anything, mock.MatchedBy(func(arg db.ListEventsParams) bool {
+			window := time.Since(arg.CreatedAfter)
+			return arg.AfterID == 110-eventReplayOverlap && slices.Equal(arg.Types, streamedEventTypes) && arg.Limit == 200 &&
+				window >= 24*time.Hour && window < 25*time.Hour
+		})).
+		Times(1).
+		Return([]*db.Event{
+			{ID: 11, Type: db.EventPropertyCreated, AggregateType: db.AggregateProperty, AggregateID: "PRO101", Payload: json.RawMessage(`{"external_id":"PRO101"}`)},
+			{ID: 12, Type: db.EventPropertyUpdated, AggregateType: db.AggregateProperty, AggregateID: "PRO999", Payload: json.RawMessage(`{}`)},
+			{ID: 13, Type: db.EventUserUpdated, AggregateType: db.AggregateUser, AggregateID: "stranger", Payload: json.RawMessage(`{}`)},
+		}, nil)
+	querier.
+		On("UserSharesProperty", mock.Anything, adminUser.Username, "stranger").
+		Times(1).
+		Return(false, nil)
+	querier.
+		On("UserSharesProperty", mock.Anything, adminUser.Username, "frontdesk").
+		Times(1).
+		Return(true, nil)
+
+	// the events below the last event id of the client are replayed too, in case they committed late
+	response, closeStream := openEventStream(t, server, adminUser, "/api/v1/auth/admin/events", "110")
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(response.Body)
+	replayed := readSSE(t, reader)
+	require.Equal(t, "11", replayed["id"])
+	require.Equal(t, db.EventPropertyCreated, replayed["event"])
+	require.JSONEq(t, `{"external_id":"PRO101"}`, replayed["data"])
+
+	// a duplicate of a replayed event, an event that is not streamed and an event in scope
+	for _, evt := range []*db.Event{
+		{ID: 11, Type: db.EventPropertyCreated, AggregateType: db.AggregateProperty, AggregateID: "PRO101", Payload: json.RawMessage(`{}`)},
+		{ID: 14, Type: db.EventRoleCreated, AggregateType: db.AggregateRole, AggregateID: "ROL101", Payload: json.RawMessage(`{}`)},
+		{ID: 15, Type: db.EventUserCreated, AggregateType: db.AggregateUser, AggregateID: "frontdesk", Payload: json.RawMessage(`{"username":"frontdesk"}`)},
+	} {
+		require.NoError(t, server.HandleEvent(context.Background(), evt))
+	}
+
+	live := readSSE(t, reader)
+	require.Equal(t, "15", live["id"])
+	require.Equal(t, db.EventUserCreated, live["event"])
+
+	closeStream()
+	querier.AssertExpectations(t)
+}
+
+func TestStreamEvents_SuperUserSeesEverything(t *testing.T) {
+	superUser := createRandomUser(db.RoleSuperUser, false)
+	querier := new(mocker.TestMocker)
+	server := newTestServer(querier, "test")
+
+	querier.
+		On("GetUser", mock.Anything, superUser.Username).
+		Times(1).
+		Return(superUser, nil)
+
+	response, closeStream := openEventStream(t, server, superUser, "/api/v1/auth/su/events", "")
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	// an event committed after a higher id, then a redelivery of an event already sent
+	for _, id := range []int64{7, 5, 7, 8} {
+		require.NoError(t, server.HandleEvent(context.Background(), &db.Event{
+			ID: id, Type: db.EventPropertyDeleted, AggregateType: db.AggregateProperty, AggregateID: "PRO999", Payload: json.RawMessage(`{}`),
+		}))
+	}
+
+	reader := bufio.NewReader(response.Body)
+	for _, id := range []string{"7", "5", "8"} {
+		require.Equal(t, id, readSSE(t, reader)["id"])
+	}
+
+	closeStream()
+	querier.AssertNotCalled(t, "ListUserPropertyIDs", mock.Anything, mock.Anything)
+	querier.AssertNotCalled(t, "ListEvents", mock.Anything, mock.Anything)
+}
+
+func TestStreamEvents_Errors(t *testing.T) {
+	adminUser := createRandomUser(db.RoleAdmin, false)
+
+	testCases := []struct {
+		name        string
+		lastEventID string
+		mock        func(querier *mocker.TestMocker)
+		status      int
+	}{
+		{
+			name:        "InvalidLastEventID",
+			lastEventID: "abc",
+			mock: func(querier *mocker.TestMocker) {
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "ScopeError",
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("ListUserPropertyIDs", mock.Anything, adminUser.Username).
+					Times(1).
+					Return(nil, sql.ErrConnDone)
+			},
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			server := newTestServer(querier, "test")
+			querier.
+				On("GetUser", mock.Anything, adminUser.Username).
+				Times(1).
+				Return(adminUser, nil)
+			tc.mock(querier)
+
+			response, closeStream := openEventStream(t, server, adminUser, "/api/v1/auth/admin/events", tc.lastEventID)
+			closeStream()
+			require.Equal(t, tc.status, response.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/rs/zerolog/log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	healthStatusOK          = "ok"
+	healthStatusUnavailable = "unavailable"
+)
+
+// unloggedPaths are polled by the orchestrator and the metrics scraper, and left out of
+// the access log.
+var unloggedPaths = []string{"/healthz", "/readyz", "/metrics"}
+
+var errTokenMakerMissing = errors.New("the token maker is not initialized")
+
+type healthCheck struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+type healthResponse struct {
+	Status string        `json:"status"`
+	Checks []healthCheck `json:"checks,omitempty"`
+}
+
+// liveness tells that the process is running and able to serve requests.
+func (server *Server) liveness(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, healthResponse{Status: healthStatusOK})
+}
+
+// readiness tells whether the server can handle traffic, that is whether every dependency it
+// needs is available. It answers 503 as long as one of them is not. The checks run
+// concurrently, so a hanging dependency delays the answer by readiness_timeout at most.
+func (server *Server) readiness(ctx *gin.Context) {
+	config := server.config.GetConfig()
+	checks := []readinessCheck{
+		{"database", server.store.Ping},
+		{"migrations", server.checkMigrations},
+		{"token_maker", server.checkTokenMaker},
+	}
+	if config.ReadinessCheckCache {
+		checks = append(checks, readinessCheck{"cache", server.checkCache})
+	}
+
+	response := healthResponse{Status: healthStatusOK, Checks: make([]healthCheck, len(checks))}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c readinessCheck) {
+			defer wg.Done()
+			response.Checks[i] = c.run(ctx.Request.Context(), config.ReadinessTimeout)
+		}(i, c)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	for _, result := range response.Checks {
+		if result.Status != healthStatusOK {
+			response.Status = healthStatusUnavailable
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	ctx.JSON(status, response)
+}
+
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// run performs the check within timeout and reports how long it took. The endpoint is not
+// authenticated, so why a check failed is only logged: driver and network errors name hosts
+// and ports.
+func (c readinessCheck) run(parent context.Context, timeout time.Duration) healthCheck {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.check(ctx)
+	result := healthCheck{
+		Name:      c.name,
+		Status:    healthStatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = healthStatusUnavailable
+		log.Warn().Err(err).Str("check", c.name).Msg("readiness check failed")
+	}
+	return result
+}
+
+// checkMigrations fails unless the database was fully migrated to the schema the code expects.
+func (server *Server) checkMigrations(ctx context.Context) error {
+	migration, err := server.store.GetSchemaMigration(ctx)
+	if err != nil {
+		return err
+	}
+	if migration.Dirty {
+		return fmt.Errorf("the migration to version %d did not complete", migration.Version)
+	}
+	if migration.Version != db.SchemaVersion {
+		return fmt.Errorf("the schema is at version %d instead of %d", migration.Version, db.SchemaVersion)
+	}
+	return nil
+}
+
+func (server *Server) checkTokenMaker(context.Context) error {
+	if server.tokenMaker == nil {
+		return errTokenMakerMissing
+	}
+	return nil
+}
+
+func (server *Server) checkCache(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", server.config.GetConfig().RedisAddress)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/newbri/posadamissportia/token"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLiveness(t *testing.T) {
+	server := newTestServer(new(mocker.TestMocker), "test")
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest(http.MethodGet, "/healthz", nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, `{"status":"ok"}`, recorder.Body.String())
+}
+
+func TestReadiness(t *testing.T) {
+	// a port nobody listens on once the listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddress := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	testCases := []struct {
+		name       string
+		checkCache bool
+		mock       func(querier *mocker.TestMocker)
+		status     int
+		checks     map[string]string
+	}{
+		{
+			name: "Ready",
+			mock: func(querier *mocker.TestMocker) {
+				querier.On("Ping", mock.Anything).Return(nil)
+				querier.On("GetSchemaMigration", mock.Anything).Return(&db.SchemaMigration{Version: db.SchemaVersion}, nil)
+			},
+			status: http.StatusOK,
+			checks: map[string]string{"database": healthStatusOK, "migrations": healthStatusOK, "token_maker": healthStatusOK},
+		},
+		{
+			name: "DatabaseDown",
+			mock: func(querier *mocker.TestMocker) {
+				querier.On("Ping", mock.Anything).Return(sql.ErrConnDone)
+				querier.On("GetSchemaMigration", mock.Anything).Return(nil, sql.ErrConnDone)
+			},
+			status: http.StatusServiceUnavailable,
+			checks: map[string]string{"database": healthStatusUnavailable, "migrations": healthStatusUnavailable, "token_maker": healthStatusOK},
+		},
+		{
+			name: "SchemaBehind",
+			mock: func(querier *mocker.TestMocker) {
+				querier.On("Ping", mock.Anything).Return(nil)
+				querier.On("GetSchemaMigration", mock.Anything).Return(&db.SchemaMigration{Version: db.SchemaVersion - 1}, nil)
+			},
+			status: http.StatusServiceUnavailable,
+			checks: map[string]string{"database": healthStatusOK, "migrations": healthStatusUnavailable, "token_maker": healthStatusOK},
+		},
+		{
+			name: "DirtyMigration",
+			mock: func(querier *mocker.TestMocker) {
+				querier.On("Ping", mock.Anything).Return(nil)
+				querier.On("GetSchemaMigration", mock.Anything).Return(&db.SchemaMigration{Version: db.SchemaVersion, Dirty: true}, nil)
+			},
+			status: http.StatusServiceUnavailable,
+			checks: map[string]string{"database": healthStatusOK, "migrations": healthStatusUnavailable, "token_maker": healthStatusOK},
+		},
+		{
+			name:       "CacheUnreachable",
+			checkCache: true,
+			mock: func(querier *mocker.TestMocker) {
+				querier.On("Ping", mock.Anything).Return(nil)
+				querier.On("GetSchemaMigration", mock.Anything).Return(&db.SchemaMigration{Version: db.SchemaVersion}, nil)
+			},
+			status: http.StatusServiceUnavailable,
+			checks: map[string]string{"database": healthStatusOK, "migrations": healthStatusOK, "token_maker": healthStatusOK, "cache": healthStatusUnavailable},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := createConfiguration()
+			config.ReadinessCheckCache = tc.checkCache
+			config.RedisAddress = closedAddress
+
+			querier := new(mocker.TestMocker)
+			querier.On("GetConfig").Return(config)
+			tc.mock(querier)
+
+			maker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
+			require.NoError(t, err)
+			server := newServerWithConfigurator(querier, maker, querier)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, tc.status, recorder.Code)
+			require.NotContains(t, recorder.Body.String(), closedAddress)
+			require.NotContains(t, recorder.Body.String(), sql.ErrConnDone.Error())
+
+			var response healthResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			if tc.status == http.StatusOK {
+				require.Equal(t, healthStatusOK, response.Status)
+			} else {
+				require.Equal(t, healthStatusUnavailable, response.Status)
+			}
+
+			statuses := map[string]string{}
+			for _, check := range response.Checks {
+				statuses[check.Name] = check.Status
+				require.GreaterOrEqual(t, check.LatencyMS, float64(0))
+			}
+			require.Equal(t, tc.checks, statuses)
+		})
+	}
+}
+
+func TestReadinessHangingDatabase(t *testing.T) {
+	config := createConfiguration()
+	config.ReadinessTimeout = 200 * time.Millisecond
+
+	// every query blocks until the check gives up
+	hang := func(args mock.Arguments) {
+		<-args.Get(0).(context.Context).Done()
+	}
+	querier := new(mocker.TestMocker)
+	querier.On("GetConfig").Return(config)
+	querier.On("Ping", mock.Anything).Run(hang).Return(context.DeadlineExceeded)
+	querier.On("GetSchemaMigration", mock.Anything).Run(hang).Return(nil, context.DeadlineExceeded)
+
+	maker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
+	require.NoError(t, err)
+	server := newServerWithConfigurator(querier, maker, querier)
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+	require.NoError(t, err)
+
+	start := time.Now()
+	server.router.ServeHTTP(recorder, request)
+	require.Less(t, time.Since(start), 2*config.ReadinessTimeout)
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	var response healthResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, []string{"database", "migrations", "token_maker"}, []string{
+		response.Checks[0].Name, response.Checks[1].Name, response.Checks[2].Name,
+	})
+	require.Equal(t, healthStatusUnavailable, response.Checks[0].Status)
+	require.Equal(t, healthStatusUnavailable, response.Checks[1].Status)
+	require.Equal(t, healthStatusOK, response.Checks[2].Status)
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+	estranslations "github.com/go-playground/validator/v10/translations/es"
+	"github.com/newbri/posadamissportia/db/util"
+	"golang.org/x/text/language"
+	"reflect"
+	"strings"
+)
+
+const (
+	acceptLanguageHeaderKey  = "Accept-Language"
+	contentLanguageHeaderKey = "Content-Language"
+)
+
+// supportedLanguages lists the languages messages are translated to. The first one is used
+// when the client accepts none of them.
+var supportedLanguages = []language.Tag{language.English, language.Spanish}
+
+var languageMatcher = language.NewMatcher(supportedLanguages)
+
+var universalTranslator = ut.New(en.New(), en.New(), es.New())
+
+// spanishMessages translates the messages of the API errors, by code. The English messages
+// are the ones the errors are declared with.
+var spanishMessages = map[string]string{
+	"unique_violation":               "el identificador debe ser único",
+	"internal_error":                 "ocurrió un error",
+	"not_found":                      "no se encontró el recurso",
+	"invalid_uri":                    "la uri no es válida",
+	"invalid_credentials":            "la contraseña no coincide",
+	"invalid_token":                  "no se pudo verificar el token",
+	"session_not_created":            "no se pudo crear la sesión",
+	"session_blocked":                "la sesión está bloqueada",
+	"session_user_mismatch":          "la sesión pertenece a otro usuario",
+	"session_token_mismatch":         "el token no corresponde a la sesión",
+	"session_expired":                "la sesión expiró",
+	"token_not_created":              "ocurrió un error al crear el token",
+	"role_not_found":                 "no se encontró el rol",
+	"role_not_allowed":               "el usuario no puede buscar este rol",
+	"role_in_use":                    "el rol todavía tiene usuarios asignados",
+	"invalid_if_match":               "la cabecera If-Match no es una etiqueta de entidad válida",
+	"version_mismatch":               "otra petición modificó el recurso",
+	"if_match_required":              "la cabecera If-Match es obligatoria",
+	"authorization_missing":          "falta la cabecera de autorización",
+	"authorization_malformed":        "el formato de la cabecera de autorización no es válido",
+	"authorization_type_unsupported": "el tipo de autorización no está soportado",
+	"token_user_unknown":             "el token no es válido, el usuario no existe",
+	"authentication_required":        "se requieren los datos de autenticación",
+	"role_forbidden":                 "el rol del usuario no tiene permitida esta acción",
+	"idempotency_key_invalid":        "la cabecera Idempotency-Key es demasiado larga",
+	"idempotency_key_reused":         "la clave de idempotencia ya se usó con otra petición",
+	"idempotency_key_in_progress":    "una petición con la misma clave de idempotencia todavía se está procesando",
+	"webhook_url_invalid":            "la url del webhook debe ser una url http o https absoluta",
+	"event_type_unknown":             "el tipo de evento no existe",
+	"last_event_id_invalid":          "el id del último evento debe ser un entero positivo",
+	"validation_failed":              "la petición tiene campos inválidos",
+	"bad_request":                    "la petición no es válida",
+}
+
+func init() {
+	if err := registerTranslations(); err != nil {
+		panic(err)
+	}
+}
+
+// passwordTag validates a password against util.MinPasswordLength. It is an alias of min,
+// whose messages it is translated with.
+const passwordTag = "password"
+
+// registerTranslations loads the message catalogs of the validator and of the API errors.
+// Invalid fields are named after their json, form or uri key, the way clients know them, and
+// the password rule is registered before any request is validated.
+func registerTranslations() error {
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return nil
+	}
+	validate.RegisterTagNameFunc(fieldName)
+	validate.RegisterAlias(passwordTag, fmt.Sprintf("min=%d", util.MinPasswordLength))
+
+	enTrans, _ := universalTranslator.GetTranslator(language.English.String())
+	esTrans, _ := universalTranslator.GetTranslator(language.Spanish.String())
+	if err := entranslations.RegisterDefaultTranslations(validate, enTrans); err != nil {
+		return err
+	}
+	if err := estranslations.RegisterDefaultTranslations(validate, esTrans); err != nil {
+		return err
+	}
+
+	for _, apiErr := range apiErrors {
+		if err := enTrans.Add(apiErr.Code, apiErr.msg, false); err != nil {
+			return err
+		}
+		if err := esTrans.Add(apiErr.Code, spanishMessages[apiErr.Code], false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fieldName(field reflect.StructField) string {
+	for _, key := range []string{"json", "form", "uri"} {
+		name, _, _ := strings.Cut(field.Tag.Get(key), ",")
+		if len(name) > 0 && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// translator returns the catalog of the supported language that best matches the
+// Accept-Language header of the request.
+func translator(ctx *gin.Context) ut.Translator {
+	_, index := language.MatchStrings(languageMatcher, ctx.GetHeader(acceptLanguageHeaderKey))
+	trans, _ := universalTranslator.GetTranslator(supportedLanguages[index].String())
+	return trans
+}
+
+// translate returns the message of e in the language of trans, falling back to English.
+func (e *APIError) translate(trans ut.Translator) string {
+	msg, err := trans.T(e.Code)
+	if err != nil || len(msg) == 0 {
+		return e.msg
+	}
+	return msg
+}
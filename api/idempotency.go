@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/token"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	idempotencyKeyHeaderKey     = "Idempotency-Key"
+	idempotentReplayedHeaderKey = "Idempotent-Replayed"
+	maxIdempotencyKeyLength     = 255
+)
+
+// idempotencyResponseWriter keeps a copy of the response so that it can be replayed.
+type idempotencyResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyResponseWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyResponseWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// idempotencyMiddleware makes a POST safe to retry. The first request carrying an
+// Idempotency-Key header is processed and its response stored for IdempotencyKeyTTL; retries
+// with the same key and body get the stored response back instead of being processed again.
+// Requests that fail are not stored, so that they can be retried once the cause is fixed.
+func idempotencyMiddleware(server *Server) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := strings.TrimSpace(ctx.GetHeader(idempotencyKeyHeaderKey))
+		if key == "" {
+			ctx.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrInvalidIdempotencyKey).Error())
+			ctx.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+			ctx.Abort()
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(hash[:])
+		scope := idempotencyScope(ctx, server, requestHash)
+		now := time.Now()
+		_, err = server.store.CreateIdempotencyKey(ctx, db.CreateIdempotencyKeyParams{
+			Scope:       scope,
+			Key:         key,
+			RequestHash: requestHash,
+			CreatedAt:   now,
+			ExpiredAt:   now.Add(server.config.GetConfig().IdempotencyKeyTTL),
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				replayIdempotentResponse(ctx, server, scope, key, requestHash)
+				return
+			}
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+			ctx.Abort()
+			return
+		}
+
+		writer := &idempotencyResponseWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+		ctx.Next()
+		ctx.Writer = writer.ResponseWriter
+
+		// the key is settled even when the client went away, or it would stay in progress
+		// until it expires
+		settleCtx := context.WithoutCancel(ctx)
+		status := ctx.Writer.Status()
+		if len(ctx.Errors) > 0 || status >= http.StatusInternalServerError {
+			if err := server.store.DeleteIdempotencyKey(settleCtx, scope, key); err != nil {
+				requestLogger(ctx).Error().Err(err).Str("key", key).Msg("cannot release the idempotency key")
+			}
+			return
+		}
+
+		err = server.store.CompleteIdempotencyKey(settleCtx, db.CompleteIdempotencyKeyParams{
+			Scope:        scope,
+			Key:          key,
+			StatusCode:   int32(status),
+			ContentType:  ctx.Writer.Header().Get("Content-Type"),
+			ETag:         ctx.Writer.Header().Get(etagHeaderKey),
+			ResponseBody: writer.body.Bytes(),
+		})
+		if err != nil {
+			requestLogger(ctx).Error().Err(err).Str("key", key).Msg("cannot store the idempotent response")
+		}
+	}
+}
+
+func replayIdempotentResponse(ctx *gin.Context, server *Server, scope string, key string, hash string) {
+	stored, err := server.store.GetIdempotencyKey(ctx, scope, key)
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		ctx.Abort()
+		return
+	}
+
+	switch {
+	case stored.RequestHash != hash:
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrIdempotencyKeyReused).Error())
+		ctx.Abort()
+	case !stored.IsCompleted:
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrIdempotencyKeyInProgress).Error())
+		ctx.Abort()
+	default:
+		ctx.Header(idempotentReplayedHeaderKey, "true")
+		if stored.ETag != "" {
+			ctx.Header(etagHeaderKey, stored.ETag)
+		}
+		ctx.Data(int(stored.StatusCode), stored.ContentType, stored.ResponseBody)
+		ctx.Abort()
+	}
+}
+
+// idempotencyScope keeps the keys of different callers and endpoints apart. Anonymous callers
+// cannot be told apart, so their keys are scoped by the request itself: a stored response is
+// only replayed to a request identical to the one it answered, and two clients reusing a key
+// for different requests never see each other's response.
+func idempotencyScope(ctx *gin.Context, server *Server, requestHash string) string {
+	caller := "anonymous:" + requestHash
+	if data, exists := ctx.Get(server.config.GetConfig().AuthorizationPayloadKey); exists {
+		if payload, ok := data.(*token.Payload); ok {
+			caller = payload.Username
+		}
+	}
+	return strings.Join([]string{ctx.Request.Method, ctx.FullPath(), caller}, " ")
+}
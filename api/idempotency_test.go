@@ -0,0 +1,250 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/newbri/posadamissportia/token"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	expectedUser := createRandomUser(db.RoleCustomer, false)
+	body, err := json.Marshal(gin.H{
+		"username":  expectedUser.Username,
+		"password":  "lexy84",
+		"full_name": expectedUser.FullName,
+		"email":     expectedUser.Email,
+	})
+	require.NoError(t, err)
+
+	hash := sha256.Sum256(body)
+	requestHash := hex.EncodeToString(hash[:])
+	const key = "4f9c0d6e-retry"
+	scope := "POST /api/v1/users anonymous:" + requestHash
+
+	testCases := []struct {
+		name     string
+		key      string
+		canceled bool
+		mock     func(querier *mocker.TestMocker)
+		response func(t *testing.T, recorder *httptest.ResponseRecorder, querier *mocker.TestMocker)
+	}{
+		{
+			name: "FirstRequestIsStored",
+			key:  key,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("CreateIdempotencyKey", mock.Anything, mock.MatchedBy(func(arg db.CreateIdempotencyKeyParams) bool {
+						return arg.Scope == scope && arg.Key == key && arg.RequestHash == requestHash && arg.ExpiredAt.After(arg.CreatedAt)
+					})).
+					Times(1).
+					Return(&db.IdempotencyKey{}, nil)
+				querier.
+					On("GetRoleByName", mock.Anything, db.RoleCustomer).
+					Times(1).
+					Return(createRandomRole(db.RoleCustomer), nil)
+				querier.
+					On("CreateUser", mock.Anything, mock.Anything).
+					Times(1).
+					Return(expectedUser, nil)
+				querier.
+					On("CompleteIdempotencyKey", mock.Anything, mock.MatchedBy(func(arg db.CompleteIdempotencyKeyParams) bool {
+						return arg.StatusCode == http.StatusOK && bytes.Contains(arg.ResponseBody, []byte(expectedUser.Username)) &&
+							arg.ETag == fmt.Sprintf(`"%d"`, expectedUser.Version)
+					})).
+					Times(1).
+					Return(nil)
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder, querier *mocker.TestMocker) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Empty(t, recorder.Header().Get(idempotentReplayedHeaderKey))
+				querier.AssertExpectations(t)
+			},
+		},
+		{
+			name: "RetryIsReplayed",
+			key:  key,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("CreateIdempotencyKey", mock.Anything, mock.Anything).
+					Times(1).
+					Return(nil, sql.ErrNoRows)
+				querier.
+					On("GetIdempotencyKey", mock.Anything, scope, key).
+					Times(1).
+					Return(&db.IdempotencyKey{
+						RequestHash:  requestHash,
+						IsCompleted:  true,
+						StatusCode:   http.StatusOK,
+						ContentType:  "application/json; charset=utf-8",
+						ETag:         `"3"`,
+						ResponseBody: []byte(`{"username":"` + expectedUser.Username + `"}`),
+					}, nil)
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder, querier *mocker.TestMocker) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "true", recorder.Header().Get(idempotentReplayedHeaderKey))
+				require.Equal(t, `"3"`, recorder.Header().Get(etagHeaderKey))
+				require.JSONEq(t, `{"username":"`+expectedUser.Username+`"}`, recorder.Body.String())
+				querier.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+			},
+		},
+		{
+			name: "KeyReusedWithDifferentBody",
+			key:  key,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("CreateIdempotencyKey", mock.Anything, mock.Anything).
+					Times(1).
+					Return(nil, sql.ErrNoRows)
+				querier.
+					On("GetIdempotencyKey", mock.Anything, scope, key).
+					Times(1).
+					Return(&db.IdempotencyKey{RequestHash: "another", IsCompleted: true}, nil)
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder, querier *mocker.TestMocker) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+				querier.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+			},
+		},
+		{
+			name: "RequestInProgress",
+			key:  key,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("CreateIdempotencyKey", mock.Anything, mock.Anything).
+					Times(1).
+					Return(nil, sql.ErrNoRows)
+				querier.
+					On("GetIdempotencyKey", mock.Anything, scope, key).
+					Times(1).
+					Return(&db.IdempotencyKey{RequestHash: requestHash}, nil)
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder, querier *mocker.TestMocker) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+		{
+			name: "FailedRequestReleasesKey",
+			key:  key,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("CreateIdempotencyKey", mock.Anything, mock.Anything).
+					Times(1).
+					Return(&db.IdempotencyKey{}, nil)
+				querier.
+					On("GetRoleByName", mock.Anything, db.RoleCustomer).
+					Times(1).
+					Return(createRandomRole(db.RoleCustomer), nil)
+				querier.
+					On("CreateUser", mock.Anything, mock.Anything).
+					Times(1).
+					Return(nil, sql.ErrConnDone)
+				querier.
+					On("DeleteIdempotencyKey", mock.Anything, scope, key).
+					Times(1).
+					Return(nil)
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder, querier *mocker.TestMocker) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				querier.AssertExpectations(t)
+			},
+		},
+		{
+			name:     "ClientDisconnected",
+			key:      key,
+			canceled: true,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("CreateIdempotencyKey", mock.Anything, mock.Anything).
+					Times(1).
+					Return(&db.IdempotencyKey{}, nil)
+				querier.
+					On("GetRoleByName", mock.Anything, db.RoleCustomer).
+					Times(1).
+					Return(createRandomRole(db.RoleCustomer), nil)
+				querier.
+					On("CreateUser", mock.Anything, mock.Anything).
+					Times(1).
+					Return(expectedUser, nil)
+				// the response is stored with a context the client cannot cancel
+				querier.
+					On("CompleteIdempotencyKey", mock.MatchedBy(func(ctx context.Context) bool {
+						return ctx.Err() == nil
+					}), mock.Anything).
+					Times(1).
+					Return(nil)
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder, querier *mocker.TestMocker) {
+				querier.AssertExpectations(t)
+			},
+		},
+		{
+			name: "KeyTooLong",
+			key:  strings.Repeat("k", maxIdempotencyKeyLength+1),
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("CreateIdempotencyKey", mock.Anything, mock.Anything).
+					Times(0)
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder, querier *mocker.TestMocker) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			server := newTestServer(querier, "test")
+			tc.mock(querier)
+
+			requestCtx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.canceled {
+				cancel()
+			}
+			request, err := http.NewRequestWithContext(requestCtx, http.MethodPost, "/api/v1/users", bytes.NewReader(body))
+			require.NoError(t, err)
+			request.Header.Set(idempotencyKeyHeaderKey, tc.key)
+
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			tc.response(t, recorder, querier)
+		})
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	server := newTestServer(new(mocker.TestMocker), "test")
+	scope := func(payload *token.Payload, requestHash string) string {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/api/v1/users", nil)
+		if payload != nil {
+			ctx.Set(server.config.GetConfig().AuthorizationPayloadKey, payload)
+		}
+		return idempotencyScope(ctx, server, requestHash)
+	}
+
+	// anonymous callers sending different requests never share a scope
+	require.NotEqual(t, scope(nil, "first"), scope(nil, "second"))
+	require.Equal(t, scope(nil, "first"), scope(nil, "first"))
+
+	// an authenticated caller keeps one scope, so a key reused for another request is refused
+	payload := &token.Payload{Username: "newbri"}
+	require.Equal(t, scope(payload, "first"), scope(payload, "second"))
+	require.NotEqual(t, scope(payload, "first"), scope(&token.Payload{Username: "lexy"}, "first"))
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/newbri/posadamissportia/token"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"time"
+)
+
+const requestIDKey = "request_id"
+
+// validRequestID limits the identifiers accepted from clients and proxies, so that they can
+// be logged and stored in the audit log as they are.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestLoggerMiddleware assigns the request its identifier, keeping the one the client or
+// a proxy sent in X-Request-ID, and echoes it in the response. It attaches a logger carrying
+// the identifier and the request fields to the context, and writes a structured access log
+// entry once the request is answered.
+func requestLoggerMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		id := ctx.GetHeader(requestIDHeaderKey)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		ctx.Set(requestIDKey, id)
+		ctx.Header(requestIDHeaderKey, id)
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		fields := log.With().
+			Str("request_id", id).
+			Str("method", ctx.Request.Method).
+			Str("route", route).
+			Str("ip", ctx.ClientIP())
+		if span := trace.SpanContextFromContext(ctx.Request.Context()); span.IsValid() {
+			fields = fields.Str("trace_id", span.TraceID().String())
+		}
+		logger := fields.Logger()
+		ctx.Request = ctx.Request.WithContext(logger.WithContext(ctx.Request.Context()))
+
+		ctx.Next()
+
+		if slices.Contains(unloggedPaths, ctx.Request.URL.Path) {
+			return
+		}
+
+		status := ctx.Writer.Status()
+		var event *zerolog.Event
+		switch {
+		case status >= http.StatusInternalServerError:
+			event = requestLogger(ctx).Error()
+		case status >= http.StatusBadRequest:
+			event = requestLogger(ctx).Warn()
+		default:
+			event = requestLogger(ctx).Info()
+		}
+		if len(ctx.Errors) > 0 {
+			event = event.Str("error", ctx.Errors.Last().Error())
+		}
+		event.
+			Str("path", ctx.Request.URL.Path).
+			Int("status", status).
+			Int("size", ctx.Writer.Size()).
+			Dur("latency", time.Since(start)).
+			Msg("request")
+	}
+}
+
+// recoveryMiddleware answers a request whose handler panicked with an internal server error
+// problem, and logs the panic with its stack trace.
+func recoveryMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			requestLogger(ctx).Error().
+				Interface("panic", recovered).
+				Bytes("stack", debug.Stack()).
+				Msg("handler panicked")
+
+			_ = ctx.Error(ErrInternalServer)
+			ctx.Abort()
+			if !ctx.Writer.Written() {
+				writeProblem(ctx)
+			}
+		}()
+
+		ctx.Next()
+	}
+}
+
+// requestLogger returns the logger attached to the request, or the global one for a context
+// that did not go through requestLoggerMiddleware.
+func requestLogger(ctx *gin.Context) *zerolog.Logger {
+	logger := zerolog.Ctx(ctx.Request.Context())
+	if logger.GetLevel() == zerolog.Disabled {
+		return &log.Logger
+	}
+	return logger
+}
+
+// logAuthenticatedUser adds the authenticated user to the fields of the request logger.
+func logAuthenticatedUser(ctx *gin.Context, payload *token.Payload) {
+	logger := zerolog.Ctx(ctx.Request.Context())
+	if logger.GetLevel() == zerolog.Disabled {
+		return
+	}
+	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		c = c.Str("user", payload.Username)
+		if payload.Role != nil {
+			c = c.Str("role", payload.Role.Name)
+		}
+		return c
+	})
+}
+
+// requestID returns the identifier assigned to the request by requestLoggerMiddleware.
+func requestID(ctx *gin.Context) string {
+	if id := ctx.GetString(requestIDKey); id != "" {
+		return id
+	}
+	return ctx.GetHeader(requestIDHeaderKey)
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLog sends the global logger to a buffer for the duration of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buffer bytes.Buffer
+	previous := log.Logger
+	log.Logger = zerolog.New(&buffer)
+	t.Cleanup(func() {
+		log.Logger = previous
+	})
+	return &buffer
+}
+
+// logEntries decodes the JSON log lines written to buffer.
+func logEntries(t *testing.T, buffer *bytes.Buffer) []map[string]any {
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRequestID(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   string
+		response func(t *testing.T, id string)
+	}{
+		{
+			name:   "Propagated",
+			header: "edge-01:4f2a",
+			response: func(t *testing.T, id string) {
+				require.Equal(t, "edge-01:4f2a", id)
+			},
+		},
+		{
+			name: "Assigned",
+			response: func(t *testing.T, id string) {
+				_, err := uuid.Parse(id)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "Replaced",
+			header: "bad id\twith spaces",
+			response: func(t *testing.T, id string) {
+				_, err := uuid.Parse(id)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "TooLong",
+			header: strings.Repeat("a", 129),
+			response: func(t *testing.T, id string) {
+				_, err := uuid.Parse(id)
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(new(mocker.TestMocker), "test")
+
+			request, err := http.NewRequest(http.MethodGet, "/healthz", nil)
+			require.NoError(t, err)
+			if tc.header != "" {
+				request.Header.Set(requestIDHeaderKey, tc.header)
+			}
+
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			tc.response(t, recorder.Header().Get(requestIDHeaderKey))
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	buffer := captureLog(t)
+	user := createRandomUser(db.RoleCustomer, false)
+
+	querier := new(mocker.TestMocker)
+	server := newTestServer(querier, "test")
+	querier.On("GetUser", mock.Anything, user.Username).Return(user, nil)
+
+	request, err := http.NewRequest(http.MethodGet, "/api/v1/auth/customer/users/info", nil)
+	require.NoError(t, err)
+	request.Header.Set(requestIDHeaderKey, "req-access")
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// the probes are left out of the access log
+	request, err = http.NewRequest(http.MethodGet, "/healthz", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(httptest.NewRecorder(), request)
+
+	entries := logEntries(t, buffer)
+	require.Len(t, entries, 1)
+
+	entry := entries[0]
+	require.Equal(t, "info", entry["level"])
+	require.Equal(t, "request", entry["message"])
+	require.Equal(t, "req-access", entry["request_id"])
+	require.Equal(t, http.MethodGet, entry["method"])
+	require.Equal(t, "/api/v1/auth/customer/users/info", entry["route"])
+	require.Equal(t, user.Username, entry["user"])
+	require.Equal(t, db.RoleCustomer, entry["role"])
+	require.EqualValues(t, http.StatusOK, entry["status"])
+	require.Contains(t, entry, "ip")
+	require.Contains(t, entry, "latency")
+}
+
+func TestAccessLogError(t *testing.T) {
+	buffer := captureLog(t)
+	server := newTestServer(new(mocker.TestMocker), "test")
+
+	request, err := http.NewRequest(http.MethodGet, "/api/v1/auth/customer/users/info", nil)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	entries := logEntries(t, buffer)
+	require.NotEmpty(t, entries)
+
+	// the handler logs through the request logger, then the access log entry closes the request
+	for _, entry := range entries {
+		require.Equal(t, recorder.Header().Get(requestIDHeaderKey), entry["request_id"])
+	}
+	access := entries[len(entries)-1]
+	require.Equal(t, "warn", access["level"])
+	require.Equal(t, ErrAuthHeaderNotProvided.Error(), access["error"])
+	require.NotContains(t, access, "user")
+}
+
+func TestRecovery(t *testing.T) {
+	buffer := captureLog(t)
+	server := newTestServer(new(mocker.TestMocker), "test")
+	server.router.GET("/panic", func(ctx *gin.Context) {
+		panic("boom")
+	})
+
+	request, err := http.NewRequest(http.MethodGet, "/panic", nil)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.Equal(t, problemContentType, recorder.Header().Get("Content-Type"))
+
+	var body problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, ErrInternalServer.Code, body.Code)
+	require.Equal(t, recorder.Header().Get(requestIDHeaderKey), body.RequestID)
+
+	entries := logEntries(t, buffer)
+	require.Len(t, entries, 2)
+	require.Equal(t, "boom", entries[0]["panic"])
+	require.Contains(t, entries[0], "stack")
+	require.Equal(t, "error", entries[1]["level"])
+	require.EqualValues(t, http.StatusInternalServerError, entries[1]["status"])
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/newbri/posadamissportia/metrics"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+// unmatchedRoute labels the requests that matched no route, so that probing random paths
+// does not create a series per path.
+const unmatchedRoute = "unmatched"
+
+// otherMethod labels the requests made with a method outside the standard set, which a
+// client could otherwise make up to create series.
+const otherMethod = "OTHER"
+
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// metricsMiddleware records the count and latency of every request under the route template
+// it matched and the status it was answered with.
+func metricsMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := ctx.Request.Method
+		if !standardMethods[method] {
+			method = otherMethod
+		}
+		metrics.ObserveRequest(route, method, ctx.Writer.Status(), time.Since(start))
+	}
+}
+
+var metricsHandler = promhttp.Handler()
+
+// getMetrics exposes the metrics in the Prometheus text format.
+func (server *Server) getMetrics(ctx *gin.Context) {
+	metricsHandler.ServeHTTP(ctx.Writer, ctx.Request)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	server := newTestServer(new(mocker.TestMocker), "test")
+
+	for _, path := range []string{"/healthz", "/not/a/route"} {
+		request, err := http.NewRequest(http.MethodGet, path, nil)
+		require.NoError(t, err)
+		server.router.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	request, err := http.NewRequest("MADEUP", "/not/a/route", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(httptest.NewRecorder(), request)
+
+	recorder := httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodGet, "/metrics", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Header().Get("Content-Type"), "text/plain")
+
+	body := recorder.Body.String()
+	require.Contains(t, body, `posada_http_requests_total{method="GET",route="/healthz",status="200"}`)
+	require.Contains(t, body, `posada_http_request_duration_seconds_bucket{method="GET",route="/healthz",status="200",le="+Inf"}`)
+	require.Contains(t, body, `posada_http_requests_total{method="GET",route="unmatched",status="404"}`)
+	require.Contains(t, body, `posada_http_requests_total{method="OTHER",route="unmatched",status="404"}`)
+	require.NotContains(t, body, "/not/a/route")
+	require.NotContains(t, body, "MADEUP")
+	for _, counter := range []string{
+		"posada_auth_logins_total",
+		"posada_auth_failed_passwords_total",
+		"posada_auth_token_renewals_total",
+		"posada_auth_refused_renewals_total",
+	} {
+		require.Contains(t, body, counter)
+	}
+}
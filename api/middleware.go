@@ -1,11 +1,10 @@
 package api
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/newbri/posadamissportia/token"
-	"github.com/rs/zerolog/log"
 	"net/http"
 	"strings"
 )
@@ -13,52 +12,50 @@ import (
 const (
 	authorizationHeaderKey  = "authorization"
 	authorizationTypeBearer = "bearer"
+	requestIDHeaderKey      = "X-Request-ID"
 )
 
-var ErrInvalidAuthHeaderFormat = errors.New("invalid authorization header format")
-var ErrAuthHeaderNotProvided = errors.New("authorization header is not provided")
-
 // authMiddleware is a Gin middleware function that performs authentication based on a provided token.
 func authMiddleware(server *Server) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authorizationHeader := strings.TrimSpace(ctx.GetHeader(server.config.GetConfig().AuthorizationHeaderKey))
 		if len(authorizationHeader) == 0 {
-			log.Info().Msg(ctx.Error(ErrAuthHeaderNotProvided).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrAuthHeaderNotProvided).Error())
+			ctx.Abort()
 			return
 		}
 
 		fields := strings.Fields(authorizationHeader)
 		if len(fields) < 2 {
-			log.Info().Msg(ctx.Error(ErrInvalidAuthHeaderFormat).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrInvalidAuthHeaderFormat).Error())
+			ctx.Abort()
 			return
 		}
 
 		authorizationType := strings.ToLower(fields[0])
 		if authorizationType != authorizationTypeBearer {
-			err := fmt.Errorf("unsupported authorization type %s", authorizationType)
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			requestLogger(ctx).Info().Msg(ctx.Error(fmt.Errorf("%w %s", ErrUnsupportedAuthType, authorizationType)).Error())
+			ctx.Abort()
 			return
 		}
 
 		accessToken := fields[1]
-		payload, err := server.tokenMaker.VerifyToken(accessToken)
+		payload, err := server.verifyToken(ctx, accessToken)
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			requestLogger(ctx).Info().Msg(ctx.Error(fmt.Errorf("%w: %s", ErrVerifyToken, err)).Error())
+			ctx.Abort()
 			return
 		}
 
 		user, err := server.store.GetUser(ctx, payload.Username)
-		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
-			return
-		}
-
-		if user.IsDeleted {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(errors.New("token is invalid. User does not exists")))
+		if err != nil || user.IsDeleted {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrUnknownTokenUser).Error())
+			ctx.Abort()
 			return
 		}
 
 		ctx.Set(server.config.GetConfig().AuthorizationPayloadKey, payload)
+		logAuthenticatedUser(ctx, payload)
 		ctx.Next()
 	}
 }
@@ -67,15 +64,15 @@ func pasetoAuthRole(server *Server, role string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		data, exist := ctx.Get(server.config.GetConfig().AuthorizationPayloadKey)
 		if !exist {
-			err := errors.New("authentication data is required")
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrAuthRequired).Error())
+			ctx.Abort()
 			return
 		}
 
 		payload, _ := data.(*token.Payload)
 		if payload.Role.Name != role {
-			err := fmt.Errorf("only %s is allowed to perform this action", role)
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, err)
+			requestLogger(ctx).Info().Msg(ctx.Error(fmt.Errorf("%w: only %s is allowed to perform this action", ErrForbiddenRole, role)).Error())
+			ctx.Abort()
 			return
 		}
 
@@ -83,63 +80,29 @@ func pasetoAuthRole(server *Server, role string) gin.HandlerFunc {
 	}
 }
 
+// errorHandlingMiddleware answers a request that failed with an RFC 7807 problem document
+// describing its last error.
 func errorHandlingMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ctx.Next()
 
-		// only run if there are some errors to handle
-		if len(ctx.Errors) > 0 {
-			for _, err := range ctx.Errors {
-				response := validateFieldError(err)
-				switch {
-				case errors.Is(err.Err, ErrUniqueViolation):
-					ctx.JSON(http.StatusForbidden, gin.H{"errors": response})
-				case errors.Is(err.Err, ErrInternalServer):
-					ctx.JSON(http.StatusInternalServerError, gin.H{"errors": response})
-				case errors.Is(err.Err, ErrNoRow):
-					ctx.JSON(http.StatusNotFound, gin.H{"errors": response})
-				case errors.Is(err.Err, ErrShouldBindUri):
-					ctx.JSON(http.StatusBadRequest, gin.H{"errors": response})
-				case errors.Is(err.Err, ErrVerifyToken) || errors.Is(err.Err, ErrAuthHeaderNotProvided) || errors.Is(err.Err, ErrInvalidAuthHeaderFormat):
-					ctx.JSON(http.StatusUnauthorized, gin.H{"errors": response})
-				case errors.Is(err.Err, ErrSession):
-					ctx.JSON(http.StatusInternalServerError, gin.H{"errors": response})
-				case errors.Is(err.Err, ErrBlockedSession):
-					ctx.JSON(http.StatusUnauthorized, gin.H{"errors": response})
-				case errors.Is(err.Err, ErrWrongUserSession):
-					ctx.JSON(http.StatusUnauthorized, gin.H{"errors": response})
-				case errors.Is(err.Err, ErrWrongSessionToken):
-					ctx.JSON(http.StatusUnauthorized, gin.H{"errors": response})
-				case errors.Is(err.Err, ErrExpiredSession):
-					ctx.JSON(http.StatusUnauthorized, gin.H{"errors": response})
-				case errors.Is(err.Err, ErrTokenCreation):
-					ctx.JSON(http.StatusInternalServerError, gin.H{"errors": response})
-				case errors.Is(err.Err, ErrPasswordMistMach):
-					ctx.JSON(http.StatusUnauthorized, gin.H{"errors": response})
-				case errors.Is(err.Err, ErrNoRole) || errors.Is(err.Err, ErrNoCustomerFound):
-					ctx.JSON(http.StatusNotFound, gin.H{"errors": response})
-				default:
-					ctx.JSON(http.StatusBadRequest, gin.H{"errors": response})
-				}
-			}
-
-			// once we handled all the errors, clear them from the gin context
-			ctx.Errors.Last().Meta = nil
+		// only run if there are some errors to handle, unless the response already started
+		if len(ctx.Errors) == 0 || ctx.Writer.Written() {
+			return
 		}
+		writeProblem(ctx)
 	}
 }
 
-func CORSMiddleware(server *Server) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", server.config.GetConfig().AccessControlAllowOrigin)
-		c.Writer.Header().Set("Access-Control-Allow-Headers", server.config.GetConfig().AccessControlAllowHeaders)
-		c.Writer.Header().Set("Access-Control-Allow-Methods", server.config.GetConfig().AccessControlAllowMethods)
-
-		if c.Request.Method == http.MethodOptions {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
-		}
-
-		c.Next()
+// writeProblem answers the request with the problem document describing its last error.
+func writeProblem(ctx *gin.Context) {
+	problem := newProblem(ctx, ctx.Errors.Last().Err)
+	body, err := json.Marshal(problem)
+	if err != nil {
+		requestLogger(ctx).Error().Err(err).Msg("cannot marshal the problem document")
+		ctx.Status(http.StatusInternalServerError)
+		return
 	}
+	ctx.Header(contentLanguageHeaderKey, problem.language)
+	ctx.Data(problem.Status, problemContentType, body)
 }
@@ -417,7 +417,7 @@ func TestPasetoAuthRole(t *testing.T) {
 					Return(config2)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				require.Equal(t, http.StatusForbidden, recorder.Code)
 			},
 			auth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
 				addAuthorization(t,
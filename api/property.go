@@ -4,8 +4,8 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 	"github.com/newbri/posadamissportia/db"
-	"github.com/rs/zerolog/log"
 	"net/http"
 	"strings"
 	"time"
@@ -38,7 +38,7 @@ func (server *Server) createProperty(ctx *gin.Context) {
 	}
 
 	if err := ctx.ShouldBindJSON(&request); err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
@@ -55,9 +55,14 @@ func (server *Server) createProperty(ctx *gin.Context) {
 		CreatedAt:  time.Now(),
 	}
 
-	createdProperty, err := server.store.CreateProperty(ctx, arg)
+	createdProperty, err := server.store.CreateProperty(audited(ctx, "property.create"), arg)
 	if err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation" {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrUniqueViolation).Error())
+			return
+		}
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
@@ -75,6 +80,7 @@ func (server *Server) createProperty(ctx *gin.Context) {
 		CreatedAt:  createdProperty.CreatedAt,
 	}
 
+	setETag(ctx, createdProperty.Version)
 	ctx.JSON(http.StatusOK, response)
 }
 
@@ -85,13 +91,21 @@ func (server *Server) activateDeactivateProperty(ctx *gin.Context) {
 	}
 
 	if err := ctx.ShouldBindJSON(&request); err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
-	activeProperty, err := server.store.ActivateDeactivateProperty(ctx, *request.Active, request.ExternalID)
+	action := "property.deactivate"
+	if *request.Active {
+		action = "property.activate"
+	}
+	activeProperty, err := server.store.ActivateDeactivateProperty(audited(ctx, action), *request.Active, request.ExternalID)
 	if err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		if errors.Is(err, sql.ErrNoRows) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
+			return
+		}
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
@@ -109,27 +123,52 @@ func (server *Server) activateDeactivateProperty(ctx *gin.Context) {
 		CreatedAt:  activeProperty.CreatedAt,
 	}
 
+	setETag(ctx, activeProperty.Version)
 	ctx.JSON(http.StatusOK, response)
 }
 
 func (server *Server) getAllProperty(ctx *gin.Context) {
 	var request struct {
-		Limit  int32 `json:"limit" binding:"required,gte=1"`
-		Offset int32 `json:"offset" binding:"min=0"`
+		Limit         int32     `form:"limit" binding:"required,gte=1"`
+		Offset        int32     `form:"offset" binding:"min=0"`
+		City          string    `form:"city" binding:"omitempty"`
+		State         string    `form:"state" binding:"omitempty"`
+		Country       string    `form:"country" binding:"omitempty"`
+		IsActive      *bool     `form:"is_active" binding:"omitempty"`
+		ExpiredBefore time.Time `form:"expired_before" binding:"omitempty"`
+		ExpiredAfter  time.Time `form:"expired_after" binding:"omitempty"`
+		Search        string    `form:"q" binding:"omitempty"`
+		Archived      bool      `form:"archived" binding:"omitempty"`
+		SortBy        string    `form:"sort_by" binding:"omitempty,oneof=name created_at"`
+		Order         string    `form:"order" binding:"omitempty,oneof=asc desc"`
 	}
-	if err := ctx.ShouldBindJSON(&request); err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
-	arg := db.LimitOffset{
-		Limit:  request.Limit,
-		Offset: request.Offset,
+	arg := db.ListPropertyParams{
+		LimitOffset: db.LimitOffset{
+			Limit:  request.Limit,
+			Offset: request.Offset,
+		},
+		City:          sql.NullString{String: request.City, Valid: len(strings.TrimSpace(request.City)) > 0},
+		State:         sql.NullString{String: request.State, Valid: len(strings.TrimSpace(request.State)) > 0},
+		Country:       sql.NullString{String: request.Country, Valid: len(strings.TrimSpace(request.Country)) > 0},
+		ExpiredBefore: sql.NullTime{Time: request.ExpiredBefore, Valid: !request.ExpiredBefore.IsZero()},
+		ExpiredAfter:  sql.NullTime{Time: request.ExpiredAfter, Valid: !request.ExpiredAfter.IsZero()},
+		Search:        sql.NullString{String: request.Search, Valid: len(strings.TrimSpace(request.Search)) > 0},
+		IsDeleted:     request.Archived,
+		SortBy:        request.SortBy,
+		SortDesc:      request.Order == "desc",
+	}
+	if request.IsActive != nil {
+		arg.IsActive = sql.NullBool{Bool: *request.IsActive, Valid: true}
 	}
 
 	allProperty, err := server.store.GetAllProperty(ctx, arg)
 	if err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
@@ -143,16 +182,21 @@ type propertyID struct {
 func (server *Server) getProperty(ctx *gin.Context) {
 	var request propertyID
 	if err := ctx.ShouldBindUri(&request); err != nil {
-		log.Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
 		return
 	}
 
 	property, err := server.store.GetProperty(ctx, request.ID)
 	if err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		if errors.Is(err, sql.ErrNoRows) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
+			return
+		}
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
+	setETag(ctx, property.Version)
 	ctx.JSON(http.StatusOK, property)
 }
 
@@ -170,7 +214,13 @@ func (server *Server) updateProperty(ctx *gin.Context) {
 	}
 
 	if err := ctx.ShouldBindJSON(&request); err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	version, err := ifMatchVersion(ctx)
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
@@ -208,33 +258,74 @@ func (server *Server) updateProperty(ctx *gin.Context) {
 			String: request.Email,
 			Valid:  len(strings.TrimSpace(request.Email)) > 0,
 		},
+		Version: version,
 	}
 
-	property, err := server.store.UpdateProperty(ctx, args)
+	property, err := server.store.UpdateProperty(audited(ctx, "property.update"), args)
 	if err != nil {
+		if errors.Is(err, db.ErrVersionMismatch) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrVersionMismatch).Error())
+			return
+		}
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Info().Msg(ctx.Error(ErrNoRow).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
 			return
 		}
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
+	setETag(ctx, property.Version)
 	ctx.JSON(http.StatusOK, property)
 }
 
 func (server *Server) deleteProperty(ctx *gin.Context) {
 	var request propertyID
 	if err := ctx.ShouldBindUri(&request); err != nil {
-		log.Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		return
+	}
+
+	version, err := ifMatchVersion(ctx)
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	property, err := server.store.DeleteProperty(audited(ctx, "property.delete"), request.ID, time.Now(), version)
+	if err != nil {
+		if errors.Is(err, db.ErrVersionMismatch) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrVersionMismatch).Error())
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
+			return
+		}
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, property)
+}
+
+func (server *Server) restoreProperty(ctx *gin.Context) {
+	var request propertyID
+	if err := ctx.ShouldBindUri(&request); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
 		return
 	}
 
-	property, err := server.store.DeleteProperty(ctx, request.ID)
+	property, err := server.store.RestoreProperty(audited(ctx, "property.restore"), request.ID)
 	if err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		if errors.Is(err, sql.ErrNoRows) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
+			return
+		}
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
+	setETag(ctx, property.Version)
 	ctx.JSON(http.StatusOK, property)
 }
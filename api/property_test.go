@@ -0,0 +1,429 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/newbri/posadamissportia/db/util"
+	"github.com/newbri/posadamissportia/token"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createRandomProperty() *db.Property {
+	return &db.Property{
+		InternalID: uuid.New(),
+		ExternalID: "PRO103",
+		Name:       util.RandomString(9),
+		Address:    util.RandomString(9),
+		State:      util.RandomString(9),
+		City:       util.RandomString(9),
+		Country:    util.RandomString(9),
+		PostalCode: util.RandomString(6),
+		Phone:      "+14388307862",
+		Email:      util.RandomEmail(),
+		IsActive:   true,
+		CreatedAt:  time.Now(),
+	}
+}
+
+func TestGetAllProperty(t *testing.T) {
+	adminUser := createRandomUser(db.RoleAdmin, false)
+	expectedProperty := createRandomProperty()
+
+	testCases := []struct {
+		name     string
+		env      string
+		query    string
+		mock     func(server *Server)
+		response func(recorder *httptest.ResponseRecorder)
+		auth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+	}{
+		{
+			name:  "OK",
+			env:   "test",
+			query: "limit=10&offset=0&city=Montreal&is_active=true&q=beach&sort_by=name&order=desc",
+			mock: func(server *Server) {
+				querier, ok := server.store.(*mocker.TestMocker)
+				require.True(t, ok)
+
+				querier.
+					On("GetUser", mock.Anything, mock.Anything).
+					Times(1).
+					Return(adminUser, nil)
+
+				expectedArg := db.ListPropertyParams{
+					LimitOffset: db.LimitOffset{Limit: 10, Offset: 0},
+					City:        sql.NullString{String: "Montreal", Valid: true},
+					IsActive:    sql.NullBool{Bool: true, Valid: true},
+					Search:      sql.NullString{String: "beach", Valid: true},
+					SortBy:      "name",
+					SortDesc:    true,
+				}
+				querier.
+					On("GetAllProperty", mock.Anything, expectedArg).
+					Times(1).
+					Return([]*db.Property{expectedProperty}, nil)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				data, err := io.ReadAll(recorder.Body)
+				require.NoError(t, err)
+
+				var response []*db.Property
+				err = json.Unmarshal(data, &response)
+				require.NoError(t, err)
+				require.Len(t, response, 1)
+				require.Equal(t, expectedProperty.ExternalID, response[0].ExternalID)
+				require.Equal(t, expectedProperty.Name, response[0].Name)
+			},
+			auth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t,
+					request,
+					tokenMaker,
+					authorizationTypeBearer,
+					adminUser.Username,
+					adminUser.Role,
+					time.Minute,
+				)
+			},
+		},
+		{
+			name:  "UnknownSortColumn",
+			env:   "test",
+			query: "limit=10&offset=0&sort_by=password",
+			mock: func(server *Server) {
+				querier, ok := server.store.(*mocker.TestMocker)
+				require.True(t, ok)
+
+				querier.
+					On("GetUser", mock.Anything, mock.Anything).
+					Times(1).
+					Return(adminUser, nil)
+
+				querier.
+					On("GetAllProperty", mock.Anything, mock.Anything).
+					Times(0)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+			auth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t,
+					request,
+					tokenMaker,
+					authorizationTypeBearer,
+					adminUser.Username,
+					adminUser.Role,
+					time.Minute,
+				)
+			},
+		},
+		{
+			name:  "InternalServerError",
+			env:   "test",
+			query: "limit=10&offset=0",
+			mock: func(server *Server) {
+				querier, ok := server.store.(*mocker.TestMocker)
+				require.True(t, ok)
+
+				querier.
+					On("GetUser", mock.Anything, mock.Anything).
+					Times(1).
+					Return(adminUser, nil)
+
+				querier.
+					On("GetAllProperty", mock.Anything, mock.Anything).
+					Times(1).
+					Return(nil, sql.ErrConnDone)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+			auth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t,
+					request,
+					tokenMaker,
+					authorizationTypeBearer,
+					adminUser.Username,
+					adminUser.Role,
+					time.Minute,
+				)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			server := newTestServer(querier, tc.env)
+			tc.mock(server)
+
+			url := "/api/v1/auth/admin/property/all?" + tc.query
+			request, err := http.NewRequest(http.MethodGet, url, nil)
+			require.NoError(t, err)
+
+			tc.auth(t, request, server.tokenMaker)
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			tc.response(recorder)
+		})
+	}
+}
+
+func TestDeleteAndRestoreProperty(t *testing.T) {
+	adminUser := createRandomUser(db.RoleAdmin, false)
+	property := createRandomProperty()
+
+	testCases := []struct {
+		name     string
+		method   string
+		url      string
+		mock     func(querier *mocker.TestMocker)
+		response func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "DeleteOK",
+			method: http.MethodDelete,
+			url:    "/api/v1/auth/admin/property/" + property.ExternalID,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("DeleteProperty", auditedAs("property.delete"), property.ExternalID, mock.Anything, sql.NullInt64{}).
+					Times(1).
+					Return(property, nil)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "DeleteNotFound",
+			method: http.MethodDelete,
+			url:    "/api/v1/auth/admin/property/" + property.ExternalID,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("DeleteProperty", mock.Anything, property.ExternalID, mock.Anything, sql.NullInt64{}).
+					Times(1).
+					Return(nil, sql.ErrNoRows)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "RestoreOK",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/admin/property/" + property.ExternalID + "/restore",
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("RestoreProperty", auditedAs("property.restore"), property.ExternalID).
+					Times(1).
+					Return(property, nil)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var response db.Property
+				err := json.Unmarshal(recorder.Body.Bytes(), &response)
+				require.NoError(t, err)
+				require.Equal(t, property.ExternalID, response.ExternalID)
+			},
+		},
+		{
+			name:   "RestoreNotArchived",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/admin/property/" + property.ExternalID + "/restore",
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("RestoreProperty", mock.Anything, property.ExternalID).
+					Times(1).
+					Return(nil, sql.ErrNoRows)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			server := newTestServer(querier, "test")
+			querier.
+				On("GetUser", mock.Anything, adminUser.Username).
+				Times(1).
+				Return(adminUser, nil)
+			tc.mock(querier)
+
+			request, err := http.NewRequest(tc.method, tc.url, nil)
+			require.NoError(t, err)
+			// any version, the version checks are covered by the If-Match cases
+			request.Header.Set(ifMatchHeaderKey, "*")
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, adminUser.Username, adminUser.Role, time.Minute)
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			tc.response(recorder)
+		})
+	}
+}
+
+func TestPropertyVersioning(t *testing.T) {
+	adminUser := createRandomUser(db.RoleAdmin, false)
+	property := createRandomProperty()
+	property.Version = 3
+
+	testCases := []struct {
+		name     string
+		method   string
+		url      string
+		ifMatch  string
+		body     string
+		mock     func(querier *mocker.TestMocker)
+		response func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "GetETag",
+			method: http.MethodGet,
+			url:    "/api/v1/auth/admin/property/" + property.ExternalID,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("GetProperty", mock.Anything, property.ExternalID).
+					Times(1).
+					Return(property, nil)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, `"3"`, recorder.Header().Get(etagHeaderKey))
+			},
+		},
+		{
+			name:    "UpdateIfMatch",
+			method:  http.MethodPut,
+			url:     "/api/v1/auth/admin/property",
+			ifMatch: `"3"`,
+			body:    `{"external_id":"` + property.ExternalID + `","name":"posada"}`,
+			mock: func(querier *mocker.TestMocker) {
+				updated := *property
+				updated.Version = 4
+				querier.
+					On("UpdateProperty", auditedAs("property.update"), mock.MatchedBy(func(arg db.UpdatePropertyParams) bool {
+						return arg.Version == sql.NullInt64{Int64: 3, Valid: true}
+					})).
+					Times(1).
+					Return(&updated, nil)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, `"4"`, recorder.Header().Get(etagHeaderKey))
+			},
+		},
+		{
+			name:    "UpdateStaleVersion",
+			method:  http.MethodPut,
+			url:     "/api/v1/auth/admin/property",
+			ifMatch: `W/"2"`,
+			body:    `{"external_id":"` + property.ExternalID + `","name":"posada"}`,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("UpdateProperty", mock.Anything, mock.MatchedBy(func(arg db.UpdatePropertyParams) bool {
+						return arg.Version == sql.NullInt64{Int64: 2, Valid: true}
+					})).
+					Times(1).
+					Return(nil, db.ErrVersionMismatch)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+			},
+		},
+		{
+			name:    "UpdateInvalidIfMatch",
+			method:  http.MethodPut,
+			url:     "/api/v1/auth/admin/property",
+			ifMatch: "three",
+			body:    `{"external_id":"` + property.ExternalID + `","name":"posada"}`,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("UpdateProperty", mock.Anything, mock.Anything).
+					Times(0)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "UpdateWithoutIfMatch",
+			method: http.MethodPut,
+			url:    "/api/v1/auth/admin/property",
+			body:   `{"external_id":"` + property.ExternalID + `","name":"posada"}`,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("UpdateProperty", mock.Anything, mock.Anything).
+					Times(0)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPreconditionRequired, recorder.Code)
+			},
+		},
+		{
+			name:   "DeleteWithoutIfMatch",
+			method: http.MethodDelete,
+			url:    "/api/v1/auth/admin/property/" + property.ExternalID,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("DeleteProperty", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+					Times(0)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPreconditionRequired, recorder.Code)
+			},
+		},
+		{
+			name:    "DeleteStaleVersion",
+			method:  http.MethodDelete,
+			url:     "/api/v1/auth/admin/property/" + property.ExternalID,
+			ifMatch: `"2"`,
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("DeleteProperty", mock.Anything, property.ExternalID, mock.Anything, sql.NullInt64{Int64: 2, Valid: true}).
+					Times(1).
+					Return(nil, db.ErrVersionMismatch)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			server := newTestServer(querier, "test")
+			querier.
+				On("GetUser", mock.Anything, adminUser.Username).
+				Times(1).
+				Return(adminUser, nil)
+			tc.mock(querier)
+
+			request, err := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			if len(tc.ifMatch) > 0 {
+				request.Header.Set(ifMatchHeaderKey, tc.ifMatch)
+			}
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, adminUser.Username, adminUser.Role, time.Minute)
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			tc.response(recorder)
+		})
+	}
+}
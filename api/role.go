@@ -6,7 +6,6 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/lib/pq"
 	"github.com/newbri/posadamissportia/db"
-	"github.com/rs/zerolog/log"
 	"net/http"
 	"strings"
 	"time"
@@ -19,7 +18,7 @@ func (server *Server) createRole(ctx *gin.Context) {
 	}
 
 	if err := ctx.ShouldBindJSON(&request); err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
@@ -28,17 +27,17 @@ func (server *Server) createRole(ctx *gin.Context) {
 		Description: request.Description,
 	}
 
-	role, err := server.store.CreateRole(ctx, arg)
+	role, err := server.store.CreateRole(audited(ctx, "role.create"), arg)
 	if err != nil {
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) {
 			switch pqErr.Code.Name() {
 			case "unique_violation":
-				log.Info().Msg(ctx.Error(ErrUniqueViolation).Error())
+				requestLogger(ctx).Info().Msg(ctx.Error(ErrUniqueViolation).Error())
 				return
 			}
 		}
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
@@ -50,31 +49,34 @@ func (server *Server) createRole(ctx *gin.Context) {
 		CreatedAt:   role.CreatedAt,
 	}
 
+	setETag(ctx, role.Version)
 	ctx.JSON(http.StatusOK, roleResp)
 }
 
 func (server *Server) getAllRole(ctx *gin.Context) {
 	var request struct {
-		Limit  int32 `json:"limit" binding:"required,gte=1"`
-		Offset int32 `json:"offset" binding:"min=0"`
+		Limit    int32 `json:"limit" binding:"required,gte=1"`
+		Offset   int32 `json:"offset" binding:"min=0"`
+		Archived bool  `json:"archived" binding:"omitempty"`
 	}
 	if err := ctx.ShouldBindJSON(&request); err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
 	arg := db.ListRoleParams{
-		Limit:  request.Limit,
-		Offset: request.Offset,
+		Limit:     request.Limit,
+		Offset:    request.Offset,
+		IsDeleted: request.Archived,
 	}
 
 	roles, err := server.store.GetAllRole(ctx, arg)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Info().Msg(ctx.Error(ErrNoRow).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
 			return
 		}
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
@@ -107,17 +109,17 @@ type roleResponse struct {
 func (server *Server) getRole(ctx *gin.Context) {
 	var request idURI
 	if err := ctx.ShouldBindUri(&request); err != nil {
-		log.Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
 		return
 	}
 
 	role, err := server.store.GetRole(ctx, request.ID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Info().Msg(ctx.Error(ErrNoRow).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
 			return
 		}
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
@@ -129,6 +131,7 @@ func (server *Server) getRole(ctx *gin.Context) {
 		CreatedAt:   role.CreatedAt,
 	}
 
+	setETag(ctx, role.Version)
 	ctx.JSON(http.StatusOK, roleResp)
 }
 
@@ -141,7 +144,13 @@ func (server *Server) updateRole(ctx *gin.Context) {
 
 	var request updateRoleRequest
 	if err := ctx.ShouldBindJSON(&request); err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	version, err := ifMatchVersion(ctx)
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
@@ -150,15 +159,20 @@ func (server *Server) updateRole(ctx *gin.Context) {
 		Name:        sql.NullString{String: request.Name, Valid: len(strings.TrimSpace(request.Name)) > 0},
 		Description: sql.NullString{String: request.Description, Valid: len(strings.TrimSpace(request.Description)) > 0},
 		UpdateAt:    time.Now(),
+		Version:     version,
 	}
 
-	role, err := server.store.UpdateRole(ctx, args)
+	role, err := server.store.UpdateRole(audited(ctx, "role.update"), args)
 	if err != nil {
+		if errors.Is(err, db.ErrVersionMismatch) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrVersionMismatch).Error())
+			return
+		}
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Info().Msg(ctx.Error(ErrNoRow).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
 			return
 		}
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
@@ -169,23 +183,65 @@ func (server *Server) updateRole(ctx *gin.Context) {
 		UpdatedAt:   role.UpdatedAt,
 		CreatedAt:   role.CreatedAt,
 	}
+	setETag(ctx, role.Version)
 	ctx.JSON(http.StatusOK, response)
 }
 
 func (server *Server) deleteRole(ctx *gin.Context) {
 	var request idURI
 	if err := ctx.ShouldBindUri(&request); err != nil {
-		log.Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		return
+	}
+
+	version, err := ifMatchVersion(ctx)
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	role, err := server.store.DeleteRole(audited(ctx, "role.delete"), request.ID, time.Now(), version)
+	if err != nil {
+		if errors.Is(err, db.ErrVersionMismatch) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrVersionMismatch).Error())
+			return
+		}
+		if errors.Is(err, db.ErrRoleInUse) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrRoleInUse).Error())
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
+			return
+		}
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	response := roleResponse{
+		ExternalID:  role.ExternalID,
+		Name:        role.Name,
+		Description: role.Description,
+		UpdatedAt:   role.UpdatedAt,
+		CreatedAt:   role.CreatedAt,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (server *Server) restoreRole(ctx *gin.Context) {
+	var request idURI
+	if err := ctx.ShouldBindUri(&request); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
 		return
 	}
 
-	role, err := server.store.DeleteRole(ctx, request.ID)
+	role, err := server.store.RestoreRole(audited(ctx, "role.restore"), request.ID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Info().Msg(ctx.Error(ErrNoRow).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
 			return
 		}
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
@@ -196,5 +252,6 @@ func (server *Server) deleteRole(ctx *gin.Context) {
 		UpdatedAt:   role.UpdatedAt,
 		CreatedAt:   role.CreatedAt,
 	}
+	setETag(ctx, role.Version)
 	ctx.JSON(http.StatusOK, response)
 }
@@ -48,7 +48,7 @@ func TestCreateRole(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("CreateRole", mock.Anything, mock.Anything).
+					On("CreateRole", auditedAs("role.create"), mock.Anything).
 					Times(1).
 					Return(expectedRole, nil)
 			},
@@ -135,7 +135,7 @@ func TestCreateRole(t *testing.T) {
 					Return(nil, &pq.Error{Code: "23505"})
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusForbidden, recorder.Code)
+				require.Equal(t, http.StatusConflict, recorder.Code)
 			},
 			auth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
 				addAuthorization(t,
@@ -594,7 +594,7 @@ func TestUpdateRole(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("UpdateRole", mock.Anything, mock.Anything).
+					On("UpdateRole", auditedAs("role.update"), mock.Anything).
 					Times(1).
 					Return(role, nil)
 			},
@@ -642,7 +642,7 @@ func TestUpdateRole(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("UpdateRole", mock.Anything, mock.Anything).
+					On("UpdateRole", auditedAs("role.update"), mock.Anything).
 					Times(1).
 					Return(role, nil)
 			},
@@ -791,6 +791,8 @@ func TestUpdateRole(t *testing.T) {
 			url := "/api/v1/auth/admin/role"
 			request, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
 			require.NoError(t, err)
+			// any version, the version checks are covered by the If-Match cases
+			request.Header.Set(ifMatchHeaderKey, "*")
 
 			tc.auth(t, request, server.tokenMaker)
 			recorder := httptest.NewRecorder()
@@ -825,7 +827,7 @@ func TestDeleteRole(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("DeleteRole", mock.Anything, mock.Anything).
+					On("DeleteRole", auditedAs("role.delete"), mock.Anything, mock.Anything, sql.NullInt64{}).
 					Times(1).
 					Return(role, nil)
 			},
@@ -870,7 +872,7 @@ func TestDeleteRole(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("DeleteRole", mock.Anything, mock.Anything).
+					On("DeleteRole", mock.Anything, mock.Anything, mock.Anything, sql.NullInt64{}).
 					Times(0)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
@@ -901,7 +903,7 @@ func TestDeleteRole(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("DeleteRole", mock.Anything, mock.Anything).
+					On("DeleteRole", mock.Anything, mock.Anything, mock.Anything, sql.NullInt64{}).
 					Times(1).
 					Return(nil, sql.ErrNoRows)
 			},
@@ -919,6 +921,38 @@ func TestDeleteRole(t *testing.T) {
 				)
 			},
 		},
+		{
+			name:       "RoleInUse",
+			externalID: role.ExternalID,
+			env:        "test",
+			mock: func(server *Server) {
+				querier, ok := server.store.(*mocker.TestMocker)
+				require.True(t, ok)
+
+				querier.
+					On("GetUser", mock.Anything, mock.Anything).
+					Times(1).
+					Return(adminUser, nil)
+
+				querier.
+					On("DeleteRole", mock.Anything, role.ExternalID, mock.Anything, sql.NullInt64{}).
+					Times(1).
+					Return(nil, db.ErrRoleInUse)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+			auth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t,
+					request,
+					tokenMaker,
+					authorizationTypeBearer,
+					adminUser.Username,
+					adminUser.Role,
+					time.Minute,
+				)
+			},
+		},
 		{
 			name:       "StatusInternalServerError",
 			externalID: role.ExternalID,
@@ -933,7 +967,7 @@ func TestDeleteRole(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("DeleteRole", mock.Anything, mock.Anything).
+					On("DeleteRole", mock.Anything, mock.Anything, mock.Anything, sql.NullInt64{}).
 					Times(1).
 					Return(nil, sql.ErrConnDone)
 			},
@@ -962,6 +996,8 @@ func TestDeleteRole(t *testing.T) {
 			url := fmt.Sprintf("/api/v1/auth/admin/role/%s", tc.externalID)
 			request, err := http.NewRequest(http.MethodDelete, url, nil)
 			require.NoError(t, err)
+			// any version, the version checks are covered by the If-Match cases
+			request.Header.Set(ifMatchHeaderKey, "*")
 
 			tc.auth(t, request, server.tokenMaker)
 			recorder := httptest.NewRecorder()
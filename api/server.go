@@ -1,39 +1,63 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/newbri/posadamissportia/configuration"
 	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/event"
 	"github.com/newbri/posadamissportia/token"
+	"net"
+	"net/http"
 )
 
 type Server struct {
 	config     configuration.Configuration
 	store      db.Store
 	router     *gin.Engine
+	httpServer *http.Server
 	tokenMaker token.Maker
+	broker     *event.Broker
 }
 
 func NewServer(store db.Store, tokenMaker token.Maker, config configuration.Configuration) *Server {
-	server := &Server{store: store, tokenMaker: tokenMaker, config: config}
+	server := &Server{
+		store:      store,
+		tokenMaker: tokenMaker,
+		config:     config,
+		broker:     event.NewBroker(config.GetConfig().EventStreamBuffer),
+	}
 
 	server.setupRouter()
+	server.setupHTTPServer()
 	return server
 }
 
 func (server *Server) setupRouter() {
-	router := gin.Default()
+	router := gin.New()
+	// lets the handlers pass the gin context to the store and keep the span of the request
+	router.ContextWithFallback = true
+	router.Use(tracingMiddleware(), requestLoggerMiddleware(), metricsMiddleware(), recoveryMiddleware())
 	router.Use(CORSMiddleware(server), errorHandlingMiddleware())
 
+	router.GET("/healthz", server.liveness)
+	router.GET("/readyz", server.readiness)
+	router.GET("/metrics", server.getMetrics)
+
 	apiGroup := router.Group("/api")
 	apiVersion := apiGroup.Group("/v1")
 	apiUsers := apiVersion.Group("/users")
 
-	apiUsers.POST("", server.createUser)
+	apiUsers.POST("", idempotencyMiddleware(server), server.createUser)
 	apiUsers.POST("/login", server.loginUser)
 	apiUsers.POST("/get_full_name", server.getUsername)
 
 	apiVersion.POST("/tokens/renew_access", server.renewAccessToken)
+	apiVersion.GET("/openapi.json", server.getOpenAPIDocument)
+	apiVersion.GET("/docs", server.getSwaggerUI)
+	apiVersion.GET("/docs/swagger-ui.css", server.getSwaggerUIStyle)
+	apiVersion.GET("/docs/swagger-ui-bundle.js", server.getSwaggerUIScript)
 
 	// auth group
 	authGroup := apiVersion.Group("/auth")
@@ -53,47 +77,98 @@ func (server *Server) setupRouter() {
 
 	// admin
 	adminGroup := authGroup.Group("/admin")
-	adminGroup.Use(pasetoAuthRole(server, db.RoleAdmin))
+	adminGroup.Use(pasetoAuthRole(server, db.RoleAdmin), auditMiddleware(server))
 	adminGroup.POST("/role", server.createRole)
 	adminGroup.GET("/role/:id", server.getRole)
 	adminGroup.POST("/role/all", server.getAllRole)
 	adminGroup.PUT("/role", server.updateRole)
 	adminGroup.DELETE("/role/:id", server.deleteRole)
+	adminGroup.POST("/role/:id/restore", server.restoreRole)
 	adminGroup.GET("/users/:username", server.getUser)
 	adminGroup.DELETE("/users/:username", server.deleteUser)
 	adminGroup.GET("/users/info", server.getUserInfo)
 	adminGroup.PUT("/users", server.updateUser)
-	adminGroup.POST("/users/all/customer", server.getAllCustomer)
-	adminGroup.POST("/property", server.createProperty)
+	adminGroup.GET("/users", server.searchUsers)
+	adminGroup.POST("/property", idempotencyMiddleware(server), server.createProperty)
 	adminGroup.POST("/property/activate", server.activateDeactivateProperty)
 	adminGroup.GET("/property/all", server.getAllProperty)
 	adminGroup.GET("/property/:id", server.getProperty)
 	adminGroup.PUT("/property", server.updateProperty)
 	adminGroup.DELETE("/property/:id", server.deleteProperty)
+	adminGroup.POST("/property/:id/restore", server.restoreProperty)
+	adminGroup.POST("/webhooks", server.createWebhook)
+	adminGroup.GET("/webhooks", server.listWebhooks)
+	adminGroup.GET("/webhooks/:id", server.getWebhook)
+	adminGroup.PUT("/webhooks/:id", server.updateWebhook)
+	adminGroup.DELETE("/webhooks/:id", server.deleteWebhook)
+	adminGroup.GET("/webhooks/:id/deliveries", server.listWebhookDeliveries)
+	adminGroup.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", server.redeliverWebhookDelivery)
+	adminGroup.GET("/events", server.streamEvents)
 
 	// su
 	suGroup := authGroup.Group("/su")
-	suGroup.Use(pasetoAuthRole(server, db.RoleSuperUser))
+	suGroup.Use(pasetoAuthRole(server, db.RoleSuperUser), auditMiddleware(server))
 	suGroup.POST("/role", server.createRole)
 	suGroup.GET("/role/:id", server.getRole)
 	suGroup.POST("/role/all", server.getAllRole)
 	suGroup.PUT("/role", server.updateRole)
 	suGroup.DELETE("/role/:id", server.deleteRole)
+	suGroup.POST("/role/:id/restore", server.restoreRole)
 	suGroup.GET("/users/:username", server.getUser)
 	suGroup.DELETE("/users/:username", server.deleteUser)
-	suGroup.POST("/users/all/customer", server.getAllCustomer)
-	suGroup.POST("/users/all/admin", server.getAllAdmin)
+	suGroup.GET("/users", server.searchUsers)
+	suGroup.GET("/deleted-users", server.getDeletedUsers)
+	suGroup.POST("/deleted-users/:username/restore", server.restoreUser)
+	suGroup.POST("/deleted-users/purge", server.purgeDeletedUsers)
+	suGroup.GET("/audit", server.getAuditLog)
+	suGroup.GET("/events", server.streamEvents)
 	suGroup.GET("/users/info", server.getUserInfo)
 	suGroup.PUT("/users", server.updateUser)
 
 	server.router = router
 }
 
-// Start runs the HTTP server on a specific address.
+func (server *Server) setupHTTPServer() {
+	config := server.config.GetConfig()
+	server.httpServer = &http.Server{
+		Handler:           server.router,
+		ReadTimeout:       config.HTTPReadTimeout,
+		ReadHeaderTimeout: config.HTTPReadHeaderTimeout,
+		WriteTimeout:      config.HTTPWriteTimeout,
+		IdleTimeout:       config.HTTPIdleTimeout,
+		MaxHeaderBytes:    config.HTTPMaxHeaderBytes,
+	}
+	// the event streams never go idle on their own, so they are ended for Shutdown to complete
+	server.httpServer.RegisterOnShutdown(server.broker.Close)
+}
+
+// Start runs the HTTP server on a specific address until Shutdown is called. The server speaks
+// TLS when both a certificate and a key file are configured.
 func (server *Server) Start(address string) error {
-	return server.router.Run(address)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return server.serve(listener)
+}
+
+func (server *Server) serve(listener net.Listener) error {
+	config := server.config.GetConfig()
+
+	var err error
+	if len(config.TLSCertFile) > 0 && len(config.TLSKeyFile) > 0 {
+		err = server.httpServer.ServeTLS(listener, config.TLSCertFile, config.TLSKeyFile)
+	} else {
+		err = server.httpServer.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
 }
 
-func errorResponse(err error) gin.H {
-	return gin.H{"error": err.Error()}
+// Shutdown stops accepting connections and waits for the requests in flight to complete, or
+// for ctx to be done.
+func (server *Server) Shutdown(ctx context.Context) error {
+	return server.httpServer.Shutdown(ctx)
 }
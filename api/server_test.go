@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/newbri/posadamissportia/token"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startServer serves server on a random local port and returns its address along with the
+// outcome of the serve call.
+func startServer(t *testing.T, server *Server) (string, <-chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.serve(listener)
+	}()
+	return listener.Addr().String(), served
+}
+
+func TestServerShutdown(t *testing.T) {
+	superUser := createRandomUser(db.RoleSuperUser, false)
+	querier := new(mocker.TestMocker)
+	server := newTestServer(querier, "test")
+
+	querier.
+		On("GetUser", mock.Anything, superUser.Username).
+		Times(1).
+		Return(superUser, nil)
+
+	address, served := startServer(t, server)
+
+	request, err := http.NewRequest(http.MethodGet, "http://"+address+"/api/v1/auth/su/events", nil)
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, superUser.Username, superUser.Role, time.Minute)
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	// the open event stream must not hold the shutdown back
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, server.Shutdown(ctx))
+
+	_, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.NoError(t, <-served)
+
+	_, err = http.Get("http://" + address + "/api/v1/openapi.json")
+	require.Error(t, err)
+}
+
+func TestServerTLS(t *testing.T) {
+	certFile, keyFile, pool := createCertificate(t)
+
+	config := createConfiguration()
+	config.TLSCertFile = certFile
+	config.TLSKeyFile = keyFile
+
+	querier := new(mocker.TestMocker)
+	querier.On("GetConfig").Return(config)
+	maker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
+	require.NoError(t, err)
+	server := newServerWithConfigurator(querier, maker, querier)
+
+	address, served := startServer(t, server)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	response, err := client.Get("https://" + address + "/api/v1/openapi.json")
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.NotNil(t, response.TLS)
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	require.NoError(t, <-served)
+}
+
+// createCertificate writes a self-signed certificate for 127.0.0.1 and returns its files
+// along with a pool trusting it.
+func createCertificate(t *testing.T) (string, string, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "posada test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+	return certFile, keyFile, pool
+}
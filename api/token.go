@@ -4,7 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog/log"
+	"github.com/newbri/posadamissportia/metrics"
 	"net/http"
 	"time"
 )
@@ -15,53 +15,55 @@ func (server *Server) renewAccessToken(ctx *gin.Context) {
 	}
 
 	if err := ctx.ShouldBindJSON(&request); err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
-	refreshPayload, err := server.tokenMaker.VerifyToken(request.RefreshToken)
+	refreshPayload, err := server.verifyToken(ctx, request.RefreshToken)
 	if err != nil {
-		log.Info().Msg(ctx.Error(ErrVerifyToken).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrVerifyToken).Error())
 		return
 	}
 
 	session, err := server.store.GetSession(ctx, refreshPayload.ID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Info().Msg(ctx.Error(ErrNoRow).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
 			return
 		}
-		log.Info().Msg(ctx.Error(ErrSession).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrSession).Error())
 		return
 	}
 
 	if session.IsBlocked {
-		log.Info().Msg(ctx.Error(ErrBlockedSession).Error())
+		metrics.RefusedRenewals.Inc()
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrBlockedSession).Error())
 		return
 	}
 
 	if session.Username != refreshPayload.Username {
-		log.Info().Msg(ctx.Error(ErrWrongUserSession).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrWrongUserSession).Error())
 		return
 	}
 
 	if session.RefreshToken != request.RefreshToken {
-		log.Info().Msg(ctx.Error(ErrWrongSessionToken).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrWrongSessionToken).Error())
 		return
 	}
 
 	if session.ExpiredAt.Before(time.Now()) {
-		log.Info().Msg(ctx.Error(ErrExpiredSession).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrExpiredSession).Error())
 		return
 	}
 
-	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+	accessToken, accessPayload, err := server.createToken(
+		ctx,
 		refreshPayload.Username,
 		refreshPayload.Role,
 		server.config.GetConfig().AccessTokenDuration,
 	)
 	if err != nil {
-		log.Info().Msg(ctx.Error(ErrTokenCreation).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrTokenCreation).Error())
 		return
 	}
 
@@ -73,5 +75,6 @@ func (server *Server) renewAccessToken(ctx *gin.Context) {
 	response.AccessToken = accessToken
 	response.AccessTokenExpiresAt = accessPayload.ExpiredAt
 
+	metrics.TokenRenewals.Inc()
 	ctx.JSON(http.StatusOK, response)
 }
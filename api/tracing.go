@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/token"
+	"github.com/newbri/posadamissportia/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"slices"
+	"time"
+)
+
+var tracer = otel.Tracer("github.com/newbri/posadamissportia/api")
+
+// tracingMiddleware opens a span for every request, continuing the trace of the caller when
+// it sent a traceparent header. The paths polled by the orchestrator and the scraper would
+// only add noise and are not traced.
+func tracingMiddleware() gin.HandlerFunc {
+	return otelgin.Middleware(tracing.ServiceName, otelgin.WithFilter(func(request *http.Request) bool {
+		return !slices.Contains(unloggedPaths, request.URL.Path)
+	}))
+}
+
+// createToken creates a token within a span of the request, as signing it is part of the
+// latency of a login.
+func (server *Server) createToken(ctx context.Context, username string, role *db.Role, duration time.Duration) (string, *token.Payload, error) {
+	_, span := tracer.Start(ctx, "token.CreateToken")
+	tokenString, payload, err := server.tokenMaker.CreateToken(username, role, duration)
+	endSpan(span, err)
+	return tokenString, payload, err
+}
+
+// verifyToken verifies a token within a span of the request.
+func (server *Server) verifyToken(ctx context.Context, tokenString string) (*token.Payload, error) {
+	_, span := tracer.Start(ctx, "token.VerifyToken")
+	payload, err := server.tokenMaker.VerifyToken(tokenString)
+	endSpan(span, err)
+	return payload, err
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	spanExporter     = tracetest.NewInMemoryExporter()
+	installProvider  sync.Once
+	remoteTraceID, _ = trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	remoteSpanID, _  = trace.SpanIDFromHex("00f067aa0ba902b7")
+)
+
+// recordSpans sends the spans of the test to an in-memory exporter. The global provider can
+// only be installed once, as the tracers obtained before stay bound to the first one.
+func recordSpans() *tracetest.InMemoryExporter {
+	installProvider.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	spanExporter.Reset()
+	return spanExporter
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	require.Failf(t, "span not found", "no span named %s", name)
+	return tracetest.SpanStub{}
+}
+
+func TestTracing(t *testing.T) {
+	exporter := recordSpans()
+	user := createRandomUser(db.RoleCustomer, false)
+
+	querier := new(mocker.TestMocker)
+	server := newTestServer(querier, "test")
+
+	// the store is called with the context of the request span
+	querier.
+		On("GetUser", mock.MatchedBy(func(ctx context.Context) bool {
+			return trace.SpanContextFromContext(ctx).TraceID() == remoteTraceID
+		}), user.Username).
+		Return(user, nil)
+
+	request, err := http.NewRequest(http.MethodGet, "/api/v1/auth/customer/users/info", nil)
+	require.NoError(t, err)
+	request.Header.Set("traceparent", "00-"+remoteTraceID.String()+"-"+remoteSpanID.String()+"-01")
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, user.Role, time.Minute)
+
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	querier.AssertExpectations(t)
+
+	spans := exporter.GetSpans()
+	requestSpan := findSpan(t, spans, "/api/v1/auth/customer/users/info")
+	require.Equal(t, remoteTraceID, requestSpan.SpanContext.TraceID())
+	require.Equal(t, remoteSpanID, requestSpan.Parent.SpanID())
+	require.Equal(t, trace.SpanKindServer, requestSpan.SpanKind)
+
+	verifySpan := findSpan(t, spans, "token.VerifyToken")
+	require.Equal(t, requestSpan.SpanContext.SpanID(), verifySpan.Parent.SpanID())
+
+	exporter.Reset()
+	request, err = http.NewRequest(http.MethodGet, "/healthz", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(httptest.NewRecorder(), request)
+	require.Empty(t, exporter.GetSpans())
+}
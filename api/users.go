@@ -1,7 +1,6 @@
 package api
 
 import (
-	"context"
 	"database/sql"
 	"errors"
 	"github.com/gin-gonic/gin"
@@ -9,9 +8,10 @@ import (
 	"github.com/lib/pq"
 	"github.com/newbri/posadamissportia/db"
 	"github.com/newbri/posadamissportia/db/util"
+	"github.com/newbri/posadamissportia/metrics"
 	"github.com/newbri/posadamissportia/token"
-	"github.com/rs/zerolog/log"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 )
@@ -19,26 +19,30 @@ import (
 func (server *Server) createUser(ctx *gin.Context) {
 	var request struct {
 		Username string `json:"username" binding:"required,alphanum"`
-		Password string `json:"password" binding:"required,min=6"`
+		Password string `json:"password" binding:"required,password"`
 		FullName string `json:"full_name" binding:"required"`
 		Email    string `json:"email" binding:"required,email"`
 	}
 
 	if err := ctx.ShouldBindJSON(&request); err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
 	hashedPassword, err := util.HashPassword(request.Password)
 	if err != nil {
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
 	defaultRole := server.config.GetConfig().DefaultRole
 	role, err := server.store.GetRoleByName(ctx, defaultRole)
 	if err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		if errors.Is(err, sql.ErrNoRows) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRole).Error())
+			return
+		}
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
@@ -56,15 +60,16 @@ func (server *Server) createUser(ctx *gin.Context) {
 		if errors.As(err, &pqErr) {
 			switch pqErr.Code.Name() {
 			case "unique_violation":
-				log.Info().Msg(ctx.Error(ErrUniqueViolation).Error())
+				requestLogger(ctx).Info().Msg(ctx.Error(ErrUniqueViolation).Error())
 				return
 			}
 		}
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
 	response := newUserResponse(user)
+	setETag(ctx, user.Version)
 	ctx.JSON(http.StatusOK, response)
 }
 
@@ -75,39 +80,47 @@ type usernameURI struct {
 func (server *Server) getUser(ctx *gin.Context) {
 	var request usernameURI
 	if err := ctx.ShouldBindUri(&request); err != nil {
-		log.Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
 		return
 	}
 
 	user, err := server.store.GetUser(ctx, request.Username)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Info().Msg(ctx.Error(ErrNoRow).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
 			return
 		}
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
 	response := newUserResponse(user)
+	setETag(ctx, user.Version)
 	ctx.JSON(http.StatusOK, response)
 }
 
 func (server *Server) updateUser(ctx *gin.Context) {
 	var request struct {
 		Username string `json:"username" binding:"required,alphanum"`
-		Password string `json:"password" binding:"omitempty,min=6"`
+		Password string `json:"password" binding:"omitempty,password"`
 		FullName string `json:"full_name" binding:"omitempty"`
 		Email    string `json:"email" binding:"omitempty,email"`
 	}
 
 	if err := ctx.ShouldBindJSON(&request); err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	version, err := ifMatchVersion(ctx)
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
 	args := db.UpdateUserParams{
 		Username: request.Username,
+		Version:  version,
 		FullName: sql.NullString{
 			String: request.FullName,
 			Valid:  len(strings.TrimSpace(request.FullName)) > 0,
@@ -121,7 +134,7 @@ func (server *Server) updateUser(ctx *gin.Context) {
 	if len(strings.TrimSpace(request.Password)) > 0 {
 		hashedPassword, err := util.HashPassword(request.Password)
 		if err != nil {
-			log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 			return
 		}
 
@@ -136,17 +149,22 @@ func (server *Server) updateUser(ctx *gin.Context) {
 		}
 	}
 
-	user, err := server.store.UpdateUser(ctx, args)
+	user, err := server.store.UpdateUser(audited(ctx, "user.update"), args)
 	if err != nil {
+		if errors.Is(err, db.ErrVersionMismatch) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrVersionMismatch).Error())
+			return
+		}
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Info().Msg(ctx.Error(ErrNoRow).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
 			return
 		}
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
 	response := newUserResponse(user)
+	setETag(ctx, user.Version)
 	ctx.JSON(http.StatusOK, response)
 }
 
@@ -173,18 +191,28 @@ func newUserResponse(user *db.User) userResponse {
 func (server *Server) deleteUser(ctx *gin.Context) {
 	var request usernameURI
 	if err := ctx.ShouldBindUri(&request); err != nil {
-		log.Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		return
+	}
+
+	version, err := ifMatchVersion(ctx)
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
 	deletedAt := time.Now()
-	user, err := server.store.DeleteUser(ctx, request.Username, deletedAt)
+	user, err := server.store.DeleteUser(audited(ctx, "user.delete"), request.Username, deletedAt, version)
 	if err != nil {
+		if errors.Is(err, db.ErrVersionMismatch) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrVersionMismatch).Error())
+			return
+		}
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Info().Msg(ctx.Error(ErrNoRow).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
 			return
 		}
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
@@ -195,48 +223,51 @@ func (server *Server) deleteUser(ctx *gin.Context) {
 func (server *Server) loginUser(ctx *gin.Context) {
 	var request struct {
 		Username string `json:"username" binding:"email,required"`
-		Password string `json:"password" binding:"required,min=6"`
+		Password string `json:"password" binding:"required,password"`
 	}
 
 	if err := ctx.ShouldBindJSON(&request); err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
 	user, err := server.store.GetUserByEmail(ctx, request.Username)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Info().Msg(ctx.Error(ErrNoRow).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
 			return
 		}
 
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
 	err = util.CheckPassword(request.Password, user.HashedPassword)
 	if err != nil {
-		log.Info().Msg(ctx.Error(ErrPasswordMistMach).Error())
+		metrics.FailedPasswords.Inc()
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrPasswordMistMach).Error())
 		return
 	}
 
-	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+	accessToken, accessPayload, err := server.createToken(
+		ctx,
 		user.Username,
 		user.Role,
 		server.config.GetConfig().AccessTokenDuration,
 	)
 	if err != nil {
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
-	refreshToken, refreshPayload, err := server.tokenMaker.CreateToken(
+	refreshToken, refreshPayload, err := server.createToken(
+		ctx,
 		user.Username,
 		user.Role,
 		server.config.GetConfig().RefreshTokenDuration,
 	)
 	if err != nil {
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
@@ -251,7 +282,7 @@ func (server *Server) loginUser(ctx *gin.Context) {
 		CreatedAt:    time.Now(),
 	})
 	if err != nil {
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
@@ -271,6 +302,7 @@ func (server *Server) loginUser(ctx *gin.Context) {
 	response.RefreshTokenExpiresAt = refreshPayload.ExpiredAt
 	response.User = newUserResponse(user)
 
+	metrics.Logins.Inc()
 	ctx.JSON(http.StatusOK, response)
 }
 
@@ -281,58 +313,93 @@ func (server *Server) getUserInfo(ctx *gin.Context) {
 	user, err := server.store.GetUser(ctx, payload.Username)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Info().Msg(ctx.Error(ErrNoRow).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
 			return
 		}
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
 	response := newUserResponse(user)
+	setETag(ctx, user.Version)
 	ctx.JSON(http.StatusOK, response)
 }
 
-func (server *Server) getAllCustomer(ctx *gin.Context) {
-	getAllUser(ctx, server.store.GetAllCustomer)
+// searchableRoles restricts the roles whose users a caller may search for. Callers whose
+// role is not listed may search every role.
+var searchableRoles = map[string][]string{
+	db.RoleAdmin: {db.RoleCustomer, db.RoleVisitor},
 }
 
-func (server *Server) getAllAdmin(ctx *gin.Context) {
-	getAllUser(ctx, server.store.GetAllAdmin)
+type searchUsersResponse struct {
+	Users  []userResponse `json:"users"`
+	Total  int64          `json:"total"`
+	Limit  int32          `json:"limit"`
+	Offset int32          `json:"offset"`
 }
 
-type getAllFunc = func(ctx context.Context, arg db.ListUsersParams) ([]*db.User, error)
-
-func getAllUser(ctx *gin.Context, fun getAllFunc) {
+func (server *Server) searchUsers(ctx *gin.Context) {
 	var request struct {
-		Limit  int32 `json:"limit" binding:"required,gte=1"`
-		Offset int32 `json:"offset" binding:"min=0"`
-	}
-	if err := ctx.ShouldBindJSON(&request); err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		Limit         int32     `form:"limit" binding:"required,gte=1"`
+		Offset        int32     `form:"offset" binding:"min=0"`
+		Role          string    `form:"role" binding:"omitempty,alphanum"`
+		Query         string    `form:"q" binding:"omitempty"`
+		CreatedAfter  time.Time `form:"created_after" binding:"omitempty"`
+		CreatedBefore time.Time `form:"created_before" binding:"omitempty"`
+		Deleted       bool      `form:"deleted" binding:"omitempty"`
+		PropertyID    string    `form:"property_id" binding:"omitempty,alphanum"`
+		SortBy        string    `form:"sort_by" binding:"omitempty,oneof=username email full_name created_at"`
+		Order         string    `form:"order" binding:"omitempty,oneof=asc desc"`
+	}
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
-	arg := db.ListUsersParams{
-		Limit:  request.Limit,
-		Offset: request.Offset,
-	}
+	data, _ := ctx.Get(server.config.GetConfig().AuthorizationPayloadKey)
+	payload, _ := data.(*token.Payload)
 
-	users, err := fun(ctx, arg)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			log.Info().Msg(ctx.Error(ErrNoRow).Error())
+	roles, restricted := searchableRoles[payload.Role.Name]
+	if len(request.Role) > 0 {
+		if restricted && !slices.Contains(roles, request.Role) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrRoleNotAllowed).Error())
 			return
 		}
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
-		return
+		roles = []string{request.Role}
 	}
 
-	if users == nil {
-		log.Info().Msg(ctx.Error(ErrNoCustomerFound).Error())
+	arg := db.SearchUsersParams{
+		LimitOffset: db.LimitOffset{
+			Limit:  request.Limit,
+			Offset: request.Offset,
+		},
+		Roles:         roles,
+		Query:         sql.NullString{String: request.Query, Valid: len(strings.TrimSpace(request.Query)) > 0},
+		CreatedAfter:  sql.NullTime{Time: request.CreatedAfter, Valid: !request.CreatedAfter.IsZero()},
+		CreatedBefore: sql.NullTime{Time: request.CreatedBefore, Valid: !request.CreatedBefore.IsZero()},
+		IsDeleted:     request.Deleted,
+		PropertyID:    sql.NullString{String: request.PropertyID, Valid: len(request.PropertyID) > 0},
+		SortBy:        request.SortBy,
+		SortDesc:      request.Order == "desc",
+	}
+
+	result, err := server.store.SearchUsers(ctx, arg)
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
-	ctx.JSON(http.StatusOK, users)
+	response := searchUsersResponse{
+		Users:  make([]userResponse, 0, len(result.Users)),
+		Total:  result.Total,
+		Limit:  request.Limit,
+		Offset: request.Offset,
+	}
+	for _, user := range result.Users {
+		response.Users = append(response.Users, newUserResponse(user))
+	}
+
+	ctx.JSON(http.StatusOK, response)
 }
 
 type userFullNameResponse struct {
@@ -345,18 +412,18 @@ func (server *Server) getUsername(ctx *gin.Context) {
 	}
 
 	if err := ctx.ShouldBindJSON(&request); err != nil {
-		log.Info().Msg(ctx.Error(err).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
 		return
 	}
 
 	user, err := server.store.GetUserByEmail(ctx, request.Email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Info().Msg(ctx.Error(ErrNoRow).Error())
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
 			return
 		}
 
-		log.Info().Msg(ctx.Error(ErrInternalServer).Error())
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
 		return
 	}
 
@@ -366,3 +433,83 @@ func (server *Server) getUsername(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, response)
 }
+
+func (server *Server) getDeletedUsers(ctx *gin.Context) {
+	var request struct {
+		Limit  int32 `form:"limit" binding:"required,gte=1"`
+		Offset int32 `form:"offset" binding:"min=0"`
+	}
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	arg := db.SearchUsersParams{
+		LimitOffset: db.LimitOffset{
+			Limit:  request.Limit,
+			Offset: request.Offset,
+		},
+		IsDeleted: true,
+		SortBy:    "created_at",
+	}
+
+	result, err := server.store.SearchUsers(ctx, arg)
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	response := searchUsersResponse{
+		Users:  make([]userResponse, 0, len(result.Users)),
+		Total:  result.Total,
+		Limit:  request.Limit,
+		Offset: request.Offset,
+	}
+	for _, user := range result.Users {
+		response.Users = append(response.Users, newUserResponse(user))
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (server *Server) restoreUser(ctx *gin.Context) {
+	var request usernameURI
+	if err := ctx.ShouldBindUri(&request); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		return
+	}
+
+	user, err := server.store.RestoreUser(audited(ctx, "user.restore"), request.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
+			return
+		}
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	response := newUserResponse(user)
+	setETag(ctx, user.Version)
+	ctx.JSON(http.StatusOK, response)
+}
+
+type purgeUsersResponse struct {
+	Purged        int64     `json:"purged"`
+	DeletedBefore time.Time `json:"deleted_before"`
+}
+
+func (server *Server) purgeDeletedUsers(ctx *gin.Context) {
+	deletedBefore := time.Now().Add(-server.config.GetConfig().DeletedUserRetention)
+	purged, err := server.store.PurgeDeletedUsers(audited(ctx, "user.purge"), deletedBefore)
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	response := purgeUsersResponse{
+		Purged:        purged,
+		DeletedBefore: deletedBefore,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
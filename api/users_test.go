@@ -209,7 +209,7 @@ func TestCreateUser(t *testing.T) {
 					Return(nil, &pq.Error{Code: "23505"})
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusForbidden, recorder.Code)
+				require.Equal(t, http.StatusConflict, recorder.Code)
 			},
 		},
 		{
@@ -253,10 +253,10 @@ func TestCreateUser(t *testing.T) {
 
 				querier.
 					On("GetRoleByName", mock.Anything, mock.Anything).
-					Return(nil, fmt.Errorf("error exist"))
+					Return(nil, sql.ErrNoRows)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Equal(t, http.StatusNotFound, recorder.Code)
 			},
 		},
 	}
@@ -741,6 +741,8 @@ func TestUpdateUser(t *testing.T) {
 			url := "/api/v1/auth/customer/users"
 			request, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
 			require.NoError(t, err)
+			// any version, the version checks are covered by the If-Match cases
+			request.Header.Set(ifMatchHeaderKey, "*")
 
 			tc.auth(t, request, server.tokenMaker)
 			recorder := httptest.NewRecorder()
@@ -775,7 +777,7 @@ func TestDeleteUser(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("DeleteUser", mock.Anything, mock.Anything, mock.Anything).
+					On("DeleteUser", auditedAs("user.delete"), mock.Anything, mock.Anything, sql.NullInt64{}).
 					Times(1).
 					Return(adminUser, nil)
 			},
@@ -820,7 +822,7 @@ func TestDeleteUser(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("DeleteUser", mock.Anything, mock.Anything, mock.Anything).
+					On("DeleteUser", mock.Anything, mock.Anything, mock.Anything, sql.NullInt64{}).
 					Times(0)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
@@ -851,7 +853,7 @@ func TestDeleteUser(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("DeleteUser", mock.Anything, mock.Anything, mock.Anything).
+					On("DeleteUser", mock.Anything, mock.Anything, mock.Anything, sql.NullInt64{}).
 					Times(1).
 					Return(nil, sql.ErrNoRows)
 			},
@@ -883,7 +885,7 @@ func TestDeleteUser(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("DeleteUser", mock.Anything, mock.Anything, mock.Anything).
+					On("DeleteUser", mock.Anything, mock.Anything, mock.Anything, sql.NullInt64{}).
 					Times(1).
 					Return(nil, sql.ErrConnDone)
 			},
@@ -912,6 +914,8 @@ func TestDeleteUser(t *testing.T) {
 			url := fmt.Sprintf("/api/v1/auth/admin/users/%s", tc.username)
 			request, err := http.NewRequest(http.MethodDelete, url, nil)
 			require.NoError(t, err)
+			// any version, the version checks are covered by the If-Match cases
+			request.Header.Set(ifMatchHeaderKey, "*")
 
 			tc.auth(t, request, server.tokenMaker)
 			recorder := httptest.NewRecorder()
@@ -1370,8 +1374,9 @@ func TestUserInfo(t *testing.T) {
 	}
 }
 
-func TestGetAllCustomer(t *testing.T) {
+func TestSearchUsers(t *testing.T) {
 	adminUser := createRandomUser(db.RoleAdmin, false)
+	superUser := createRandomUser(db.RoleSuperUser, false)
 	var allCustomer []*db.User
 	for i := 0; i < 6; i++ {
 		allCustomer = append(allCustomer, createRandomUser(db.RoleCustomer, false))
@@ -1380,7 +1385,7 @@ func TestGetAllCustomer(t *testing.T) {
 	testCases := []struct {
 		name     string
 		env      string
-		body     gin.H
+		url      string
 		mock     func(server *Server)
 		response func(recorder *httptest.ResponseRecorder)
 		auth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
@@ -1388,10 +1393,7 @@ func TestGetAllCustomer(t *testing.T) {
 		{
 			name: "OK",
 			env:  "test",
-			body: gin.H{
-				"offset": 0,
-				"limit":  6,
-			},
+			url:  "/api/v1/auth/admin/users?limit=6&offset=0&q=doe&sort_by=email&order=desc",
 			mock: func(server *Server) {
 				querier, ok := server.store.(*mocker.TestMocker)
 				require.True(t, ok)
@@ -1401,10 +1403,17 @@ func TestGetAllCustomer(t *testing.T) {
 					Times(1).
 					Return(adminUser, nil)
 
+				expectedArg := db.SearchUsersParams{
+					LimitOffset: db.LimitOffset{Limit: 6, Offset: 0},
+					Roles:       []string{db.RoleCustomer, db.RoleVisitor},
+					Query:       sql.NullString{String: "doe", Valid: true},
+					SortBy:      "email",
+					SortDesc:    true,
+				}
 				querier.
-					On("GetAllCustomer", mock.Anything, mock.Anything).
+					On("SearchUsers", mock.Anything, expectedArg).
 					Times(1).
-					Return(allCustomer, nil)
+					Return(&db.SearchUsersResult{Users: allCustomer, Total: 42}, nil)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -1412,24 +1421,18 @@ func TestGetAllCustomer(t *testing.T) {
 				data, err := io.ReadAll(recorder.Body)
 				require.NoError(t, err)
 
-				var request []*userResponse
-				err = json.Unmarshal(data, &request)
+				var response searchUsersResponse
+				err = json.Unmarshal(data, &response)
 				require.NoError(t, err)
 
+				require.Equal(t, int64(42), response.Total)
+				require.Equal(t, int32(6), response.Limit)
+				require.Len(t, response.Users, len(allCustomer))
 				for i, user := range allCustomer {
-					expectedUser := &userResponse{
-						Username:          user.Username,
-						FullName:          user.FullName,
-						Email:             user.Email,
-						PasswordChangedAt: user.PasswordChangedAt,
-						CreatedAt:         user.CreatedAt,
-						Role:              user.Role,
-					}
-					require.Equal(t, expectedUser.Username, request[i].Username)
-					require.Equal(t, expectedUser.FullName, request[i].FullName)
-					require.Equal(t, expectedUser.Email, request[i].Email)
-					require.Equal(t, expectedUser.PasswordChangedAt.Unix(), request[i].PasswordChangedAt.Unix())
-					require.Equal(t, expectedUser.CreatedAt.Unix(), request[i].CreatedAt.Unix())
+					require.Equal(t, user.Username, response.Users[i].Username)
+					require.Equal(t, user.FullName, response.Users[i].FullName)
+					require.Equal(t, user.Email, response.Users[i].Email)
+					require.Equal(t, user.CreatedAt.Unix(), response.Users[i].CreatedAt.Unix())
 				}
 			},
 			auth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
@@ -1444,12 +1447,9 @@ func TestGetAllCustomer(t *testing.T) {
 			},
 		},
 		{
-			name: "BadRequest",
+			name: "SuperUserSearchesAdmin",
 			env:  "test",
-			body: gin.H{
-				"offset": 0,
-				"limit1": 6,
-			},
+			url:  "/api/v1/auth/su/users?limit=6&offset=0&role=admin",
 			mock: func(server *Server) {
 				querier, ok := server.store.(*mocker.TestMocker)
 				require.True(t, ok)
@@ -1457,33 +1457,35 @@ func TestGetAllCustomer(t *testing.T) {
 				querier.
 					On("GetUser", mock.Anything, mock.Anything).
 					Times(1).
-					Return(adminUser, nil)
+					Return(superUser, nil)
 
+				expectedArg := db.SearchUsersParams{
+					LimitOffset: db.LimitOffset{Limit: 6, Offset: 0},
+					Roles:       []string{db.RoleAdmin},
+				}
 				querier.
-					On("GetAllCustomer", mock.Anything, mock.Anything).
-					Times(0)
+					On("SearchUsers", mock.Anything, expectedArg).
+					Times(1).
+					Return(&db.SearchUsersResult{Users: []*db.User{}, Total: 0}, nil)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Equal(t, http.StatusOK, recorder.Code)
 			},
 			auth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
 				addAuthorization(t,
 					request,
 					tokenMaker,
 					authorizationTypeBearer,
-					adminUser.Username,
-					adminUser.Role,
+					superUser.Username,
+					superUser.Role,
 					time.Minute,
 				)
 			},
 		},
 		{
-			name: "ErrNoRows",
+			name: "AdminSearchesAdmin",
 			env:  "test",
-			body: gin.H{
-				"offset": 0,
-				"limit":  6,
-			},
+			url:  "/api/v1/auth/admin/users?limit=6&offset=0&role=admin",
 			mock: func(server *Server) {
 				querier, ok := server.store.(*mocker.TestMocker)
 				require.True(t, ok)
@@ -1494,12 +1496,11 @@ func TestGetAllCustomer(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("GetAllCustomer", mock.Anything, mock.Anything).
-					Times(1).
-					Return(nil, sql.ErrNoRows)
+					On("SearchUsers", mock.Anything, mock.Anything).
+					Times(0)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusNotFound, recorder.Code)
+				require.Equal(t, http.StatusForbidden, recorder.Code)
 			},
 			auth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
 				addAuthorization(t,
@@ -1513,12 +1514,9 @@ func TestGetAllCustomer(t *testing.T) {
 			},
 		},
 		{
-			name: "InternalServerError",
+			name: "BadRequest",
 			env:  "test",
-			body: gin.H{
-				"offset": 0,
-				"limit":  6,
-			},
+			url:  "/api/v1/auth/admin/users?offset=0&sort_by=hashed_password",
 			mock: func(server *Server) {
 				querier, ok := server.store.(*mocker.TestMocker)
 				require.True(t, ok)
@@ -1529,12 +1527,11 @@ func TestGetAllCustomer(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("GetAllCustomer", mock.Anything, mock.Anything).
-					Times(1).
-					Return(nil, sql.ErrConnDone)
+					On("SearchUsers", mock.Anything, mock.Anything).
+					Times(0)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
 			},
 			auth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
 				addAuthorization(t,
@@ -1548,12 +1545,9 @@ func TestGetAllCustomer(t *testing.T) {
 			},
 		},
 		{
-			name: "NoCustomerFound",
+			name: "InternalServerError",
 			env:  "test",
-			body: gin.H{
-				"offset": 0,
-				"limit":  6,
-			},
+			url:  "/api/v1/auth/admin/users?limit=6&offset=0",
 			mock: func(server *Server) {
 				querier, ok := server.store.(*mocker.TestMocker)
 				require.True(t, ok)
@@ -1564,12 +1558,12 @@ func TestGetAllCustomer(t *testing.T) {
 					Return(adminUser, nil)
 
 				querier.
-					On("GetAllCustomer", mock.Anything, mock.Anything).
+					On("SearchUsers", mock.Anything, mock.Anything).
 					Times(1).
-					Return(nil, nil)
+					Return(nil, sql.ErrConnDone)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusNotFound, recorder.Code)
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
 			},
 			auth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
 				addAuthorization(t,
@@ -1590,12 +1584,7 @@ func TestGetAllCustomer(t *testing.T) {
 			server := newTestServer(querier, tc.env)
 			tc.mock(server)
 
-			// Marshal body data to JSON
-			data, err := json.Marshal(tc.body)
-			require.NoError(t, err)
-
-			url := "/api/v1/auth/admin/users/all/customer"
-			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			request, err := http.NewRequest(http.MethodGet, tc.url, nil)
 			require.NoError(t, err)
 
 			tc.auth(t, request, server.tokenMaker)
@@ -1606,41 +1595,29 @@ func TestGetAllCustomer(t *testing.T) {
 	}
 }
 
-func TestGetAllAdmin(t *testing.T) {
-	superUser := createRandomUser(db.RoleSuperUser, false)
-	var allAdmin []*db.User
-	for i := 0; i < 6; i++ {
-		allAdmin = append(allAdmin, createRandomUser(db.RoleAdmin, false))
-	}
+func TestGetUserByEmail(t *testing.T) {
+	roleCustomer := createRandomUser(db.RoleCustomer, false)
 
 	testCases := []struct {
 		name     string
-		env      string
 		body     gin.H
+		env      string
 		mock     func(server *Server)
 		response func(recorder *httptest.ResponseRecorder)
-		auth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
 	}{
 		{
 			name: "OK",
 			env:  "test",
 			body: gin.H{
-				"offset": 0,
-				"limit":  6,
+				"email": roleCustomer.Email,
 			},
 			mock: func(server *Server) {
 				querier, ok := server.store.(*mocker.TestMocker)
 				require.True(t, ok)
 
 				querier.
-					On("GetUser", mock.Anything, mock.Anything).
-					Times(1).
-					Return(superUser, nil)
-
-				querier.
-					On("GetAllAdmin", mock.Anything, mock.Anything).
-					Times(1).
-					Return(allAdmin, nil)
+					On("GetUserByEmail", mock.Anything, mock.Anything).
+					Return(roleCustomer, nil)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -1648,35 +1625,68 @@ func TestGetAllAdmin(t *testing.T) {
 				data, err := io.ReadAll(recorder.Body)
 				require.NoError(t, err)
 
-				var request []*userResponse
+				var request userFullNameResponse
 				err = json.Unmarshal(data, &request)
 				require.NoError(t, err)
 
-				for i, user := range allAdmin {
-					expectedUser := &userResponse{
-						Username:          user.Username,
-						FullName:          user.FullName,
-						Email:             user.Email,
-						PasswordChangedAt: user.PasswordChangedAt,
-						CreatedAt:         user.CreatedAt,
-						Role:              user.Role,
-					}
-					require.Equal(t, expectedUser.Username, request[i].Username)
-					require.Equal(t, expectedUser.FullName, request[i].FullName)
-					require.Equal(t, expectedUser.Email, request[i].Email)
-					require.Equal(t, expectedUser.PasswordChangedAt.Unix(), request[i].PasswordChangedAt.Unix())
-					require.Equal(t, expectedUser.CreatedAt.Unix(), request[i].CreatedAt.Unix())
-				}
+				require.Equal(t, roleCustomer.FullName, request.FullName)
 			},
-			auth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
-				addAuthorization(t,
-					request,
-					tokenMaker,
-					authorizationTypeBearer,
-					superUser.Username,
-					superUser.Role,
-					time.Minute,
-				)
+		},
+		{
+			name: "StatusBadRequest",
+			env:  "test",
+			mock: func(server *Server) {
+				querier, ok := server.store.(*mocker.TestMocker)
+				require.True(t, ok)
+
+				querier.
+					On("GetUserByEmail", mock.Anything, mock.Anything).
+					Return(roleCustomer, nil)
+
+				querier.
+					On("GetUserByEmail", mock.Anything, mock.Anything).
+					Times(0)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "StatusNotFound",
+			env:  "test",
+			body: gin.H{
+				"email": roleCustomer.Email,
+			},
+			mock: func(server *Server) {
+				querier, ok := server.store.(*mocker.TestMocker)
+				require.True(t, ok)
+
+				querier.
+					On("GetUserByEmail", mock.Anything, mock.Anything).
+					Times(1).
+					Return(nil, sql.ErrNoRows)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "StatusInternalServerError",
+			env:  "test",
+			body: gin.H{
+				"email": roleCustomer.Email,
+			},
+			mock: func(server *Server) {
+				querier, ok := server.store.(*mocker.TestMocker)
+				require.True(t, ok)
+
+				querier.
+					On("GetUserByEmail", mock.Anything, mock.Anything).
+					Times(1).
+					Return(nil, sql.ErrConnDone)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
 			},
 		},
 	}
@@ -1691,11 +1701,10 @@ func TestGetAllAdmin(t *testing.T) {
 			data, err := json.Marshal(tc.body)
 			require.NoError(t, err)
 
-			url := "/api/v1/auth/su/users/all/admin"
+			url := "/api/v1/users/get_full_name"
 			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
 			require.NoError(t, err)
 
-			tc.auth(t, request, server.tokenMaker)
 			recorder := httptest.NewRecorder()
 			server.router.ServeHTTP(recorder, request)
 			tc.response(recorder)
@@ -1703,95 +1712,150 @@ func TestGetAllAdmin(t *testing.T) {
 	}
 }
 
-func TestGetUserByEmail(t *testing.T) {
-	roleCustomer := createRandomUser(db.RoleCustomer, false)
+func TestRestoreUser(t *testing.T) {
+	superUser := createRandomUser(db.RoleSuperUser, false)
+	deletedUser := createRandomUser(db.RoleCustomer, false)
 
 	testCases := []struct {
 		name     string
-		body     gin.H
-		env      string
+		username string
 		mock     func(server *Server)
 		response func(recorder *httptest.ResponseRecorder)
 	}{
 		{
-			name: "OK",
-			env:  "test",
-			body: gin.H{
-				"email": roleCustomer.Email,
-			},
+			name:     "OK",
+			username: deletedUser.Username,
 			mock: func(server *Server) {
 				querier, ok := server.store.(*mocker.TestMocker)
 				require.True(t, ok)
 
 				querier.
-					On("GetUserByEmail", mock.Anything, mock.Anything).
-					Return(roleCustomer, nil)
+					On("GetUser", mock.Anything, superUser.Username).
+					Times(1).
+					Return(superUser, nil)
+
+				querier.
+					On("RestoreUser", auditedAs("user.restore"), deletedUser.Username).
+					Times(1).
+					Return(deletedUser, nil)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
 
-				data, err := io.ReadAll(recorder.Body)
-				require.NoError(t, err)
-
-				var request userFullNameResponse
-				err = json.Unmarshal(data, &request)
+				var response userResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &response)
 				require.NoError(t, err)
-
-				require.Equal(t, roleCustomer.FullName, request.FullName)
+				require.Equal(t, deletedUser.Username, response.Username)
 			},
 		},
 		{
-			name: "StatusBadRequest",
-			env:  "test",
+			name:     "NotDeleted",
+			username: deletedUser.Username,
 			mock: func(server *Server) {
 				querier, ok := server.store.(*mocker.TestMocker)
 				require.True(t, ok)
 
 				querier.
-					On("GetUserByEmail", mock.Anything, mock.Anything).
-					Return(roleCustomer, nil)
+					On("GetUser", mock.Anything, superUser.Username).
+					Times(1).
+					Return(superUser, nil)
 
 				querier.
-					On("GetUserByEmail", mock.Anything, mock.Anything).
-					Times(0)
+					On("RestoreUser", mock.Anything, deletedUser.Username).
+					Times(1).
+					Return(nil, sql.ErrNoRows)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Equal(t, http.StatusNotFound, recorder.Code)
 			},
 		},
 		{
-			name: "StatusNotFound",
-			env:  "test",
-			body: gin.H{
-				"email": roleCustomer.Email,
-			},
+			name:     "InvalidUsername",
+			username: "not-valid",
 			mock: func(server *Server) {
 				querier, ok := server.store.(*mocker.TestMocker)
 				require.True(t, ok)
 
 				querier.
-					On("GetUserByEmail", mock.Anything, mock.Anything).
+					On("GetUser", mock.Anything, superUser.Username).
 					Times(1).
-					Return(nil, sql.ErrNoRows)
+					Return(superUser, nil)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusNotFound, recorder.Code)
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
 			},
 		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			server := newTestServer(querier, "test")
+			tc.mock(server)
+
+			url := fmt.Sprintf("/api/v1/auth/su/deleted-users/%s/restore", tc.username)
+			request, err := http.NewRequest(http.MethodPost, url, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, superUser.Username, superUser.Role, time.Minute)
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			tc.response(recorder)
+		})
+	}
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	superUser := createRandomUser(db.RoleSuperUser, false)
+
+	testCases := []struct {
+		name     string
+		mock     func(server *Server)
+		response func(recorder *httptest.ResponseRecorder)
+	}{
 		{
-			name: "StatusInternalServerError",
-			env:  "test",
-			body: gin.H{
-				"email": roleCustomer.Email,
+			name: "OK",
+			mock: func(server *Server) {
+				querier, ok := server.store.(*mocker.TestMocker)
+				require.True(t, ok)
+
+				querier.
+					On("GetUser", mock.Anything, superUser.Username).
+					Times(1).
+					Return(superUser, nil)
+
+				retention := server.config.GetConfig().DeletedUserRetention
+				querier.
+					On("PurgeDeletedUsers", auditedAs("user.purge"), mock.MatchedBy(func(deletedBefore time.Time) bool {
+						return time.Since(deletedBefore) >= retention
+					})).
+					Times(1).
+					Return(int64(4), nil)
 			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var response purgeUsersResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &response)
+				require.NoError(t, err)
+				require.Equal(t, int64(4), response.Purged)
+			},
+		},
+		{
+			name: "InternalServerError",
 			mock: func(server *Server) {
 				querier, ok := server.store.(*mocker.TestMocker)
 				require.True(t, ok)
 
 				querier.
-					On("GetUserByEmail", mock.Anything, mock.Anything).
+					On("GetUser", mock.Anything, superUser.Username).
 					Times(1).
-					Return(nil, sql.ErrConnDone)
+					Return(superUser, nil)
+
+				querier.
+					On("PurgeDeletedUsers", mock.Anything, mock.Anything).
+					Times(1).
+					Return(int64(0), sql.ErrConnDone)
 			},
 			response: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
@@ -1802,17 +1866,13 @@ func TestGetUserByEmail(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			querier := new(mocker.TestMocker)
-			server := newTestServer(querier, tc.env)
+			server := newTestServer(querier, "test")
 			tc.mock(server)
 
-			// Marshal body data to JSON
-			data, err := json.Marshal(tc.body)
-			require.NoError(t, err)
-
-			url := "/api/v1/users/get_full_name"
-			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			request, err := http.NewRequest(http.MethodPost, "/api/v1/auth/su/deleted-users/purge", nil)
 			require.NoError(t, err)
 
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, superUser.Username, superUser.Role, time.Minute)
 			recorder := httptest.NewRecorder()
 			server.router.ServeHTTP(recorder, request)
 			tc.response(recorder)
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/webhook"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+type webhookURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type createWebhookResponse struct {
+	db.WebhookSubscription
+	// Secret is only ever returned when the subscription is created.
+	Secret string `json:"secret"`
+}
+
+func (server *Server) createWebhook(ctx *gin.Context) {
+	var request struct {
+		URL        string   `json:"url" binding:"required"`
+		EventTypes []string `json:"event_types" binding:"required,min=1"`
+		Secret     string   `json:"secret" binding:"omitempty,min=16"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	if err := validateWebhook(request.URL, request.EventTypes); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	secret := request.Secret
+	if len(secret) == 0 {
+		var err error
+		secret, err = webhook.NewSecret()
+		if err != nil {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+			return
+		}
+	}
+
+	subscription, err := server.store.CreateWebhookSubscription(audited(ctx, "webhook.create"), db.CreateWebhookSubscriptionParams{
+		URL:        request.URL,
+		EventTypes: request.EventTypes,
+		Secret:     secret,
+	})
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, createWebhookResponse{WebhookSubscription: *subscription, Secret: subscription.Secret})
+}
+
+func (server *Server) listWebhooks(ctx *gin.Context) {
+	var request struct {
+		Limit  int32 `form:"limit" binding:"required,gte=1"`
+		Offset int32 `form:"offset" binding:"min=0"`
+	}
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	subscriptions, err := server.store.ListWebhookSubscriptions(ctx, db.LimitOffset{Limit: request.Limit, Offset: request.Offset})
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, subscriptions)
+}
+
+func (server *Server) getWebhook(ctx *gin.Context) {
+	var uri webhookURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		return
+	}
+
+	subscription, err := server.store.GetWebhookSubscription(ctx, uri.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
+			return
+		}
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, subscription)
+}
+
+func (server *Server) updateWebhook(ctx *gin.Context) {
+	var uri webhookURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		return
+	}
+
+	var request struct {
+		URL        string   `json:"url" binding:"omitempty"`
+		EventTypes []string `json:"event_types" binding:"omitempty,min=1"`
+		IsActive   *bool    `json:"is_active" binding:"omitempty"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	if len(request.URL) > 0 {
+		if err := validateWebhookURL(request.URL); err != nil {
+			requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+			return
+		}
+	}
+	if err := validateEventTypes(request.EventTypes); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	arg := db.UpdateWebhookSubscriptionParams{
+		ID:         uri.ID,
+		URL:        sql.NullString{String: request.URL, Valid: len(request.URL) > 0},
+		EventTypes: request.EventTypes,
+		UpdatedAt:  time.Now(),
+	}
+	if request.IsActive != nil {
+		arg.IsActive = sql.NullBool{Bool: *request.IsActive, Valid: true}
+	}
+
+	subscription, err := server.store.UpdateWebhookSubscription(audited(ctx, "webhook.update"), arg)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
+			return
+		}
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, subscription)
+}
+
+func (server *Server) deleteWebhook(ctx *gin.Context) {
+	var uri webhookURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		return
+	}
+
+	subscription, err := server.store.DeleteWebhookSubscription(audited(ctx, "webhook.delete"), uri.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
+			return
+		}
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, subscription)
+}
+
+func (server *Server) listWebhookDeliveries(ctx *gin.Context) {
+	var uri webhookURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		return
+	}
+
+	var request struct {
+		Limit  int32  `form:"limit" binding:"required,gte=1"`
+		Offset int32  `form:"offset" binding:"min=0"`
+		Status string `form:"status" binding:"omitempty,oneof=pending succeeded failed"`
+	}
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(err).Error())
+		return
+	}
+
+	deliveries, err := server.store.ListWebhookDeliveries(ctx, db.ListWebhookDeliveriesParams{
+		LimitOffset:    db.LimitOffset{Limit: request.Limit, Offset: request.Offset},
+		SubscriptionID: uri.ID,
+		Status:         sql.NullString{String: request.Status, Valid: len(request.Status) > 0},
+	})
+	if err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, deliveries)
+}
+
+func (server *Server) redeliverWebhookDelivery(ctx *gin.Context) {
+	var uri struct {
+		ID         int64 `uri:"id" binding:"required,min=1"`
+		DeliveryID int64 `uri:"delivery_id" binding:"required,min=1"`
+	}
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrShouldBindUri).Error())
+		return
+	}
+
+	delivery, err := server.store.RedeliverWebhookDelivery(audited(ctx, "webhook.redeliver"), uri.ID, uri.DeliveryID, time.Now())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			requestLogger(ctx).Info().Msg(ctx.Error(ErrNoRow).Error())
+			return
+		}
+		requestLogger(ctx).Info().Msg(ctx.Error(ErrInternalServer).Error())
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, delivery)
+}
+
+func validateWebhook(rawURL string, eventTypes []string) error {
+	if err := validateWebhookURL(rawURL); err != nil {
+		return err
+	}
+	return validateEventTypes(eventTypes)
+}
+
+func validateWebhookURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+		return ErrInvalidWebhookURL
+	}
+	return nil
+}
+
+func validateEventTypes(eventTypes []string) error {
+	for _, eventType := range eventTypes {
+		if eventType != db.WebhookAllEvents && !slices.Contains(db.EventTypes, eventType) {
+			return ErrUnknownEventType
+		}
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateWebhook(t *testing.T) {
+	adminUser := createRandomUser(db.RoleAdmin, false)
+	subscription := &db.WebhookSubscription{
+		ID:         1,
+		URL:        "https://partner.example.com/hooks",
+		EventTypes: []string{db.EventPropertyCreated, db.EventUserCreated},
+		IsActive:   true,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	testCases := []struct {
+		name     string
+		body     gin.H
+		mock     func(querier *mocker.TestMocker)
+		response func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "GeneratedSecret",
+			body: gin.H{"url": subscription.URL, "event_types": subscription.EventTypes},
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("CreateWebhookSubscription", auditedAs("webhook.create"), mock.MatchedBy(func(arg db.CreateWebhookSubscriptionParams) bool {
+						subscription.Secret = arg.Secret
+						return arg.URL == subscription.URL && strings.HasPrefix(arg.Secret, "whsec_")
+					})).
+					Times(1).
+					Return(subscription, nil)
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var response createWebhookResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				require.Equal(t, subscription.ID, response.ID)
+				require.Equal(t, subscription.EventTypes, response.EventTypes)
+				require.Equal(t, subscription.Secret, response.Secret)
+			},
+		},
+		{
+			name: "ProvidedSecret",
+			body: gin.H{"url": subscription.URL, "event_types": []string{db.WebhookAllEvents}, "secret": "0123456789abcdef"},
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("CreateWebhookSubscription", auditedAs("webhook.create"), db.CreateWebhookSubscriptionParams{
+						URL:        subscription.URL,
+						EventTypes: []string{db.WebhookAllEvents},
+						Secret:     "0123456789abcdef",
+					}).
+					Times(1).
+					Return(subscription, nil)
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "UnknownEventType",
+			body: gin.H{"url": subscription.URL, "event_types": []string{"reservation.created"}},
+			mock: func(querier *mocker.TestMocker) {
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Contains(t, recorder.Body.String(), ErrUnknownEventType.Error())
+			},
+		},
+		{
+			name: "InvalidURL",
+			body: gin.H{"url": "ftp://partner.example.com", "event_types": subscription.EventTypes},
+			mock: func(querier *mocker.TestMocker) {
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Contains(t, recorder.Body.String(), ErrInvalidWebhookURL.Error())
+			},
+		},
+		{
+			name: "NoEventTypes",
+			body: gin.H{"url": subscription.URL, "event_types": []string{}},
+			mock: func(querier *mocker.TestMocker) {
+			},
+			response: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			server := newTestServer(querier, "test")
+			querier.
+				On("GetUser", mock.Anything, adminUser.Username).
+				Times(1).
+				Return(adminUser, nil)
+			tc.mock(querier)
+
+			body, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+			request, err := http.NewRequest(http.MethodPost, "/api/v1/auth/admin/webhooks", bytes.NewReader(body))
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, adminUser.Username, adminUser.Role, time.Minute)
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			tc.response(t, recorder)
+		})
+	}
+}
+
+func TestUpdateWebhook(t *testing.T) {
+	adminUser := createRandomUser(db.RoleAdmin, false)
+	subscription := &db.WebhookSubscription{ID: 3, URL: "https://partner.example.com/hooks", EventTypes: []string{db.WebhookAllEvents}, IsActive: true}
+
+	querier := new(mocker.TestMocker)
+	server := newTestServer(querier, "test")
+	querier.
+		On("GetUser", mock.Anything, adminUser.Username).
+		Times(1).
+		Return(adminUser, nil)
+	querier.
+		On("UpdateWebhookSubscription", auditedAs("webhook.update"), mock.MatchedBy(func(arg db.UpdateWebhookSubscriptionParams) bool {
+			return arg.ID == 3 && !arg.URL.Valid && arg.EventTypes == nil && arg.IsActive == sql.NullBool{Bool: false, Valid: true}
+		})).
+		Times(1).
+		Return(&db.WebhookSubscription{ID: 3, URL: subscription.URL, EventTypes: subscription.EventTypes}, nil)
+
+	request, err := http.NewRequest(http.MethodPut, "/api/v1/auth/admin/webhooks/3", strings.NewReader(`{"is_active":false}`))
+	require.NoError(t, err)
+
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, adminUser.Username, adminUser.Role, time.Minute)
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"is_active":false`)
+	querier.AssertExpectations(t)
+}
+
+func TestListWebhookDeliveries(t *testing.T) {
+	adminUser := createRandomUser(db.RoleAdmin, false)
+	deliveries := []*db.WebhookDelivery{
+		{ID: 9, SubscriptionID: 3, EventID: 42, EventType: db.EventPropertyCreated, Payload: json.RawMessage(`{"id":42}`), Status: db.WebhookDeliveryFailed, Attempts: 10, ResponseStatus: 500},
+	}
+
+	testCases := []struct {
+		name     string
+		query    string
+		mock     func(querier *mocker.TestMocker)
+		response func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: "?limit=10&offset=0&status=failed",
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("ListWebhookDeliveries", mock.Anything, db.ListWebhookDeliveriesParams{
+						LimitOffset:    db.LimitOffset{Limit: 10, Offset: 0},
+						SubscriptionID: 3,
+						Status:         sql.NullString{String: db.WebhookDeliveryFailed, Valid: true},
+					}).
+					Times(1).
+					Return(deliveries, nil)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var actual []*db.WebhookDelivery
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &actual))
+				require.Len(t, actual, 1)
+				require.Equal(t, int64(42), actual[0].EventID)
+				require.Equal(t, db.WebhookDeliveryFailed, actual[0].Status)
+			},
+		},
+		{
+			name:  "UnknownStatus",
+			query: "?limit=10&offset=0&status=lost",
+			mock: func(querier *mocker.TestMocker) {
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			server := newTestServer(querier, "test")
+			querier.
+				On("GetUser", mock.Anything, adminUser.Username).
+				Times(1).
+				Return(adminUser, nil)
+			tc.mock(querier)
+
+			request, err := http.NewRequest(http.MethodGet, "/api/v1/auth/admin/webhooks/3/deliveries"+tc.query, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, adminUser.Username, adminUser.Role, time.Minute)
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			tc.response(recorder)
+		})
+	}
+}
+
+func TestRedeliverWebhookDelivery(t *testing.T) {
+	adminUser := createRandomUser(db.RoleAdmin, false)
+
+	testCases := []struct {
+		name     string
+		mock     func(querier *mocker.TestMocker)
+		response func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("RedeliverWebhookDelivery", auditedAs("webhook.redeliver"), int64(3), int64(9), mock.Anything).
+					Times(1).
+					Return(&db.WebhookDelivery{ID: 9, SubscriptionID: 3, Status: db.WebhookDeliveryPending}, nil)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"status":"pending"`)
+			},
+		},
+		{
+			name: "NotFound",
+			mock: func(querier *mocker.TestMocker) {
+				querier.
+					On("RedeliverWebhookDelivery", mock.Anything, int64(3), int64(9), mock.Anything).
+					Times(1).
+					Return(nil, sql.ErrNoRows)
+			},
+			response: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			server := newTestServer(querier, "test")
+			querier.
+				On("GetUser", mock.Anything, adminUser.Username).
+				Times(1).
+				Return(adminUser, nil)
+			tc.mock(querier)
+
+			request, err := http.NewRequest(http.MethodPost, "/api/v1/auth/admin/webhooks/3/deliveries/9/redeliver", nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, adminUser.Username, adminUser.Role, time.Minute)
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			tc.response(recorder)
+			querier.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/util"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var validUsername = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+type app struct {
+	in      io.Reader
+	out     io.Writer
+	errOut  io.Writer
+	now     func() time.Time
+	actor   string
+	connect func(ctx context.Context) (db.Store, error)
+}
+
+type command struct {
+	summary string
+	run     func(ctx context.Context, app *app, args []string) error
+}
+
+var commands = map[string]command{
+	"create-user":        {"create a user with a role", createUser},
+	"reset-password":     {"set a new password for a user and block their sessions", resetPassword},
+	"assign-role":        {"give a user another role and block their sessions", assignRole},
+	"block-session":      {"block a session so that its refresh token is refused", blockSession},
+	"list-properties":    {"list the properties", listProperties},
+	"rotate-su-password": {"set a new password for the super user and block their sessions", rotateSuperUserPassword},
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (app *app) flagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet("posadactl "+name, flag.ContinueOnError)
+	flags.SetOutput(app.errOut)
+	return flags
+}
+
+// parse parses the flags of a command and checks that the required ones are set.
+func (app *app) parse(flags *flag.FlagSet, args []string, required ...string) error {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{err}
+	}
+	if flags.NArg() > 0 {
+		return app.misuse(flags, "unexpected arguments %q", flags.Args())
+	}
+	for _, name := range required {
+		if strings.TrimSpace(flags.Lookup(name).Value.String()) == "" {
+			return app.misuse(flags, "-%s is required", name)
+		}
+	}
+	return nil
+}
+
+func (app *app) misuse(flags *flag.FlagSet, format string, args ...any) error {
+	err := fmt.Errorf(format, args...)
+	fmt.Fprintln(app.errOut, err)
+	flags.Usage()
+	return usageError{err}
+}
+
+// password reads the password from the first line of the standard input when fromStdin is
+// set, and generates one otherwise, which is then printed.
+func (app *app) password(fromStdin bool) (password string, generated bool, err error) {
+	if !fromStdin {
+		random := make([]byte, 15)
+		if _, err = rand.Read(random); err != nil {
+			return "", false, err
+		}
+		return base64.RawURLEncoding.EncodeToString(random), true, nil
+	}
+
+	line, err := bufio.NewReader(app.in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", false, err
+	}
+	password = strings.TrimRight(line, "\r\n")
+	if len(password) < util.MinPasswordLength {
+		return "", false, fmt.Errorf("the password must have at least %d characters", util.MinPasswordLength)
+	}
+	return password, false, nil
+}
+
+// audited attaches the audit entry of action to ctx, so that the store writes it in the
+// transaction of the change.
+func (app *app) audited(ctx context.Context, action string) context.Context {
+	return db.WithAuditEntry(ctx, db.AuditEntry{
+		ActorUsername: app.actor,
+		// the command runs with the privileges of the database, those of the super user at least
+		ActorRole: db.RoleSuperUser,
+		Action:    action,
+	})
+}
+
+func (app *app) printUser(user *db.User, password string) {
+	fmt.Fprintf(app.out, "username: %s\n", user.Username)
+	fmt.Fprintf(app.out, "role:     %s\n", user.Role.Name)
+	if password != "" {
+		fmt.Fprintf(app.out, "password: %s\n", password)
+	}
+}
+
+func createUser(ctx context.Context, app *app, args []string) error {
+	flags := app.flagSet("create-user")
+	username := flags.String("username", "", "the username, made of letters and digits")
+	fullName := flags.String("full-name", "", "the full name")
+	email := flags.String("email", "", "the email address")
+	roleName := flags.String("role", db.RoleCustomer, "the name of the role")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from the standard input instead of generating one")
+	if err := app.parse(flags, args, "username", "full-name", "email", "role"); err != nil {
+		return err
+	}
+	if !validUsername.MatchString(*username) {
+		return app.misuse(flags, "-username can only hold letters and digits")
+	}
+
+	password, generated, err := app.password(*passwordStdin)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := util.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	store, err := app.connect(ctx)
+	if err != nil {
+		return err
+	}
+	role, err := getRole(ctx, store, *roleName)
+	if err != nil {
+		return err
+	}
+
+	user, err := store.CreateUser(app.audited(ctx, "user.create"), &db.CreateUserParams{
+		Username:       *username,
+		HashedPassword: hashedPassword,
+		FullName:       *fullName,
+		Email:          *email,
+		RoleID:         role.InternalID,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create the user %s: %w", *username, err)
+	}
+
+	if !generated {
+		password = ""
+	}
+	app.printUser(user, password)
+	return nil
+}
+
+func resetPassword(ctx context.Context, app *app, args []string) error {
+	flags := app.flagSet("reset-password")
+	username := flags.String("username", "", "the username")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from the standard input instead of generating one")
+	if err := app.parse(flags, args, "username"); err != nil {
+		return err
+	}
+
+	store, err := app.connect(ctx)
+	if err != nil {
+		return err
+	}
+	user, err := getUser(ctx, store, *username)
+	if err != nil {
+		return err
+	}
+	return app.setPassword(ctx, store, user, *passwordStdin, "user.reset_password")
+}
+
+// rotateSuperUserPassword resets the password of a user holding the super user role. It
+// refuses any other user, so that a typo cannot hand out the password of a customer.
+func rotateSuperUserPassword(ctx context.Context, app *app, args []string) error {
+	flags := app.flagSet("rotate-su-password")
+	username := flags.String("username", db.RoleSuperUser, "the username of the super user")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from the standard input instead of generating one")
+	if err := app.parse(flags, args, "username"); err != nil {
+		return err
+	}
+
+	store, err := app.connect(ctx)
+	if err != nil {
+		return err
+	}
+	user, err := getUser(ctx, store, *username)
+	if err != nil {
+		return err
+	}
+	if user.Role == nil || user.Role.Name != db.RoleSuperUser {
+		return fmt.Errorf("the user %s is not a super user", user.Username)
+	}
+	return app.setPassword(ctx, store, user, *passwordStdin, "user.rotate_password")
+}
+
+// setPassword changes the password of user and blocks their sessions: a password is usually
+// changed because it leaked, and the refresh tokens obtained with it must not outlive it.
+func (app *app) setPassword(ctx context.Context, store db.Store, user *db.User, passwordStdin bool, action string) error {
+	password, generated, err := app.password(passwordStdin)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := util.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	now := app.now()
+	update, err := store.UpdateUserAndBlockSessions(app.audited(ctx, action), db.UpdateUserParams{
+		Username:          user.Username,
+		HashedPassword:    sql.NullString{String: hashedPassword, Valid: true},
+		PasswordChangedAt: sql.NullTime{Time: now, Valid: true},
+	}, now)
+	if err != nil {
+		return fmt.Errorf("cannot update the user %s: %w", user.Username, err)
+	}
+
+	if !generated {
+		password = ""
+	}
+	app.printUser(update.User, password)
+	fmt.Fprintf(app.out, "sessions: %d blocked\n", len(update.BlockedSessions))
+	return nil
+}
+
+// assignRole changes the role of a user and blocks their sessions, the access tokens being
+// renewed with the role held when the session was created.
+func assignRole(ctx context.Context, app *app, args []string) error {
+	flags := app.flagSet("assign-role")
+	username := flags.String("username", "", "the username")
+	roleName := flags.String("role", "", "the name of the role")
+	if err := app.parse(flags, args, "username", "role"); err != nil {
+		return err
+	}
+
+	store, err := app.connect(ctx)
+	if err != nil {
+		return err
+	}
+	user, err := getUser(ctx, store, *username)
+	if err != nil {
+		return err
+	}
+	role, err := getRole(ctx, store, *roleName)
+	if err != nil {
+		return err
+	}
+
+	update, err := store.UpdateUserAndBlockSessions(app.audited(ctx, "user.assign_role"), db.UpdateUserParams{
+		Username: user.Username,
+		RoleID:   uuid.NullUUID{UUID: role.InternalID, Valid: true},
+	}, app.now())
+	if err != nil {
+		return fmt.Errorf("cannot update the user %s: %w", user.Username, err)
+	}
+
+	app.printUser(update.User, "")
+	fmt.Fprintf(app.out, "sessions: %d blocked\n", len(update.BlockedSessions))
+	return nil
+}
+
+func blockSession(ctx context.Context, app *app, args []string) error {
+	flags := app.flagSet("block-session")
+	id := flags.String("id", "", "the ID of the session")
+	if err := app.parse(flags, args, "id"); err != nil {
+		return err
+	}
+	sessionID, err := uuid.Parse(*id)
+	if err != nil {
+		return app.misuse(flags, "-id must be a UUID")
+	}
+
+	store, err := app.connect(ctx)
+	if err != nil {
+		return err
+	}
+	session, err := store.BlockSession(app.audited(ctx, "session.block"), sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("the session %s does not exist", sessionID)
+		}
+		return fmt.Errorf("cannot block the session %s: %w", sessionID, err)
+	}
+
+	fmt.Fprintf(app.out, "session %s of %s blocked\n", session.ID, session.Username)
+	return nil
+}
+
+func listProperties(ctx context.Context, app *app, args []string) error {
+	flags := app.flagSet("list-properties")
+	limit := flags.Int("limit", 50, "the number of properties to list")
+	offset := flags.Int("offset", 0, "the number of properties to skip")
+	if err := app.parse(flags, args); err != nil {
+		return err
+	}
+	if *limit < 1 || *offset < 0 {
+		return app.misuse(flags, "-limit must be at least 1 and -offset cannot be negative")
+	}
+
+	store, err := app.connect(ctx)
+	if err != nil {
+		return err
+	}
+	properties, err := store.GetAllProperty(ctx, db.ListPropertyParams{
+		LimitOffset: db.LimitOffset{Limit: int32(*limit), Offset: int32(*offset)},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot list the properties: %w", err)
+	}
+
+	table := tabwriter.NewWriter(app.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "EXTERNAL ID\tNAME\tCITY\tCOUNTRY\tACTIVE")
+	for _, property := range properties {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%t\n", property.ExternalID, property.Name, property.City, property.Country, property.IsActive)
+	}
+	return table.Flush()
+}
+
+func getUser(ctx context.Context, store db.Store, username string) (*db.User, error) {
+	user, err := store.GetUser(ctx, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("the user %s does not exist", username)
+		}
+		return nil, fmt.Errorf("cannot get the user %s: %w", username, err)
+	}
+	return user, nil
+}
+
+func getRole(ctx context.Context, store db.Store, name string) (*db.Role, error) {
+	role, err := store.GetRoleByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("the role %s does not exist", name)
+		}
+		return nil, fmt.Errorf("cannot get the role %s: %w", name, err)
+	}
+	return role, nil
+}
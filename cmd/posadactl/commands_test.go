@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/newbri/posadamissportia/db/util"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestApp(store db.Store, stdin string) (*app, *bytes.Buffer) {
+	out := new(bytes.Buffer)
+	return &app{
+		in:     strings.NewReader(stdin),
+		out:    out,
+		errOut: new(bytes.Buffer),
+		now:    func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) },
+		actor:  "posadactl:test",
+		connect: func(ctx context.Context) (db.Store, error) {
+			return store, nil
+		},
+	}, out
+}
+
+func createRandomRole(name string) *db.Role {
+	return &db.Role{
+		InternalID: uuid.New(),
+		Name:       name,
+		ExternalID: "URE" + util.RandomString(3),
+	}
+}
+
+func createRandomUser(role *db.Role) *db.User {
+	return &db.User{
+		Username: util.RandomOwner(),
+		FullName: util.RandomOwner(),
+		Email:    util.RandomEmail(),
+		Role:     role,
+	}
+}
+
+// auditedAs matches the context of a change the store audits under action, on behalf of the
+// actor of newTestApp.
+func auditedAs(action string) any {
+	return mock.MatchedBy(func(ctx context.Context) bool {
+		entry, ok := db.AuditEntryFrom(ctx)
+		return ok && entry == db.AuditEntry{ActorUsername: "posadactl:test", ActorRole: db.RoleSuperUser, Action: action}
+	})
+}
+
+func TestCreateUser(t *testing.T) {
+	role := createRandomRole(db.RoleSuperUser)
+	user := createRandomUser(role)
+	args := []string{"-username", user.Username, "-full-name", user.FullName, "-email", user.Email, "-role", role.Name}
+
+	testCases := []struct {
+		name  string
+		stdin string
+		args  []string
+		check func(t *testing.T, err error, querier *mocker.TestMocker, out string)
+	}{
+		{
+			name: "GeneratedPassword",
+			args: args,
+			check: func(t *testing.T, err error, querier *mocker.TestMocker, out string) {
+				require.NoError(t, err)
+				require.Contains(t, out, "username: "+user.Username)
+				require.Contains(t, out, "role:     su")
+
+				// the printed password is the one stored
+				password := strings.TrimPrefix(strings.Split(out, "\n")[2], "password: ")
+				require.Len(t, password, 20)
+				arg := querier.Calls[1].Arguments.Get(1).(*db.CreateUserParams)
+				require.NoError(t, util.CheckPassword(password, arg.HashedPassword))
+			},
+		},
+		{
+			name:  "PasswordStdin",
+			stdin: "s3cret password\n",
+			args:  append([]string{"-password-stdin"}, args...),
+			check: func(t *testing.T, err error, querier *mocker.TestMocker, out string) {
+				require.NoError(t, err)
+				require.NotContains(t, out, "password:")
+				arg := querier.Calls[1].Arguments.Get(1).(*db.CreateUserParams)
+				require.NoError(t, util.CheckPassword("s3cret password", arg.HashedPassword))
+			},
+		},
+		{
+			name:  "ShortPassword",
+			stdin: "short\n",
+			args:  append([]string{"-password-stdin"}, args...),
+			check: func(t *testing.T, err error, querier *mocker.TestMocker, out string) {
+				require.EqualError(t, err, "the password must have at least 6 characters")
+				querier.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+			},
+		},
+		{
+			name: "MissingFlag",
+			args: []string{"-username", user.Username},
+			check: func(t *testing.T, err error, querier *mocker.TestMocker, out string) {
+				require.Equal(t, 2, exitStatus(err))
+				require.EqualError(t, err, "-full-name is required")
+			},
+		},
+		{
+			name: "InvalidUsername",
+			args: []string{"-username", "not valid", "-full-name", user.FullName, "-email", user.Email},
+			check: func(t *testing.T, err error, querier *mocker.TestMocker, out string) {
+				require.Equal(t, 2, exitStatus(err))
+			},
+		},
+		{
+			name: "UnknownRole",
+			args: []string{"-username", user.Username, "-full-name", user.FullName, "-email", user.Email, "-role", "guest"},
+			check: func(t *testing.T, err error, querier *mocker.TestMocker, out string) {
+				require.EqualError(t, err, "the role guest does not exist")
+				require.Equal(t, 1, exitStatus(err))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			querier.On("GetRoleByName", mock.Anything, role.Name).Return(role, nil)
+			querier.On("GetRoleByName", mock.Anything, "guest").Return(nil, sql.ErrNoRows)
+			querier.On("CreateUser", auditedAs("user.create"), mock.Anything).Return(user, nil)
+
+			app, out := newTestApp(querier, tc.stdin)
+			err := createUser(context.Background(), app, tc.args)
+			tc.check(t, err, querier, out.String())
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	user := createRandomUser(createRandomRole(db.RoleCustomer))
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	session := &db.Session{ID: uuid.New(), Username: user.Username, IsBlocked: true}
+
+	testCases := []struct {
+		name  string
+		err   error
+		check func(t *testing.T, err error, out string)
+	}{
+		{
+			name: "OK",
+			check: func(t *testing.T, err error, out string) {
+				require.NoError(t, err)
+				require.NotContains(t, out, "password:")
+				require.Contains(t, out, "sessions: 1 blocked\n")
+			},
+		},
+		{
+			name: "BlockFails",
+			err:  sql.ErrConnDone,
+			check: func(t *testing.T, err error, out string) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+				require.EqualError(t, err, "cannot update the user "+user.Username+": "+sql.ErrConnDone.Error())
+				require.Empty(t, out)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			querier.On("GetUser", mock.Anything, user.Username).Return(user, nil)
+			update := &db.UserSessionsUpdate{User: user, BlockedSessions: []*db.Session{session}}
+			if tc.err != nil {
+				update = nil
+			}
+			querier.On("UpdateUserAndBlockSessions", auditedAs("user.reset_password"), mock.MatchedBy(func(arg db.UpdateUserParams) bool {
+				return arg.Username == user.Username &&
+					util.CheckPassword("n3w password", arg.HashedPassword.String) == nil &&
+					arg.PasswordChangedAt.Time.Equal(now)
+			}), now).Return(update, tc.err).Once()
+
+			app, out := newTestApp(querier, "n3w password")
+			err := resetPassword(context.Background(), app, []string{"-username", user.Username, "-password-stdin"})
+			tc.check(t, err, out.String())
+			querier.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRotateSuperUserPassword(t *testing.T) {
+	testCases := []struct {
+		name  string
+		role  string
+		check func(t *testing.T, err error, out string)
+	}{
+		{
+			name: "SuperUser",
+			role: db.RoleSuperUser,
+			check: func(t *testing.T, err error, out string) {
+				require.NoError(t, err)
+				require.Contains(t, out, "password: ")
+				require.Contains(t, out, "sessions: 0 blocked\n")
+			},
+		},
+		{
+			name: "NotSuperUser",
+			role: db.RoleAdmin,
+			check: func(t *testing.T, err error, out string) {
+				require.EqualError(t, err, "the user su is not a super user")
+				require.Empty(t, out)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			user := createRandomUser(createRandomRole(tc.role))
+			user.Username = db.RoleSuperUser
+
+			querier := new(mocker.TestMocker)
+			querier.On("GetUser", mock.Anything, db.RoleSuperUser).Return(user, nil)
+			querier.On("UpdateUserAndBlockSessions", auditedAs("user.rotate_password"), mock.Anything, mock.Anything).
+				Return(&db.UserSessionsUpdate{User: user, BlockedSessions: []*db.Session{}}, nil)
+
+			app, out := newTestApp(querier, "")
+			err := rotateSuperUserPassword(context.Background(), app, nil)
+			tc.check(t, err, out.String())
+		})
+	}
+}
+
+func TestAssignRole(t *testing.T) {
+	user := createRandomUser(createRandomRole(db.RoleCustomer))
+	admin := createRandomRole(db.RoleAdmin)
+	updated := *user
+	updated.Role = admin
+
+	querier := new(mocker.TestMocker)
+	querier.On("GetUser", mock.Anything, user.Username).Return(user, nil)
+	querier.On("GetRoleByName", mock.Anything, db.RoleAdmin).Return(admin, nil)
+	session := &db.Session{ID: uuid.New(), Username: user.Username, IsBlocked: true}
+	querier.On("UpdateUserAndBlockSessions", auditedAs("user.assign_role"), db.UpdateUserParams{
+		Username: user.Username,
+		RoleID:   uuid.NullUUID{UUID: admin.InternalID, Valid: true},
+	}, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)).Return(&db.UserSessionsUpdate{User: &updated, BlockedSessions: []*db.Session{session}}, nil)
+
+	app, out := newTestApp(querier, "")
+	err := assignRole(context.Background(), app, []string{"-username", user.Username, "-role", db.RoleAdmin})
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "role:     admin")
+	require.Contains(t, out.String(), "sessions: 1 blocked\n")
+	querier.AssertExpectations(t)
+}
+
+func TestBlockSession(t *testing.T) {
+	session := &db.Session{ID: uuid.New(), Username: util.RandomOwner(), IsBlocked: true}
+
+	testCases := []struct {
+		name  string
+		id    string
+		mock  func(querier *mocker.TestMocker)
+		check func(t *testing.T, err error, out string)
+	}{
+		{
+			name: "OK",
+			id:   session.ID.String(),
+			mock: func(querier *mocker.TestMocker) {
+				querier.On("BlockSession", auditedAs("session.block"), session.ID).Return(session, nil)
+			},
+			check: func(t *testing.T, err error, out string) {
+				require.NoError(t, err)
+				require.Equal(t, "session "+session.ID.String()+" of "+session.Username+" blocked\n", out)
+			},
+		},
+		{
+			name: "NotFound",
+			id:   session.ID.String(),
+			mock: func(querier *mocker.TestMocker) {
+				querier.On("BlockSession", mock.Anything, session.ID).Return(nil, sql.ErrNoRows)
+			},
+			check: func(t *testing.T, err error, out string) {
+				require.EqualError(t, err, "the session "+session.ID.String()+" does not exist")
+			},
+		},
+		{
+			name: "InvalidID",
+			id:   "1234",
+			mock: func(querier *mocker.TestMocker) {},
+			check: func(t *testing.T, err error, out string) {
+				require.Equal(t, 2, exitStatus(err))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			tc.mock(querier)
+
+			app, out := newTestApp(querier, "")
+			err := blockSession(context.Background(), app, []string{"-id", tc.id})
+			tc.check(t, err, out.String())
+			querier.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListProperties(t *testing.T) {
+	properties := []*db.Property{
+		{ExternalID: "PRO101", Name: "Posada Miss Portia", City: "San Andres", Country: "Colombia", IsActive: true},
+		{ExternalID: "PRO102", Name: "Cabana", City: "Providencia", Country: "Colombia"},
+	}
+
+	querier := new(mocker.TestMocker)
+	querier.On("GetAllProperty", mock.Anything, db.ListPropertyParams{
+		LimitOffset: db.LimitOffset{Limit: 10, Offset: 5},
+	}).Return(properties, nil)
+
+	app, out := newTestApp(querier, "")
+	err := listProperties(context.Background(), app, []string{"-limit", "10", "-offset", "5"})
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	require.Equal(t, []string{"EXTERNAL", "ID", "NAME", "CITY", "COUNTRY", "ACTIVE"}, strings.Fields(lines[0]))
+	require.Contains(t, lines[1], "Posada Miss Portia")
+	require.True(t, strings.HasSuffix(lines[2], "false"))
+}
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		name   string
+		args   []string
+		status int
+		stderr string
+	}{
+		{name: "NoCommand", status: 2, stderr: "Commands:"},
+		{name: "UnknownCommand", args: []string{"drop-database"}, status: 2, stderr: `unknown command "drop-database"`},
+		{name: "Help", args: []string{"create-user", "-h"}, status: 0, stderr: "-password-stdin"},
+		{name: "InvalidFlag", args: []string{"list-properties", "-limit", "many"}, status: 2, stderr: "invalid value"},
+		{name: "MissingConfiguration", args: []string{"-config", "missing.yaml", "list-properties"}, status: 1, stderr: "posadactl: invalid configuration"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("POSADA_ENV", "test")
+			stderr := new(bytes.Buffer)
+			status := run(context.Background(), tc.args, strings.NewReader(""), new(bytes.Buffer), stderr)
+			require.Equal(t, tc.status, status)
+			require.Contains(t, stderr.String(), tc.stderr)
+		})
+	}
+}
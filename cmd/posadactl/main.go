@@ -0,0 +1,145 @@
+// Command posadactl administers posada straight through its database, for the operations
+// that have no HTTP API or that are needed before anybody can log in, such as creating the
+// super user of a new deployment.
+//
+// Usage:
+//
+//	posadactl [-config app.yaml] <command> [flags]
+//
+// The configuration is loaded as the server loads it, from the block of the YAML file named
+// by POSADA_ENV and the POSADA_* variables. Run a command with -h to list its flags.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/joho/godotenv"
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/newbri/posadamissportia/db"
+	"io"
+	"os"
+	"os/signal"
+	"os/user"
+	"time"
+)
+
+func main() {
+	// the variables of a .env file are used when there is one, as the server does
+	_ = godotenv.Load()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command in args and returns the exit status: 0 on success, 1 when the command
+// failed and 2 when it was misused.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("posadactl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "app.yaml", "path of the YAML configuration")
+	flags.Usage = func() {
+		printUsage(stderr, flags)
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitStatus(usageError{err})
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "posadactl: unknown command %q\n\n", flags.Arg(0))
+		flags.Usage()
+		return 2
+	}
+
+	var conn *sql.DB
+	defer func() {
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}()
+
+	app := &app{
+		in:     stdin,
+		out:    stdout,
+		errOut: stderr,
+		now:    time.Now,
+		actor:  actor(),
+		connect: func(ctx context.Context) (db.Store, error) {
+			config, err := configuration.NewLayeredConfiguration(*configPath, os.Getenv("POSADA_ENV"), nil)
+			if err != nil {
+				return nil, err
+			}
+			conn, err = sql.Open(config.GetConfig().DBDriver, config.GetConfig().DBSource)
+			if err != nil {
+				return nil, err
+			}
+			if err = conn.PingContext(ctx); err != nil {
+				return nil, fmt.Errorf("cannot reach the database: %w", err)
+			}
+			return db.NewStore(conn), nil
+		},
+	}
+
+	if err := cmd.run(ctx, app, flags.Args()[1:]); err != nil {
+		status := exitStatus(err)
+		if status == 1 {
+			fmt.Fprintln(stderr, "posadactl:", err)
+		}
+		return status
+	}
+	return 0
+}
+
+// usageError is a misuse of the command line, already reported along with the usage.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
+
+func exitStatus(err error) int {
+	var usage usageError
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.As(err, &usage):
+		return 2
+	default:
+		return 1
+	}
+}
+
+func printUsage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: posadactl [-config app.yaml] <command> [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "  %-20s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w, "\nFlags:")
+	flags.PrintDefaults()
+}
+
+// actor names the operator in the audit log.
+func actor() string {
+	current, err := user.Current()
+	if err != nil {
+		return "posadactl"
+	}
+	return "posadactl:" + current.Username
+}
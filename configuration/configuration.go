@@ -1,6 +1,7 @@
 package configuration
 
 import (
+	"github.com/rs/zerolog/log"
 	"time"
 )
 
@@ -12,17 +13,79 @@ type Config struct {
 	Name                      string        `yaml:"name"`
 	DBDriver                  string        `yaml:"db_driver"`
 	DBSource                  string        `yaml:"db_source"`
-	MigrationURL              string        `yaml:"migration_url"`
+	DBSourceFile              string        `yaml:"db_source_file"`
+	DBPassword                string        `yaml:"db_password"`
+	DBPasswordFile            string        `yaml:"db_password_file"`
+	MigrationMode             string        `yaml:"migration_mode"`
+	SeedDemoUsers             bool          `yaml:"seed_demo_users"`
+	SeedDemoPassword          string        `yaml:"seed_demo_password"`
 	HTTPServerAddress         string        `yaml:"http_server_address"`
+	HTTPReadTimeout           time.Duration `yaml:"http_read_timeout"`
+	HTTPReadHeaderTimeout     time.Duration `yaml:"http_read_header_timeout"`
+	HTTPWriteTimeout          time.Duration `yaml:"http_write_timeout"`
+	HTTPIdleTimeout           time.Duration `yaml:"http_idle_timeout"`
+	HTTPMaxHeaderBytes        int           `yaml:"http_max_header_bytes"`
+	ShutdownTimeout           time.Duration `yaml:"shutdown_timeout"`
+	TLSCertFile               string        `yaml:"tls_cert_file"`
+	TLSKeyFile                string        `yaml:"tls_key_file"`
 	TokenSymmetricKey         string        `yaml:"token_symmetric_key"`
+	TokenSymmetricKeyFile     string        `yaml:"token_symmetric_key_file"`
 	AccessTokenDuration       time.Duration `yaml:"access_token_duration"`
 	RefreshTokenDuration      time.Duration `yaml:"refresh_token_duration"`
 	RedisAddress              string        `yaml:"http_redis_address"`
+	ReadinessTimeout          time.Duration `yaml:"readiness_timeout"`
+	ReadinessCheckCache       bool          `yaml:"readiness_check_cache"`
 	DefaultRole               string        `yaml:"default_role"`
 	AuthorizationHeaderKey    string        `yaml:"authorization_header_key"`
 	AuthorizationTypeBearer   string        `yaml:"authorization_type_bearer"`
 	AuthorizationPayloadKey   string        `yaml:"authorization_payload_key"`
-	AccessControlAllowOrigin  string        `yaml:"access_control_allow_origin"`
-	AccessControlAllowHeaders string        `yaml:"access_control_allow_headers"`
-	AccessControlAllowMethods string        `yaml:"access_control_allow_methods"`
+	AccessControlAllowOrigins string        `yaml:"access_control_allow_origins"`
+	// Deprecated: AccessControlAllowOrigin is the former name of AccessControlAllowOrigins,
+	// still read by applyDeprecatedSettings.
+	AccessControlAllowOrigin      string        `yaml:"access_control_allow_origin"`
+	AccessControlAllowHeaders     string        `yaml:"access_control_allow_headers"`
+	AccessControlAllowMethods     string        `yaml:"access_control_allow_methods"`
+	AccessControlExposeHeaders    string        `yaml:"access_control_expose_headers"`
+	AccessControlAllowCredentials bool          `yaml:"access_control_allow_credentials"`
+	AccessControlMaxAge           time.Duration `yaml:"access_control_max_age"`
+	DeletedUserRetention          time.Duration `yaml:"deleted_user_retention"`
+	UserPurgeInterval             time.Duration `yaml:"user_purge_interval"`
+	IdempotencyKeyTTL             time.Duration `yaml:"idempotency_key_ttl"`
+	IdempotencyKeyPurgeInterval   time.Duration `yaml:"idempotency_key_purge_interval"`
+	OutboxPollInterval            time.Duration `yaml:"outbox_poll_interval"`
+	OutboxBatchSize               int32         `yaml:"outbox_batch_size"`
+	OutboxLease                   time.Duration `yaml:"outbox_lease"`
+	OutboxRetryBaseDelay          time.Duration `yaml:"outbox_retry_base_delay"`
+	OutboxRetryMaxDelay           time.Duration `yaml:"outbox_retry_max_delay"`
+	OutboxMaxAttempts             int32         `yaml:"outbox_max_attempts"`
+	OutboxRetention               time.Duration `yaml:"outbox_retention"`
+	OutboxPurgeInterval           time.Duration `yaml:"outbox_purge_interval"`
+	WebhookPollInterval           time.Duration `yaml:"webhook_poll_interval"`
+	WebhookBatchSize              int32         `yaml:"webhook_batch_size"`
+	WebhookTimeout                time.Duration `yaml:"webhook_timeout"`
+	WebhookMaxAttempts            int32         `yaml:"webhook_max_attempts"`
+	WebhookRetryBaseDelay         time.Duration `yaml:"webhook_retry_base_delay"`
+	WebhookRetryMaxDelay          time.Duration `yaml:"webhook_retry_max_delay"`
+	EventStreamHeartbeat          time.Duration `yaml:"event_stream_heartbeat"`
+	EventStreamBuffer             int           `yaml:"event_stream_buffer"`
+	EventStreamReplayLimit        int32         `yaml:"event_stream_replay_limit"`
+	EventStreamReplayWindow       time.Duration `yaml:"event_stream_replay_window"`
+	TracingExporter               string        `yaml:"tracing_exporter"`
+	TracingEndpoint               string        `yaml:"tracing_endpoint"`
+	TracingInsecure               bool          `yaml:"tracing_insecure"`
+	TracingSampleRatio            float64       `yaml:"tracing_sample_ratio"`
+}
+
+// applyDeprecatedSettings carries the settings still configured under their former name over
+// to their current one, warning about the rename. The current name wins when both are set.
+func applyDeprecatedSettings(config *Config) {
+	if config.AccessControlAllowOrigin == "" {
+		return
+	}
+	if config.AccessControlAllowOrigins != "" {
+		log.Warn().Msg("access_control_allow_origin is deprecated and ignored, access_control_allow_origins is set")
+		return
+	}
+	log.Warn().Msg("access_control_allow_origin is deprecated, rename it to access_control_allow_origins")
+	config.AccessControlAllowOrigins = config.AccessControlAllowOrigin
 }
@@ -0,0 +1,239 @@
+package configuration
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/newbri/posadamissportia/db"
+	"gopkg.in/yaml.v3"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the name of the environment variables overriding the configuration.
+const EnvPrefix = "POSADA_"
+
+// LayeredConfiguration holds a configuration loaded in layers by NewLayeredConfiguration. It
+// reloads as ConfigYAML does, going through every layer again.
+type LayeredConfiguration struct {
+	ConfigYAML
+}
+
+// NewLayeredConfiguration loads the configuration of env in layers, each one overriding the
+// settings of the previous ones:
+//
+//  1. the defaults of Default;
+//  2. the env block of the YAML file at path, skipped when the file does not exist;
+//  3. the environment variables named after the YAML keys with the POSADA_ prefix, such as
+//     POSADA_DB_SOURCE or POSADA_TOKEN_SYMMETRIC_KEY;
+//  4. the command line flags in args, named after the YAML keys with dashes, such as
+//     -db-source or -http-server-address.
+//
+// The secrets are then resolved: db_source, db_password and token_symmetric_key are read from
+// the file named by their *_file variant when it is set and no later layer sets the secret, every value starting with enc: is
+// decrypted with the key in POSADA_CONFIG_KEY, and db_password is set in db_source.
+//
+// Durations are written as in the YAML file, such as 15m or 24h. The result is validated, and
+// every problem found is reported in the returned error.
+func NewLayeredConfiguration(path string, env string, args []string) (*LayeredConfiguration, error) {
+	app := &LayeredConfiguration{}
+	app.path = path
+	app.load = func() (*Config, error) {
+		return loadLayers(path, env, args)
+	}
+	if err := app.init(); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func loadLayers(path string, env string, args []string) (*Config, error) {
+	config := Default()
+
+	if err := loadYAML(config, path, env); err != nil {
+		return nil, err
+	}
+	err := overrideSecrets(config, func(config *Config) error {
+		return loadEnv(config, os.LookupEnv)
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = overrideSecrets(config, func(config *Config) error {
+		return loadFlags(config, args)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveSecrets(config, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	applyDeprecatedSettings(config)
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return config, nil
+}
+
+// Default returns the settings that do not depend on the deployment. The database source
+// and the token key have no default and have to be configured.
+func Default() *Config {
+	return &Config{
+		DBDriver:                    "postgres",
+		MigrationMode:               MigrationModeAuto,
+		HTTPServerAddress:           "0.0.0.0:8080",
+		HTTPReadTimeout:             15 * time.Second,
+		HTTPReadHeaderTimeout:       5 * time.Second,
+		HTTPWriteTimeout:            30 * time.Second,
+		HTTPIdleTimeout:             2 * time.Minute,
+		HTTPMaxHeaderBytes:          1 << 20,
+		ShutdownTimeout:             30 * time.Second,
+		AccessTokenDuration:         15 * time.Minute,
+		RefreshTokenDuration:        24 * time.Hour,
+		ReadinessTimeout:            2 * time.Second,
+		DefaultRole:                 db.RoleCustomer,
+		AuthorizationHeaderKey:      "authorization",
+		AuthorizationTypeBearer:     "bearer",
+		AuthorizationPayloadKey:     "authorization_payload",
+		AccessControlAllowHeaders:   "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, If-Match, Idempotency-Key, Last-Event-ID",
+		AccessControlAllowMethods:   "POST, OPTIONS, GET, PUT, DELETE",
+		AccessControlExposeHeaders:  "ETag, Idempotent-Replayed, X-Request-ID",
+		AccessControlMaxAge:         10 * time.Minute,
+		DeletedUserRetention:        720 * time.Hour,
+		UserPurgeInterval:           24 * time.Hour,
+		IdempotencyKeyTTL:           24 * time.Hour,
+		IdempotencyKeyPurgeInterval: time.Hour,
+		OutboxPollInterval:          time.Second,
+		OutboxBatchSize:             100,
+		OutboxLease:                 time.Minute,
+		OutboxRetryBaseDelay:        time.Second,
+		OutboxRetryMaxDelay:         time.Hour,
+		OutboxMaxAttempts:           20,
+		OutboxRetention:             168 * time.Hour,
+		OutboxPurgeInterval:         time.Hour,
+		WebhookPollInterval:         time.Second,
+		WebhookBatchSize:            20,
+		WebhookTimeout:              10 * time.Second,
+		WebhookMaxAttempts:          10,
+		WebhookRetryBaseDelay:       30 * time.Second,
+		WebhookRetryMaxDelay:        6 * time.Hour,
+		EventStreamHeartbeat:        15 * time.Second,
+		EventStreamBuffer:           64,
+		EventStreamReplayLimit:      200,
+		EventStreamReplayWindow:     24 * time.Hour,
+		TracingExporter:             TracingExporterNone,
+		TracingEndpoint:             "localhost:4318",
+		TracingSampleRatio:          1,
+	}
+}
+
+func loadYAML(config *Config, path string, env string) error {
+	fileBytes, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", path, err)
+	}
+
+	if env == "" {
+		return errors.New("the environment cannot be empty")
+	}
+
+	var document struct {
+		Config map[string]yaml.Node `yaml:"config"`
+	}
+	if err = yaml.Unmarshal(fileBytes, &document); err != nil {
+		return fmt.Errorf("cannot unmarshal %s: %w", path, err)
+	}
+
+	block, ok := document.Config[env]
+	if !ok {
+		return fmt.Errorf("the environment %q does not exist in %s", env, path)
+	}
+	// decoding into the defaults keeps the settings the block leaves out
+	if err = block.Decode(config); err != nil {
+		return fmt.Errorf("cannot unmarshal the %s environment: %w", env, err)
+	}
+	return nil
+}
+
+func loadEnv(config *Config, lookup func(string) (string, bool)) error {
+	var errs []error
+	forEachSetting(config, func(key string, field reflect.Value) {
+		name := EnvPrefix + strings.ToUpper(key)
+		value, ok := lookup(name)
+		if !ok {
+			return
+		}
+		if err := setSetting(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+func loadFlags(config *Config, args []string) error {
+	flags := flag.NewFlagSet("posada", flag.ContinueOnError)
+	forEachSetting(config, func(key string, field reflect.Value) {
+		name := strings.ReplaceAll(key, "_", "-")
+		flags.Func(name, "overrides "+key, func(value string) error {
+			return setSetting(field, value)
+		})
+	})
+	return flags.Parse(args)
+}
+
+// forEachSetting calls fn with the YAML key and the field of every setting of config.
+func forEachSetting(config *Config, fn func(key string, field reflect.Value)) {
+	value := reflect.ValueOf(config).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		key, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		fn(key, value.Field(i))
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setSetting(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(parsed)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package configuration
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testYAML = `config:
+    test:
+        name: test
+        db_source: postgresql://yaml
+        token_symmetric_key: 12345678901234567890123456789012
+        access_control_allow_origins: http://localhost:5173
+        http_server_address: 0.0.0.0:9090
+        access_token_duration: 5m
+        outbox_batch_size: 50
+`
+
+func writeYAML(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testYAML), 0o600))
+	return path
+}
+
+func TestLayeredConfiguration(t *testing.T) {
+	path := writeYAML(t)
+
+	testCases := []struct {
+		name  string
+		path  string
+		env   map[string]string
+		args  []string
+		check func(t *testing.T, config *Config)
+	}{
+		{
+			name: "Defaults",
+			path: filepath.Join(t.TempDir(), "missing.yaml"),
+			env: map[string]string{
+				"POSADA_DB_SOURCE":                    "postgresql://env",
+				"POSADA_TOKEN_SYMMETRIC_KEY":          "12345678901234567890123456789012",
+				"POSADA_ACCESS_CONTROL_ALLOW_ORIGINS": "*",
+			},
+			check: func(t *testing.T, config *Config) {
+				expected := Default()
+				expected.DBSource = "postgresql://env"
+				expected.TokenSymmetricKey = "12345678901234567890123456789012"
+				expected.AccessControlAllowOrigins = "*"
+				require.Equal(t, expected, config)
+			},
+		},
+		{
+			name: "YAMLOverDefaults",
+			path: path,
+			check: func(t *testing.T, config *Config) {
+				require.Equal(t, "postgresql://yaml", config.DBSource)
+				require.Equal(t, "0.0.0.0:9090", config.HTTPServerAddress)
+				require.Equal(t, 5*time.Minute, config.AccessTokenDuration)
+				require.EqualValues(t, 50, config.OutboxBatchSize)
+				// left out of the block
+				require.Equal(t, Default().RefreshTokenDuration, config.RefreshTokenDuration)
+			},
+		},
+		{
+			name: "EnvOverYAML",
+			path: path,
+			env: map[string]string{
+				"POSADA_DB_SOURCE":             "postgresql://env",
+				"POSADA_TOKEN_SYMMETRIC_KEY":   "abcdefghijabcdefghijabcdefghijab",
+				"POSADA_ACCESS_TOKEN_DURATION": "1m",
+				"POSADA_READINESS_CHECK_CACHE": "true",
+				"POSADA_HTTP_REDIS_ADDRESS":    "redis:6379",
+				"POSADA_TRACING_SAMPLE_RATIO":  "0.25",
+			},
+			check: func(t *testing.T, config *Config) {
+				require.Equal(t, "postgresql://env", config.DBSource)
+				require.Equal(t, "abcdefghijabcdefghijabcdefghijab", config.TokenSymmetricKey)
+				require.Equal(t, time.Minute, config.AccessTokenDuration)
+				require.True(t, config.ReadinessCheckCache)
+				require.Equal(t, 0.25, config.TracingSampleRatio)
+				require.Equal(t, "0.0.0.0:9090", config.HTTPServerAddress)
+			},
+		},
+		{
+			name: "FlagsOverEnv",
+			path: path,
+			env:  map[string]string{"POSADA_DB_SOURCE": "postgresql://env"},
+			args: []string{"-db-source", "postgresql://flag", "-outbox-batch-size=7"},
+			check: func(t *testing.T, config *Config) {
+				require.Equal(t, "postgresql://flag", config.DBSource)
+				require.EqualValues(t, 7, config.OutboxBatchSize)
+			},
+		},
+		{
+			name: "DeprecatedOrigin",
+			path: filepath.Join(t.TempDir(), "missing.yaml"),
+			env: map[string]string{
+				"POSADA_DB_SOURCE":                   "postgresql://env",
+				"POSADA_TOKEN_SYMMETRIC_KEY":         "12345678901234567890123456789012",
+				"POSADA_ACCESS_CONTROL_ALLOW_ORIGIN": "https://staff.posada.example",
+			},
+			check: func(t *testing.T, config *Config) {
+				require.Equal(t, "https://staff.posada.example", config.AccessControlAllowOrigins)
+			},
+		},
+		{
+			name: "DeprecatedOriginIgnored",
+			path: path,
+			env:  map[string]string{"POSADA_ACCESS_CONTROL_ALLOW_ORIGIN": "https://staff.posada.example"},
+			check: func(t *testing.T, config *Config) {
+				require.Equal(t, "http://localhost:5173", config.AccessControlAllowOrigins)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+
+			configuration, err := NewLayeredConfiguration(tc.path, "test", tc.args)
+			require.NoError(t, err)
+			tc.check(t, configuration.GetConfig())
+		})
+	}
+}
+
+func TestLayeredConfigurationErrors(t *testing.T) {
+	path := writeYAML(t)
+
+	testCases := []struct {
+		name    string
+		env     string
+		vars    map[string]string
+		args    []string
+		message string
+	}{
+		{name: "EmptyEnvironment", env: "", message: "the environment cannot be empty"},
+		{name: "UnknownEnvironment", env: "staging", message: `"staging" does not exist`},
+		{name: "InvalidDuration", env: "test", vars: map[string]string{"POSADA_OUTBOX_LEASE": "soon"}, message: "POSADA_OUTBOX_LEASE"},
+		{name: "InvalidNumber", env: "test", vars: map[string]string{"POSADA_OUTBOX_BATCH_SIZE": "many"}, message: "POSADA_OUTBOX_BATCH_SIZE"},
+		{name: "OutOfRange", env: "test", vars: map[string]string{"POSADA_WEBHOOK_BATCH_SIZE": "4294967296"}, message: "POSADA_WEBHOOK_BATCH_SIZE"},
+		{name: "UnknownFlag", env: "test", args: []string{"-no-such-setting"}, message: "no-such-setting"},
+		{name: "InvalidFlag", env: "test", args: []string{"-readiness-check-cache=maybe"}, message: "readiness-check-cache"},
+		{name: "Invalid", env: "test", args: []string{"-token-symmetric-key=short"}, message: "token_symmetric_key: must be exactly 32 characters"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.vars {
+				t.Setenv(name, value)
+			}
+
+			configuration, err := NewLayeredConfiguration(path, tc.env, tc.args)
+			require.ErrorContains(t, err, tc.message)
+			require.Nil(t, configuration)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package configuration
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/nacl/secretbox"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const (
+	// EncryptedPrefix marks a setting encrypted with EncryptValue.
+	EncryptedPrefix = "enc:"
+	// ConfigKeyEnv holds the base64 key decrypting the encrypted settings, and ConfigKeyFileEnv
+	// the path of a file holding it.
+	ConfigKeyEnv     = EnvPrefix + "CONFIG_KEY"
+	ConfigKeyFileEnv = EnvPrefix + "CONFIG_KEY_FILE"
+
+	keySize   = 32
+	nonceSize = 24
+)
+
+var (
+	errMissingConfigKey = errors.New("the configuration holds encrypted settings but " + ConfigKeyEnv + " is not set")
+	errInvalidConfigKey = fmt.Errorf("the configuration key must be %d bytes encoded in base64", keySize)
+	errUndecryptable    = errors.New("cannot decrypt the value with the configuration key")
+)
+
+// GenerateKey returns a new random key for EncryptValue, encoded in base64.
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// EncryptValue seals value with the base64 key using NaCl secretbox, and returns it in the
+// form the configuration decrypts: enc: followed by the nonce and the sealed value in base64.
+func EncryptValue(encodedKey string, value string) (string, error) {
+	key, err := parseKey(encodedKey)
+	if err != nil {
+		return "", err
+	}
+
+	var nonce [nonceSize]byte
+	if _, err = rand.Read(nonce[:]); err != nil {
+		return "", err
+	}
+	sealed := secretbox.Seal(nonce[:], []byte(value), &nonce, key)
+	return EncryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptValue(key *[keySize]byte, value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EncryptedPrefix))
+	if err != nil || len(sealed) < nonceSize {
+		return "", errUndecryptable
+	}
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], sealed[:nonceSize])
+	opened, ok := secretbox.Open(nil, sealed[nonceSize:], &nonce, key)
+	if !ok {
+		return "", errUndecryptable
+	}
+	return string(opened), nil
+}
+
+func parseKey(encodedKey string) (*[keySize]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil || len(decoded) != keySize {
+		return nil, errInvalidConfigKey
+	}
+	var key [keySize]byte
+	copy(key[:], decoded)
+	return &key, nil
+}
+
+// loadConfigKey reads the configuration key from ConfigKeyEnv, or from the file named by
+// ConfigKeyFileEnv. It returns nil when neither is set.
+func loadConfigKey(lookup func(string) (string, bool)) (*[keySize]byte, error) {
+	encodedKey, ok := lookup(ConfigKeyEnv)
+	if !ok {
+		path, ok := lookup(ConfigKeyFileEnv)
+		if !ok {
+			return nil, nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ConfigKeyFileEnv, err)
+		}
+		encodedKey = string(content)
+	}
+	return parseKey(encodedKey)
+}
+
+type secretFile struct {
+	key   string
+	value *string
+	path  *string
+}
+
+// secretFiles returns the secrets of config that can be read from a file.
+func secretFiles(config *Config) []secretFile {
+	return []secretFile{
+		{"db_source", &config.DBSource, &config.DBSourceFile},
+		{"db_password", &config.DBPassword, &config.DBPasswordFile},
+		{"token_symmetric_key", &config.TokenSymmetricKey, &config.TokenSymmetricKeyFile},
+	}
+}
+
+// overrideSecrets runs the layer load on config, and drops the *_file variant set by the
+// previous layers of the secrets the layer sets, so that a plain value overrides a file named
+// earlier as it overrides a plain value.
+func overrideSecrets(config *Config, load func(config *Config) error) error {
+	type setting struct{ value, path string }
+	var previous []setting
+	for _, secret := range secretFiles(config) {
+		previous = append(previous, setting{*secret.value, *secret.path})
+	}
+
+	if err := load(config); err != nil {
+		return err
+	}
+
+	for i, secret := range secretFiles(config) {
+		if *secret.value != previous[i].value && *secret.path == previous[i].path {
+			*secret.path = ""
+		}
+	}
+	return nil
+}
+
+// resolveSecrets replaces the secrets by the content of their *_file variant when it is set,
+// decrypts the settings holding an encrypted value, and sets db_password in db_source.
+func resolveSecrets(config *Config, lookup func(string) (string, bool)) error {
+	var errs []error
+
+	for _, secret := range secretFiles(config) {
+		if *secret.path == "" {
+			continue
+		}
+		content, err := os.ReadFile(*secret.path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s_file: %w", secret.key, err))
+			continue
+		}
+		// editors and echo leave a trailing newline
+		*secret.value = strings.TrimRight(string(content), "\r\n")
+	}
+
+	type encryptedSetting struct {
+		key   string
+		field reflect.Value
+	}
+	var encrypted []encryptedSetting
+	forEachSetting(config, func(key string, field reflect.Value) {
+		if field.Kind() == reflect.String && strings.HasPrefix(field.String(), EncryptedPrefix) {
+			encrypted = append(encrypted, encryptedSetting{key, field})
+		}
+	})
+	if len(encrypted) > 0 {
+		key, err := loadConfigKey(lookup)
+		if err == nil && key == nil {
+			err = errMissingConfigKey
+		}
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+
+		for _, setting := range encrypted {
+			value, err := decryptValue(key, setting.field.String())
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", setting.key, err))
+				continue
+			}
+			setting.field.SetString(value)
+		}
+	}
+
+	// a password left encrypted by an error above is not set
+	if len(errs) == 0 && config.DBPassword != "" {
+		source, err := withPassword(config.DBSource, config.DBPassword)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			config.DBSource = source
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// withPassword sets the password of the postgres URL source.
+func withPassword(source string, password string) (string, error) {
+	parsed, err := url.Parse(source)
+	if err != nil || parsed.Scheme == "" || parsed.User == nil {
+		return "", errors.New("db_password: db_source must be a URL naming the user, such as postgresql://root@localhost:5432/posada")
+	}
+	parsed.User = url.UserPassword(parsed.User.Username(), password)
+	return parsed.String(), nil
+}
@@ -0,0 +1,267 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/util"
+	"golang.org/x/crypto/chacha20poly1305"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// MigrationModeAuto migrates the schema and seeds the database on startup,
+	// MigrationModeCheck refuses to start unless the schema is up to date, and MigrationModeOff
+	// leaves the database to the migrate command.
+	MigrationModeAuto  = "auto"
+	MigrationModeCheck = "check"
+	MigrationModeOff   = "off"
+
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+var (
+	dbDrivers        = []string{"postgres", "pgx"}
+	migrationModes   = []string{MigrationModeAuto, MigrationModeCheck, MigrationModeOff}
+	tracingExporters = []string{TracingExporterNone, TracingExporterStdout, TracingExporterOTLP}
+	// the default role is granted on signup, so it cannot be a privileged one
+	signupRoles = []string{db.RoleCustomer, db.RoleVisitor}
+	corsMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions,
+	}
+)
+
+// validator collects the problems of a configuration, each one naming the YAML key of the
+// setting at fault.
+type validator struct {
+	errs []error
+}
+
+func (v *validator) fail(key string, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) required(key string, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.fail(key, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) oneOf(key string, value string, allowed []string) {
+	if !slices.Contains(allowed, value) {
+		v.fail(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+	}
+}
+
+func (v *validator) positive(key string, value time.Duration) {
+	if value <= 0 {
+		v.fail(key, "must be a positive duration, got %s", value)
+	}
+}
+
+func (v *validator) notNegative(key string, value time.Duration) {
+	if value < 0 {
+		v.fail(key, "cannot be negative, got %s", value)
+	}
+}
+
+func (v *validator) atLeast(key string, value int64, least int64) {
+	if value < least {
+		v.fail(key, "must be at least %d, got %d", least, value)
+	}
+}
+
+func (v *validator) address(key string, value string) {
+	if !v.required(key, value) {
+		return
+	}
+	if _, _, err := net.SplitHostPort(value); err != nil {
+		v.fail(key, "must be a host:port address: %s", err)
+	}
+}
+
+func (v *validator) url(key string, value string, schemes ...string) {
+	if !v.required(key, value) {
+		return
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		v.fail(key, "must be a URL: %s", err)
+		return
+	}
+	if !slices.Contains(schemes, parsed.Scheme) {
+		v.fail(key, "must be a %s URL, got %q", strings.Join(schemes, " or "), value)
+	}
+}
+
+// Validate checks the configuration and returns all its problems at once, joined with
+// errors.Join, or nil when it is valid.
+func (config *Config) Validate() error {
+	v := &validator{}
+
+	v.oneOf("db_driver", config.DBDriver, dbDrivers)
+	v.validateDBSource(config.DBSource)
+	v.oneOf("migration_mode", config.MigrationMode, migrationModes)
+	if config.MigrationMode != MigrationModeOff && config.DBSource != "" && !strings.Contains(config.DBSource, "://") {
+		v.fail("db_source", "must be a URL for the migrations to run, or migration_mode must be off")
+	}
+	if config.SeedDemoUsers && len(config.SeedDemoPassword) < util.MinPasswordLength {
+		v.fail("seed_demo_password", "must have at least %d characters to seed the demo users", util.MinPasswordLength)
+	}
+	v.address("http_server_address", config.HTTPServerAddress)
+
+	v.notNegative("http_read_timeout", config.HTTPReadTimeout)
+	v.notNegative("http_read_header_timeout", config.HTTPReadHeaderTimeout)
+	v.notNegative("http_write_timeout", config.HTTPWriteTimeout)
+	v.notNegative("http_idle_timeout", config.HTTPIdleTimeout)
+	v.atLeast("http_max_header_bytes", int64(config.HTTPMaxHeaderBytes), 0)
+	v.positive("shutdown_timeout", config.ShutdownTimeout)
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		v.fail("tls_cert_file", "must be set along with tls_key_file")
+	}
+
+	if v.required("token_symmetric_key", config.TokenSymmetricKey) && len(config.TokenSymmetricKey) != chacha20poly1305.KeySize {
+		v.fail("token_symmetric_key", "must be exactly %d characters, got %d", chacha20poly1305.KeySize, len(config.TokenSymmetricKey))
+	}
+	v.positive("access_token_duration", config.AccessTokenDuration)
+	v.positive("refresh_token_duration", config.RefreshTokenDuration)
+	if config.AccessTokenDuration > config.RefreshTokenDuration {
+		v.fail("access_token_duration", "cannot outlive the refresh token (%s)", config.RefreshTokenDuration)
+	}
+
+	v.positive("readiness_timeout", config.ReadinessTimeout)
+	if config.ReadinessCheckCache {
+		v.address("http_redis_address", config.RedisAddress)
+	}
+
+	v.oneOf("default_role", config.DefaultRole, signupRoles)
+	v.required("authorization_header_key", config.AuthorizationHeaderKey)
+	v.required("authorization_type_bearer", config.AuthorizationTypeBearer)
+	v.required("authorization_payload_key", config.AuthorizationPayloadKey)
+
+	v.validateCORS(config)
+
+	v.positive("deleted_user_retention", config.DeletedUserRetention)
+	v.positive("user_purge_interval", config.UserPurgeInterval)
+	v.positive("idempotency_key_ttl", config.IdempotencyKeyTTL)
+	v.positive("idempotency_key_purge_interval", config.IdempotencyKeyPurgeInterval)
+
+	v.positive("outbox_poll_interval", config.OutboxPollInterval)
+	v.atLeast("outbox_batch_size", int64(config.OutboxBatchSize), 1)
+	v.positive("outbox_lease", config.OutboxLease)
+	v.validateBackoff("outbox", config.OutboxRetryBaseDelay, config.OutboxRetryMaxDelay)
+	v.atLeast("outbox_max_attempts", int64(config.OutboxMaxAttempts), 1)
+	v.positive("outbox_purge_interval", config.OutboxPurgeInterval)
+	v.positive("outbox_retention", config.OutboxRetention)
+	// a dashboard resuming its event stream is replayed the events it missed from the outbox
+	if config.OutboxRetention > 0 && config.OutboxRetention <= config.EventStreamReplayWindow {
+		v.fail("outbox_retention", "must be longer than event_stream_replay_window (%s)", config.EventStreamReplayWindow)
+	}
+
+	v.positive("webhook_poll_interval", config.WebhookPollInterval)
+	v.atLeast("webhook_batch_size", int64(config.WebhookBatchSize), 1)
+	v.positive("webhook_timeout", config.WebhookTimeout)
+	v.atLeast("webhook_max_attempts", int64(config.WebhookMaxAttempts), 1)
+	v.validateBackoff("webhook", config.WebhookRetryBaseDelay, config.WebhookRetryMaxDelay)
+
+	v.positive("event_stream_heartbeat", config.EventStreamHeartbeat)
+	v.atLeast("event_stream_buffer", int64(config.EventStreamBuffer), 1)
+	v.atLeast("event_stream_replay_limit", int64(config.EventStreamReplayLimit), 1)
+	v.positive("event_stream_replay_window", config.EventStreamReplayWindow)
+
+	v.oneOf("tracing_exporter", config.TracingExporter, tracingExporters)
+	if config.TracingExporter == TracingExporterOTLP {
+		v.address("tracing_endpoint", config.TracingEndpoint)
+	}
+	if config.TracingSampleRatio < 0 || config.TracingSampleRatio > 1 {
+		v.fail("tracing_sample_ratio", "must be between 0 and 1, got %g", config.TracingSampleRatio)
+	}
+
+	return errors.Join(v.errs...)
+}
+
+// validateDBSource accepts a postgres URL, or the key=value form lib/pq and pgx also read.
+func (v *validator) validateDBSource(source string) {
+	if !strings.Contains(source, "://") {
+		if v.required("db_source", source) && !strings.Contains(source, "=") {
+			v.fail("db_source", "must be a postgres URL or a list of key=value settings")
+		}
+		return
+	}
+	v.url("db_source", source, "postgres", "postgresql")
+}
+
+func (v *validator) validateBackoff(prefix string, baseDelay time.Duration, maxDelay time.Duration) {
+	v.positive(prefix+"_retry_base_delay", baseDelay)
+	v.positive(prefix+"_retry_max_delay", maxDelay)
+	if baseDelay > maxDelay {
+		v.fail(prefix+"_retry_base_delay", "cannot exceed %s_retry_max_delay (%s)", prefix, maxDelay)
+	}
+}
+
+func (v *validator) validateCORS(config *Config) {
+	if v.required("access_control_allow_origins", config.AccessControlAllowOrigins) {
+		for _, origin := range strings.Split(config.AccessControlAllowOrigins, ",") {
+			origin = strings.TrimSpace(origin)
+			if origin == "*" {
+				// browsers refuse credentials from a response allowing any origin
+				if config.AccessControlAllowCredentials {
+					v.fail("access_control_allow_credentials", "cannot be used with the * origin")
+				}
+				continue
+			}
+			if !validOriginPattern(origin) {
+				v.fail("access_control_allow_origins", "must be * or http(s) origins such as https://example.com or https://*.example.com, got %q", origin)
+			}
+		}
+	}
+
+	if v.required("access_control_allow_headers", config.AccessControlAllowHeaders) {
+		v.headerNames("access_control_allow_headers", config.AccessControlAllowHeaders)
+	}
+	if strings.TrimSpace(config.AccessControlExposeHeaders) != "" {
+		v.headerNames("access_control_expose_headers", config.AccessControlExposeHeaders)
+	}
+
+	if v.required("access_control_allow_methods", config.AccessControlAllowMethods) {
+		for _, method := range strings.Split(config.AccessControlAllowMethods, ",") {
+			v.oneOf("access_control_allow_methods", strings.TrimSpace(method), corsMethods)
+		}
+	}
+
+	v.notNegative("access_control_max_age", config.AccessControlMaxAge)
+}
+
+func (v *validator) headerNames(key string, value string) {
+	for _, header := range strings.Split(value, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" || strings.ContainsAny(header, " \t:;") {
+			v.fail(key, "contains an invalid header name %q", header)
+		}
+	}
+}
+
+// validOriginPattern accepts an http(s) origin whose host may start with a *. wildcard
+// standing for any subdomain.
+func validOriginPattern(origin string) bool {
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok || (scheme != "http" && scheme != "https") {
+		return false
+	}
+	host = strings.TrimPrefix(host, "*.")
+	if host == "" || strings.ContainsAny(host, "*/?#@") {
+		return false
+	}
+	parsed, err := url.Parse(scheme + "://" + host)
+	return err == nil && parsed.Host == host
+}
@@ -0,0 +1,209 @@
+package configuration
+
+import (
+	"context"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// reloadDelay lets the editors and the orchestrators finish writing the file, which they do
+// in several steps, before it is reloaded.
+const reloadDelay = 200 * time.Millisecond
+
+// restartSettings are read once at startup, by the database connection, the listener, the
+// token maker, the workers or the tracer, or have to stay the same during a request, as the
+// key the authentication middleware stores the token payload under. A reload keeps their value
+// and warns that changing them needs a restart.
+var restartSettings = map[string]bool{
+	"name":                           true,
+	"db_driver":                      true,
+	"db_source":                      true,
+	"db_source_file":                 true,
+	"db_password":                    true,
+	"db_password_file":               true,
+	"migration_mode":                 true,
+	"seed_demo_users":                true,
+	"seed_demo_password":             true,
+	"http_server_address":            true,
+	"http_read_timeout":              true,
+	"http_read_header_timeout":       true,
+	"http_write_timeout":             true,
+	"http_idle_timeout":              true,
+	"http_max_header_bytes":          true,
+	"tls_cert_file":                  true,
+	"tls_key_file":                   true,
+	"token_symmetric_key":            true,
+	"token_symmetric_key_file":       true,
+	"authorization_header_key":       true,
+	"authorization_payload_key":      true,
+	"user_purge_interval":            true,
+	"idempotency_key_purge_interval": true,
+	"outbox_poll_interval":           true,
+	"webhook_poll_interval":          true,
+	"webhook_timeout":                true,
+	"event_stream_buffer":            true,
+	"tracing_exporter":               true,
+	"tracing_endpoint":               true,
+	"tracing_insecure":               true,
+	"tracing_sample_ratio":           true,
+}
+
+// Subscribe calls fn with the previous and the current configuration after every reload
+// changing a setting. fn is called outside of the reload, and may subscribe or reload again.
+func (app *ConfigYAML) Subscribe(fn func(previous *Config, current *Config)) {
+	app.reloading.Lock()
+	defer app.reloading.Unlock()
+	app.subscribers = append(app.subscribers, fn)
+}
+
+// Reload loads the configuration again and, when it is valid, swaps the one returned by
+// GetConfig and notifies the subscribers. The changes to the restartSettings are dropped
+// with a warning. An invalid configuration is returned as an error and the previous one
+// stays in use.
+func (app *ConfigYAML) Reload() error {
+	previous, current, subscribers, err := app.swap()
+	if err != nil || current == nil {
+		return err
+	}
+	for _, subscriber := range subscribers {
+		subscriber(previous, current)
+	}
+	return nil
+}
+
+// swap replaces the configuration with the one loaded again, and returns both along with the
+// subscribers to notify. current is nil when no setting changed.
+func (app *ConfigYAML) swap() (previous *Config, current *Config, subscribers []func(previous *Config, current *Config), err error) {
+	app.reloading.Lock()
+	defer app.reloading.Unlock()
+
+	// the layers fall back to the defaults without the file, which a reload must not do
+	if _, err = os.Stat(app.path); err != nil {
+		return nil, nil, nil, fmt.Errorf("cannot reload the configuration: %w", err)
+	}
+	config, err := app.load()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	previous = app.config.Load()
+	previousSettings := make(map[string]reflect.Value)
+	forEachSetting(previous, func(key string, field reflect.Value) {
+		previousSettings[key] = field
+	})
+
+	var changed []string
+	forEachSetting(config, func(key string, field reflect.Value) {
+		previousField := previousSettings[key]
+		if reflect.DeepEqual(field.Interface(), previousField.Interface()) {
+			return
+		}
+		if restartSettings[key] {
+			// the values are left out of the log as they may be secrets
+			log.Warn().Str("setting", key).Msg("the setting cannot change at runtime, restart to apply it")
+			field.Set(previousField)
+			return
+		}
+		changed = append(changed, key)
+	})
+	if len(changed) == 0 {
+		return previous, nil, nil, nil
+	}
+
+	app.config.Store(config)
+	log.Info().Strs("changed", changed).Msg("configuration reloaded")
+	return previous, config, slices.Clone(app.subscribers), nil
+}
+
+// LogDurationChanges logs the durations changed by a reload with their previous and current
+// value, which unlike the other settings are never secrets. It is meant for Subscribe.
+func LogDurationChanges(previous *Config, current *Config) {
+	previousSettings := make(map[string]reflect.Value)
+	forEachSetting(previous, func(key string, field reflect.Value) {
+		previousSettings[key] = field
+	})
+	forEachSetting(current, func(key string, field reflect.Value) {
+		duration, ok := field.Interface().(time.Duration)
+		if !ok {
+			return
+		}
+		if previousDuration := previousSettings[key].Interface().(time.Duration); previousDuration != duration {
+			log.Info().Str("setting", key).Dur("previous", previousDuration).Dur("current", duration).Msg("duration changed")
+		}
+	})
+}
+
+// Watch reloads the configuration whenever its file changes or the process receives SIGHUP,
+// until ctx is cancelled. A configuration that cannot be reloaded is logged, and the previous
+// one stays in use.
+func (app *ConfigYAML) Watch(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var changes <-chan fsnotify.Event
+	var watchErrors <-chan error
+	watcher, err := app.watchFile()
+	if err != nil {
+		log.Warn().Err(err).Msg("cannot watch the configuration file, send SIGHUP to reload it")
+	} else {
+		defer watcher.Close()
+		changes, watchErrors = watcher.Events, watcher.Errors
+	}
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			app.reload()
+		case change, ok := <-changes:
+			if !ok {
+				changes = nil
+				continue
+			}
+			if filepath.Clean(change.Name) == filepath.Clean(app.path) &&
+				change.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+				settled = time.After(reloadDelay)
+			}
+		case err, ok := <-watchErrors:
+			if !ok {
+				watchErrors = nil
+				continue
+			}
+			log.Error().Err(err).Msg("cannot watch the configuration file")
+		case <-settled:
+			settled = nil
+			app.reload()
+		}
+	}
+}
+
+// watchFile watches the directory of the file, since editors and orchestrators replace the
+// file rather than write it in place.
+func (app *ConfigYAML) watchFile() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err = watcher.Add(filepath.Dir(app.path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+func (app *ConfigYAML) reload() {
+	if err := app.Reload(); err != nil {
+		log.Error().Err(err).Msg("cannot reload the configuration, keeping the previous one")
+	}
+}
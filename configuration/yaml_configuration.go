@@ -1,45 +1,67 @@
 package configuration
 
 import (
+	"fmt"
 	"github.com/rs/zerolog/log"
-	"gopkg.in/yaml.v3"
 	"os"
+	"sync"
+	"sync/atomic"
 )
 
+// ConfigYAML holds a configuration loaded from a YAML file. Reload and Watch load the file
+// again and swap the configuration returned by GetConfig.
 type ConfigYAML struct {
-	config *Config
+	path   string
+	load   func() (*Config, error)
+	config atomic.Pointer[Config]
+
+	reloading   sync.Mutex
+	subscribers []func(previous *Config, current *Config)
 }
 
-func NewYAMLConfiguration(path string, env string) Configuration {
-	type data struct {
-		Config map[string]*Config `yaml:"config"`
+// NewYAMLConfiguration loads the env block of the YAML file at path alone, without defaults
+// nor overrides, and exits when the file is missing or the configuration invalid.
+func NewYAMLConfiguration(path string, env string) *ConfigYAML {
+	app := &ConfigYAML{
+		path: path,
+		load: func() (*Config, error) {
+			return loadYAMLFile(path, env)
+		},
 	}
-	var yamlConfig *data
-
-	fileBytes, err := os.ReadFile(path)
-	if err != nil {
-		log.Fatal().Msg("cannot load config")
+	if err := app.init(); err != nil {
+		log.Fatal().Err(err).Msg("cannot load config")
 	}
+	return app
+}
 
-	err = yaml.Unmarshal(fileBytes, &yamlConfig)
+func (app *ConfigYAML) init() error {
+	config, err := app.load()
 	if err != nil {
-		log.Fatal().Msg("unable to unmarshal YAML config")
+		return err
 	}
+	app.config.Store(config)
+	return nil
+}
 
-	if "" == env {
-		log.Fatal().Msg("the environment cannot be empty")
-	}
+func (app *ConfigYAML) GetConfig() *Config {
+	return app.config.Load()
+}
 
-	config, ok := yamlConfig.Config[env]
-	if !ok {
-		log.Fatal().Msg("the environment does not exist")
+func loadYAMLFile(path string, env string) (*Config, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
 	}
 
-	return &ConfigYAML{
-		config: config,
+	config := &Config{}
+	if err := loadYAML(config, path, env); err != nil {
+		return nil, err
 	}
-}
-
-func (app *ConfigYAML) GetConfig() *Config {
-	return app.config
+	if err := resolveSecrets(config, os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("cannot resolve the secrets:\n%w", err)
+	}
+	applyDeprecatedSettings(config)
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return config, nil
 }
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+const (
+	// auditTargetWebhook is the target type of the changes made to webhook subscriptions.
+	auditTargetWebhook = "webhook"
+	// auditActionBlockSessions is the action the sessions of a user blocked at once are
+	// audited under, whatever change led to it.
+	auditActionBlockSessions = "user.block_sessions"
+)
+
+// AuditEntry describes who makes a change, and why. Attached to the context of a mutation with
+// WithAuditEntry, it is written to the audit log by SQLStore in the transaction of the change,
+// along with the state of the target before and after it.
+type AuditEntry struct {
+	ActorUsername string
+	ActorRole     string
+	Action        string
+	ClientIP      string
+	RequestID     string
+}
+
+type auditEntryKey struct{}
+
+// WithAuditEntry returns a copy of ctx carrying entry, auditing the mutations made with it.
+func WithAuditEntry(ctx context.Context, entry AuditEntry) context.Context {
+	return context.WithValue(ctx, auditEntryKey{}, entry)
+}
+
+// AuditEntryFrom returns the entry attached to ctx with WithAuditEntry, if any.
+func AuditEntryFrom(ctx context.Context) (AuditEntry, bool) {
+	entry, ok := ctx.Value(auditEntryKey{}).(AuditEntry)
+	return entry, ok
+}
+
+const createAuditLogQuery = `
+INSERT INTO audit_log (actor_username, actor_role, action, target_type, target_id, before, after, client_ip, request_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, actor_username, actor_role, action, target_type, target_id, before, after, client_ip, request_id, created_at;
+`
+
+type CreateAuditLogParams struct {
+	ActorUsername string
+	ActorRole     string
+	Action        string
+	TargetType    string
+	TargetID      string
+	Before        json.RawMessage
+	After         json.RawMessage
+	ClientIP      string
+	RequestID     string
+}
+
+func (q *Queries) CreateAuditLog(ctx context.Context, arg CreateAuditLogParams) (*AuditLog, error) {
+	row := q.db.QueryRowContext(ctx, createAuditLogQuery,
+		arg.ActorUsername,
+		arg.ActorRole,
+		arg.Action,
+		arg.TargetType,
+		arg.TargetID,
+		nullJSON(arg.Before),
+		nullJSON(arg.After),
+		arg.ClientIP,
+		arg.RequestID,
+	)
+	return scanAuditLog(row)
+}
+
+const listAuditLogQuery = `
+SELECT id, actor_username, actor_role, action, target_type, target_id, before, after, client_ip, request_id, created_at
+FROM audit_log
+`
+
+// auditLogSortColumns lists the columns the audit log can be sorted by.
+var auditLogSortColumns = map[string]string{
+	"created_at": "created_at",
+}
+
+type ListAuditLogParams struct {
+	LimitOffset
+	ActorUsername sql.NullString
+	Action        sql.NullString
+	TargetType    sql.NullString
+	TargetID      sql.NullString
+	CreatedAfter  sql.NullTime
+	CreatedBefore sql.NullTime
+}
+
+// ListAuditLog returns the matching audit entries, most recent first.
+func (q *Queries) ListAuditLog(ctx context.Context, arg ListAuditLogParams) ([]*AuditLog, error) {
+	builder := newQueryBuilder(listAuditLogQuery)
+	if arg.ActorUsername.Valid {
+		builder.Where("actor_username = ?", arg.ActorUsername.String)
+	}
+	if arg.Action.Valid {
+		builder.Where("action = ?", arg.Action.String)
+	}
+	if arg.TargetType.Valid {
+		builder.Where("target_type = ?", arg.TargetType.String)
+	}
+	if arg.TargetID.Valid {
+		builder.Where("target_id = ?", arg.TargetID.String)
+	}
+	if arg.CreatedAfter.Valid {
+		builder.Where("created_at >= ?", arg.CreatedAfter.Time)
+	}
+	if arg.CreatedBefore.Valid {
+		builder.Where("created_at < ?", arg.CreatedBefore.Time)
+	}
+	query, args := builder.
+		OrderBy(auditLogSortColumns, "created_at", "created_at", true, "id").
+		Page(arg.Limit, arg.Offset).
+		Build()
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	items := []*AuditLog{}
+	for rows.Next() {
+		entry, err := scanAuditLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAuditLog(row rowScanner) (*AuditLog, error) {
+	var entry AuditLog
+	var before, after []byte
+	err := row.Scan(
+		&entry.ID,
+		&entry.ActorUsername,
+		&entry.ActorRole,
+		&entry.Action,
+		&entry.TargetType,
+		&entry.TargetID,
+		&before,
+		&after,
+		&entry.ClientIP,
+		&entry.RequestID,
+		&entry.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	entry.Before = before
+	entry.After = after
+	return &entry, nil
+}
+
+// recordAudit writes entry to the audit log for the change of a target from before to after.
+func (q *Queries) recordAudit(ctx context.Context, entry AuditEntry, targetType string, targetID string, before any, after any) error {
+	beforeDocument, err := auditDocument(before)
+	if err != nil {
+		return err
+	}
+	afterDocument, err := auditDocument(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.CreateAuditLog(ctx, CreateAuditLogParams{
+		ActorUsername: entry.ActorUsername,
+		ActorRole:     entry.ActorRole,
+		Action:        entry.Action,
+		TargetType:    targetType,
+		TargetID:      targetID,
+		Before:        beforeDocument,
+		After:         afterDocument,
+		ClientIP:      entry.ClientIP,
+		RequestID:     entry.RequestID,
+	})
+	return err
+}
+
+// auditDocument marshals the audited state of a target, a nil state giving no document.
+func auditDocument(state any) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+
+	document, err := json.Marshal(state)
+	if err != nil || string(document) == "null" {
+		return nil, err
+	}
+	return document, nil
+}
+
+// nullJSON binds an empty document as SQL NULL.
+func nullJSON(document json.RawMessage) any {
+	if len(document) == 0 {
+		return nil
+	}
+	return string(document)
+}
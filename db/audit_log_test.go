@@ -0,0 +1,279 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var auditLogColumns = []string{"id", "actor_username", "actor_role", "action", "target_type", "target_id", "before", "after", "client_ip", "request_id", "created_at"}
+
+func TestCreateAuditLog(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	createdAt := time.Now()
+	arg := CreateAuditLogParams{
+		ActorUsername: "admin",
+		ActorRole:     RoleAdmin,
+		Action:        "role.create",
+		TargetType:    "role",
+		TargetID:      "ROL101",
+		After:         json.RawMessage(`{"name":"manager"}`),
+		ClientIP:      "127.0.0.1",
+		RequestID:     "f0c3",
+	}
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(createAuditLogQuery)).
+		WithArgs(arg.ActorUsername, arg.ActorRole, arg.Action, arg.TargetType, arg.TargetID, nil, string(arg.After), arg.ClientIP, arg.RequestID).
+		WillReturnRows(sqlmock.NewRows(auditLogColumns).
+			AddRow(int64(1), arg.ActorUsername, arg.ActorRole, arg.Action, arg.TargetType, arg.TargetID, nil, []byte(arg.After), arg.ClientIP, arg.RequestID, createdAt))
+
+	entry, err := q.CreateAuditLog(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), entry.ID)
+	require.Equal(t, arg.Action, entry.Action)
+	require.Empty(t, entry.Before)
+	require.JSONEq(t, string(arg.After), string(entry.After))
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestListAuditLog(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	createdAfter := time.Now().Add(-time.Hour)
+
+	testCases := []struct {
+		name     string
+		arg      ListAuditLogParams
+		mock     func(arg ListAuditLogParams)
+		response func(entries []*AuditLog, err error)
+	}{
+		{
+			name: "OK",
+			arg: ListAuditLogParams{
+				LimitOffset:   LimitOffset{Limit: 10, Offset: 0},
+				ActorUsername: sql.NullString{String: "admin", Valid: true},
+				TargetType:    sql.NullString{String: "property", Valid: true},
+				CreatedAfter:  sql.NullTime{Time: createdAfter, Valid: true},
+			},
+			mock: func(arg ListAuditLogParams) {
+				mocker.
+					ExpectQuery(regexp.QuoteMeta("FROM audit_log WHERE actor_username = $1 AND target_type = $2 AND created_at >= $3 "+
+						"ORDER BY created_at DESC, id DESC LIMIT $4 OFFSET $5;")).
+					WithArgs("admin", "property", createdAfter, int32(10), int32(0)).
+					WillReturnRows(sqlmock.NewRows(auditLogColumns).
+						AddRow(int64(2), "admin", RoleAdmin, "property.delete", "property", "PRO101", []byte(`{}`), nil, "127.0.0.1", "", time.Now()))
+			},
+			response: func(entries []*AuditLog, err error) {
+				require.NoError(t, err)
+				require.Len(t, entries, 1)
+				require.Equal(t, "property.delete", entries[0].Action)
+			},
+		},
+		{
+			name: "Fail",
+			arg:  ListAuditLogParams{LimitOffset: LimitOffset{Limit: 10, Offset: 0}},
+			mock: func(arg ListAuditLogParams) {
+				mocker.
+					ExpectQuery(regexp.QuoteMeta("FROM audit_log ORDER BY created_at DESC, id DESC LIMIT $1 OFFSET $2;")).
+					WithArgs(int32(10), int32(0)).
+					WillReturnError(sql.ErrConnDone)
+			},
+			response: func(entries []*AuditLog, err error) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+				require.Nil(t, entries)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mock(tc.arg)
+			tc.response(q.ListAuditLog(context.Background(), tc.arg))
+			require.NoError(t, mocker.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSQLStore_AuditedMutation(t *testing.T) {
+	role := createRole()
+	deletedAt := time.Now()
+	entry := AuditEntry{ActorUsername: "admin", ActorRole: RoleSuperUser, Action: "role.delete", ClientIP: "127.0.0.1", RequestID: "f0c3"}
+	event := &Event{ID: 1, Type: EventRoleDeleted, AggregateType: AggregateRole, AggregateID: role.ExternalID, Payload: []byte(`{}`)}
+
+	// expectDelete expects the role to be loaded and deleted, along with its event, in a transaction.
+	expectDelete := func(mocker sqlmock.Sqlmock) {
+		mocker.ExpectBegin()
+		setupMockBD(mocker, getRoleQuery, getRow(role, role.UpdatedAt), nil, role.ExternalID, false)
+		setupMockBD(mocker, deleteRoleQuery, getRow(role, role.UpdatedAt), nil, true, deletedAt, role.ExternalID, false, nil)
+		mocker.
+			ExpectQuery(regexp.QuoteMeta(createEventQuery)).
+			WithArgs(EventRoleDeleted, AggregateRole, role.ExternalID, sqlmock.AnyArg()).
+			WillReturnRows(getMockedExpectedEventRows(event))
+	}
+	expectAudit := func(mocker sqlmock.Sqlmock) *sqlmock.ExpectedQuery {
+		return mocker.
+			ExpectQuery(regexp.QuoteMeta(createAuditLogQuery)).
+			WithArgs(entry.ActorUsername, entry.ActorRole, entry.Action, AggregateRole, role.ExternalID, sqlmock.AnyArg(), nil, entry.ClientIP, entry.RequestID)
+	}
+
+	testCases := []struct {
+		name     string
+		mock     func(mocker sqlmock.Sqlmock)
+		response func(actual *Role, err error)
+	}{
+		{
+			name: "OK",
+			mock: func(mocker sqlmock.Sqlmock) {
+				expectDelete(mocker)
+				expectAudit(mocker).
+					WillReturnRows(sqlmock.NewRows(auditLogColumns).
+						AddRow(int64(1), entry.ActorUsername, entry.ActorRole, entry.Action, AggregateRole, role.ExternalID, []byte(`{}`), nil, entry.ClientIP, entry.RequestID, time.Now()))
+				mocker.ExpectCommit()
+			},
+			response: func(actual *Role, err error) {
+				require.NoError(t, err)
+				require.Equal(t, role.ExternalID, actual.ExternalID)
+			},
+		},
+		{
+			name: "AuditFails",
+			mock: func(mocker sqlmock.Sqlmock) {
+				expectDelete(mocker)
+				expectAudit(mocker).WillReturnError(sql.ErrConnDone)
+				mocker.ExpectRollback()
+			},
+			response: func(actual *Role, err error) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+				require.Nil(t, actual)
+			},
+		},
+		{
+			name: "BeforeNotFound",
+			mock: func(mocker sqlmock.Sqlmock) {
+				mocker.ExpectBegin()
+				setupMockBD(mocker, getRoleQuery, nil, sql.ErrNoRows, role.ExternalID, false)
+				mocker.ExpectRollback()
+			},
+			response: func(actual *Role, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Nil(t, actual)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mocker, err := sqlmock.New()
+			require.NoError(t, err)
+			defer func(db *sql.DB) {
+				_ = db.Close()
+			}(db)
+
+			tc.mock(mocker)
+			ctx := WithAuditEntry(context.Background(), entry)
+			tc.response(NewStore(db).DeleteRole(ctx, role.ExternalID, deletedAt, sql.NullInt64{}))
+			require.NoError(t, mocker.ExpectationsWereMet())
+		})
+	}
+}
+
+// jsonArgument matches a JSON document argument equal to the one it holds.
+type jsonArgument string
+
+func (expected jsonArgument) Match(actual driver.Value) bool {
+	document, ok := actual.(string)
+	if !ok {
+		return false
+	}
+	var want, got any
+	return json.Unmarshal([]byte(expected), &want) == nil && json.Unmarshal([]byte(document), &got) == nil &&
+		reflect.DeepEqual(want, got)
+}
+
+func TestSQLStore_AuditedSessionBlocks(t *testing.T) {
+	session := createSession(createSessionParams())
+	session.IsBlocked = true
+	entry := AuditEntry{ActorUsername: "posadactl:root", ActorRole: RoleSuperUser, Action: "session.block"}
+	event := &Event{ID: 1, Type: EventSessionBlocked, AggregateType: AggregateSession, AggregateID: session.ID.String(), Payload: []byte(`{}`)}
+	auditRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(auditLogColumns).
+			AddRow(int64(1), entry.ActorUsername, entry.ActorRole, entry.Action, AggregateSession, session.ID.String(), nil, []byte(`{}`), "", "", time.Now())
+	}
+
+	t.Run("BlockSession", func(t *testing.T) {
+		db, mocker, err := sqlmock.New()
+		require.NoError(t, err)
+		defer func(db *sql.DB) {
+			_ = db.Close()
+		}(db)
+
+		blocked, err := json.Marshal(sessionBlockedPayload{ID: session.ID, Username: session.Username, BlockedAt: session.BlockedAt})
+		require.NoError(t, err)
+
+		mocker.ExpectBegin()
+		mocker.ExpectExec(regexp.QuoteMeta(blockSessionQuery)).
+			WithArgs(true, sqlmock.AnyArg(), session.ID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mocker.ExpectQuery(regexp.QuoteMeta(getSessionQuery)).
+			WithArgs(session.ID).
+			WillReturnRows(getMockedExpectedCreateSession(session))
+		mocker.ExpectQuery(regexp.QuoteMeta(createEventQuery)).
+			WithArgs(EventSessionBlocked, AggregateSession, session.ID.String(), sqlmock.AnyArg()).
+			WillReturnRows(getMockedExpectedEventRows(event))
+		// the refresh token of the session is left out of the audit log
+		mocker.ExpectQuery(regexp.QuoteMeta(createAuditLogQuery)).
+			WithArgs(entry.ActorUsername, entry.ActorRole, entry.Action, AggregateSession, session.ID.String(), nil, jsonArgument(blocked), "", "").
+			WillReturnRows(auditRows())
+		mocker.ExpectCommit()
+
+		_, err = NewStore(db).BlockSession(WithAuditEntry(context.Background(), entry), session.ID)
+		require.NoError(t, err)
+		require.NoError(t, mocker.ExpectationsWereMet())
+	})
+
+	t.Run("BlockUserSessions", func(t *testing.T) {
+		db, mocker, err := sqlmock.New()
+		require.NoError(t, err)
+		defer func(db *sql.DB) {
+			_ = db.Close()
+		}(db)
+
+		blockedAt := time.Now()
+		mocker.ExpectBegin()
+		mocker.ExpectQuery(regexp.QuoteMeta(blockUserSessionsQuery)).
+			WithArgs(true, blockedAt, session.Username, false).
+			WillReturnRows(getMockedExpectedCreateSession(session))
+		mocker.ExpectQuery(regexp.QuoteMeta(createEventQuery)).
+			WithArgs(EventSessionBlocked, AggregateSession, session.ID.String(), sqlmock.AnyArg()).
+			WillReturnRows(getMockedExpectedEventRows(event))
+		mocker.ExpectQuery(regexp.QuoteMeta(createAuditLogQuery)).
+			WithArgs(entry.ActorUsername, entry.ActorRole, auditActionBlockSessions, AggregateUser, session.Username, nil,
+				jsonArgument(`{"sessions":["`+session.ID.String()+`"]}`), "", "").
+			WillReturnRows(auditRows())
+		mocker.ExpectCommit()
+
+		sessions, err := NewStore(db).BlockUserSessions(WithAuditEntry(context.Background(), entry), session.Username, blockedAt)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		require.NoError(t, mocker.ExpectationsWereMet())
+	})
+}
@@ -1,11 +1,26 @@
 package db
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+)
+
+// DBTX is implemented by both *sql.DB and *sql.Tx, so the same queries can run inside
+// or outside a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
 
 type Queries struct {
-	db *sql.DB
+	db DBTX
 }
 
-func New(db *sql.DB) *Queries {
+func New(db DBTX) *Queries {
 	return &Queries{db: db}
 }
+
+func (q *Queries) WithTx(tx *sql.Tx) *Queries {
+	return &Queries{db: tx}
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const createIdempotencyKeyQuery = `
+INSERT INTO idempotency_keys (scope, key, request_hash, created_at, expired_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (scope, key) DO UPDATE
+SET request_hash = excluded.request_hash,
+    is_completed = false,
+    status_code = 0,
+    content_type = '',
+    etag = '',
+    response_body = '',
+    created_at = excluded.created_at,
+    expired_at = excluded.expired_at
+WHERE idempotency_keys.expired_at <= excluded.created_at
+RETURNING scope, key, request_hash, is_completed, status_code, content_type, etag, response_body, created_at, expired_at;
+`
+
+type CreateIdempotencyKeyParams struct {
+	Scope       string
+	Key         string
+	RequestHash string
+	CreatedAt   time.Time
+	ExpiredAt   time.Time
+}
+
+// CreateIdempotencyKey claims a key for the request being processed. A key that has
+// expired is claimed again, while a live one is left untouched and sql.ErrNoRows is returned.
+func (q *Queries) CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (*IdempotencyKey, error) {
+	row := q.db.QueryRowContext(ctx, createIdempotencyKeyQuery,
+		arg.Scope,
+		arg.Key,
+		arg.RequestHash,
+		arg.CreatedAt,
+		arg.ExpiredAt,
+	)
+	return getIdempotencyKey(row)
+}
+
+const getIdempotencyKeyQuery = `
+SELECT scope, key, request_hash, is_completed, status_code, content_type, etag, response_body, created_at, expired_at
+FROM idempotency_keys WHERE scope = $1 AND key = $2;
+`
+
+func (q *Queries) GetIdempotencyKey(ctx context.Context, scope string, key string) (*IdempotencyKey, error) {
+	row := q.db.QueryRowContext(ctx, getIdempotencyKeyQuery, scope, key)
+	return getIdempotencyKey(row)
+}
+
+const completeIdempotencyKeyQuery = `
+UPDATE idempotency_keys SET is_completed = $1, status_code = $2, content_type = $3, etag = $4, response_body = $5
+WHERE scope = $6 AND key = $7;
+`
+
+type CompleteIdempotencyKeyParams struct {
+	Scope        string
+	Key          string
+	StatusCode   int32
+	ContentType  string
+	ETag         string
+	ResponseBody []byte
+}
+
+// CompleteIdempotencyKey stores the response to replay when the request is retried.
+func (q *Queries) CompleteIdempotencyKey(ctx context.Context, arg CompleteIdempotencyKeyParams) error {
+	_, err := q.db.ExecContext(ctx, completeIdempotencyKeyQuery,
+		true,
+		arg.StatusCode,
+		arg.ContentType,
+		arg.ETag,
+		arg.ResponseBody,
+		arg.Scope,
+		arg.Key,
+	)
+	return err
+}
+
+const deleteIdempotencyKeyQuery = `DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND is_completed = $3;`
+
+// DeleteIdempotencyKey releases a key whose request did not complete, so that a retry is
+// processed again.
+func (q *Queries) DeleteIdempotencyKey(ctx context.Context, scope string, key string) error {
+	_, err := q.db.ExecContext(ctx, deleteIdempotencyKeyQuery, scope, key, false)
+	return err
+}
+
+const purgeExpiredIdempotencyKeysQuery = `DELETE FROM idempotency_keys WHERE expired_at <= $1;`
+
+// PurgeExpiredIdempotencyKeys removes the keys expired at expiredBefore, which a retry would
+// claim again anyway, and returns how many were removed.
+func (q *Queries) PurgeExpiredIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeExpiredIdempotencyKeysQuery, expiredBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func getIdempotencyKey(row *sql.Row) (*IdempotencyKey, error) {
+	var idempotencyKey IdempotencyKey
+	err := row.Scan(
+		&idempotencyKey.Scope,
+		&idempotencyKey.Key,
+		&idempotencyKey.RequestHash,
+		&idempotencyKey.IsCompleted,
+		&idempotencyKey.StatusCode,
+		&idempotencyKey.ContentType,
+		&idempotencyKey.ETag,
+		&idempotencyKey.ResponseBody,
+		&idempotencyKey.CreatedAt,
+		&idempotencyKey.ExpiredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &idempotencyKey, nil
+}
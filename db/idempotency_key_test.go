@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var idempotencyKeyColumns = []string{"scope", "key", "request_hash", "is_completed", "status_code", "content_type", "etag", "response_body", "created_at", "expired_at"}
+
+func TestCreateIdempotencyKey(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	createdAt := time.Now()
+	arg := CreateIdempotencyKeyParams{
+		Scope:       "POST /api/v1/users ",
+		Key:         "4f9c0d6e",
+		RequestHash: "a1b2c3",
+		CreatedAt:   createdAt,
+		ExpiredAt:   createdAt.Add(24 * time.Hour),
+	}
+
+	testCases := []struct {
+		name     string
+		mock     func()
+		response func(idempotencyKey *IdempotencyKey, err error)
+	}{
+		{
+			name: "OK",
+			mock: func() {
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(createIdempotencyKeyQuery)).
+					WithArgs(arg.Scope, arg.Key, arg.RequestHash, arg.CreatedAt, arg.ExpiredAt).
+					WillReturnRows(sqlmock.NewRows(idempotencyKeyColumns).
+						AddRow(arg.Scope, arg.Key, arg.RequestHash, false, int32(0), "", "", []byte{}, arg.CreatedAt, arg.ExpiredAt))
+			},
+			response: func(idempotencyKey *IdempotencyKey, err error) {
+				require.NoError(t, err)
+				require.Equal(t, arg.Key, idempotencyKey.Key)
+				require.Equal(t, arg.RequestHash, idempotencyKey.RequestHash)
+				require.False(t, idempotencyKey.IsCompleted)
+			},
+		},
+		{
+			name: "KeyInUse",
+			mock: func() {
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(createIdempotencyKeyQuery)).
+					WithArgs(arg.Scope, arg.Key, arg.RequestHash, arg.CreatedAt, arg.ExpiredAt).
+					WillReturnRows(sqlmock.NewRows(idempotencyKeyColumns))
+			},
+			response: func(idempotencyKey *IdempotencyKey, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Nil(t, idempotencyKey)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.mock()
+			idempotencyKey, err := q.CreateIdempotencyKey(context.Background(), arg)
+			tc.response(idempotencyKey, err)
+			require.NoError(t, mocker.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCompleteIdempotencyKey(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	arg := CompleteIdempotencyKeyParams{
+		Scope:        "POST /api/v1/users ",
+		Key:          "4f9c0d6e",
+		StatusCode:   200,
+		ContentType:  "application/json; charset=utf-8",
+		ETag:         `"1"`,
+		ResponseBody: []byte(`{"username":"lexy"}`),
+	}
+
+	mocker.
+		ExpectExec(regexp.QuoteMeta(completeIdempotencyKeyQuery)).
+		WithArgs(true, arg.StatusCode, arg.ContentType, arg.ETag, arg.ResponseBody, arg.Scope, arg.Key).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, q.CompleteIdempotencyKey(context.Background(), arg))
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestDeleteIdempotencyKey(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+
+	mocker.
+		ExpectExec(regexp.QuoteMeta(deleteIdempotencyKeyQuery)).
+		WithArgs("POST /api/v1/users ", "4f9c0d6e", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, q.DeleteIdempotencyKey(context.Background(), "POST /api/v1/users ", "4f9c0d6e"))
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestPurgeExpiredIdempotencyKeys(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	expiredBefore := time.Now()
+
+	mocker.
+		ExpectExec(regexp.QuoteMeta(purgeExpiredIdempotencyKeysQuery)).
+		WithArgs(expiredBefore).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	purged, err := q.PurgeExpiredIdempotencyKeys(context.Background(), expiredBefore)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), purged)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
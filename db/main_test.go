@@ -67,7 +67,7 @@ func createRole() *Role {
 }
 
 func getMockedExpectedUserRows(user *User) *sqlmock.Rows {
-	return sqlmock.NewRows([]string{"username", "hashed_password", "full_name", "email", "password_changed_at", "users.created_at", "is_deleted", "deleted_at", "p.internal_id", "p.name", "p.description", "p.external_id", "p.created_at", "p.updated_at"}).
+	return sqlmock.NewRows([]string{"username", "hashed_password", "full_name", "email", "password_changed_at", "users.created_at", "is_deleted", "deleted_at", "p.internal_id", "p.name", "p.description", "p.external_id", "p.created_at", "p.updated_at", "users.version"}).
 		AddRow(
 			&user.Username,
 			&user.HashedPassword,
@@ -83,11 +83,12 @@ func getMockedExpectedUserRows(user *User) *sqlmock.Rows {
 			&user.Role.ExternalID,
 			&user.Role.CreatedAt,
 			&user.Role.UpdatedAt,
+			&user.Version,
 		)
 }
 
 func getMockedExpectedCreateUserRows(user *User) *sqlmock.Rows {
-	return sqlmock.NewRows([]string{"username", "hashed_password", "full_name", "email", "password_changed_at", "created_at", "role_id", "is_deleted", "deleted_at"}).
+	return sqlmock.NewRows([]string{"username", "hashed_password", "full_name", "email", "password_changed_at", "created_at", "role_id", "is_deleted", "deleted_at", "version"}).
 		AddRow(
 			&user.Username,
 			&user.HashedPassword,
@@ -98,11 +99,12 @@ func getMockedExpectedCreateUserRows(user *User) *sqlmock.Rows {
 			&user.Role.InternalID,
 			&user.IsDeleted,
 			&user.DeletedAt,
+			&user.Version,
 		)
 }
 
 func getMockedExpectedUpdateUserRows(user *User) *sqlmock.Rows {
-	return sqlmock.NewRows([]string{"username", "hashed_password", "full_name", "email", "password_changed_at", "created_at", "role_id", "is_deleted", "deleted_at"}).
+	return sqlmock.NewRows([]string{"username", "hashed_password", "full_name", "email", "password_changed_at", "created_at", "role_id", "is_deleted", "deleted_at", "version"}).
 		AddRow(
 			&user.Username,
 			&user.HashedPassword,
@@ -113,6 +115,7 @@ func getMockedExpectedUpdateUserRows(user *User) *sqlmock.Rows {
 			&user.Role.InternalID,
 			&user.IsDeleted,
 			&user.DeletedAt,
+			&user.Version,
 		)
 }
 
@@ -131,7 +134,7 @@ func getMockedWrongExpectedUserRows(user *User) *sqlmock.Rows {
 }
 
 func getMockedExpectedRoleRows(role *Role) *sqlmock.Rows {
-	return sqlmock.NewRows([]string{"internal_id", "name", "description", "external_id", "updated_at", "created_at"}).
+	return sqlmock.NewRows([]string{"internal_id", "name", "description", "external_id", "updated_at", "created_at", "version"}).
 		AddRow(
 			&role.InternalID,
 			&role.Name,
@@ -139,11 +142,12 @@ func getMockedExpectedRoleRows(role *Role) *sqlmock.Rows {
 			&role.ExternalID,
 			&role.UpdatedAt,
 			&role.CreatedAt,
+			&role.Version,
 		)
 }
 
 func getMultipleMockedExpectedUserRows(users []*User) *sqlmock.Rows {
-	rowHeading := sqlmock.NewRows([]string{"username", "hashed_password", "full_name", "email", "password_changed_at", "created_at", "role_id", "is_deleted", "deleted_at"})
+	rowHeading := sqlmock.NewRows([]string{"username", "hashed_password", "full_name", "email", "password_changed_at", "users.created_at", "is_deleted", "deleted_at", "r.internal_id", "r.name", "r.description", "r.external_id", "r.created_at", "r.updated_at", "users.version"})
 	for _, user := range users {
 		rowHeading = rowHeading.AddRow(
 			&user.Username,
@@ -152,16 +156,22 @@ func getMultipleMockedExpectedUserRows(users []*User) *sqlmock.Rows {
 			&user.Email,
 			&user.PasswordChangedAt,
 			&user.CreatedAt,
-			&user.Role.InternalID,
 			&user.IsDeleted,
 			&user.DeletedAt,
+			&user.Role.InternalID,
+			&user.Role.Name,
+			&user.Role.Description,
+			&user.Role.ExternalID,
+			&user.Role.CreatedAt,
+			&user.Role.UpdatedAt,
+			&user.Version,
 		)
 	}
 	return rowHeading
 }
 
 func getMultipleWrongMockedExpectedUserRows(users []*User) *sqlmock.Rows {
-	rowHeading := sqlmock.NewRows([]string{"username", "hashed_password", "full_name", "email", "password_changed_at", "created_at", "role_id", "is_deleted"})
+	rowHeading := sqlmock.NewRows([]string{"username", "hashed_password", "full_name", "email", "password_changed_at", "users.created_at", "is_deleted", "deleted_at"})
 	for _, user := range users {
 		rowHeading = rowHeading.AddRow(
 			&user.Username,
@@ -170,8 +180,8 @@ func getMultipleWrongMockedExpectedUserRows(users []*User) *sqlmock.Rows {
 			&user.Email,
 			&user.PasswordChangedAt,
 			&user.CreatedAt,
-			&user.Role.InternalID,
 			&user.IsDeleted,
+			&user.DeletedAt,
 		)
 	}
 	return rowHeading
@@ -230,7 +240,7 @@ func createSession(arg *CreateSessionParams) *Session {
 }
 
 func getMockedExpectedCreateProperty(property *Property) *sqlmock.Rows {
-	return sqlmock.NewRows([]string{"internal_id", "external_id", "name", "address", "state", "city", "country", "postal_code", "phone", "email", "is_active", "expired_at", "created_at"}).
+	return sqlmock.NewRows([]string{"internal_id", "external_id", "name", "address", "state", "city", "country", "postal_code", "phone", "email", "is_active", "expired_at", "created_at", "version"}).
 		AddRow(
 			&property.InternalID, // internal_id
 			&property.ExternalID, // external_id
@@ -245,6 +255,7 @@ func getMockedExpectedCreateProperty(property *Property) *sqlmock.Rows {
 			&property.IsActive,   // is_active
 			&property.ExpiredAt,  // expired_at
 			&property.CreatedAt,  // created_at
+			&property.Version,    // version
 		)
 }
 
@@ -282,7 +293,7 @@ func createPropertyParams() *CreatePropertyParams {
 }
 
 func getMockedExpectedProperty(property *Property) *sqlmock.Rows {
-	return sqlmock.NewRows([]string{"internal_id", "external_id", "name", "address", "state", "city", "country", "postal_code", "phone", "email", "is_active", "expired_at", "created_at"}).
+	return sqlmock.NewRows([]string{"internal_id", "external_id", "name", "address", "state", "city", "country", "postal_code", "phone", "email", "is_active", "expired_at", "created_at", "version"}).
 		AddRow(
 			&property.InternalID, // internal_id
 			&property.ExternalID, // external_id
@@ -297,5 +308,6 @@ func getMockedExpectedProperty(property *Property) *sqlmock.Rows {
 			&property.IsActive,   // is_active
 			&property.ExpiredAt,  // expired_at
 			&property.CreatedAt,  // created_at
+			&property.Version,    // version
 		)
 }
@@ -0,0 +1,9 @@
+package db
+
+import "embed"
+
+// Migrations holds the SQL files of the schema migrations, under the migration directory, so
+// that the binaries migrate the database without the sources next to them.
+//
+//go:embed migration/*.sql
+var Migrations embed.FS
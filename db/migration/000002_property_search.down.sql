@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "property_name_index";
+DROP INDEX IF EXISTS "property_created_at_index";
+DROP INDEX IF EXISTS "property_search_vector_index";
+
+ALTER TABLE IF EXISTS "property" DROP COLUMN IF EXISTS "search_vector";
@@ -0,0 +1,7 @@
+ALTER TABLE IF EXISTS "property"
+    ADD COLUMN IF NOT EXISTS "search_vector" tsvector
+        GENERATED ALWAYS AS (to_tsvector('simple', coalesce("name", '') || ' ' || coalesce("address", ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS "property_search_vector_index" ON "property" USING GIN ("search_vector");
+CREATE INDEX IF NOT EXISTS "property_created_at_index" ON "property" ("created_at");
+CREATE INDEX IF NOT EXISTS "property_name_index" ON "property" ("name");
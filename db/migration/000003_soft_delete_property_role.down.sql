@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS "users_role_id_index";
+DROP INDEX IF EXISTS "property_is_deleted_index";
+
+ALTER TABLE IF EXISTS "role"
+    DROP COLUMN IF EXISTS "deleted_at",
+    DROP COLUMN IF EXISTS "is_deleted";
+
+ALTER TABLE IF EXISTS "property"
+    DROP COLUMN IF EXISTS "deleted_at",
+    DROP COLUMN IF EXISTS "is_deleted";
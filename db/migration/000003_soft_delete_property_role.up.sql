@@ -0,0 +1,10 @@
+ALTER TABLE IF EXISTS "property"
+    ADD COLUMN IF NOT EXISTS "is_deleted" boolean     NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz NOT NULL DEFAULT ('0001-01-01');
+
+ALTER TABLE IF EXISTS "role"
+    ADD COLUMN IF NOT EXISTS "is_deleted" boolean     NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz NOT NULL DEFAULT ('0001-01-01');
+
+CREATE INDEX IF NOT EXISTS "property_is_deleted_index" ON "property" ("is_deleted");
+CREATE INDEX IF NOT EXISTS "users_role_id_index" ON "users" ("role_id");
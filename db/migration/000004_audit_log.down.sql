@@ -0,0 +1,6 @@
+DROP RULE IF EXISTS "audit_log_no_delete" ON "audit_log";
+DROP RULE IF EXISTS "audit_log_no_update" ON "audit_log";
+DROP INDEX IF EXISTS "audit_log_target_index";
+DROP INDEX IF EXISTS "audit_log_actor_index";
+DROP INDEX IF EXISTS "audit_log_created_at_index";
+DROP TABLE IF EXISTS "audit_log";
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS "audit_log"
+(
+    "id"             bigserial PRIMARY KEY,
+    "actor_username" text        NOT NULL,
+    "actor_role"     text        NOT NULL,
+    "action"         text        NOT NULL,
+    "target_type"    text        NOT NULL,
+    "target_id"      text        NOT NULL,
+    "before"         jsonb,
+    "after"          jsonb,
+    "client_ip"      text        NOT NULL,
+    "request_id"     text        NOT NULL,
+    "created_at"     timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX IF NOT EXISTS "audit_log_created_at_index" ON "audit_log" ("created_at");
+CREATE INDEX IF NOT EXISTS "audit_log_actor_index" ON "audit_log" ("actor_username");
+CREATE INDEX IF NOT EXISTS "audit_log_target_index" ON "audit_log" ("target_type", "target_id");
+
+-- the audit log is append-only: rows can be inserted but never changed or removed
+CREATE OR REPLACE RULE "audit_log_no_update" AS ON UPDATE TO "audit_log" DO INSTEAD NOTHING;
+CREATE OR REPLACE RULE "audit_log_no_delete" AS ON DELETE TO "audit_log" DO INSTEAD NOTHING;
@@ -0,0 +1,8 @@
+ALTER TABLE IF EXISTS "users"
+    DROP COLUMN IF EXISTS "version";
+
+ALTER TABLE IF EXISTS "role"
+    DROP COLUMN IF EXISTS "version";
+
+ALTER TABLE IF EXISTS "property"
+    DROP COLUMN IF EXISTS "version";
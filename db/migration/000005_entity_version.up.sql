@@ -0,0 +1,8 @@
+ALTER TABLE IF EXISTS "property"
+    ADD COLUMN IF NOT EXISTS "version" bigint NOT NULL DEFAULT 1;
+
+ALTER TABLE IF EXISTS "role"
+    ADD COLUMN IF NOT EXISTS "version" bigint NOT NULL DEFAULT 1;
+
+ALTER TABLE IF EXISTS "users"
+    ADD COLUMN IF NOT EXISTS "version" bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS "idempotency_keys"
+(
+    "scope"         text        NOT NULL,
+    "key"           text        NOT NULL,
+    "request_hash"  text        NOT NULL,
+    "is_completed"  boolean     NOT NULL DEFAULT false,
+    "status_code"   integer     NOT NULL DEFAULT 0,
+    "content_type"  text        NOT NULL DEFAULT '',
+    "response_body" bytea       NOT NULL DEFAULT '',
+    "created_at"    timestamptz NOT NULL DEFAULT (now()),
+    "expired_at"    timestamptz NOT NULL,
+    PRIMARY KEY ("scope", "key")
+);
+
+CREATE INDEX IF NOT EXISTS "idempotency_keys_expired_at_index" ON "idempotency_keys" ("expired_at");
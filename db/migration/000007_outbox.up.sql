@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS "outbox"
+(
+    "id"             bigserial PRIMARY KEY,
+    "event_type"     text        NOT NULL,
+    "aggregate_type" text        NOT NULL,
+    "aggregate_id"   text        NOT NULL,
+    "payload"        jsonb       NOT NULL,
+    "attempts"       integer     NOT NULL DEFAULT 0,
+    "last_error"     text        NOT NULL DEFAULT '',
+    "available_at"   timestamptz NOT NULL DEFAULT (now()),
+    "created_at"     timestamptz NOT NULL DEFAULT (now()),
+    "dispatched_at"  timestamptz
+);
+
+-- the dispatcher only ever looks for pending events that are due
+CREATE INDEX IF NOT EXISTS "outbox_pending_index" ON "outbox" ("available_at") WHERE "dispatched_at" IS NULL;
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS "webhook_subscriptions"
+(
+    "id"          bigserial PRIMARY KEY,
+    "url"         text        NOT NULL,
+    "event_types" text[]      NOT NULL,
+    "secret"      text        NOT NULL,
+    "is_active"   boolean     NOT NULL DEFAULT true,
+    "created_at"  timestamptz NOT NULL DEFAULT (now()),
+    "updated_at"  timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE IF NOT EXISTS "webhook_deliveries"
+(
+    "id"              bigserial PRIMARY KEY,
+    "subscription_id" bigint      NOT NULL REFERENCES "webhook_subscriptions" ("id") ON DELETE CASCADE,
+    "event_id"        bigint      NOT NULL,
+    "event_type"      text        NOT NULL,
+    "payload"         jsonb       NOT NULL,
+    "status"          text        NOT NULL DEFAULT 'pending',
+    "attempts"        integer     NOT NULL DEFAULT 0,
+    "response_status" integer     NOT NULL DEFAULT 0,
+    "response_body"   text        NOT NULL DEFAULT '',
+    "last_error"      text        NOT NULL DEFAULT '',
+    "next_attempt_at" timestamptz NOT NULL DEFAULT (now()),
+    "created_at"      timestamptz NOT NULL DEFAULT (now()),
+    "delivered_at"    timestamptz,
+    -- an event handed out twice by the outbox must not be delivered twice to the same subscriber
+    UNIQUE ("subscription_id", "event_id")
+);
+
+CREATE INDEX IF NOT EXISTS "webhook_deliveries_pending_index" ON "webhook_deliveries" ("next_attempt_at") WHERE "status" = 'pending';
+CREATE INDEX IF NOT EXISTS "webhook_deliveries_subscription_index" ON "webhook_deliveries" ("subscription_id", "created_at");
@@ -0,0 +1,15 @@
+-- the default users are not seeded again, as their password is public
+CREATE OR REPLACE FUNCTION create_user(user_name TEXT, hashedPassword TEXT, fullName TEXT, userEmail TEXT,
+                                       role_type TEXT) RETURNS void AS
+$$
+DECLARE
+    role_uuid uuid;
+BEGIN
+    SELECT internal_id INTO role_uuid FROM role WHERE name = role_type;
+
+    INSERT INTO users ("username", hashed_password, full_name, email, role_id)
+    VALUES (user_name, hashedPassword, fullName, userEmail, role_uuid);
+END;
+$$
+    LANGUAGE plpgsql
+    SECURITY DEFINER;
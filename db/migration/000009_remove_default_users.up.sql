@@ -0,0 +1,8 @@
+-- the users seeded by the first migration share a published password hash: the ones still
+-- using it are removed, and the accounts are now created with posadactl
+DELETE
+FROM users
+WHERE username IN ('su', 'anewball', 'jayjay')
+  AND hashed_password = '$2a$10$ovvoX8WckUAZTEhRLfIWKOcwcp2qeAvNZoAIXrE5ve1PccMGZpSDa';
+
+DROP FUNCTION IF EXISTS create_user(TEXT, TEXT, TEXT, TEXT, TEXT);
@@ -0,0 +1 @@
+ALTER TABLE "idempotency_keys" ADD COLUMN IF NOT EXISTS "etag" text NOT NULL DEFAULT '';
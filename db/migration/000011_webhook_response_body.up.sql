@@ -0,0 +1,2 @@
+-- the body of a receiver's response is no longer kept, as the url may lead to an internal service
+ALTER TABLE "webhook_deliveries" DROP COLUMN IF EXISTS "response_body";
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS "outbox_dispatched_index";
+
+DROP INDEX IF EXISTS "outbox_pending_index";
+CREATE INDEX IF NOT EXISTS "outbox_pending_index" ON "outbox" ("available_at") WHERE "dispatched_at" IS NULL;
+
+ALTER TABLE "outbox" DROP COLUMN IF EXISTS "failed_at";
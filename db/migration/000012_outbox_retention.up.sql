@@ -0,0 +1,8 @@
+-- an event that keeps failing is given up on after outbox_max_attempts, and kept for inspection
+ALTER TABLE "outbox" ADD COLUMN IF NOT EXISTS "failed_at" timestamptz;
+
+DROP INDEX IF EXISTS "outbox_pending_index";
+CREATE INDEX IF NOT EXISTS "outbox_pending_index" ON "outbox" ("available_at") WHERE "dispatched_at" IS NULL AND "failed_at" IS NULL;
+
+-- the dispatched events are purged once they are older than outbox_retention
+CREATE INDEX IF NOT EXISTS "outbox_dispatched_index" ON "outbox" ("dispatched_at") WHERE "dispatched_at" IS NOT NULL;
@@ -0,0 +1,187 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/newbri/posadamissportia/db"
+	"io"
+	"strconv"
+)
+
+// Schema is what the migrate command needs of a Migrator.
+type Schema interface {
+	Up() error
+	Down(steps int) error
+	To(version uint) error
+	Force(version int) error
+	Version() (version uint, dirty bool, err error)
+}
+
+// Migrator migrates a database with the migrations embedded in db.Migrations.
+type Migrator struct {
+	migrate *migrate.Migrate
+}
+
+// New returns a Migrator for the postgres database at the dbSource URL. It has to be closed.
+func New(dbSource string) (*Migrator, error) {
+	source, err := iofs.New(db.Migrations, "migration")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the migrations: %w", err)
+	}
+	m, err := migrate.NewWithSourceInstance("iofs", source, dbSource)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the migrate instance: %w", err)
+	}
+	return &Migrator{migrate: m}, nil
+}
+
+// Up applies every migration the database does not have yet.
+func (m *Migrator) Up() error {
+	return ignoreNoChange(m.migrate.Up())
+}
+
+// Down reverts the last steps migrations.
+func (m *Migrator) Down(steps int) error {
+	return ignoreNoChange(m.migrate.Steps(-steps))
+}
+
+// To migrates the database up or down to version.
+func (m *Migrator) To(version uint) error {
+	return ignoreNoChange(m.migrate.Migrate(version))
+}
+
+// Force sets the version of the database without running any migration, to recover from a
+// migration that failed halfway and left the database dirty.
+func (m *Migrator) Force(version int) error {
+	return m.migrate.Force(version)
+}
+
+// Version returns the version of the database, 0 before the first migration, and whether
+// the last migration failed halfway.
+func (m *Migrator) Version() (uint, bool, error) {
+	version, dirty, err := m.migrate.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+func (m *Migrator) Close() error {
+	sourceErr, databaseErr := m.migrate.Close()
+	return errors.Join(sourceErr, databaseErr)
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
+// Check returns an error unless the schema is at db.SchemaVersion, the version the code
+// expects.
+func Check(schema Schema) error {
+	version, dirty, err := schema.Version()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("the migration to version %d did not complete", version)
+	}
+	if version != db.SchemaVersion {
+		return fmt.Errorf("the schema is at version %d instead of %d", version, db.SchemaVersion)
+	}
+	return nil
+}
+
+// Run runs the migrate command in args and prints the version of the schema afterwards:
+//
+//	up          applies every pending migration
+//	down [N]    reverts the last N migrations, 1 by default
+//	to N        migrates up or down to version N
+//	status      only prints the version
+//	force N     sets the version to N without migrating, after a failed migration
+func Run(schema Schema, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("missing migrate command: up, down [N], to N, status or force N")
+	}
+
+	command, args := args[0], args[1:]
+	var err error
+	switch command {
+	case "up":
+		if err = expectArgs(command, args, 0); err == nil {
+			err = schema.Up()
+		}
+	case "down":
+		steps := 1
+		if len(args) > 0 {
+			steps, err = numberArg(command, args)
+		}
+		if err == nil && steps == 0 {
+			err = errors.New("migrate down reverts at least 1 migration")
+		}
+		if err == nil {
+			err = schema.Down(steps)
+		}
+	case "to":
+		var version int
+		if version, err = numberArg(command, args); err == nil {
+			err = schema.To(uint(version))
+		}
+	case "force":
+		var version int
+		if version, err = numberArg(command, args); err == nil {
+			err = schema.Force(version)
+		}
+	case "status":
+		err = expectArgs(command, args, 0)
+	default:
+		return fmt.Errorf("unknown migrate command %q: expected up, down [N], to N, status or force N", command)
+	}
+	if err != nil {
+		return err
+	}
+
+	return printStatus(schema, out)
+}
+
+func printStatus(schema Schema, out io.Writer) error {
+	version, dirty, err := schema.Version()
+	if err != nil {
+		return err
+	}
+	state := "up to date"
+	switch {
+	case dirty:
+		state = "dirty, fix the database and force the version"
+	case version < db.SchemaVersion:
+		state = fmt.Sprintf("%d migrations pending", db.SchemaVersion-version)
+	case version > db.SchemaVersion:
+		state = "ahead of this binary"
+	}
+	_, err = fmt.Fprintf(out, "schema version %d of %d: %s\n", version, db.SchemaVersion, state)
+	return err
+}
+
+func expectArgs(command string, args []string, count int) error {
+	if len(args) != count {
+		return fmt.Errorf("migrate %s expects %d arguments, got %d", command, count, len(args))
+	}
+	return nil
+}
+
+// numberArg parses the single migration number args holds.
+func numberArg(command string, args []string) (int, error) {
+	if err := expectArgs(command, args, 1); err != nil {
+		return 0, err
+	}
+	number, err := strconv.Atoi(args[0])
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("%q is not a migration number", args[0])
+	}
+	return number, nil
+}
@@ -0,0 +1,163 @@
+package migrator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// fakeSchema records the migrations instead of running them.
+type fakeSchema struct {
+	version uint
+	dirty   bool
+	calls   []string
+}
+
+func (s *fakeSchema) Up() error {
+	s.calls = append(s.calls, "up")
+	s.version = db.SchemaVersion
+	return nil
+}
+
+func (s *fakeSchema) Down(steps int) error {
+	if uint(steps) > s.version {
+		return errors.New("no migration")
+	}
+	s.calls = append(s.calls, "down")
+	s.version -= uint(steps)
+	return nil
+}
+
+func (s *fakeSchema) To(version uint) error {
+	s.calls = append(s.calls, "to")
+	s.version = version
+	return nil
+}
+
+func (s *fakeSchema) Force(version int) error {
+	s.calls = append(s.calls, "force")
+	s.version, s.dirty = uint(version), false
+	return nil
+}
+
+func (s *fakeSchema) Version() (uint, bool, error) {
+	return s.version, s.dirty, nil
+}
+
+// status is the line Run prints for a schema at version.
+func status(version uint, state string) string {
+	return fmt.Sprintf("schema version %d of %d: %s\n", version, db.SchemaVersion, state)
+}
+
+func TestRun(t *testing.T) {
+	const latest = db.SchemaVersion
+	testCases := []struct {
+		name    string
+		schema  fakeSchema
+		args    []string
+		calls   []string
+		out     string
+		wantErr string
+	}{
+		{
+			name:  "Up",
+			args:  []string{"up"},
+			calls: []string{"up"},
+			out:   status(latest, "up to date"),
+		},
+		{
+			name:   "Down",
+			schema: fakeSchema{version: latest},
+			args:   []string{"down"},
+			calls:  []string{"down"},
+			out:    status(latest-1, "1 migrations pending"),
+		},
+		{
+			name:   "Down Steps",
+			schema: fakeSchema{version: latest},
+			args:   []string{"down", "3"},
+			calls:  []string{"down"},
+			out:    status(latest-3, "3 migrations pending"),
+		},
+		{
+			name:   "To",
+			schema: fakeSchema{version: 2},
+			args:   []string{"to", "5"},
+			calls:  []string{"to"},
+			out:    status(5, fmt.Sprintf("%d migrations pending", latest-5)),
+		},
+		{
+			name:   "Force",
+			schema: fakeSchema{version: 4, dirty: true},
+			args:   []string{"force", "3"},
+			calls:  []string{"force"},
+			out:    status(3, fmt.Sprintf("%d migrations pending", latest-3)),
+		},
+		{
+			name:   "Status Dirty",
+			schema: fakeSchema{version: 4, dirty: true},
+			args:   []string{"status"},
+			out:    status(4, "dirty, fix the database and force the version"),
+		},
+		{
+			name:   "Status Ahead",
+			schema: fakeSchema{version: latest + 1},
+			args:   []string{"status"},
+			out:    status(latest+1, "ahead of this binary"),
+		},
+		{
+			name:    "Missing Command",
+			wantErr: "missing migrate command: up, down [N], to N, status or force N",
+		},
+		{
+			name:    "Unknown Command",
+			args:    []string{"sideways"},
+			wantErr: `unknown migrate command "sideways": expected up, down [N], to N, status or force N`,
+		},
+		{
+			name:    "Down Zero",
+			args:    []string{"down", "0"},
+			wantErr: "migrate down reverts at least 1 migration",
+		},
+		{
+			name:    "To Missing Version",
+			args:    []string{"to"},
+			wantErr: "migrate to expects 1 arguments, got 0",
+		},
+		{
+			name:    "Force Not A Number",
+			args:    []string{"force", "-1"},
+			wantErr: `"-1" is not a migration number`,
+		},
+		{
+			name:    "Migration Error",
+			schema:  fakeSchema{version: 1},
+			args:    []string{"down", "2"},
+			wantErr: "no migration",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			err := Run(&tc.schema, tc.args, out)
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				require.Empty(t, out.String())
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.calls, tc.schema.calls)
+			require.Equal(t, tc.out, out.String())
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	require.NoError(t, Check(&fakeSchema{version: db.SchemaVersion}))
+	require.EqualError(t, Check(&fakeSchema{version: 7}), fmt.Sprintf("the schema is at version 7 instead of %d", db.SchemaVersion))
+	require.EqualError(t, Check(&fakeSchema{version: db.SchemaVersion, dirty: true}), fmt.Sprintf("the migration to version %d did not complete", db.SchemaVersion))
+}
@@ -2,6 +2,8 @@ package mocker
 
 import (
 	"context"
+	"database/sql"
+	"github.com/google/uuid"
 	"github.com/newbri/posadamissportia/configuration"
 	"github.com/newbri/posadamissportia/db"
 	"github.com/newbri/posadamissportia/token"
@@ -37,8 +39,8 @@ func (m *TestMocker) GetUser(ctx context.Context, username string) (*db.User, er
 	return ret0, ret1
 }
 
-func (m *TestMocker) DeleteUser(ctx context.Context, username string, deletedAt time.Time) (*db.User, error) {
-	args := m.Called(ctx, username, deletedAt)
+func (m *TestMocker) DeleteUser(ctx context.Context, username string, deletedAt time.Time, version sql.NullInt64) (*db.User, error) {
+	args := m.Called(ctx, username, deletedAt, version)
 	ret0, _ := args.Get(0).(*db.User)
 	ret1, _ := args.Get(1).(error)
 	return ret0, ret1
@@ -73,16 +75,9 @@ func (m *TestMocker) CreateSession(ctx context.Context, arg db.CreateSessionPara
 	return ret0, ret1
 }
 
-func (m *TestMocker) GetAllCustomer(ctx context.Context, arg db.ListUsersParams) ([]*db.User, error) {
+func (m *TestMocker) SearchUsers(ctx context.Context, arg db.SearchUsersParams) (*db.SearchUsersResult, error) {
 	args := m.Called(ctx, arg)
-	ret0, _ := args.Get(0).([]*db.User)
-	ret1, _ := args.Get(1).(error)
-	return ret0, ret1
-}
-
-func (m *TestMocker) GetAllAdmin(ctx context.Context, arg db.ListUsersParams) ([]*db.User, error) {
-	args := m.Called(ctx, arg)
-	ret0, _ := args.Get(0).([]*db.User)
+	ret0, _ := args.Get(0).(*db.SearchUsersResult)
 	ret1, _ := args.Get(1).(error)
 	return ret0, ret1
 }
@@ -115,8 +110,8 @@ func (m *TestMocker) UpdateRole(ctx context.Context, arg db.UpdateRoleParams) (*
 	return ret0, ret1
 }
 
-func (m *TestMocker) DeleteRole(ctx context.Context, externalID string) (*db.Role, error) {
-	args := m.Called(ctx, externalID)
+func (m *TestMocker) DeleteRole(ctx context.Context, externalID string, deletedAt time.Time, version sql.NullInt64) (*db.Role, error) {
+	args := m.Called(ctx, externalID, deletedAt, version)
 	ret0, _ := args.Get(0).(*db.Role)
 	ret1, _ := args.Get(1).(error)
 	return ret0, ret1
@@ -134,3 +129,268 @@ func (m *TestMocker) GetUserByEmail(ctx context.Context, email string) (*db.User
 	ret1, _ := args.Get(1).(error)
 	return ret0, ret1
 }
+
+func (m *TestMocker) GetAllProperty(ctx context.Context, arg db.ListPropertyParams) ([]*db.Property, error) {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).([]*db.Property)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) RestoreUser(ctx context.Context, username string) (*db.User, error) {
+	args := m.Called(ctx, username)
+	ret0, _ := args.Get(0).(*db.User)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	args := m.Called(ctx, deletedBefore)
+	ret0, _ := args.Get(0).(int64)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) RestoreRole(ctx context.Context, externalID string) (*db.Role, error) {
+	args := m.Called(ctx, externalID)
+	ret0, _ := args.Get(0).(*db.Role)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) GetProperty(ctx context.Context, externalID string) (*db.Property, error) {
+	args := m.Called(ctx, externalID)
+	ret0, _ := args.Get(0).(*db.Property)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) UpdateProperty(ctx context.Context, arg db.UpdatePropertyParams) (*db.Property, error) {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).(*db.Property)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) DeleteProperty(ctx context.Context, externalID string, deletedAt time.Time, version sql.NullInt64) (*db.Property, error) {
+	args := m.Called(ctx, externalID, deletedAt, version)
+	ret0, _ := args.Get(0).(*db.Property)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) RestoreProperty(ctx context.Context, externalID string) (*db.Property, error) {
+	args := m.Called(ctx, externalID)
+	ret0, _ := args.Get(0).(*db.Property)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) BlockSession(ctx context.Context, sessionID uuid.UUID) (*db.Session, error) {
+	args := m.Called(ctx, sessionID)
+	ret0, _ := args.Get(0).(*db.Session)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) BlockUserSessions(ctx context.Context, username string, blockedAt time.Time) ([]*db.Session, error) {
+	args := m.Called(ctx, username, blockedAt)
+	ret0, _ := args.Get(0).([]*db.Session)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) CreateAuditLog(ctx context.Context, arg db.CreateAuditLogParams) (*db.AuditLog, error) {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).(*db.AuditLog)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) ListAuditLog(ctx context.Context, arg db.ListAuditLogParams) ([]*db.AuditLog, error) {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).([]*db.AuditLog)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) CreateIdempotencyKey(ctx context.Context, arg db.CreateIdempotencyKeyParams) (*db.IdempotencyKey, error) {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).(*db.IdempotencyKey)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) GetIdempotencyKey(ctx context.Context, scope string, key string) (*db.IdempotencyKey, error) {
+	args := m.Called(ctx, scope, key)
+	ret0, _ := args.Get(0).(*db.IdempotencyKey)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) CompleteIdempotencyKey(ctx context.Context, arg db.CompleteIdempotencyKeyParams) error {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).(error)
+	return ret0
+}
+
+func (m *TestMocker) DeleteIdempotencyKey(ctx context.Context, scope string, key string) error {
+	args := m.Called(ctx, scope, key)
+	ret0, _ := args.Get(0).(error)
+	return ret0
+}
+
+func (m *TestMocker) PurgeExpiredIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	args := m.Called(ctx, expiredBefore)
+	ret0, _ := args.Get(0).(int64)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) ClaimEvents(ctx context.Context, arg db.ClaimEventsParams) ([]*db.Event, error) {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).([]*db.Event)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) MarkEventDispatched(ctx context.Context, id int64, dispatchedAt time.Time) error {
+	args := m.Called(ctx, id, dispatchedAt)
+	ret0, _ := args.Get(0).(error)
+	return ret0
+}
+
+func (m *TestMocker) RetryEvent(ctx context.Context, arg db.RetryEventParams) error {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).(error)
+	return ret0
+}
+
+func (m *TestMocker) MarkEventFailed(ctx context.Context, arg db.MarkEventFailedParams) error {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).(error)
+	return ret0
+}
+
+func (m *TestMocker) PurgeDispatchedEvents(ctx context.Context, dispatchedBefore time.Time) (int64, error) {
+	args := m.Called(ctx, dispatchedBefore)
+	ret0, _ := args.Get(0).(int64)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) CreateWebhookSubscription(ctx context.Context, arg db.CreateWebhookSubscriptionParams) (*db.WebhookSubscription, error) {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).(*db.WebhookSubscription)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) GetWebhookSubscription(ctx context.Context, id int64) (*db.WebhookSubscription, error) {
+	args := m.Called(ctx, id)
+	ret0, _ := args.Get(0).(*db.WebhookSubscription)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) ListWebhookSubscriptions(ctx context.Context, arg db.LimitOffset) ([]*db.WebhookSubscription, error) {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).([]*db.WebhookSubscription)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) ListWebhookSubscriptionsForEvent(ctx context.Context, eventType string) ([]*db.WebhookSubscription, error) {
+	args := m.Called(ctx, eventType)
+	ret0, _ := args.Get(0).([]*db.WebhookSubscription)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) UpdateWebhookSubscription(ctx context.Context, arg db.UpdateWebhookSubscriptionParams) (*db.WebhookSubscription, error) {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).(*db.WebhookSubscription)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) DeleteWebhookSubscription(ctx context.Context, id int64) (*db.WebhookSubscription, error) {
+	args := m.Called(ctx, id)
+	ret0, _ := args.Get(0).(*db.WebhookSubscription)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) CreateWebhookDelivery(ctx context.Context, arg db.CreateWebhookDeliveryParams) error {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).(error)
+	return ret0
+}
+
+func (m *TestMocker) ClaimWebhookDeliveries(ctx context.Context, arg db.ClaimWebhookDeliveriesParams) ([]*db.WebhookDelivery, error) {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).([]*db.WebhookDelivery)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) RecordWebhookDeliveryAttempt(ctx context.Context, arg db.RecordWebhookDeliveryAttemptParams) error {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).(error)
+	return ret0
+}
+
+func (m *TestMocker) ListWebhookDeliveries(ctx context.Context, arg db.ListWebhookDeliveriesParams) ([]*db.WebhookDelivery, error) {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).([]*db.WebhookDelivery)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) RedeliverWebhookDelivery(ctx context.Context, subscriptionID int64, id int64, nextAttemptAt time.Time) (*db.WebhookDelivery, error) {
+	args := m.Called(ctx, subscriptionID, id, nextAttemptAt)
+	ret0, _ := args.Get(0).(*db.WebhookDelivery)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) ListEvents(ctx context.Context, arg db.ListEventsParams) ([]*db.Event, error) {
+	args := m.Called(ctx, arg)
+	ret0, _ := args.Get(0).([]*db.Event)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) ListUserPropertyIDs(ctx context.Context, username string) ([]string, error) {
+	args := m.Called(ctx, username)
+	ret0, _ := args.Get(0).([]string)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) UserSharesProperty(ctx context.Context, username string, other string) (bool, error) {
+	args := m.Called(ctx, username, other)
+	ret0, _ := args.Get(0).(bool)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) GetSchemaMigration(ctx context.Context) (*db.SchemaMigration, error) {
+	args := m.Called(ctx)
+	ret0, _ := args.Get(0).(*db.SchemaMigration)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) UpdateUserAndBlockSessions(ctx context.Context, arg db.UpdateUserParams, blockedAt time.Time) (*db.UserSessionsUpdate, error) {
+	args := m.Called(ctx, arg, blockedAt)
+	ret0, _ := args.Get(0).(*db.UserSessionsUpdate)
+	ret1, _ := args.Get(1).(error)
+	return ret0, ret1
+}
+
+func (m *TestMocker) Ping(ctx context.Context) error {
+	args := m.Called(ctx)
+	ret0, _ := args.Get(0).(error)
+	return ret0
+}
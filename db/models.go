@@ -1,6 +1,8 @@
 package db
 
 import (
+	"database/sql"
+	"encoding/json"
 	"github.com/google/uuid"
 	"time"
 )
@@ -15,6 +17,7 @@ type User struct {
 	IsDeleted         bool      `json:"-"`
 	DeletedAt         time.Time `json:"-"`
 	Role              *Role     `json:"role"`
+	Version           int64     `json:"-"`
 }
 
 type Session struct {
@@ -36,6 +39,7 @@ type Role struct {
 	ExternalID  string    `json:"external_id"`
 	UpdatedAt   time.Time `json:"expired_at"`
 	CreatedAt   time.Time `json:"created_at"`
+	Version     int64     `json:"-"`
 }
 
 type Property struct {
@@ -52,9 +56,80 @@ type Property struct {
 	IsActive   bool      `json:"is_active"`
 	ExpiredAt  time.Time `json:"expired_at"`
 	CreatedAt  time.Time `json:"created_at"`
+	Version    int64     `json:"-"`
 }
 
 type LimitOffset struct {
 	Limit  int32 `json:"limit"`
 	Offset int32 `json:"offset"`
 }
+
+type AuditLog struct {
+	ID            int64           `json:"id"`
+	ActorUsername string          `json:"actor_username"`
+	ActorRole     string          `json:"actor_role"`
+	Action        string          `json:"action"`
+	TargetType    string          `json:"target_type"`
+	TargetID      string          `json:"target_id"`
+	Before        json.RawMessage `json:"before"`
+	After         json.RawMessage `json:"after"`
+	ClientIP      string          `json:"client_ip"`
+	RequestID     string          `json:"request_id"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+type IdempotencyKey struct {
+	Scope        string    `json:"scope"`
+	Key          string    `json:"key"`
+	RequestHash  string    `json:"request_hash"`
+	IsCompleted  bool      `json:"is_completed"`
+	StatusCode   int32     `json:"status_code"`
+	ContentType  string    `json:"content_type"`
+	ETag         string    `json:"etag"`
+	ResponseBody []byte    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiredAt    time.Time `json:"expired_at"`
+}
+
+type Event struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	Attempts      int32           `json:"attempts"`
+	LastError     string          `json:"last_error"`
+	AvailableAt   time.Time       `json:"available_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DispatchedAt  sql.NullTime    `json:"-"`
+}
+
+type WebhookSubscription struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"-"`
+	IsActive   bool      `json:"is_active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	EventID        int64           `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	ResponseStatus int32           `json:"response_status"`
+	LastError      string          `json:"last_error"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    sql.NullTime    `json:"-"`
+}
+
+type SchemaMigration struct {
+	Version int64 `json:"version"`
+	Dirty   bool  `json:"dirty"`
+}
@@ -0,0 +1,218 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	EventUserCreated         = "user.created"
+	EventUserUpdated         = "user.updated"
+	EventUserDeleted         = "user.deleted"
+	EventUserRestored        = "user.restored"
+	EventRoleCreated         = "role.created"
+	EventRoleUpdated         = "role.updated"
+	EventRoleDeleted         = "role.deleted"
+	EventRoleRestored        = "role.restored"
+	EventPropertyCreated     = "property.created"
+	EventPropertyUpdated     = "property.updated"
+	EventPropertyActivated   = "property.activated"
+	EventPropertyDeactivated = "property.deactivated"
+	EventPropertyDeleted     = "property.deleted"
+	EventPropertyRestored    = "property.restored"
+	EventSessionBlocked      = "session.blocked"
+)
+
+// EventTypes lists every event type recorded in the outbox.
+var EventTypes = []string{
+	EventUserCreated, EventUserUpdated, EventUserDeleted, EventUserRestored,
+	EventRoleCreated, EventRoleUpdated, EventRoleDeleted, EventRoleRestored,
+	EventPropertyCreated, EventPropertyUpdated, EventPropertyActivated, EventPropertyDeactivated,
+	EventPropertyDeleted, EventPropertyRestored,
+	EventSessionBlocked,
+}
+
+const (
+	AggregateUser     = "user"
+	AggregateRole     = "role"
+	AggregateProperty = "property"
+	AggregateSession  = "session"
+)
+
+const createEventQuery = `
+INSERT INTO outbox (event_type, aggregate_type, aggregate_id, payload)
+VALUES ($1, $2, $3, $4)
+RETURNING id, event_type, aggregate_type, aggregate_id, payload, attempts, last_error, available_at, created_at, dispatched_at;
+`
+
+type CreateEventParams struct {
+	Type          string
+	AggregateType string
+	AggregateID   string
+	Payload       any
+}
+
+// createEvent records an event in the outbox. It is meant to run in the transaction of
+// the mutation the event describes, so that the event exists if and only if the mutation
+// was committed.
+func (q *Queries) createEvent(ctx context.Context, arg CreateEventParams) (*Event, error) {
+	payload, err := json.Marshal(arg.Payload)
+	if err != nil {
+		return nil, err
+	}
+	row := q.db.QueryRowContext(ctx, createEventQuery, arg.Type, arg.AggregateType, arg.AggregateID, string(payload))
+	return scanEvent(row)
+}
+
+const claimEventsQuery = `
+UPDATE outbox SET attempts = attempts + 1, available_at = $1
+WHERE id IN (SELECT id FROM outbox
+             WHERE dispatched_at IS NULL AND failed_at IS NULL AND available_at <= $2
+             ORDER BY id
+             LIMIT $3 FOR UPDATE SKIP LOCKED)
+RETURNING id, event_type, aggregate_type, aggregate_id, payload, attempts, last_error, available_at, created_at, dispatched_at;
+`
+
+type ClaimEventsParams struct {
+	Now        time.Time
+	LeaseUntil time.Time
+	Limit      int32
+}
+
+// ClaimEvents leases the oldest pending events that are due. A claimed event is not handed
+// out again until LeaseUntil, so concurrent dispatchers never process the same event at the
+// same time, while an event whose dispatcher died is picked up again once the lease expires.
+func (q *Queries) ClaimEvents(ctx context.Context, arg ClaimEventsParams) ([]*Event, error) {
+	rows, err := q.db.QueryContext(ctx, claimEventsQuery, arg.LeaseUntil, arg.Now, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	events := []*Event{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+const markEventDispatchedQuery = `UPDATE outbox SET dispatched_at = $1, last_error = $2 WHERE id = $3;`
+
+func (q *Queries) MarkEventDispatched(ctx context.Context, id int64, dispatchedAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, markEventDispatchedQuery, dispatchedAt, "", id)
+	return err
+}
+
+const retryEventQuery = `UPDATE outbox SET available_at = $1, last_error = $2 WHERE id = $3 AND dispatched_at IS NULL;`
+
+type RetryEventParams struct {
+	ID          int64
+	AvailableAt time.Time
+	LastError   string
+}
+
+// RetryEvent schedules a failed event to be dispatched again at AvailableAt.
+func (q *Queries) RetryEvent(ctx context.Context, arg RetryEventParams) error {
+	_, err := q.db.ExecContext(ctx, retryEventQuery, arg.AvailableAt, arg.LastError, arg.ID)
+	return err
+}
+
+const markEventFailedQuery = `UPDATE outbox SET failed_at = $1, last_error = $2 WHERE id = $3 AND dispatched_at IS NULL;`
+
+type MarkEventFailedParams struct {
+	ID        int64
+	FailedAt  time.Time
+	LastError string
+}
+
+// MarkEventFailed gives up on an event, which is no longer claimed but kept in the outbox, along
+// with its last error, for an operator to look into.
+func (q *Queries) MarkEventFailed(ctx context.Context, arg MarkEventFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markEventFailedQuery, arg.FailedAt, arg.LastError, arg.ID)
+	return err
+}
+
+const purgeDispatchedEventsQuery = `DELETE FROM outbox WHERE dispatched_at < $1;`
+
+// PurgeDispatchedEvents removes the events dispatched before dispatchedBefore, and returns how
+// many were removed. The failed events are left alone.
+func (q *Queries) PurgeDispatchedEvents(ctx context.Context, dispatchedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDispatchedEventsQuery, dispatchedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanEvent(row rowScanner) (*Event, error) {
+	var event Event
+	var payload []byte
+	err := row.Scan(
+		&event.ID,
+		&event.Type,
+		&event.AggregateType,
+		&event.AggregateID,
+		&payload,
+		&event.Attempts,
+		&event.LastError,
+		&event.AvailableAt,
+		&event.CreatedAt,
+		&event.DispatchedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	event.Payload = payload
+	return &event, nil
+}
+
+const listEventsQuery = `
+SELECT id, event_type, aggregate_type, aggregate_id, payload, attempts, last_error, available_at, created_at, dispatched_at
+FROM outbox WHERE id > $1 AND event_type = ANY($2) AND created_at >= $3
+ORDER BY id
+LIMIT $4;
+`
+
+type ListEventsParams struct {
+	AfterID      int64
+	Types        []string
+	CreatedAfter time.Time
+	Limit        int32
+}
+
+// ListEvents returns the events of the given types recorded after AfterID and since
+// CreatedAfter, oldest first, whether they were dispatched already or not.
+func (q *Queries) ListEvents(ctx context.Context, arg ListEventsParams) ([]*Event, error) {
+	rows, err := q.db.QueryContext(ctx, listEventsQuery, arg.AfterID, pq.Array(arg.Types), arg.CreatedAfter, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	events := []*Event{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
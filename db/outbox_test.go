@@ -0,0 +1,264 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var eventColumns = []string{"id", "event_type", "aggregate_type", "aggregate_id", "payload", "attempts", "last_error", "available_at", "created_at", "dispatched_at"}
+
+func getMockedExpectedEventRows(event *Event) *sqlmock.Rows {
+	return sqlmock.NewRows(eventColumns).
+		AddRow(event.ID, event.Type, event.AggregateType, event.AggregateID, []byte(event.Payload), event.Attempts,
+			event.LastError, event.AvailableAt, event.CreatedAt, nil)
+}
+
+func TestSQLStore_MutationWithEvent(t *testing.T) {
+	role := createRole()
+	event := &Event{
+		ID:            1,
+		Type:          EventRoleRestored,
+		AggregateType: AggregateRole,
+		AggregateID:   role.ExternalID,
+		Payload:       []byte(`{}`),
+		AvailableAt:   time.Now(),
+		CreatedAt:     time.Now(),
+	}
+
+	testCases := []struct {
+		name     string
+		mock     func(mocker sqlmock.Sqlmock)
+		response func(actual *Role, err error)
+	}{
+		{
+			name: "OK",
+			mock: func(mocker sqlmock.Sqlmock) {
+				mocker.ExpectBegin()
+				setupMockBD(mocker, restoreRoleQuery, getRow(role, role.UpdatedAt), nil, false, time.Time{}, role.ExternalID, true)
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(createEventQuery)).
+					WithArgs(EventRoleRestored, AggregateRole, role.ExternalID, sqlmock.AnyArg()).
+					WillReturnRows(getMockedExpectedEventRows(event))
+				mocker.ExpectCommit()
+			},
+			response: func(actual *Role, err error) {
+				require.NoError(t, err)
+				require.Equal(t, role.ExternalID, actual.ExternalID)
+			},
+		},
+		{
+			name: "MutationFails",
+			mock: func(mocker sqlmock.Sqlmock) {
+				mocker.ExpectBegin()
+				setupMockBD(mocker, restoreRoleQuery, nil, sql.ErrNoRows, false, time.Time{}, role.ExternalID, true)
+				mocker.ExpectRollback()
+			},
+			response: func(actual *Role, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Nil(t, actual)
+			},
+		},
+		{
+			name: "EventFails",
+			mock: func(mocker sqlmock.Sqlmock) {
+				mocker.ExpectBegin()
+				setupMockBD(mocker, restoreRoleQuery, getRow(role, role.UpdatedAt), nil, false, time.Time{}, role.ExternalID, true)
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(createEventQuery)).
+					WithArgs(EventRoleRestored, AggregateRole, role.ExternalID, sqlmock.AnyArg()).
+					WillReturnError(sql.ErrConnDone)
+				mocker.ExpectRollback()
+			},
+			response: func(actual *Role, err error) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+				require.Nil(t, actual)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mocker, err := sqlmock.New()
+			require.NoError(t, err)
+			defer func(db *sql.DB) {
+				_ = db.Close()
+			}(db)
+
+			tc.mock(mocker)
+			actual, err := NewStore(db).RestoreRole(context.Background(), role.ExternalID)
+			tc.response(actual, err)
+			require.NoError(t, mocker.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestClaimEvents(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	now := time.Now()
+	arg := ClaimEventsParams{Now: now, LeaseUntil: now.Add(time.Minute), Limit: 10}
+	event := &Event{
+		ID:            7,
+		Type:          EventUserCreated,
+		AggregateType: AggregateUser,
+		AggregateID:   "lexy",
+		Payload:       []byte(`{"username":"lexy"}`),
+		Attempts:      1,
+		AvailableAt:   arg.LeaseUntil,
+		CreatedAt:     now,
+	}
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(claimEventsQuery)).
+		WithArgs(arg.LeaseUntil, arg.Now, arg.Limit).
+		WillReturnRows(getMockedExpectedEventRows(event))
+
+	events, err := q.ClaimEvents(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, event.ID, events[0].ID)
+	require.Equal(t, event.Type, events[0].Type)
+	require.JSONEq(t, string(event.Payload), string(events[0].Payload))
+	require.False(t, events[0].DispatchedAt.Valid)
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(claimEventsQuery)).
+		WithArgs(arg.LeaseUntil, arg.Now, arg.Limit).
+		WillReturnError(sql.ErrConnDone)
+
+	events, err = q.ClaimEvents(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrConnDone)
+	require.Nil(t, events)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestMarkEventDispatched(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	dispatchedAt := time.Now()
+
+	mocker.
+		ExpectExec(regexp.QuoteMeta(markEventDispatchedQuery)).
+		WithArgs(dispatchedAt, "", int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, q.MarkEventDispatched(context.Background(), 7, dispatchedAt))
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestRetryEvent(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	arg := RetryEventParams{ID: 7, AvailableAt: time.Now().Add(time.Second), LastError: "handler failed"}
+
+	mocker.
+		ExpectExec(regexp.QuoteMeta(retryEventQuery)).
+		WithArgs(arg.AvailableAt, arg.LastError, arg.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, q.RetryEvent(context.Background(), arg))
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestMarkEventFailed(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	arg := MarkEventFailedParams{ID: 7, FailedAt: time.Now(), LastError: "handler failed"}
+
+	mocker.
+		ExpectExec(regexp.QuoteMeta(markEventFailedQuery)).
+		WithArgs(arg.FailedAt, arg.LastError, arg.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, q.MarkEventFailed(context.Background(), arg))
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestPurgeDispatchedEvents(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	dispatchedBefore := time.Now().Add(-168 * time.Hour)
+
+	mocker.
+		ExpectExec(regexp.QuoteMeta(purgeDispatchedEventsQuery)).
+		WithArgs(dispatchedBefore).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	purged, err := q.PurgeDispatchedEvents(context.Background(), dispatchedBefore)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), purged)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestListEvents(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	now := time.Now()
+	arg := ListEventsParams{AfterID: 6, Types: []string{EventPropertyCreated}, CreatedAfter: now.Add(-time.Hour), Limit: 10}
+	event := &Event{
+		ID:            7,
+		Type:          EventPropertyCreated,
+		AggregateType: AggregateProperty,
+		AggregateID:   "a1b2",
+		Payload:       []byte(`{"external_id":"a1b2"}`),
+		AvailableAt:   now,
+		CreatedAt:     now,
+	}
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(listEventsQuery)).
+		WithArgs(arg.AfterID, pq.Array(arg.Types), arg.CreatedAfter, arg.Limit).
+		WillReturnRows(getMockedExpectedEventRows(event))
+
+	events, err := q.ListEvents(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, event.ID, events[0].ID)
+	require.Equal(t, event.AggregateID, events[0].AggregateID)
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(listEventsQuery)).
+		WithArgs(arg.AfterID, pq.Array(arg.Types), arg.CreatedAfter, arg.Limit).
+		WillReturnError(sql.ErrConnDone)
+
+	events, err = q.ListEvents(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrConnDone)
+	require.Nil(t, events)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
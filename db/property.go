@@ -9,7 +9,7 @@ import (
 const createPropertyQuery = `
 	INSERT INTO property(internal_id, external_id, name, address, state, city, country, postal_code, phone, email, expired_at, created_at) 
 	VALUES (gen_random_uuid(), CONCAT('PRO',nextval('property_sequence')), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-	RETURNING internal_id, external_id, name, address, state, city, country, postal_code, phone, email, is_active, expired_at, created_at;
+	RETURNING internal_id, external_id, name, address, state, city, country, postal_code, phone, email, is_active, expired_at, created_at, version;
 `
 
 type CreatePropertyParams struct {
@@ -44,22 +44,72 @@ func (q *Queries) CreateProperty(ctx context.Context, arg CreatePropertyParams)
 }
 
 const activatePropertyQuery = `
-	UPDATE property SET is_active = $1 WHERE property.external_id = $2
-	RETURNING internal_id, external_id, name, address, state, city, country, postal_code, phone, email, is_active, expired_at, created_at;
+	UPDATE property SET is_active = $1, version = version + 1 WHERE property.external_id = $2 AND is_deleted = $3
+	RETURNING internal_id, external_id, name, address, state, city, country, postal_code, phone, email, is_active, expired_at, created_at, version;
 `
 
 func (q *Queries) ActivateDeactivateProperty(ctx context.Context, isActive bool, externalId string) (*Property, error) {
-	row := q.db.QueryRowContext(ctx, activatePropertyQuery, isActive, externalId)
+	row := q.db.QueryRowContext(ctx, activatePropertyQuery, isActive, externalId, false)
 	return getProperty(row)
 }
 
 const getAllPropertyQuery = `
-SELECT internal_id, external_id, name, address, state, city, country, postal_code, phone, email, is_active, expired_at, created_at
-FROM property LIMIT $1 OFFSET $2;
+SELECT internal_id, external_id, name, address, state, city, country, postal_code, phone, email, is_active, expired_at, created_at, version
+FROM property
 `
 
-func (q *Queries) GetAllProperty(ctx context.Context, arg LimitOffset) ([]*Property, error) {
-	rows, err := q.db.QueryContext(ctx, getAllPropertyQuery, arg.Limit, arg.Offset)
+// propertySortColumns lists the columns a property listing can be sorted by.
+var propertySortColumns = map[string]string{
+	"name":       "name",
+	"created_at": "created_at",
+}
+
+type ListPropertyParams struct {
+	LimitOffset
+	City          sql.NullString
+	State         sql.NullString
+	Country       sql.NullString
+	IsActive      sql.NullBool
+	ExpiredBefore sql.NullTime
+	ExpiredAfter  sql.NullTime
+	Search        sql.NullString
+	IsDeleted     bool
+	SortBy        string
+	SortDesc      bool
+}
+
+func listPropertyQuery(arg ListPropertyParams) (string, []any) {
+	builder := newQueryBuilder(getAllPropertyQuery).Where("is_deleted = ?", arg.IsDeleted)
+	if arg.City.Valid {
+		builder.Where("lower(city) = lower(?)", arg.City.String)
+	}
+	if arg.State.Valid {
+		builder.Where("lower(state) = lower(?)", arg.State.String)
+	}
+	if arg.Country.Valid {
+		builder.Where("lower(country) = lower(?)", arg.Country.String)
+	}
+	if arg.IsActive.Valid {
+		builder.Where("is_active = ?", arg.IsActive.Bool)
+	}
+	if arg.ExpiredBefore.Valid {
+		builder.Where("expired_at < ?", arg.ExpiredBefore.Time)
+	}
+	if arg.ExpiredAfter.Valid {
+		builder.Where("expired_at > ?", arg.ExpiredAfter.Time)
+	}
+	if arg.Search.Valid {
+		builder.Where("search_vector @@ plainto_tsquery('simple', ?)", arg.Search.String)
+	}
+	return builder.
+		OrderBy(propertySortColumns, arg.SortBy, "created_at", arg.SortDesc, "external_id").
+		Page(arg.Limit, arg.Offset).
+		Build()
+}
+
+func (q *Queries) GetAllProperty(ctx context.Context, arg ListPropertyParams) ([]*Property, error) {
+	query, args := listPropertyQuery(arg)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -84,6 +134,7 @@ func (q *Queries) GetAllProperty(ctx context.Context, arg LimitOffset) ([]*Prope
 			&property.IsActive,
 			&property.ExpiredAt,
 			&property.CreatedAt,
+			&property.Version,
 		)
 		if err != nil {
 			return nil, err
@@ -97,12 +148,12 @@ func (q *Queries) GetAllProperty(ctx context.Context, arg LimitOffset) ([]*Prope
 }
 
 const getPropertyQuery = `
-SELECT internal_id, external_id, name, address, state, city, country, postal_code, phone, email, is_active, expired_at, created_at
-FROM property WHERE external_id = $1;
+SELECT internal_id, external_id, name, address, state, city, country, postal_code, phone, email, is_active, expired_at, created_at, version
+FROM property WHERE external_id = $1 AND is_deleted = $2;
 `
 
 func (q *Queries) GetProperty(ctx context.Context, Id string) (*Property, error) {
-	row := q.db.QueryRowContext(ctx, getPropertyQuery, Id)
+	row := q.db.QueryRowContext(ctx, getPropertyQuery, Id, false)
 	return getProperty(row)
 }
 
@@ -116,6 +167,7 @@ type UpdatePropertyParams struct {
 	PostalCode sql.NullString `json:"postal_code"`
 	Phone      sql.NullString `json:"phone"`
 	Email      sql.NullString `json:"email"`
+	Version    sql.NullInt64  `json:"version"`
 }
 
 const updatePropertyQuery = `
@@ -127,9 +179,10 @@ SET name = coalesce($1, name),
     country = coalesce($5, country), 
     postal_code = coalesce($6, postal_code), 
     phone = coalesce($7, phone), 
-    email = coalesce($8, email)
-WHERE external_id = $9
-RETURNING internal_id, external_id, name, address, state, city, country, postal_code, phone, email, is_active, expired_at, created_at;
+    email = coalesce($8, email),
+    version = version + 1
+WHERE external_id = $9 AND is_deleted = $10 AND version = coalesce($11, version)
+RETURNING internal_id, external_id, name, address, state, city, country, postal_code, phone, email, is_active, expired_at, created_at, version;
 `
 
 func (q *Queries) UpdateProperty(ctx context.Context, arg UpdatePropertyParams) (*Property, error) {
@@ -143,20 +196,88 @@ func (q *Queries) UpdateProperty(ctx context.Context, arg UpdatePropertyParams)
 		arg.Phone,
 		arg.Email,
 		arg.ExternalID,
+		false,
+		arg.Version,
 	)
-	return getProperty(row)
+	property, err := getProperty(row)
+	if err != nil {
+		return nil, q.versionMismatch(ctx, err, arg.Version, propertyVersionQuery, arg.ExternalID)
+	}
+	return property, nil
 }
 
 const deletePropertyQuery = `
-	DELETE FROM property WHERE external_id = $1
-	RETURNING internal_id, external_id, name, address, state, city, country, postal_code, phone, email, is_active, expired_at, created_at;
+	UPDATE property SET is_deleted = $1, deleted_at = $2, version = version + 1
+	WHERE external_id = $3 AND is_deleted = $4 AND version = coalesce($5, version)
+	RETURNING internal_id, external_id, name, address, state, city, country, postal_code, phone, email, is_active, expired_at, created_at, version;
 `
 
-func (q *Queries) DeleteProperty(ctx context.Context, externalID string) (*Property, error) {
-	row := q.db.QueryRowContext(ctx, deletePropertyQuery, externalID)
+// DeleteProperty archives a property. Its user assignments are kept so that restoring the
+// property brings it back as it was.
+func (q *Queries) DeleteProperty(ctx context.Context, externalID string, deletedAt time.Time, version sql.NullInt64) (*Property, error) {
+	row := q.db.QueryRowContext(ctx, deletePropertyQuery, true, deletedAt, externalID, false, version)
+	property, err := getProperty(row)
+	if err != nil {
+		return nil, q.versionMismatch(ctx, err, version, propertyVersionQuery, externalID)
+	}
+	return property, nil
+}
+
+const restorePropertyQuery = `
+	UPDATE property SET is_deleted = $1, deleted_at = $2, version = version + 1 WHERE external_id = $3 AND is_deleted = $4
+	RETURNING internal_id, external_id, name, address, state, city, country, postal_code, phone, email, is_active, expired_at, created_at, version;
+`
+
+// RestoreProperty brings back an archived property.
+func (q *Queries) RestoreProperty(ctx context.Context, externalID string) (*Property, error) {
+	row := q.db.QueryRowContext(ctx, restorePropertyQuery, false, time.Time{}, externalID, true)
 	return getProperty(row)
 }
 
+const propertyVersionQuery = `SELECT version FROM property WHERE external_id = $1 AND is_deleted = $2;`
+
+const listUserPropertyIDsQuery = `
+SELECT p.external_id FROM property_user pu INNER JOIN property p ON pu.property_internal_id = p.internal_id
+WHERE pu.username = $1
+ORDER BY p.external_id;
+`
+
+// ListUserPropertyIDs returns the external ids of the properties a user is assigned to.
+func (q *Queries) ListUserPropertyIDs(ctx context.Context, username string) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listUserPropertyIDsQuery, username)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+const userSharesPropertyQuery = `
+SELECT EXISTS (SELECT 1 FROM property_user a INNER JOIN property_user b ON a.property_internal_id = b.property_internal_id
+               WHERE a.username = $1 AND b.username = $2);
+`
+
+// UserSharesProperty reports whether two users are assigned to at least one common property.
+func (q *Queries) UserSharesProperty(ctx context.Context, username string, other string) (bool, error) {
+	var shares bool
+	err := q.db.QueryRowContext(ctx, userSharesPropertyQuery, username, other).Scan(&shares)
+	return shares, err
+}
+
 func getProperty(row *sql.Row) (*Property, error) {
 	var property Property
 	err := row.Scan(
@@ -173,6 +294,7 @@ func getProperty(row *sql.Row) (*Property, error) {
 		&property.IsActive,
 		&property.ExpiredAt,
 		&property.CreatedAt,
+		&property.Version,
 	)
 	if err != nil {
 		return nil, err
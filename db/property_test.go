@@ -3,11 +3,13 @@ package db
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/require"
 	"regexp"
 	"testing"
+	"time"
 )
 
 func TestCreateProperty(t *testing.T) {
@@ -115,7 +117,7 @@ func TestActivateDeactivateProperty(t *testing.T) {
 				// the CreateUser sql mock
 				mocker.
 					ExpectQuery(regexp.QuoteMeta(activatePropertyQuery)).
-					WithArgs(isActive, externalId).
+					WithArgs(isActive, externalId, false).
 					WillReturnRows(propertyQueryRows)
 			},
 			response: func(querier Querier, expectedProperty *Property, isActive bool, externalId string) {
@@ -146,40 +148,244 @@ func TestGetAllProperty(t *testing.T) {
 	expectedProperty := []*Property{createProperty(createPropertyParams())}
 	testCases := []struct {
 		name              string
-		isActive          bool
-		externalId        string
-		arg               LimitOffset
+		arg               ListPropertyParams
+		query             string
+		args              []driver.Value
 		propertyQueryRows *sqlmock.Rows
-		mock              func(userQueryRows *sqlmock.Rows, arg LimitOffset)
-		response          func(querier Querier, expectedProperty []*Property, arg LimitOffset)
+		mock              func(propertyQueryRows *sqlmock.Rows, query string, args []driver.Value)
+		response          func(querier Querier, expectedProperty []*Property, arg ListPropertyParams)
 	}{
 		{
 			name:              "GetProperty",
-			isActive:          true,
-			externalId:        "PRO103",
-			arg:               LimitOffset{Limit: 0, Offset: 0},
+			arg:               ListPropertyParams{LimitOffset: LimitOffset{Limit: 5, Offset: 0}},
+			query:             "FROM property WHERE is_deleted = $1 ORDER BY created_at ASC, external_id ASC LIMIT $2 OFFSET $3;",
+			args:              []driver.Value{false, int32(5), int32(0)},
 			propertyQueryRows: getMockedExpectedProperty(expectedProperty[0]),
-			mock: func(propertyQueryRows *sqlmock.Rows, arg LimitOffset) {
-				// the CreateUser sql mock
+			mock: func(propertyQueryRows *sqlmock.Rows, query string, args []driver.Value) {
 				mocker.
-					ExpectQuery(regexp.QuoteMeta(getAllPropertyQuery)).
-					WithArgs(arg.Limit, arg.Offset).
+					ExpectQuery(regexp.QuoteMeta(query)).
+					WithArgs(args...).
 					WillReturnRows(propertyQueryRows)
 			},
-			response: func(querier Querier, expectedProperty []*Property, arg LimitOffset) {
+			response: func(querier Querier, expectedProperty []*Property, arg ListPropertyParams) {
 				actualProperty, err := querier.GetAllProperty(context.Background(), arg)
 				require.NoError(t, err)
 				require.Equal(t, actualProperty, expectedProperty)
 			},
 		},
+		{
+			name: "FilterSortAndSearch",
+			arg: ListPropertyParams{
+				LimitOffset: LimitOffset{Limit: 10, Offset: 20},
+				City:        sql.NullString{String: "Montreal", Valid: true},
+				IsActive:    sql.NullBool{Bool: true, Valid: true},
+				Search:      sql.NullString{String: "posada beach", Valid: true},
+				SortBy:      "name",
+				SortDesc:    true,
+			},
+			query: "FROM property WHERE is_deleted = $1 AND lower(city) = lower($2) AND is_active = $3 AND search_vector @@ plainto_tsquery('simple', $4) " +
+				"ORDER BY name DESC, external_id DESC LIMIT $5 OFFSET $6;",
+			args:              []driver.Value{false, "Montreal", true, "posada beach", int32(10), int32(20)},
+			propertyQueryRows: getMockedExpectedProperty(expectedProperty[0]),
+			mock: func(propertyQueryRows *sqlmock.Rows, query string, args []driver.Value) {
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(query)).
+					WithArgs(args...).
+					WillReturnRows(propertyQueryRows)
+			},
+			response: func(querier Querier, expectedProperty []*Property, arg ListPropertyParams) {
+				actualProperty, err := querier.GetAllProperty(context.Background(), arg)
+				require.NoError(t, err)
+				require.Equal(t, actualProperty, expectedProperty)
+			},
+		},
+		{
+			name:  "UnknownSortColumn",
+			arg:   ListPropertyParams{LimitOffset: LimitOffset{Limit: 5, Offset: 0}, SortBy: "name; DROP TABLE property"},
+			query: "FROM property WHERE is_deleted = $1 ORDER BY created_at ASC, external_id ASC LIMIT $2 OFFSET $3;",
+			args:  []driver.Value{false, int32(5), int32(0)},
+			mock: func(propertyQueryRows *sqlmock.Rows, query string, args []driver.Value) {
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(query)).
+					WithArgs(args...).
+					WillReturnError(sql.ErrConnDone)
+			},
+			response: func(querier Querier, expectedProperty []*Property, arg ListPropertyParams) {
+				actualProperty, err := querier.GetAllProperty(context.Background(), arg)
+				require.Error(t, err)
+				require.Nil(t, actualProperty)
+			},
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			mockQuery := &Queries{db: db}
 
-			tc.mock(tc.propertyQueryRows, tc.arg)
+			tc.mock(tc.propertyQueryRows, tc.query, tc.args)
 			tc.response(mockQuery, expectedProperty, tc.arg)
+			require.NoError(t, mocker.ExpectationsWereMet())
 		})
 	}
 }
+
+func TestDeleteProperty(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	expectedProperty := createProperty(createPropertyParams())
+	deletedAt := time.Now()
+	mockQuery := &Queries{db: db}
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(deletePropertyQuery)).
+		WithArgs(true, deletedAt, expectedProperty.ExternalID, false, nil).
+		WillReturnRows(getMockedExpectedProperty(expectedProperty))
+	actualProperty, err := mockQuery.DeleteProperty(context.Background(), expectedProperty.ExternalID, deletedAt, sql.NullInt64{})
+	require.NoError(t, err)
+	require.Equal(t, expectedProperty, actualProperty)
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(restorePropertyQuery)).
+		WithArgs(false, time.Time{}, expectedProperty.ExternalID, true).
+		WillReturnRows(getMockedExpectedProperty(expectedProperty))
+	actualProperty, err = mockQuery.RestoreProperty(context.Background(), expectedProperty.ExternalID)
+	require.NoError(t, err)
+	require.Equal(t, expectedProperty, actualProperty)
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(restorePropertyQuery)).
+		WithArgs(false, time.Time{}, expectedProperty.ExternalID, true).
+		WillReturnError(sql.ErrNoRows)
+	actualProperty, err = mockQuery.RestoreProperty(context.Background(), expectedProperty.ExternalID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.Nil(t, actualProperty)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestUpdateProperty(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	expectedProperty := createProperty(createPropertyParams())
+	arg := UpdatePropertyParams{
+		ExternalID: expectedProperty.ExternalID,
+		Name:       sql.NullString{String: expectedProperty.Name, Valid: true},
+		Version:    sql.NullInt64{Int64: 3, Valid: true},
+	}
+
+	testCases := []struct {
+		name     string
+		mock     func()
+		response func(property *Property, err error)
+	}{
+		{
+			name: "OK",
+			mock: func() {
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(updatePropertyQuery)).
+					WithArgs(arg.Name, arg.Address, arg.State, arg.City, arg.Country, arg.PostalCode, arg.Phone, arg.Email, arg.ExternalID, false, int64(3)).
+					WillReturnRows(getMockedExpectedProperty(expectedProperty))
+			},
+			response: func(property *Property, err error) {
+				require.NoError(t, err)
+				require.Equal(t, expectedProperty, property)
+			},
+		},
+		{
+			name: "VersionMismatch",
+			mock: func() {
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(updatePropertyQuery)).
+					WillReturnError(sql.ErrNoRows)
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(propertyVersionQuery)).
+					WithArgs(arg.ExternalID, false).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(4)))
+			},
+			response: func(property *Property, err error) {
+				require.ErrorIs(t, err, ErrVersionMismatch)
+				require.Nil(t, property)
+			},
+		},
+		{
+			name: "NotFound",
+			mock: func() {
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(updatePropertyQuery)).
+					WillReturnError(sql.ErrNoRows)
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(propertyVersionQuery)).
+					WithArgs(arg.ExternalID, false).
+					WillReturnError(sql.ErrNoRows)
+			},
+			response: func(property *Property, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Nil(t, property)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockQuery := &Queries{db: db}
+
+			tc.mock()
+			tc.response(mockQuery.UpdateProperty(context.Background(), arg))
+			require.NoError(t, mocker.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestListUserPropertyIDs(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(listUserPropertyIDsQuery)).
+		WithArgs("lexy").
+		WillReturnRows(sqlmock.NewRows([]string{"external_id"}).AddRow("a1").AddRow("b2"))
+
+	ids, err := q.ListUserPropertyIDs(context.Background(), "lexy")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a1", "b2"}, ids)
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(listUserPropertyIDsQuery)).
+		WithArgs("lexy").
+		WillReturnError(sql.ErrConnDone)
+
+	ids, err = q.ListUserPropertyIDs(context.Background(), "lexy")
+	require.ErrorIs(t, err, sql.ErrConnDone)
+	require.Nil(t, ids)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestUserSharesProperty(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(userSharesPropertyQuery)).
+		WithArgs("lexy", "bob").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	shares, err := q.UserSharesProperty(context.Background(), "lexy", "bob")
+	require.NoError(t, err)
+	require.True(t, shares)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"github.com/google/uuid"
 	"time"
 )
@@ -11,23 +12,54 @@ type Querier interface {
 	GetUser(ctx context.Context, username string) (*User, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (*User, error)
-	DeleteUser(ctx context.Context, username string, deletedAt time.Time) (*User, error)
+	DeleteUser(ctx context.Context, username string, deletedAt time.Time, version sql.NullInt64) (*User, error)
+	RestoreUser(ctx context.Context, username string) (*User, error)
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
 	GetSession(ctx context.Context, id uuid.UUID) (*Session, error)
 	CreateSession(ctx context.Context, arg CreateSessionParams) (*Session, error)
 	BlockSession(ctx context.Context, sessionID uuid.UUID) (*Session, error)
+	BlockUserSessions(ctx context.Context, username string, blockedAt time.Time) ([]*Session, error)
 	CreateRole(ctx context.Context, arg CreateRoleParams) (*Role, error)
 	GetAllRole(ctx context.Context, arg ListRoleParams) ([]*Role, error)
 	GetRole(ctx context.Context, externalId string) (*Role, error)
 	GetRoleByName(ctx context.Context, name string) (*Role, error)
 	GetRoleByUUID(ctx context.Context, internalId uuid.UUID) (*Role, error)
 	UpdateRole(ctx context.Context, arg UpdateRoleParams) (*Role, error)
-	DeleteRole(ctx context.Context, externalID string) (*Role, error)
-	GetAllCustomer(ctx context.Context, arg ListUsersParams) ([]*User, error)
-	GetAllAdmin(ctx context.Context, arg ListUsersParams) ([]*User, error)
+	DeleteRole(ctx context.Context, externalID string, deletedAt time.Time, version sql.NullInt64) (*Role, error)
+	RestoreRole(ctx context.Context, externalID string) (*Role, error)
+	SearchUsers(ctx context.Context, arg SearchUsersParams) (*SearchUsersResult, error)
 	CreateProperty(ctx context.Context, arg CreatePropertyParams) (*Property, error)
 	ActivateDeactivateProperty(ctx context.Context, isActive bool, externalId string) (*Property, error)
-	GetAllProperty(ctx context.Context, arg LimitOffset) ([]*Property, error)
+	GetAllProperty(ctx context.Context, arg ListPropertyParams) ([]*Property, error)
 	GetProperty(ctx context.Context, Id string) (*Property, error)
 	UpdateProperty(ctx context.Context, arg UpdatePropertyParams) (*Property, error)
-	DeleteProperty(ctx context.Context, externalID string) (*Property, error)
+	DeleteProperty(ctx context.Context, externalID string, deletedAt time.Time, version sql.NullInt64) (*Property, error)
+	RestoreProperty(ctx context.Context, externalID string) (*Property, error)
+	CreateAuditLog(ctx context.Context, arg CreateAuditLogParams) (*AuditLog, error)
+	ListAuditLog(ctx context.Context, arg ListAuditLogParams) ([]*AuditLog, error)
+	CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (*IdempotencyKey, error)
+	GetIdempotencyKey(ctx context.Context, scope string, key string) (*IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, arg CompleteIdempotencyKeyParams) error
+	DeleteIdempotencyKey(ctx context.Context, scope string, key string) error
+	PurgeExpiredIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int64, error)
+	ClaimEvents(ctx context.Context, arg ClaimEventsParams) ([]*Event, error)
+	MarkEventDispatched(ctx context.Context, id int64, dispatchedAt time.Time) error
+	RetryEvent(ctx context.Context, arg RetryEventParams) error
+	MarkEventFailed(ctx context.Context, arg MarkEventFailedParams) error
+	PurgeDispatchedEvents(ctx context.Context, dispatchedBefore time.Time) (int64, error)
+	CreateWebhookSubscription(ctx context.Context, arg CreateWebhookSubscriptionParams) (*WebhookSubscription, error)
+	GetWebhookSubscription(ctx context.Context, id int64) (*WebhookSubscription, error)
+	ListWebhookSubscriptions(ctx context.Context, arg LimitOffset) ([]*WebhookSubscription, error)
+	ListWebhookSubscriptionsForEvent(ctx context.Context, eventType string) ([]*WebhookSubscription, error)
+	UpdateWebhookSubscription(ctx context.Context, arg UpdateWebhookSubscriptionParams) (*WebhookSubscription, error)
+	DeleteWebhookSubscription(ctx context.Context, id int64) (*WebhookSubscription, error)
+	CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) error
+	ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]*WebhookDelivery, error)
+	RecordWebhookDeliveryAttempt(ctx context.Context, arg RecordWebhookDeliveryAttemptParams) error
+	ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]*WebhookDelivery, error)
+	RedeliverWebhookDelivery(ctx context.Context, subscriptionID int64, id int64, nextAttemptAt time.Time) (*WebhookDelivery, error)
+	ListEvents(ctx context.Context, arg ListEventsParams) ([]*Event, error)
+	ListUserPropertyIDs(ctx context.Context, username string) ([]string, error)
+	UserSharesProperty(ctx context.Context, username string, other string) (bool, error)
+	GetSchemaMigration(ctx context.Context) (*SchemaMigration, error)
 }
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// queryBuilder assembles a parameterised query on top of a fixed base statement.
+// Conditions are written by this package and only the values supplied by callers are
+// passed along as bind arguments, while the ORDER BY clause is resolved through a
+// whitelist of sortable columns. User input therefore never ends up in the SQL text.
+type queryBuilder struct {
+	base    string
+	where   []string
+	args    []any
+	orderBy string
+	paged   bool
+	limit   int32
+	offset  int32
+}
+
+func newQueryBuilder(base string) *queryBuilder {
+	return &queryBuilder{base: base}
+}
+
+// Where adds a condition joined with AND. Each "?" in cond is replaced by the
+// placeholder of the matching value in args.
+func (b *queryBuilder) Where(cond string, args ...any) *queryBuilder {
+	var sb strings.Builder
+	next := 0
+	for _, c := range cond {
+		if c == '?' && next < len(args) {
+			sb.WriteString(b.bind(args[next]))
+			next++
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	b.where = append(b.where, sb.String())
+	return b
+}
+
+// OrderBy sorts on the column registered for field in columns, falling back to the
+// column registered for fallback when field is unknown. The result is completed by
+// tieBreaker so pagination stays stable between pages.
+func (b *queryBuilder) OrderBy(columns map[string]string, field string, fallback string, desc bool, tieBreaker string) *queryBuilder {
+	column, ok := columns[field]
+	if !ok {
+		column = columns[fallback]
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+
+	b.orderBy = fmt.Sprintf("%s %s, %s %s", column, direction, tieBreaker, direction)
+	return b
+}
+
+// Page restricts the result to a window of the query.
+func (b *queryBuilder) Page(limit int32, offset int32) *queryBuilder {
+	b.paged = true
+	b.limit = limit
+	b.offset = offset
+	return b
+}
+
+// Build returns the final SQL text along with its bind arguments.
+func (b *queryBuilder) Build() (string, []any) {
+	var sb strings.Builder
+	sb.WriteString(b.filtered(b.base))
+
+	args := append([]any{}, b.args...)
+	if b.orderBy != "" {
+		sb.WriteString(" ORDER BY ")
+		sb.WriteString(b.orderBy)
+	}
+	if b.paged {
+		args = append(args, b.limit, b.offset)
+		sb.WriteString(fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args)))
+	}
+	sb.WriteString(";")
+	return sb.String(), args
+}
+
+// BuildCount returns a query counting every row matched by the conditions, using
+// countBase in place of the base statement and ignoring ordering and pagination.
+func (b *queryBuilder) BuildCount(countBase string) (string, []any) {
+	return b.filtered(countBase) + ";", append([]any{}, b.args...)
+}
+
+func (b *queryBuilder) filtered(base string) string {
+	query := strings.TrimSpace(base)
+	if len(b.where) > 0 {
+		query += " WHERE " + strings.Join(b.where, " AND ")
+	}
+	return query
+}
+
+// likePattern turns value into an ILIKE pattern matching it anywhere in a column,
+// escaping the wildcards it may contain.
+func likePattern(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return "%" + replacer.Replace(value) + "%"
+}
+
+func (b *queryBuilder) bind(arg any) string {
+	b.args = append(b.args, arg)
+	return fmt.Sprintf("$%d", len(b.args))
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"github.com/google/uuid"
 	"time"
 )
@@ -16,7 +17,7 @@ const (
 const createRoleQuery = `
 INSERT INTO role (internal_id, name, description, external_id) 
 VALUES (gen_random_uuid(),$1,$2, CONCAT('URE',nextval('role_sequence')))
-RETURNING internal_id,name,description,external_id,created_at,updated_at
+RETURNING internal_id,name,description,external_id,created_at,updated_at,version
 `
 
 type CreateRoleParams struct {
@@ -39,21 +40,23 @@ func (q *Queries) CreateRole(ctx context.Context, arg CreateRoleParams) (*Role,
 		&role.ExternalID,
 		&role.CreatedAt,
 		&role.UpdatedAt,
+		&role.Version,
 	)
 	return &role, err
 }
 
 type ListRoleParams struct {
-	Limit  int32 `json:"limit"`
-	Offset int32 `json:"offset"`
+	Limit     int32 `json:"limit"`
+	Offset    int32 `json:"offset"`
+	IsDeleted bool  `json:"is_deleted"`
 }
 
 const getAllRoleQuery = `
-SELECT internal_id,name,description,external_id,created_at,updated_at FROM role LIMIT $1 OFFSET $2;
+SELECT internal_id,name,description,external_id,created_at,updated_at,version FROM role WHERE is_deleted = $1 LIMIT $2 OFFSET $3;
 `
 
 func (q *Queries) GetAllRole(ctx context.Context, arg ListRoleParams) ([]*Role, error) {
-	rows, err := q.db.QueryContext(ctx, getAllRoleQuery, arg.Limit, arg.Offset)
+	rows, err := q.db.QueryContext(ctx, getAllRoleQuery, arg.IsDeleted, arg.Limit, arg.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -71,6 +74,7 @@ func (q *Queries) GetAllRole(ctx context.Context, arg ListRoleParams) ([]*Role,
 			&role.ExternalID,
 			&role.CreatedAt,
 			&role.UpdatedAt,
+			&role.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -86,11 +90,11 @@ func (q *Queries) GetAllRole(ctx context.Context, arg ListRoleParams) ([]*Role,
 }
 
 const getRoleQuery = `
-	SELECT internal_id,name,description,external_id,created_at,updated_at FROM role WHERE external_id = $1;
+	SELECT internal_id,name,description,external_id,created_at,updated_at,version FROM role WHERE external_id = $1 AND is_deleted = $2;
 `
 
 func (q *Queries) GetRole(ctx context.Context, externalId string) (*Role, error) {
-	row := q.db.QueryRowContext(ctx, getRoleQuery, externalId)
+	row := q.db.QueryRowContext(ctx, getRoleQuery, externalId, false)
 	var role Role
 	err := row.Scan(
 		&role.InternalID,
@@ -99,15 +103,16 @@ func (q *Queries) GetRole(ctx context.Context, externalId string) (*Role, error)
 		&role.ExternalID,
 		&role.CreatedAt,
 		&role.UpdatedAt,
+		&role.Version,
 	)
 	return &role, err
 }
 
 const getRoleByNameQuery = `
-	SELECT internal_id,name,description,external_id,created_at,updated_at FROM role WHERE name = $1;`
+	SELECT internal_id,name,description,external_id,created_at,updated_at,version FROM role WHERE name = $1 AND is_deleted = $2;`
 
 func (q *Queries) GetRoleByName(ctx context.Context, name string) (*Role, error) {
-	row := q.db.QueryRowContext(ctx, getRoleByNameQuery, name)
+	row := q.db.QueryRowContext(ctx, getRoleByNameQuery, name, false)
 	var role Role
 	err := row.Scan(
 		&role.InternalID,
@@ -116,12 +121,13 @@ func (q *Queries) GetRoleByName(ctx context.Context, name string) (*Role, error)
 		&role.ExternalID,
 		&role.CreatedAt,
 		&role.UpdatedAt,
+		&role.Version,
 	)
 	return &role, err
 }
 
 const getRoleByUUIDQuery = `
-	SELECT internal_id,name,description,external_id,created_at,updated_at FROM role WHERE internal_id = $1;
+	SELECT internal_id,name,description,external_id,created_at,updated_at,version FROM role WHERE internal_id = $1;
 `
 
 func (q *Queries) GetRoleByUUID(ctx context.Context, internalId uuid.UUID) (*Role, error) {
@@ -134,6 +140,7 @@ func (q *Queries) GetRoleByUUID(ctx context.Context, internalId uuid.UUID) (*Rol
 		&role.ExternalID,
 		&role.CreatedAt,
 		&role.UpdatedAt,
+		&role.Version,
 	)
 	return &role, err
 }
@@ -143,15 +150,17 @@ type UpdateRoleParams struct {
 	Name        sql.NullString `json:"name"`
 	Description sql.NullString `json:"description"`
 	UpdateAt    time.Time      `json:"-"`
+	Version     sql.NullInt64  `json:"version"`
 }
 
 const updateRoleQuery = `
 UPDATE role
 SET name = coalesce($1, name),
     description = coalesce($2, description),
-    updated_at = coalesce($3, updated_at)
-WHERE external_id = $4
-RETURNING internal_id, name, description, external_id, created_at, updated_at;
+    updated_at = coalesce($3, updated_at),
+    version = version + 1
+WHERE external_id = $4 AND is_deleted = $5 AND version = coalesce($6, version)
+RETURNING internal_id, name, description, external_id, created_at, updated_at, version;
 `
 
 func (q *Queries) UpdateRole(ctx context.Context, arg UpdateRoleParams) (*Role, error) {
@@ -160,6 +169,8 @@ func (q *Queries) UpdateRole(ctx context.Context, arg UpdateRoleParams) (*Role,
 		arg.Description,
 		arg.UpdateAt,
 		arg.ExternalID,
+		false,
+		arg.Version,
 	)
 	var role Role
 	err := row.Scan(
@@ -169,15 +180,26 @@ func (q *Queries) UpdateRole(ctx context.Context, arg UpdateRoleParams) (*Role,
 		&role.ExternalID,
 		&role.CreatedAt,
 		&role.UpdatedAt,
+		&role.Version,
 	)
-	return &role, err
+	return &role, q.versionMismatch(ctx, err, arg.Version, roleVersionQuery, arg.ExternalID)
 }
 
-const deleteRoleQuery = `DELETE FROM role WHERE external_id = $1 
-     RETURNING internal_id, name, description, external_id, created_at, updated_at;`
+// ErrRoleInUse is returned when archiving a role that users are still assigned to.
+var ErrRoleInUse = errors.New("the role still has users assigned")
+
+const deleteRoleQuery = `UPDATE role SET is_deleted = $1, deleted_at = $2, version = version + 1
+     WHERE external_id = $3 AND is_deleted = $4 AND version = coalesce($5, version)
+       AND NOT EXISTS (SELECT 1 FROM users WHERE users.role_id = role.internal_id)
+     RETURNING internal_id, name, description, external_id, created_at, updated_at, version;`
 
-func (q *Queries) DeleteRole(ctx context.Context, externalID string) (*Role, error) {
-	row := q.db.QueryRowContext(ctx, deleteRoleQuery, externalID)
+const countRoleUsersQuery = `SELECT count(*) FROM users INNER JOIN role ON users.role_id = role.internal_id
+     WHERE role.external_id = $1 AND role.is_deleted = $2;`
+
+// DeleteRole archives a role. Roles still assigned to a user, including a soft-deleted one
+// that could be restored, are left untouched and ErrRoleInUse is returned.
+func (q *Queries) DeleteRole(ctx context.Context, externalID string, deletedAt time.Time, version sql.NullInt64) (*Role, error) {
+	row := q.db.QueryRowContext(ctx, deleteRoleQuery, true, deletedAt, externalID, false, version)
 	var role Role
 	err := row.Scan(
 		&role.InternalID,
@@ -186,6 +208,44 @@ func (q *Queries) DeleteRole(ctx context.Context, externalID string) (*Role, err
 		&role.ExternalID,
 		&role.CreatedAt,
 		&role.UpdatedAt,
+		&role.Version,
 	)
-	return &role, err
+	err = q.versionMismatch(ctx, err, version, roleVersionQuery, externalID)
+	if errors.Is(err, sql.ErrNoRows) {
+		var users int64
+		if countErr := q.db.QueryRowContext(ctx, countRoleUsersQuery, externalID, false).Scan(&users); countErr != nil {
+			return nil, countErr
+		}
+		if users > 0 {
+			return nil, ErrRoleInUse
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+const restoreRoleQuery = `UPDATE role SET is_deleted = $1, deleted_at = $2, version = version + 1 WHERE external_id = $3 AND is_deleted = $4
+     RETURNING internal_id, name, description, external_id, created_at, updated_at, version;`
+
+// RestoreRole brings back an archived role.
+func (q *Queries) RestoreRole(ctx context.Context, externalID string) (*Role, error) {
+	row := q.db.QueryRowContext(ctx, restoreRoleQuery, false, time.Time{}, externalID, true)
+	var role Role
+	err := row.Scan(
+		&role.InternalID,
+		&role.Name,
+		&role.Description,
+		&role.ExternalID,
+		&role.CreatedAt,
+		&role.UpdatedAt,
+		&role.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
 }
+
+const roleVersionQuery = `SELECT version FROM role WHERE external_id = $1 AND is_deleted = $2;`
@@ -39,7 +39,7 @@ func TestGetAllRole(t *testing.T) {
 			mock: func() {
 				role := createRole()
 				rows := getRow(role, updateDate)
-				setupMockBD(mockDB, getAllRoleQuery, rows, nil, 2, 0)
+				setupMockBD(mockDB, getAllRoleQuery, rows, nil, false, 2, 0)
 			},
 			input:       ListRoleParams{Limit: 2, Offset: 0},
 			expectedErr: false,
@@ -47,7 +47,7 @@ func TestGetAllRole(t *testing.T) {
 		{
 			name: "Fail",
 			mock: func() {
-				setupMockBD(mockDB, getAllRoleQuery, nil, sql.ErrConnDone, 2, 0)
+				setupMockBD(mockDB, getAllRoleQuery, nil, sql.ErrConnDone, false, 2, 0)
 			},
 			input:       ListRoleParams{Limit: 2, Offset: 0},
 			expectedErr: true,
@@ -58,7 +58,7 @@ func TestGetAllRole(t *testing.T) {
 				mockDB.ExpectClose()
 				err = db.Close()
 				require.NoError(t, err) // There should be no
-				setupMockBD(mockDB, getAllRoleQuery, nil, sql.ErrConnDone, 2, 0)
+				setupMockBD(mockDB, getAllRoleQuery, nil, sql.ErrConnDone, false, 2, 0)
 			},
 			input:       ListRoleParams{Limit: 2, Offset: 0},
 			expectedErr: true,
@@ -98,7 +98,7 @@ func TestQueries_GetRole(t *testing.T) {
 			name: "OK",
 			mockFunc: func(mock sqlmock.Sqlmock) {
 				rows := getRow(role, updateDate)
-				setupMockBD(mock, getRoleQuery, rows, nil, role.ExternalID)
+				setupMockBD(mock, getRoleQuery, rows, nil, role.ExternalID, false)
 			},
 			id:      role.ExternalID,
 			wantErr: false,
@@ -106,7 +106,7 @@ func TestQueries_GetRole(t *testing.T) {
 		{
 			name: "Fail",
 			mockFunc: func(mock sqlmock.Sqlmock) {
-				setupMockBD(mock, getRoleQuery, nil, fmt.Errorf("some error"), role.ExternalID)
+				setupMockBD(mock, getRoleQuery, nil, fmt.Errorf("some error"), role.ExternalID, false)
 			},
 			id:      role.ExternalID,
 			wantErr: true,
@@ -191,7 +191,7 @@ func TestQueries_UpdateRole(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mocker.ExpectQuery(regexp.QuoteMeta(updateRoleQuery)).
-				WithArgs(tt.arg.Name, tt.arg.Description, tt.arg.UpdateAt, tt.arg.ExternalID).
+				WithArgs(tt.arg.Name, tt.arg.Description, tt.arg.UpdateAt, tt.arg.ExternalID, false, tt.arg.Version).
 				WillReturnRows(rows)
 
 			_, err := q.UpdateRole(ctx, tt.arg)
@@ -214,7 +214,7 @@ func setupMockBD(moc sqlmock.Sqlmock, query string, rows *sqlmock.Rows, err erro
 }
 
 func getRow(role *Role, updateDate time.Time) *sqlmock.Rows {
-	return sqlmock.NewRows([]string{"internal_id", "name", "description", "external_id", "created_at", "updated_at"}).
+	return sqlmock.NewRows([]string{"internal_id", "name", "description", "external_id", "created_at", "updated_at", "version"}).
 		AddRow(
 			role.InternalID,
 			role.Name,
@@ -222,5 +222,87 @@ func getRow(role *Role, updateDate time.Time) *sqlmock.Rows {
 			role.ExternalID,
 			updateDate,
 			role.CreatedAt,
+			role.Version,
 		)
 }
+
+func TestQueries_DeleteRole(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	role := createRole()
+	deletedAt := time.Now()
+
+	tests := []struct {
+		name     string
+		mock     func()
+		response func(role *Role, err error)
+	}{
+		{
+			name: "OK",
+			mock: func() {
+				setupMockBD(mocker, deleteRoleQuery, getRow(role, role.UpdatedAt), nil, true, deletedAt, role.ExternalID, false, nil)
+			},
+			response: func(actual *Role, err error) {
+				require.NoError(t, err)
+				require.Equal(t, role.ExternalID, actual.ExternalID)
+			},
+		},
+		{
+			name: "RoleInUse",
+			mock: func() {
+				setupMockBD(mocker, deleteRoleQuery, nil, sql.ErrNoRows, true, deletedAt, role.ExternalID, false, nil)
+				setupMockBD(mocker, countRoleUsersQuery, sqlmock.NewRows([]string{"count"}).AddRow(int64(3)), nil, role.ExternalID, false)
+			},
+			response: func(actual *Role, err error) {
+				require.ErrorIs(t, err, ErrRoleInUse)
+				require.Nil(t, actual)
+			},
+		},
+		{
+			name: "NotFound",
+			mock: func() {
+				setupMockBD(mocker, deleteRoleQuery, nil, sql.ErrNoRows, true, deletedAt, role.ExternalID, false, nil)
+				setupMockBD(mocker, countRoleUsersQuery, sqlmock.NewRows([]string{"count"}).AddRow(int64(0)), nil, role.ExternalID, false)
+			},
+			response: func(actual *Role, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Nil(t, actual)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+			tt.response(q.DeleteRole(context.Background(), role.ExternalID, deletedAt, sql.NullInt64{}))
+			require.NoError(t, mocker.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestQueries_RestoreRole(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	role := createRole()
+
+	setupMockBD(mocker, restoreRoleQuery, getRow(role, role.UpdatedAt), nil, false, time.Time{}, role.ExternalID, true)
+	actual, err := q.RestoreRole(context.Background(), role.ExternalID)
+	require.NoError(t, err)
+	require.Equal(t, role.ExternalID, actual.ExternalID)
+
+	setupMockBD(mocker, restoreRoleQuery, nil, sql.ErrNoRows, false, time.Time{}, role.ExternalID, true)
+	actual, err = q.RestoreRole(context.Background(), role.ExternalID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.Nil(t, actual)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
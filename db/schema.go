@@ -0,0 +1,26 @@
+package db
+
+import (
+	"context"
+)
+
+// SchemaVersion is the version of the latest migration in db/migration, the one the code
+// expects the database to be at.
+const SchemaVersion = 12
+
+const getSchemaMigrationQuery = `SELECT version, dirty FROM schema_migrations LIMIT 1;`
+
+// GetSchemaMigration returns the version golang-migrate last migrated the database to.
+func (q *Queries) GetSchemaMigration(ctx context.Context) (*SchemaMigration, error) {
+	var migration SchemaMigration
+	err := q.db.QueryRowContext(ctx, getSchemaMigrationQuery).Scan(&migration.Version, &migration.Dirty)
+	if err != nil {
+		return nil, err
+	}
+	return &migration, nil
+}
+
+// Ping checks that the database can still be reached.
+func (store *SQLStore) Ping(ctx context.Context) error {
+	return store.db.PingContext(ctx)
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	entries, err := os.ReadDir("migration")
+	require.NoError(t, err)
+
+	var latest int64
+	for _, entry := range entries {
+		prefix, _, found := strings.Cut(entry.Name(), "_")
+		require.True(t, found, entry.Name())
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		require.NoError(t, err)
+		latest = max(latest, version)
+	}
+	require.EqualValues(t, latest, SchemaVersion, "SchemaVersion must be bumped along with the migrations")
+}
+
+func TestGetSchemaMigration(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(getSchemaMigrationQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(SchemaVersion, false))
+
+	migration, err := q.GetSchemaMigration(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, &SchemaMigration{Version: SchemaVersion}, migration)
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(getSchemaMigrationQuery)).
+		WillReturnError(sql.ErrConnDone)
+
+	migration, err = q.GetSchemaMigration(context.Background())
+	require.ErrorIs(t, err, sql.ErrConnDone)
+	require.Nil(t, migration)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestPing(t *testing.T) {
+	db, mocker, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	store := NewStore(db)
+	mocker.ExpectPing()
+	require.NoError(t, store.Ping(context.Background()))
+
+	mocker.ExpectPing().WillReturnError(sql.ErrConnDone)
+	require.ErrorIs(t, store.Ping(context.Background()), sql.ErrConnDone)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
@@ -0,0 +1,122 @@
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/util"
+	"github.com/rs/zerolog/log"
+)
+
+// Roles are the roles every environment needs, the API granting access by their name.
+var Roles = []db.CreateRoleParams{
+	{Name: db.RoleSuperUser, Description: "Super user's role"},
+	{Name: db.RoleAdmin, Description: "Administrator's role"},
+	{Name: db.RoleCustomer, Description: "Customer's role"},
+	{Name: db.RoleVisitor, Description: "Visitor's role"},
+}
+
+// DemoUser is a user created in the environments seeding demo users.
+type DemoUser struct {
+	Username string
+	FullName string
+	Email    string
+	Role     string
+}
+
+// DemoUsers let a developer log in right away. There is no super user among them: it is
+// created with posadactl.
+var DemoUsers = []DemoUser{
+	{Username: "anewball", FullName: "Andy Newball", Email: "andy.newball@anewball.com", Role: db.RoleAdmin},
+	{Username: "jayjay", FullName: "Jayden Newball", Email: "jayden.newball@anewball.com", Role: db.RoleCustomer},
+}
+
+// Run creates the Roles missing from the database and, when seed_demo_users is set, the
+// DemoUsers missing too, with the seed_demo_password password. It can be run any number of
+// times: what already exists, even soft deleted, is left untouched.
+func Run(ctx context.Context, store db.Store, config *configuration.Config) error {
+	roles := make(map[string]*db.Role, len(Roles))
+	for _, arg := range Roles {
+		role, err := ensureRole(ctx, store, arg)
+		if err != nil {
+			return err
+		}
+		roles[arg.Name] = role
+	}
+
+	if !config.SeedDemoUsers {
+		return nil
+	}
+
+	hashedPassword, err := util.HashPassword(config.SeedDemoPassword)
+	if err != nil {
+		return err
+	}
+	for _, user := range DemoUsers {
+		if err = ensureUser(ctx, store, user, roles[user.Role], hashedPassword); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ensureRole(ctx context.Context, store db.Store, arg db.CreateRoleParams) (*db.Role, error) {
+	role, err := store.GetRoleByName(ctx, arg.Name)
+	if err == nil {
+		return role, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("cannot get the role %s: %w", arg.Name, err)
+	}
+
+	role, err = store.CreateRole(ctx, arg)
+	if isUniqueViolation(err) {
+		// a soft deleted role keeps its name, and stays deleted
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the role %s: %w", arg.Name, err)
+	}
+	log.Info().Str("role", arg.Name).Msg("role seeded")
+	return role, nil
+}
+
+func ensureUser(ctx context.Context, store db.Store, user DemoUser, role *db.Role, hashedPassword string) error {
+	if role == nil {
+		return fmt.Errorf("cannot seed the user %s: the role %s is deleted", user.Username, user.Role)
+	}
+
+	_, err := store.GetUser(ctx, user.Username)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("cannot get the user %s: %w", user.Username, err)
+	}
+
+	_, err = store.CreateUser(ctx, &db.CreateUserParams{
+		Username:       user.Username,
+		HashedPassword: hashedPassword,
+		FullName:       user.FullName,
+		Email:          user.Email,
+		RoleID:         role.InternalID,
+	})
+	if isUniqueViolation(err) {
+		// a soft deleted user keeps its username, and stays deleted
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot create the user %s: %w", user.Username, err)
+	}
+	log.Info().Str("username", user.Username).Msg("demo user seeded")
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation"
+}
@@ -0,0 +1,126 @@
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/newbri/posadamissportia/db/util"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func expectRoles(querier *mocker.TestMocker, missing ...string) map[string]*db.Role {
+	roles := make(map[string]*db.Role)
+	for _, arg := range Roles {
+		role := &db.Role{InternalID: uuid.New(), Name: arg.Name, Description: arg.Description}
+		roles[arg.Name] = role
+
+		created := false
+		for _, name := range missing {
+			created = created || name == arg.Name
+		}
+		if !created {
+			querier.On("GetRoleByName", mock.Anything, arg.Name).Return(role, nil).Once()
+			continue
+		}
+		querier.On("GetRoleByName", mock.Anything, arg.Name).Return(nil, sql.ErrNoRows).Once()
+		querier.On("CreateRole", mock.Anything, arg).Return(role, nil).Once()
+	}
+	return roles
+}
+
+func TestRun(t *testing.T) {
+	password := util.RandomString(8)
+
+	testCases := []struct {
+		name          string
+		config        configuration.Config
+		buildStubs    func(querier *mocker.TestMocker)
+		checkResponse func(t *testing.T, err error)
+	}{
+		{
+			name:   "OK Roles",
+			config: configuration.Config{},
+			buildStubs: func(querier *mocker.TestMocker) {
+				expectRoles(querier, db.RoleSuperUser, db.RoleVisitor)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "OK Demo Users",
+			config: configuration.Config{SeedDemoUsers: true, SeedDemoPassword: password},
+			buildStubs: func(querier *mocker.TestMocker) {
+				roles := expectRoles(querier)
+				querier.On("GetUser", mock.Anything, "anewball").Return(&db.User{Username: "anewball"}, nil).Once()
+				querier.On("GetUser", mock.Anything, "jayjay").Return(nil, sql.ErrNoRows).Once()
+				querier.On("CreateUser", mock.Anything, mock.MatchedBy(func(arg *db.CreateUserParams) bool {
+					return arg.Username == "jayjay" &&
+						arg.RoleID == roles[db.RoleCustomer].InternalID &&
+						util.CheckPassword(password, arg.HashedPassword) == nil
+				})).Return(&db.User{Username: "jayjay"}, nil).Once()
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "OK Soft Deleted User",
+			config: configuration.Config{SeedDemoUsers: true, SeedDemoPassword: password},
+			buildStubs: func(querier *mocker.TestMocker) {
+				expectRoles(querier)
+				querier.On("GetUser", mock.Anything, "anewball").Return(nil, sql.ErrNoRows).Once()
+				querier.On("GetUser", mock.Anything, "jayjay").Return(&db.User{Username: "jayjay"}, nil).Once()
+				querier.On("CreateUser", mock.Anything, mock.Anything).
+					Return(nil, &pq.Error{Code: "23505"}).Once()
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "Soft Deleted Role",
+			config: configuration.Config{SeedDemoUsers: true, SeedDemoPassword: password},
+			buildStubs: func(querier *mocker.TestMocker) {
+				for _, arg := range Roles {
+					if arg.Name == db.RoleAdmin {
+						querier.On("GetRoleByName", mock.Anything, arg.Name).Return(nil, sql.ErrNoRows).Once()
+						querier.On("CreateRole", mock.Anything, arg).Return(nil, &pq.Error{Code: "23505"}).Once()
+						continue
+					}
+					querier.On("GetRoleByName", mock.Anything, arg.Name).Return(&db.Role{Name: arg.Name}, nil).Once()
+				}
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.EqualError(t, err, "cannot seed the user anewball: the role admin is deleted")
+			},
+		},
+		{
+			name:   "Database Error",
+			config: configuration.Config{},
+			buildStubs: func(querier *mocker.TestMocker) {
+				querier.On("GetRoleByName", mock.Anything, db.RoleSuperUser).Return(nil, sql.ErrConnDone).Once()
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			querier := new(mocker.TestMocker)
+			tc.buildStubs(querier)
+
+			err := Run(context.Background(), querier, &tc.config)
+			tc.checkResponse(t, err)
+			querier.AssertExpectations(t)
+		})
+	}
+}
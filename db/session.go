@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"github.com/google/uuid"
 	"time"
 )
@@ -89,3 +90,44 @@ func (q *Queries) BlockSession(ctx context.Context, sessionID uuid.UUID) (*Sessi
 	}
 	return q.GetSession(ctx, sessionID)
 }
+
+const blockUserSessionsQuery = `
+UPDATE sessions SET is_blocked = $1, blocked_at = $2
+WHERE username = $3 AND is_blocked = $4
+RETURNING id, username, refresh_token, user_agent, client_ip, is_blocked, expired_at, created_at, blocked_at;
+`
+
+// BlockUserSessions blocks every session of the user that is not blocked yet, and returns them.
+func (q *Queries) BlockUserSessions(ctx context.Context, username string, blockedAt time.Time) ([]*Session, error) {
+	rows, err := q.db.QueryContext(ctx, blockUserSessionsQuery, true, blockedAt, username, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err = rows.Scan(
+			&session.ID,
+			&session.Username,
+			&session.RefreshToken,
+			&session.UserAgent,
+			&session.ClientIp,
+			&session.IsBlocked,
+			&session.ExpiredAt,
+			&session.CreatedAt,
+			&session.BlockedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
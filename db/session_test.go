@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"regexp"
 	"testing"
+	"time"
 )
 
 func TestCreateSession(t *testing.T) {
@@ -104,3 +105,85 @@ func TestGetSession(t *testing.T) {
 		})
 	}
 }
+
+func TestBlockUserSessions(t *testing.T) {
+	session := createSession(createSessionParams())
+	session.IsBlocked = true
+	blockedAt := time.Now()
+	event := &Event{ID: 1, Type: EventSessionBlocked, AggregateType: AggregateSession, AggregateID: session.ID.String(), Payload: []byte(`{}`)}
+
+	testCases := []struct {
+		name     string
+		mock     func(mocker sqlmock.Sqlmock)
+		response func(sessions []*Session, err error)
+	}{
+		{
+			name: "OK",
+			mock: func(mocker sqlmock.Sqlmock) {
+				mocker.ExpectBegin()
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(blockUserSessionsQuery)).
+					WithArgs(true, blockedAt, session.Username, false).
+					WillReturnRows(getMockedExpectedCreateSession(session))
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(createEventQuery)).
+					WithArgs(EventSessionBlocked, AggregateSession, session.ID.String(), sqlmock.AnyArg()).
+					WillReturnRows(getMockedExpectedEventRows(event))
+				mocker.ExpectCommit()
+			},
+			response: func(sessions []*Session, err error) {
+				require.NoError(t, err)
+				require.Len(t, sessions, 1)
+				require.Equal(t, session.ID, sessions[0].ID)
+				require.True(t, sessions[0].IsBlocked)
+			},
+		},
+		{
+			name: "NoSession",
+			mock: func(mocker sqlmock.Sqlmock) {
+				mocker.ExpectBegin()
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(blockUserSessionsQuery)).
+					WithArgs(true, blockedAt, session.Username, false).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "refresh_token", "user_agent", "client_ip", "is_blocked", "expired_at", "created_at", "blocked_at"}))
+				mocker.ExpectCommit()
+			},
+			response: func(sessions []*Session, err error) {
+				require.NoError(t, err)
+				require.Empty(t, sessions)
+			},
+		},
+		{
+			name: "EventFails",
+			mock: func(mocker sqlmock.Sqlmock) {
+				mocker.ExpectBegin()
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(blockUserSessionsQuery)).
+					WithArgs(true, blockedAt, session.Username, false).
+					WillReturnRows(getMockedExpectedCreateSession(session))
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(createEventQuery)).
+					WillReturnError(sql.ErrConnDone)
+				mocker.ExpectRollback()
+			},
+			response: func(sessions []*Session, err error) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+				require.Nil(t, sessions)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mocker, err := sqlmock.New()
+			require.NoError(t, err)
+			defer func(db *sql.DB) {
+				_ = db.Close()
+			}(db)
+
+			tc.mock(mocker)
+			tc.response(NewStore(db).BlockUserSessions(context.Background(), session.Username, blockedAt))
+			require.NoError(t, mocker.ExpectationsWereMet())
+		})
+	}
+}
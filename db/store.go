@@ -1,15 +1,480 @@
 package db
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"strconv"
+	"time"
+)
 
 type Store interface {
 	Querier
+	Ping(ctx context.Context) error
+	UpdateUserAndBlockSessions(ctx context.Context, arg UpdateUserParams, blockedAt time.Time) (*UserSessionsUpdate, error)
 }
 
+// SQLStore runs the queries against the database. The mutations that other parts of the
+// application react to, or that are audited, are overridden so that they record their domain
+// event in the outbox and their audit log entry within the same transaction. The paged
+// searches are overridden so that their total and their page are read from one snapshot.
 type SQLStore struct {
 	*Queries
+	db *sql.DB
 }
 
 func NewStore(db *sql.DB) Store {
-	return &SQLStore{Queries: New(db)}
+	return &SQLStore{Queries: New(db), db: db}
+}
+
+// execTx runs fn within a database transaction, committing it when fn succeeds and
+// rolling it back otherwise.
+func (store *SQLStore) execTx(ctx context.Context, fn func(*Queries) error) error {
+	return store.execTxWithOptions(ctx, nil, fn)
+}
+
+// readSnapshot is a read-only transaction whose statements all see the same snapshot.
+var readSnapshot = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+
+func (store *SQLStore) execTxWithOptions(ctx context.Context, opts *sql.TxOptions, fn func(*Queries) error) error {
+	tx, err := store.db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(store.WithTx(tx)); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// mutation is a change SQLStore makes in one transaction, along with what it records.
+type mutation[T any] struct {
+	// before loads the state the change starts from for the audit log. It is left nil by a
+	// change creating its target.
+	before func(q *Queries) (T, error)
+	change func(q *Queries) (T, error)
+	// event builds the domain event of the change recorded in the outbox, if any.
+	event func(T) CreateEventParams
+	// target names what the change applies to in the audit log, the aggregate of its event
+	// by default.
+	target func(T) (targetType string, targetID string)
+	// state gives the state after the change written to the audit log, the result by default.
+	state func(T) any
+	// removes leaves the state after the change out of the audit log, the target being gone.
+	removes bool
+}
+
+// execMutation runs m in one transaction, recording its event and, when ctx carries an
+// AuditEntry, the audit log entry of the change. A change is never committed without them.
+func execMutation[T any](ctx context.Context, store *SQLStore, m mutation[T]) (T, error) {
+	var result T
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+		result, err = applyMutation(ctx, q, m)
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// applyMutation makes the change of m and records what execMutation does, within the
+// transaction of q.
+func applyMutation[T any](ctx context.Context, q *Queries, m mutation[T]) (T, error) {
+	var zero T
+	entry, audited := AuditEntryFrom(ctx)
+
+	var before any
+	if audited && m.before != nil {
+		state, err := m.before(q)
+		if err != nil {
+			return zero, err
+		}
+		before = state
+	}
+
+	result, err := m.change(q)
+	if err != nil {
+		return zero, err
+	}
+
+	var event CreateEventParams
+	if m.event != nil {
+		event = m.event(result)
+		if _, err = q.createEvent(ctx, event); err != nil {
+			return zero, err
+		}
+	}
+	if !audited {
+		return result, nil
+	}
+
+	targetType, targetID := event.AggregateType, event.AggregateID
+	if m.target != nil {
+		targetType, targetID = m.target(result)
+	}
+	var after any = result
+	if m.state != nil {
+		after = m.state(result)
+	}
+	if m.removes {
+		after = nil
+	}
+	if err = q.recordAudit(ctx, entry, targetType, targetID, before, after); err != nil {
+		return zero, err
+	}
+	return result, nil
+}
+
+// mutateWithEvent runs mutate and records the event built from its result in one transaction.
+func mutateWithEvent[T any](ctx context.Context, store *SQLStore, mutate func(*Queries) (T, error), event func(T) CreateEventParams) (T, error) {
+	return execMutation(ctx, store, mutation[T]{change: mutate, event: event})
+}
+
+func userEvent(eventType string) func(*User) CreateEventParams {
+	return func(user *User) CreateEventParams {
+		return CreateEventParams{Type: eventType, AggregateType: AggregateUser, AggregateID: user.Username, Payload: user}
+	}
+}
+
+func roleEvent(eventType string) func(*Role) CreateEventParams {
+	return func(role *Role) CreateEventParams {
+		return CreateEventParams{Type: eventType, AggregateType: AggregateRole, AggregateID: role.ExternalID, Payload: role}
+	}
+}
+
+func propertyEvent(eventType string) func(*Property) CreateEventParams {
+	return func(property *Property) CreateEventParams {
+		return CreateEventParams{Type: eventType, AggregateType: AggregateProperty, AggregateID: property.ExternalID, Payload: property}
+	}
+}
+
+func (store *SQLStore) CreateUser(ctx context.Context, arg *CreateUserParams) (*User, error) {
+	return mutateWithEvent(ctx, store, func(q *Queries) (*User, error) {
+		return q.CreateUser(ctx, arg)
+	}, userEvent(EventUserCreated))
+}
+
+// SearchUsers counts the matching users and reads the page from the same snapshot, so the
+// total agrees with the page under concurrent writes.
+func (store *SQLStore) SearchUsers(ctx context.Context, arg SearchUsersParams) (*SearchUsersResult, error) {
+	var result *SearchUsersResult
+	err := store.execTxWithOptions(ctx, readSnapshot, func(q *Queries) error {
+		var err error
+		result, err = q.SearchUsers(ctx, arg)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func updateUser(ctx context.Context, arg UpdateUserParams) mutation[*User] {
+	return mutation[*User]{
+		before: func(q *Queries) (*User, error) {
+			return q.GetUser(ctx, arg.Username)
+		},
+		change: func(q *Queries) (*User, error) {
+			return q.UpdateUser(ctx, arg)
+		},
+		event: userEvent(EventUserUpdated),
+	}
+}
+
+func (store *SQLStore) UpdateUser(ctx context.Context, arg UpdateUserParams) (*User, error) {
+	return execMutation(ctx, store, updateUser(ctx, arg))
+}
+
+// UserSessionsUpdate is the outcome of UpdateUserAndBlockSessions.
+type UserSessionsUpdate struct {
+	User            *User
+	BlockedSessions []*Session
+}
+
+// UpdateUserAndBlockSessions updates the user and blocks their sessions in one transaction,
+// the way UpdateUser and BlockUserSessions do each. It is used for the changes the refresh
+// tokens issued before must not outlive, such as a new password or role.
+func (store *SQLStore) UpdateUserAndBlockSessions(ctx context.Context, arg UpdateUserParams, blockedAt time.Time) (*UserSessionsUpdate, error) {
+	var update UserSessionsUpdate
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+		if update.User, err = applyMutation(ctx, q, updateUser(ctx, arg)); err != nil {
+			return err
+		}
+		update.BlockedSessions, err = blockUserSessions(ctx, q, arg.Username, blockedAt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+func (store *SQLStore) DeleteUser(ctx context.Context, username string, deletedAt time.Time, version sql.NullInt64) (*User, error) {
+	return execMutation(ctx, store, mutation[*User]{
+		before: func(q *Queries) (*User, error) {
+			return q.GetUser(ctx, username)
+		},
+		change: func(q *Queries) (*User, error) {
+			return q.DeleteUser(ctx, username, deletedAt, version)
+		},
+		event:   userEvent(EventUserDeleted),
+		removes: true,
+	})
+}
+
+func (store *SQLStore) RestoreUser(ctx context.Context, username string) (*User, error) {
+	return mutateWithEvent(ctx, store, func(q *Queries) (*User, error) {
+		return q.RestoreUser(ctx, username)
+	}, userEvent(EventUserRestored))
+}
+
+func (store *SQLStore) CreateRole(ctx context.Context, arg CreateRoleParams) (*Role, error) {
+	return mutateWithEvent(ctx, store, func(q *Queries) (*Role, error) {
+		return q.CreateRole(ctx, arg)
+	}, roleEvent(EventRoleCreated))
+}
+
+func (store *SQLStore) UpdateRole(ctx context.Context, arg UpdateRoleParams) (*Role, error) {
+	return execMutation(ctx, store, mutation[*Role]{
+		before: func(q *Queries) (*Role, error) {
+			return q.GetRole(ctx, arg.ExternalID)
+		},
+		change: func(q *Queries) (*Role, error) {
+			return q.UpdateRole(ctx, arg)
+		},
+		event: roleEvent(EventRoleUpdated),
+	})
+}
+
+func (store *SQLStore) DeleteRole(ctx context.Context, externalID string, deletedAt time.Time, version sql.NullInt64) (*Role, error) {
+	return execMutation(ctx, store, mutation[*Role]{
+		before: func(q *Queries) (*Role, error) {
+			return q.GetRole(ctx, externalID)
+		},
+		change: func(q *Queries) (*Role, error) {
+			return q.DeleteRole(ctx, externalID, deletedAt, version)
+		},
+		event:   roleEvent(EventRoleDeleted),
+		removes: true,
+	})
+}
+
+func (store *SQLStore) RestoreRole(ctx context.Context, externalID string) (*Role, error) {
+	return mutateWithEvent(ctx, store, func(q *Queries) (*Role, error) {
+		return q.RestoreRole(ctx, externalID)
+	}, roleEvent(EventRoleRestored))
+}
+
+func (store *SQLStore) CreateProperty(ctx context.Context, arg CreatePropertyParams) (*Property, error) {
+	return mutateWithEvent(ctx, store, func(q *Queries) (*Property, error) {
+		return q.CreateProperty(ctx, arg)
+	}, propertyEvent(EventPropertyCreated))
+}
+
+func (store *SQLStore) UpdateProperty(ctx context.Context, arg UpdatePropertyParams) (*Property, error) {
+	return execMutation(ctx, store, mutation[*Property]{
+		before: func(q *Queries) (*Property, error) {
+			return q.GetProperty(ctx, arg.ExternalID)
+		},
+		change: func(q *Queries) (*Property, error) {
+			return q.UpdateProperty(ctx, arg)
+		},
+		event: propertyEvent(EventPropertyUpdated),
+	})
+}
+
+func (store *SQLStore) ActivateDeactivateProperty(ctx context.Context, isActive bool, externalId string) (*Property, error) {
+	eventType := EventPropertyDeactivated
+	if isActive {
+		eventType = EventPropertyActivated
+	}
+	return execMutation(ctx, store, mutation[*Property]{
+		before: func(q *Queries) (*Property, error) {
+			return q.GetProperty(ctx, externalId)
+		},
+		change: func(q *Queries) (*Property, error) {
+			return q.ActivateDeactivateProperty(ctx, isActive, externalId)
+		},
+		event: propertyEvent(eventType),
+	})
+}
+
+func (store *SQLStore) DeleteProperty(ctx context.Context, externalID string, deletedAt time.Time, version sql.NullInt64) (*Property, error) {
+	return execMutation(ctx, store, mutation[*Property]{
+		before: func(q *Queries) (*Property, error) {
+			return q.GetProperty(ctx, externalID)
+		},
+		change: func(q *Queries) (*Property, error) {
+			return q.DeleteProperty(ctx, externalID, deletedAt, version)
+		},
+		event:   propertyEvent(EventPropertyDeleted),
+		removes: true,
+	})
+}
+
+func (store *SQLStore) RestoreProperty(ctx context.Context, externalID string) (*Property, error) {
+	return mutateWithEvent(ctx, store, func(q *Queries) (*Property, error) {
+		return q.RestoreProperty(ctx, externalID)
+	}, propertyEvent(EventPropertyRestored))
+}
+
+// sessionBlockedPayload leaves the refresh token of the blocked session out of the event.
+type sessionBlockedPayload struct {
+	ID        uuid.UUID `json:"id"`
+	Username  string    `json:"username"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+func blockedSession(session *Session) any {
+	return sessionBlockedPayload{ID: session.ID, Username: session.Username, BlockedAt: session.BlockedAt}
+}
+
+func sessionBlockedEvent(session *Session) CreateEventParams {
+	return CreateEventParams{
+		Type:          EventSessionBlocked,
+		AggregateType: AggregateSession,
+		AggregateID:   session.ID.String(),
+		Payload:       blockedSession(session),
+	}
+}
+
+func (store *SQLStore) BlockSession(ctx context.Context, sessionID uuid.UUID) (*Session, error) {
+	return execMutation(ctx, store, mutation[*Session]{
+		change: func(q *Queries) (*Session, error) {
+			return q.BlockSession(ctx, sessionID)
+		},
+		event: sessionBlockedEvent,
+		state: blockedSession,
+	})
+}
+
+// blockedSessions is the audited state of the sessions of a user blocked at once.
+type blockedSessions struct {
+	Sessions []uuid.UUID `json:"sessions"`
+}
+
+// BlockUserSessions blocks the sessions of the user, recording an event for each of them. When
+// ctx carries an AuditEntry, the blocked sessions are written to the audit log under the
+// auditActionBlockSessions action.
+func (store *SQLStore) BlockUserSessions(ctx context.Context, username string, blockedAt time.Time) ([]*Session, error) {
+	var sessions []*Session
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+		sessions, err = blockUserSessions(ctx, q, username, blockedAt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func blockUserSessions(ctx context.Context, q *Queries, username string, blockedAt time.Time) ([]*Session, error) {
+	sessions, err := q.BlockUserSessions(ctx, username, blockedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		if _, err = q.createEvent(ctx, sessionBlockedEvent(session)); err != nil {
+			return nil, err
+		}
+	}
+
+	entry, audited := AuditEntryFrom(ctx)
+	if !audited || len(sessions) == 0 {
+		return sessions, nil
+	}
+	blocked := blockedSessions{Sessions: make([]uuid.UUID, 0, len(sessions))}
+	for _, session := range sessions {
+		blocked.Sessions = append(blocked.Sessions, session.ID)
+	}
+	entry.Action = auditActionBlockSessions
+	if err = q.recordAudit(ctx, entry, AggregateUser, username, nil, blocked); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// usersPurge is the audited state of a purge of the soft deleted users.
+type usersPurge struct {
+	Purged        int64     `json:"purged"`
+	DeletedBefore time.Time `json:"deleted_before"`
+}
+
+func (store *SQLStore) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	purge, err := execMutation(ctx, store, mutation[*usersPurge]{
+		change: func(q *Queries) (*usersPurge, error) {
+			purged, err := q.PurgeDeletedUsers(ctx, deletedBefore)
+			return &usersPurge{Purged: purged, DeletedBefore: deletedBefore}, err
+		},
+		target: func(*usersPurge) (string, string) {
+			return AggregateUser, ""
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purge.Purged, nil
+}
+
+func webhookTarget(subscriptionID int64) (string, string) {
+	return auditTargetWebhook, strconv.FormatInt(subscriptionID, 10)
+}
+
+func subscriptionTarget(subscription *WebhookSubscription) (string, string) {
+	return webhookTarget(subscription.ID)
+}
+
+func (store *SQLStore) CreateWebhookSubscription(ctx context.Context, arg CreateWebhookSubscriptionParams) (*WebhookSubscription, error) {
+	return execMutation(ctx, store, mutation[*WebhookSubscription]{
+		change: func(q *Queries) (*WebhookSubscription, error) {
+			return q.CreateWebhookSubscription(ctx, arg)
+		},
+		target: subscriptionTarget,
+	})
+}
+
+func (store *SQLStore) UpdateWebhookSubscription(ctx context.Context, arg UpdateWebhookSubscriptionParams) (*WebhookSubscription, error) {
+	return execMutation(ctx, store, mutation[*WebhookSubscription]{
+		before: func(q *Queries) (*WebhookSubscription, error) {
+			return q.GetWebhookSubscription(ctx, arg.ID)
+		},
+		change: func(q *Queries) (*WebhookSubscription, error) {
+			return q.UpdateWebhookSubscription(ctx, arg)
+		},
+		target: subscriptionTarget,
+	})
+}
+
+func (store *SQLStore) DeleteWebhookSubscription(ctx context.Context, id int64) (*WebhookSubscription, error) {
+	return execMutation(ctx, store, mutation[*WebhookSubscription]{
+		before: func(q *Queries) (*WebhookSubscription, error) {
+			return q.GetWebhookSubscription(ctx, id)
+		},
+		change: func(q *Queries) (*WebhookSubscription, error) {
+			return q.DeleteWebhookSubscription(ctx, id)
+		},
+		target:  subscriptionTarget,
+		removes: true,
+	})
+}
+
+func (store *SQLStore) RedeliverWebhookDelivery(ctx context.Context, subscriptionID int64, id int64, nextAttemptAt time.Time) (*WebhookDelivery, error) {
+	return execMutation(ctx, store, mutation[*WebhookDelivery]{
+		change: func(q *Queries) (*WebhookDelivery, error) {
+			return q.RedeliverWebhookDelivery(ctx, subscriptionID, id, nextAttemptAt)
+		},
+		target: func(delivery *WebhookDelivery) (string, string) {
+			return webhookTarget(delivery.SubscriptionID)
+		},
+	})
 }
@@ -0,0 +1,441 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/newbri/posadamissportia/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"reflect"
+	"time"
+)
+
+const rowsAttributeKey = attribute.Key("db.rows")
+
+var tracer = otel.Tracer("github.com/newbri/posadamissportia/db")
+
+// observeQuery records the latency of a query in the metrics, replaced in the tests.
+var observeQuery = metrics.ObserveQuery
+
+// tracedStore opens a span around every call to the store it wraps, named after the query
+// and recording how many rows it returned or changed. The call is also timed in the query
+// metrics under the same name.
+type tracedStore struct {
+	store Store
+}
+
+// NewTracedStore wraps store so that its queries are traced. It implements every method
+// itself rather than embedding the store, so that a query added to the Querier without a
+// span here does not compile.
+func NewTracedStore(store Store) Store {
+	return &tracedStore{store: store}
+}
+
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "db."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation(name)),
+	)
+}
+
+// endSpan records err on span, apart from sql.ErrNoRows which is an expected outcome.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// observe records the query in the metrics, a missing row not counting as a failure.
+func observe(name string, start time.Time, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	observeQuery(name, time.Since(start), err)
+}
+
+func traced[T any](ctx context.Context, name string, call func(ctx context.Context) (T, error)) (T, error) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, name)
+	result, err := call(ctx)
+	if err == nil {
+		span.SetAttributes(rowsAttributeKey.Int64(rowCount(result)))
+	}
+	endSpan(span, err)
+	observe(name, start, err)
+	return result, err
+}
+
+func tracedExec(ctx context.Context, name string, call func(ctx context.Context) error) error {
+	start := time.Now()
+	ctx, span := startSpan(ctx, name)
+	err := call(ctx)
+	endSpan(span, err)
+	observe(name, start, err)
+	return err
+}
+
+// rowCount tells how many rows a query result holds: the length of a list, the number of
+// rows a bulk statement changed, or one for a single row.
+func rowCount(result any) int64 {
+	switch result := result.(type) {
+	case *SearchUsersResult:
+		if result == nil {
+			return 0
+		}
+		return int64(len(result.Users))
+	case int64:
+		return result
+	}
+
+	value := reflect.ValueOf(result)
+	switch value.Kind() {
+	case reflect.Slice:
+		return int64(value.Len())
+	case reflect.Pointer:
+		if value.IsNil() {
+			return 0
+		}
+	}
+	return 1
+}
+
+func (store *tracedStore) Ping(ctx context.Context) error {
+	return tracedExec(ctx, "Ping", store.store.Ping)
+}
+
+func (store *tracedStore) UpdateUserAndBlockSessions(ctx context.Context, arg UpdateUserParams, blockedAt time.Time) (*UserSessionsUpdate, error) {
+	return traced(ctx, "UpdateUserAndBlockSessions", func(ctx context.Context) (*UserSessionsUpdate, error) {
+		return store.store.UpdateUserAndBlockSessions(ctx, arg, blockedAt)
+	})
+}
+
+func (store *tracedStore) CreateUser(ctx context.Context, arg *CreateUserParams) (*User, error) {
+	return traced(ctx, "CreateUser", func(ctx context.Context) (*User, error) {
+		return store.store.CreateUser(ctx, arg)
+	})
+}
+
+func (store *tracedStore) GetUser(ctx context.Context, username string) (*User, error) {
+	return traced(ctx, "GetUser", func(ctx context.Context) (*User, error) {
+		return store.store.GetUser(ctx, username)
+	})
+}
+
+func (store *tracedStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	return traced(ctx, "GetUserByEmail", func(ctx context.Context) (*User, error) {
+		return store.store.GetUserByEmail(ctx, email)
+	})
+}
+
+func (store *tracedStore) UpdateUser(ctx context.Context, arg UpdateUserParams) (*User, error) {
+	return traced(ctx, "UpdateUser", func(ctx context.Context) (*User, error) {
+		return store.store.UpdateUser(ctx, arg)
+	})
+}
+
+func (store *tracedStore) DeleteUser(ctx context.Context, username string, deletedAt time.Time, version sql.NullInt64) (*User, error) {
+	return traced(ctx, "DeleteUser", func(ctx context.Context) (*User, error) {
+		return store.store.DeleteUser(ctx, username, deletedAt, version)
+	})
+}
+
+func (store *tracedStore) RestoreUser(ctx context.Context, username string) (*User, error) {
+	return traced(ctx, "RestoreUser", func(ctx context.Context) (*User, error) {
+		return store.store.RestoreUser(ctx, username)
+	})
+}
+
+func (store *tracedStore) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	return traced(ctx, "PurgeDeletedUsers", func(ctx context.Context) (int64, error) {
+		return store.store.PurgeDeletedUsers(ctx, deletedBefore)
+	})
+}
+
+func (store *tracedStore) GetSession(ctx context.Context, id uuid.UUID) (*Session, error) {
+	return traced(ctx, "GetSession", func(ctx context.Context) (*Session, error) {
+		return store.store.GetSession(ctx, id)
+	})
+}
+
+func (store *tracedStore) CreateSession(ctx context.Context, arg CreateSessionParams) (*Session, error) {
+	return traced(ctx, "CreateSession", func(ctx context.Context) (*Session, error) {
+		return store.store.CreateSession(ctx, arg)
+	})
+}
+
+func (store *tracedStore) BlockSession(ctx context.Context, sessionID uuid.UUID) (*Session, error) {
+	return traced(ctx, "BlockSession", func(ctx context.Context) (*Session, error) {
+		return store.store.BlockSession(ctx, sessionID)
+	})
+}
+
+func (store *tracedStore) BlockUserSessions(ctx context.Context, username string, blockedAt time.Time) ([]*Session, error) {
+	return traced(ctx, "BlockUserSessions", func(ctx context.Context) ([]*Session, error) {
+		return store.store.BlockUserSessions(ctx, username, blockedAt)
+	})
+}
+
+func (store *tracedStore) CreateRole(ctx context.Context, arg CreateRoleParams) (*Role, error) {
+	return traced(ctx, "CreateRole", func(ctx context.Context) (*Role, error) {
+		return store.store.CreateRole(ctx, arg)
+	})
+}
+
+func (store *tracedStore) GetAllRole(ctx context.Context, arg ListRoleParams) ([]*Role, error) {
+	return traced(ctx, "GetAllRole", func(ctx context.Context) ([]*Role, error) {
+		return store.store.GetAllRole(ctx, arg)
+	})
+}
+
+func (store *tracedStore) GetRole(ctx context.Context, externalId string) (*Role, error) {
+	return traced(ctx, "GetRole", func(ctx context.Context) (*Role, error) {
+		return store.store.GetRole(ctx, externalId)
+	})
+}
+
+func (store *tracedStore) GetRoleByName(ctx context.Context, name string) (*Role, error) {
+	return traced(ctx, "GetRoleByName", func(ctx context.Context) (*Role, error) {
+		return store.store.GetRoleByName(ctx, name)
+	})
+}
+
+func (store *tracedStore) GetRoleByUUID(ctx context.Context, internalId uuid.UUID) (*Role, error) {
+	return traced(ctx, "GetRoleByUUID", func(ctx context.Context) (*Role, error) {
+		return store.store.GetRoleByUUID(ctx, internalId)
+	})
+}
+
+func (store *tracedStore) UpdateRole(ctx context.Context, arg UpdateRoleParams) (*Role, error) {
+	return traced(ctx, "UpdateRole", func(ctx context.Context) (*Role, error) {
+		return store.store.UpdateRole(ctx, arg)
+	})
+}
+
+func (store *tracedStore) DeleteRole(ctx context.Context, externalID string, deletedAt time.Time, version sql.NullInt64) (*Role, error) {
+	return traced(ctx, "DeleteRole", func(ctx context.Context) (*Role, error) {
+		return store.store.DeleteRole(ctx, externalID, deletedAt, version)
+	})
+}
+
+func (store *tracedStore) RestoreRole(ctx context.Context, externalID string) (*Role, error) {
+	return traced(ctx, "RestoreRole", func(ctx context.Context) (*Role, error) {
+		return store.store.RestoreRole(ctx, externalID)
+	})
+}
+
+func (store *tracedStore) SearchUsers(ctx context.Context, arg SearchUsersParams) (*SearchUsersResult, error) {
+	return traced(ctx, "SearchUsers", func(ctx context.Context) (*SearchUsersResult, error) {
+		return store.store.SearchUsers(ctx, arg)
+	})
+}
+
+func (store *tracedStore) CreateProperty(ctx context.Context, arg CreatePropertyParams) (*Property, error) {
+	return traced(ctx, "CreateProperty", func(ctx context.Context) (*Property, error) {
+		return store.store.CreateProperty(ctx, arg)
+	})
+}
+
+func (store *tracedStore) ActivateDeactivateProperty(ctx context.Context, isActive bool, externalId string) (*Property, error) {
+	return traced(ctx, "ActivateDeactivateProperty", func(ctx context.Context) (*Property, error) {
+		return store.store.ActivateDeactivateProperty(ctx, isActive, externalId)
+	})
+}
+
+func (store *tracedStore) GetAllProperty(ctx context.Context, arg ListPropertyParams) ([]*Property, error) {
+	return traced(ctx, "GetAllProperty", func(ctx context.Context) ([]*Property, error) {
+		return store.store.GetAllProperty(ctx, arg)
+	})
+}
+
+func (store *tracedStore) GetProperty(ctx context.Context, Id string) (*Property, error) {
+	return traced(ctx, "GetProperty", func(ctx context.Context) (*Property, error) {
+		return store.store.GetProperty(ctx, Id)
+	})
+}
+
+func (store *tracedStore) UpdateProperty(ctx context.Context, arg UpdatePropertyParams) (*Property, error) {
+	return traced(ctx, "UpdateProperty", func(ctx context.Context) (*Property, error) {
+		return store.store.UpdateProperty(ctx, arg)
+	})
+}
+
+func (store *tracedStore) DeleteProperty(ctx context.Context, externalID string, deletedAt time.Time, version sql.NullInt64) (*Property, error) {
+	return traced(ctx, "DeleteProperty", func(ctx context.Context) (*Property, error) {
+		return store.store.DeleteProperty(ctx, externalID, deletedAt, version)
+	})
+}
+
+func (store *tracedStore) RestoreProperty(ctx context.Context, externalID string) (*Property, error) {
+	return traced(ctx, "RestoreProperty", func(ctx context.Context) (*Property, error) {
+		return store.store.RestoreProperty(ctx, externalID)
+	})
+}
+
+func (store *tracedStore) CreateAuditLog(ctx context.Context, arg CreateAuditLogParams) (*AuditLog, error) {
+	return traced(ctx, "CreateAuditLog", func(ctx context.Context) (*AuditLog, error) {
+		return store.store.CreateAuditLog(ctx, arg)
+	})
+}
+
+func (store *tracedStore) ListAuditLog(ctx context.Context, arg ListAuditLogParams) ([]*AuditLog, error) {
+	return traced(ctx, "ListAuditLog", func(ctx context.Context) ([]*AuditLog, error) {
+		return store.store.ListAuditLog(ctx, arg)
+	})
+}
+
+func (store *tracedStore) CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (*IdempotencyKey, error) {
+	return traced(ctx, "CreateIdempotencyKey", func(ctx context.Context) (*IdempotencyKey, error) {
+		return store.store.CreateIdempotencyKey(ctx, arg)
+	})
+}
+
+func (store *tracedStore) GetIdempotencyKey(ctx context.Context, scope string, key string) (*IdempotencyKey, error) {
+	return traced(ctx, "GetIdempotencyKey", func(ctx context.Context) (*IdempotencyKey, error) {
+		return store.store.GetIdempotencyKey(ctx, scope, key)
+	})
+}
+
+func (store *tracedStore) CompleteIdempotencyKey(ctx context.Context, arg CompleteIdempotencyKeyParams) error {
+	return tracedExec(ctx, "CompleteIdempotencyKey", func(ctx context.Context) error {
+		return store.store.CompleteIdempotencyKey(ctx, arg)
+	})
+}
+
+func (store *tracedStore) DeleteIdempotencyKey(ctx context.Context, scope string, key string) error {
+	return tracedExec(ctx, "DeleteIdempotencyKey", func(ctx context.Context) error {
+		return store.store.DeleteIdempotencyKey(ctx, scope, key)
+	})
+}
+
+func (store *tracedStore) PurgeExpiredIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	return traced(ctx, "PurgeExpiredIdempotencyKeys", func(ctx context.Context) (int64, error) {
+		return store.store.PurgeExpiredIdempotencyKeys(ctx, expiredBefore)
+	})
+}
+
+func (store *tracedStore) ClaimEvents(ctx context.Context, arg ClaimEventsParams) ([]*Event, error) {
+	return traced(ctx, "ClaimEvents", func(ctx context.Context) ([]*Event, error) {
+		return store.store.ClaimEvents(ctx, arg)
+	})
+}
+
+func (store *tracedStore) MarkEventDispatched(ctx context.Context, id int64, dispatchedAt time.Time) error {
+	return tracedExec(ctx, "MarkEventDispatched", func(ctx context.Context) error {
+		return store.store.MarkEventDispatched(ctx, id, dispatchedAt)
+	})
+}
+
+func (store *tracedStore) RetryEvent(ctx context.Context, arg RetryEventParams) error {
+	return tracedExec(ctx, "RetryEvent", func(ctx context.Context) error {
+		return store.store.RetryEvent(ctx, arg)
+	})
+}
+
+func (store *tracedStore) MarkEventFailed(ctx context.Context, arg MarkEventFailedParams) error {
+	return tracedExec(ctx, "MarkEventFailed", func(ctx context.Context) error {
+		return store.store.MarkEventFailed(ctx, arg)
+	})
+}
+
+func (store *tracedStore) PurgeDispatchedEvents(ctx context.Context, dispatchedBefore time.Time) (int64, error) {
+	return traced(ctx, "PurgeDispatchedEvents", func(ctx context.Context) (int64, error) {
+		return store.store.PurgeDispatchedEvents(ctx, dispatchedBefore)
+	})
+}
+
+func (store *tracedStore) CreateWebhookSubscription(ctx context.Context, arg CreateWebhookSubscriptionParams) (*WebhookSubscription, error) {
+	return traced(ctx, "CreateWebhookSubscription", func(ctx context.Context) (*WebhookSubscription, error) {
+		return store.store.CreateWebhookSubscription(ctx, arg)
+	})
+}
+
+func (store *tracedStore) GetWebhookSubscription(ctx context.Context, id int64) (*WebhookSubscription, error) {
+	return traced(ctx, "GetWebhookSubscription", func(ctx context.Context) (*WebhookSubscription, error) {
+		return store.store.GetWebhookSubscription(ctx, id)
+	})
+}
+
+func (store *tracedStore) ListWebhookSubscriptions(ctx context.Context, arg LimitOffset) ([]*WebhookSubscription, error) {
+	return traced(ctx, "ListWebhookSubscriptions", func(ctx context.Context) ([]*WebhookSubscription, error) {
+		return store.store.ListWebhookSubscriptions(ctx, arg)
+	})
+}
+
+func (store *tracedStore) ListWebhookSubscriptionsForEvent(ctx context.Context, eventType string) ([]*WebhookSubscription, error) {
+	return traced(ctx, "ListWebhookSubscriptionsForEvent", func(ctx context.Context) ([]*WebhookSubscription, error) {
+		return store.store.ListWebhookSubscriptionsForEvent(ctx, eventType)
+	})
+}
+
+func (store *tracedStore) UpdateWebhookSubscription(ctx context.Context, arg UpdateWebhookSubscriptionParams) (*WebhookSubscription, error) {
+	return traced(ctx, "UpdateWebhookSubscription", func(ctx context.Context) (*WebhookSubscription, error) {
+		return store.store.UpdateWebhookSubscription(ctx, arg)
+	})
+}
+
+func (store *tracedStore) DeleteWebhookSubscription(ctx context.Context, id int64) (*WebhookSubscription, error) {
+	return traced(ctx, "DeleteWebhookSubscription", func(ctx context.Context) (*WebhookSubscription, error) {
+		return store.store.DeleteWebhookSubscription(ctx, id)
+	})
+}
+
+func (store *tracedStore) CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) error {
+	return tracedExec(ctx, "CreateWebhookDelivery", func(ctx context.Context) error {
+		return store.store.CreateWebhookDelivery(ctx, arg)
+	})
+}
+
+func (store *tracedStore) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]*WebhookDelivery, error) {
+	return traced(ctx, "ClaimWebhookDeliveries", func(ctx context.Context) ([]*WebhookDelivery, error) {
+		return store.store.ClaimWebhookDeliveries(ctx, arg)
+	})
+}
+
+func (store *tracedStore) RecordWebhookDeliveryAttempt(ctx context.Context, arg RecordWebhookDeliveryAttemptParams) error {
+	return tracedExec(ctx, "RecordWebhookDeliveryAttempt", func(ctx context.Context) error {
+		return store.store.RecordWebhookDeliveryAttempt(ctx, arg)
+	})
+}
+
+func (store *tracedStore) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]*WebhookDelivery, error) {
+	return traced(ctx, "ListWebhookDeliveries", func(ctx context.Context) ([]*WebhookDelivery, error) {
+		return store.store.ListWebhookDeliveries(ctx, arg)
+	})
+}
+
+func (store *tracedStore) RedeliverWebhookDelivery(ctx context.Context, subscriptionID int64, id int64, nextAttemptAt time.Time) (*WebhookDelivery, error) {
+	return traced(ctx, "RedeliverWebhookDelivery", func(ctx context.Context) (*WebhookDelivery, error) {
+		return store.store.RedeliverWebhookDelivery(ctx, subscriptionID, id, nextAttemptAt)
+	})
+}
+
+func (store *tracedStore) ListEvents(ctx context.Context, arg ListEventsParams) ([]*Event, error) {
+	return traced(ctx, "ListEvents", func(ctx context.Context) ([]*Event, error) {
+		return store.store.ListEvents(ctx, arg)
+	})
+}
+
+func (store *tracedStore) ListUserPropertyIDs(ctx context.Context, username string) ([]string, error) {
+	return traced(ctx, "ListUserPropertyIDs", func(ctx context.Context) ([]string, error) {
+		return store.store.ListUserPropertyIDs(ctx, username)
+	})
+}
+
+func (store *tracedStore) UserSharesProperty(ctx context.Context, username string, other string) (bool, error) {
+	return traced(ctx, "UserSharesProperty", func(ctx context.Context) (bool, error) {
+		return store.store.UserSharesProperty(ctx, username, other)
+	})
+}
+
+func (store *tracedStore) GetSchemaMigration(ctx context.Context) (*SchemaMigration, error) {
+	return traced(ctx, "GetSchemaMigration", func(ctx context.Context) (*SchemaMigration, error) {
+		return store.store.GetSchemaMigration(ctx)
+	})
+}
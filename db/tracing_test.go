@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/newbri/posadamissportia/metrics"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTracedStore(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+	store := NewTracedStore(NewStore(db))
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(listUserPropertyIDsQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"external_id"}).AddRow("a").AddRow("b"))
+	_, err = store.ListUserPropertyIDs(context.Background(), "owner")
+	require.NoError(t, err)
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(getSchemaMigrationQuery)).
+		WillReturnError(sql.ErrNoRows)
+	_, err = store.GetSchemaMigration(context.Background())
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(getSchemaMigrationQuery)).
+		WillReturnError(sql.ErrConnDone)
+	_, err = store.GetSchemaMigration(context.Background())
+	require.ErrorIs(t, err, sql.ErrConnDone)
+	require.NoError(t, mocker.ExpectationsWereMet())
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+
+	require.Equal(t, "db.ListUserPropertyIDs", spans[0].Name)
+	require.Contains(t, spans[0].Attributes, rowsAttributeKey.Int64(2))
+	require.Equal(t, codes.Unset, spans[0].Status.Code)
+
+	// a missing row is an answer, not a failure
+	require.Equal(t, "db.GetSchemaMigration", spans[1].Name)
+	require.Equal(t, codes.Unset, spans[1].Status.Code)
+
+	require.Equal(t, "db.GetSchemaMigration", spans[2].Name)
+	require.Equal(t, codes.Error, spans[2].Status.Code)
+}
+
+type observedQuery struct {
+	name   string
+	failed bool
+}
+
+func TestTracedStoreMetrics(t *testing.T) {
+	var observed []observedQuery
+	observeQuery = func(query string, elapsed time.Duration, err error) {
+		require.GreaterOrEqual(t, elapsed, time.Duration(0))
+		observed = append(observed, observedQuery{name: query, failed: err != nil})
+	}
+	defer func() {
+		observeQuery = metrics.ObserveQuery
+	}()
+
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+	store := NewTracedStore(NewStore(db))
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(getSchemaMigrationQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(SchemaVersion, false))
+	_, err = store.GetSchemaMigration(context.Background())
+	require.NoError(t, err)
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(getSchemaMigrationQuery)).
+		WillReturnError(sql.ErrNoRows)
+	_, err = store.GetSchemaMigration(context.Background())
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// the transaction and the version lookup of a mismatch are timed with the DeleteRole call
+	mocker.ExpectBegin()
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(deleteRoleQuery)).
+		WillReturnError(sql.ErrNoRows)
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(roleVersionQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	mocker.ExpectRollback()
+	_, err = store.DeleteRole(context.Background(), "role", time.Now(), sql.NullInt64{Int64: 1, Valid: true})
+	require.ErrorIs(t, err, ErrVersionMismatch)
+
+	mocker.
+		ExpectExec(regexp.QuoteMeta(deleteIdempotencyKeyQuery)).
+		WillReturnError(sql.ErrConnDone)
+	err = store.DeleteIdempotencyKey(context.Background(), "scope", "key")
+	require.ErrorIs(t, err, sql.ErrConnDone)
+
+	require.Equal(t, []observedQuery{
+		{name: "GetSchemaMigration"},
+		{name: "GetSchemaMigration"},
+		{name: "DeleteRole", failed: true},
+		{name: "DeleteIdempotencyKey", failed: true},
+	}, observed)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestRowCount(t *testing.T) {
+	testCases := []struct {
+		name   string
+		result any
+		rows   int64
+	}{
+		{name: "List", result: []*Role{{}, {}, {}}, rows: 3},
+		{name: "EmptyList", result: []string(nil), rows: 0},
+		{name: "Row", result: &Role{}, rows: 1},
+		{name: "NoRow", result: (*Role)(nil), rows: 0},
+		{name: "Search", result: &SearchUsersResult{Users: []*User{{}, {}}, Total: 10}, rows: 2},
+		{name: "Purged", result: int64(7), rows: 7},
+		{name: "Scalar", result: true, rows: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.rows, rowCount(tc.result))
+		})
+	}
+}
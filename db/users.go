@@ -4,13 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"time"
 )
 
 const insertUserQuery = `
 INSERT INTO users (username, hashed_password, full_name, email, role_id) 
 VALUES ($1,$2,$3,$4,$5)
-RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role_id, is_deleted, deleted_at;
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role_id, is_deleted, deleted_at, version;
 `
 
 type CreateUserParams struct {
@@ -41,6 +42,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg *CreateUserParams) (*User,
 		&role.InternalID,
 		&user.IsDeleted,
 		&user.DeletedAt,
+		&user.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -51,10 +53,10 @@ func (q *Queries) CreateUser(ctx context.Context, arg *CreateUserParams) (*User,
 
 const getUserQuery = `
 SELECT username, hashed_password, full_name, email, password_changed_at,
-       users.created_at, is_deleted, deleted_at,
-       p.internal_id, p.name, p.description, p.external_id, p.created_at, p.updated_at
+       users.created_at, users.is_deleted, users.deleted_at,
+       p.internal_id, p.name, p.description, p.external_id, p.created_at, p.updated_at, users.version
 FROM users FULL OUTER JOIN role p ON users.role_id = p.internal_id 
-WHERE username = $1 AND is_deleted = $2;
+WHERE username = $1 AND users.is_deleted = $2;
 `
 
 func (q *Queries) GetUser(ctx context.Context, username string) (*User, error) {
@@ -76,6 +78,7 @@ func (q *Queries) GetUser(ctx context.Context, username string) (*User, error) {
 		&role.ExternalID,
 		&role.CreatedAt,
 		&role.UpdatedAt,
+		&user.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -85,28 +88,14 @@ func (q *Queries) GetUser(ctx context.Context, username string) (*User, error) {
 	return &user, err
 }
 
-type ListUsersParams struct {
-	Limit  int32 `json:"limit"`
-	Offset int32 `json:"offset"`
-}
-
-const getAllUserQuery = `SELECT username, hashed_password, full_name, email, password_changed_at, users.created_at, role_id, is_deleted, deleted_at
-FROM users INNER JOIN role on users.role_id = role.internal_id WHERE role.name = $1 AND is_deleted = $2 LIMIT $3 OFFSET $4;`
-
-func (q *Queries) GetAllCustomer(ctx context.Context, arg ListUsersParams) ([]*User, error) {
-	return q.getUsersByRole(ctx, getAllUserQuery, RoleCustomer, false, arg)
-}
-
-func (q *Queries) GetAllAdmin(ctx context.Context, arg ListUsersParams) ([]*User, error) {
-	return q.getUsersByRole(ctx, getAllUserQuery, RoleAdmin, false, arg)
-}
-
 type UpdateUserParams struct {
 	HashedPassword    sql.NullString `json:"hashed_password"`
 	PasswordChangedAt sql.NullTime   `json:"password_changed_at"`
 	FullName          sql.NullString `json:"full_name"`
 	Email             sql.NullString `json:"email"`
+	RoleID            uuid.NullUUID  `json:"-"`
 	Username          string         `json:"username"`
+	Version           sql.NullInt64  `json:"version"`
 }
 
 const updateUserQuery = `
@@ -114,9 +103,11 @@ UPDATE users
 SET hashed_password = coalesce($1, hashed_password),
     password_changed_at = coalesce($2, password_changed_at),
     full_name = coalesce($3, full_name),
-    email = coalesce($4, email)
-WHERE username = $5 AND is_deleted = $6
-RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role_id, is_deleted, deleted_at;
+    email = coalesce($4, email),
+    role_id = coalesce($8, role_id),
+    version = version + 1
+WHERE username = $5 AND is_deleted = $6 AND version = coalesce($7, version)
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role_id, is_deleted, deleted_at, version;
 `
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (*User, error) {
@@ -127,6 +118,8 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (*User,
 		arg.Email,
 		arg.Username,
 		false,
+		arg.Version,
+		arg.RoleID,
 	)
 	var user User
 	var role Role
@@ -140,19 +133,21 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (*User,
 		&role.InternalID,
 		&user.IsDeleted,
 		&user.DeletedAt,
+		&user.Version,
 	)
 	if err != nil {
-		return nil, err
+		return nil, q.versionMismatch(ctx, err, arg.Version, userVersionQuery, arg.Username)
 	}
 	user.Role, err = q.GetRoleByUUID(ctx, role.InternalID)
 	return &user, err
 }
 
-const deleteUserQuery = `UPDATE users SET is_deleted = $1, deleted_at = $2 WHERE username = $3 AND is_deleted = $4
-     RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role_id, is_deleted, deleted_at;`
+const deleteUserQuery = `UPDATE users SET is_deleted = $1, deleted_at = $2, version = version + 1
+     WHERE username = $3 AND is_deleted = $4 AND version = coalesce($5, version)
+     RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role_id, is_deleted, deleted_at, version;`
 
-func (q *Queries) DeleteUser(ctx context.Context, username string, deletedAt time.Time) (*User, error) {
-	row := q.db.QueryRowContext(ctx, deleteUserQuery, true, deletedAt, username, false)
+func (q *Queries) DeleteUser(ctx context.Context, username string, deletedAt time.Time, version sql.NullInt64) (*User, error) {
+	row := q.db.QueryRowContext(ctx, deleteUserQuery, true, deletedAt, username, false, version)
 	var user User
 	var role Role
 	err := row.Scan(
@@ -165,58 +160,62 @@ func (q *Queries) DeleteUser(ctx context.Context, username string, deletedAt tim
 		&role.InternalID,
 		&user.IsDeleted,
 		&user.DeletedAt,
+		&user.Version,
 	)
 	if err != nil {
-		return nil, err
+		return nil, q.versionMismatch(ctx, err, version, userVersionQuery, username)
 	}
 	user.Role, err = q.GetRoleByUUID(ctx, role.InternalID)
 	return &user, err
 }
 
-func (q *Queries) getUsersByRole(ctx context.Context, query string, role string, isDeleted bool, arg ListUsersParams) ([]*User, error) {
-	rows, err := q.db.QueryContext(ctx, query, role, isDeleted, arg.Limit, arg.Offset)
+const restoreUserQuery = `UPDATE users SET is_deleted = $1, deleted_at = $2, version = version + 1 WHERE username = $3 AND is_deleted = $4
+     RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role_id, is_deleted, deleted_at, version;`
+
+// RestoreUser brings back a soft-deleted user.
+func (q *Queries) RestoreUser(ctx context.Context, username string) (*User, error) {
+	row := q.db.QueryRowContext(ctx, restoreUserQuery, false, time.Time{}, username, true)
+	var user User
+	var role Role
+	err := row.Scan(
+		&user.Username,
+		&user.HashedPassword,
+		&user.FullName,
+		&user.Email,
+		&user.PasswordChangedAt,
+		&user.CreatedAt,
+		&role.InternalID,
+		&user.IsDeleted,
+		&user.DeletedAt,
+		&user.Version,
+	)
 	if err != nil {
 		return nil, err
 	}
-	defer func(rows *sql.Rows) {
-		_ = rows.Close()
-	}(rows)
+	user.Role, err = q.GetRoleByUUID(ctx, role.InternalID)
+	return &user, err
+}
 
-	var items []*User
-	for rows.Next() {
-		var user User
-		var role Role
-		if err := rows.Scan(
-			&user.Username,
-			&user.HashedPassword,
-			&user.FullName,
-			&user.Email,
-			&user.PasswordChangedAt,
-			&user.CreatedAt,
-			&role.InternalID,
-			&user.IsDeleted,
-			&user.DeletedAt,
-		); err != nil {
-			return nil, err
-		}
-		user.Role, err = q.GetRoleByUUID(ctx, role.InternalID)
-		if err != nil {
-			return nil, err
-		}
-		items = append(items, &user)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+const userVersionQuery = `SELECT version FROM users WHERE username = $1 AND is_deleted = $2;`
+
+const purgeDeletedUsersQuery = `DELETE FROM users WHERE is_deleted = $1 AND deleted_at < $2;`
+
+// PurgeDeletedUsers permanently removes the users soft-deleted before deletedBefore. Their
+// sessions and property assignments go with them through the ON DELETE CASCADE foreign keys.
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsersQuery, true, deletedBefore)
+	if err != nil {
+		return 0, err
 	}
-	return items, nil
+	return result.RowsAffected()
 }
 
 const getUserByEmailQuery = `
 SELECT username, hashed_password, full_name, email, password_changed_at,
-       users.created_at, is_deleted, deleted_at,
-       p.internal_id, p.name, p.description, p.external_id, p.created_at, p.updated_at
+       users.created_at, users.is_deleted, users.deleted_at,
+       p.internal_id, p.name, p.description, p.external_id, p.created_at, p.updated_at, users.version
 FROM users FULL OUTER JOIN role p ON users.role_id = p.internal_id 
-WHERE email = $1 AND is_deleted = $2;
+WHERE email = $1 AND users.is_deleted = $2;
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (*User, error) {
@@ -238,6 +237,7 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (*User, erro
 		&role.ExternalID,
 		&role.CreatedAt,
 		&role.UpdatedAt,
+		&user.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -246,3 +246,113 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (*User, erro
 
 	return &user, err
 }
+
+const searchUsersQuery = `
+SELECT username, hashed_password, full_name, email, password_changed_at,
+       users.created_at, users.is_deleted, users.deleted_at,
+       r.internal_id, r.name, r.description, r.external_id, r.created_at, r.updated_at, users.version
+FROM users INNER JOIN role r ON users.role_id = r.internal_id
+`
+
+const countUsersQuery = `
+SELECT count(*) FROM users INNER JOIN role r ON users.role_id = r.internal_id
+`
+
+// userSortColumns lists the columns a user search can be sorted by.
+var userSortColumns = map[string]string{
+	"username":   "users.username",
+	"email":      "users.email",
+	"full_name":  "users.full_name",
+	"created_at": "users.created_at",
+}
+
+type SearchUsersParams struct {
+	LimitOffset
+	Roles         []string
+	Query         sql.NullString
+	CreatedAfter  sql.NullTime
+	CreatedBefore sql.NullTime
+	IsDeleted     bool
+	PropertyID    sql.NullString
+	SortBy        string
+	SortDesc      bool
+}
+
+type SearchUsersResult struct {
+	Users []*User `json:"users"`
+	Total int64   `json:"total"`
+}
+
+func searchUsersQueryBuilder(arg SearchUsersParams) *queryBuilder {
+	builder := newQueryBuilder(searchUsersQuery).Where("users.is_deleted = ?", arg.IsDeleted)
+	if len(arg.Roles) > 0 {
+		builder.Where("r.name = ANY(?)", pq.Array(arg.Roles))
+	}
+	if arg.Query.Valid {
+		pattern := likePattern(arg.Query.String)
+		builder.Where("(users.username ILIKE ? OR users.email ILIKE ? OR users.full_name ILIKE ?)", pattern, pattern, pattern)
+	}
+	if arg.CreatedAfter.Valid {
+		builder.Where("users.created_at >= ?", arg.CreatedAfter.Time)
+	}
+	if arg.CreatedBefore.Valid {
+		builder.Where("users.created_at < ?", arg.CreatedBefore.Time)
+	}
+	if arg.PropertyID.Valid {
+		builder.Where(`EXISTS (SELECT 1 FROM property_user pu INNER JOIN property p ON pu.property_internal_id = p.internal_id
+WHERE pu.username = users.username AND p.external_id = ?)`, arg.PropertyID.String)
+	}
+	return builder.OrderBy(userSortColumns, arg.SortBy, "created_at", arg.SortDesc, "users.username")
+}
+
+// SearchUsers returns a page of the users matching arg along with the number of
+// matching users across every page.
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) (*SearchUsersResult, error) {
+	builder := searchUsersQueryBuilder(arg)
+
+	countQuery, countArgs := builder.BuildCount(countUsersQuery)
+	var result SearchUsersResult
+	if err := q.db.QueryRowContext(ctx, countQuery, countArgs...).Scan(&result.Total); err != nil {
+		return nil, err
+	}
+
+	query, args := builder.Page(arg.Limit, arg.Offset).Build()
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	result.Users = []*User{}
+	for rows.Next() {
+		var user User
+		var role Role
+		if err := rows.Scan(
+			&user.Username,
+			&user.HashedPassword,
+			&user.FullName,
+			&user.Email,
+			&user.PasswordChangedAt,
+			&user.CreatedAt,
+			&user.IsDeleted,
+			&user.DeletedAt,
+			&role.InternalID,
+			&role.Name,
+			&role.Description,
+			&role.ExternalID,
+			&role.CreatedAt,
+			&role.UpdatedAt,
+			&user.Version,
+		); err != nil {
+			return nil, err
+		}
+		user.Role = &role
+		result.Users = append(result.Users, &user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
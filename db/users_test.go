@@ -195,7 +195,7 @@ func TestUpdateUser(t *testing.T) {
 				// the CreateUser sql mock
 				mocker.
 					ExpectQuery(regexp.QuoteMeta(updateUserQuery)).
-					WithArgs(arg.HashedPassword, arg.PasswordChangedAt, arg.FullName, arg.Email, arg.Username, isDeleted).
+					WithArgs(arg.HashedPassword, arg.PasswordChangedAt, arg.FullName, arg.Email, arg.Username, isDeleted, arg.Version, arg.RoleID).
 					WillReturnRows(userQueryRows)
 
 				// the GetRoleByUUID sql mock
@@ -225,7 +225,7 @@ func TestUpdateUser(t *testing.T) {
 				// the CreateUser sql mock
 				mocker.
 					ExpectQuery(regexp.QuoteMeta(updateUserQuery)).
-					WithArgs(arg.HashedPassword, arg.PasswordChangedAt, arg.FullName, arg.Email, arg.Username, isDeleted).
+					WithArgs(arg.HashedPassword, arg.PasswordChangedAt, arg.FullName, arg.Email, arg.Username, isDeleted, arg.Version, arg.RoleID).
 					WillReturnRows(userQueryRows)
 
 				// the GetRoleByUUID sql mock
@@ -240,6 +240,35 @@ func TestUpdateUser(t *testing.T) {
 				require.Equal(t, actualUser.Role, expectedUser.Role)
 			},
 		},
+		{
+			name:          "OK Role",
+			userQueryRows: getMockedExpectedUpdateUserRows(expectedUser),
+			roleQueryRows: getMockedExpectedRoleRows(expectedUser.Role),
+			arg: UpdateUserParams{
+				Username: expectedUser.Username,
+				RoleID: uuid.NullUUID{
+					UUID:  expectedUser.Role.InternalID,
+					Valid: true,
+				},
+			},
+			mock: func(userQueryRows *sqlmock.Rows, roleQueryRows *sqlmock.Rows, arg UpdateUserParams, roleId uuid.UUID, isDeleted bool) {
+				// the UpdateUser sql mock
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(updateUserQuery)).
+					WithArgs(arg.HashedPassword, arg.PasswordChangedAt, arg.FullName, arg.Email, arg.Username, isDeleted, arg.Version, arg.RoleID).
+					WillReturnRows(userQueryRows)
+
+				// the GetRoleByUUID sql mock
+				mocker.ExpectQuery(regexp.QuoteMeta(getRoleByUUIDQuery)).
+					WithArgs(roleId).
+					WillReturnRows(roleQueryRows)
+			},
+			response: func(querier Querier, arg UpdateUserParams) {
+				actualUser, err := querier.UpdateUser(context.Background(), arg)
+				require.NoError(t, err)
+				require.Equal(t, expectedUser.Role, actualUser.Role)
+			},
+		},
 		{
 			name:          "Error",
 			userQueryRows: getMockedWrongExpectedUserRows(expectedUser),
@@ -255,7 +284,7 @@ func TestUpdateUser(t *testing.T) {
 				// the CreateUser sql mock
 				mocker.
 					ExpectQuery(regexp.QuoteMeta(updateUserQuery)).
-					WithArgs(arg.HashedPassword, arg.PasswordChangedAt, arg.FullName, arg.Email, arg.Username, isDeleted).
+					WithArgs(arg.HashedPassword, arg.PasswordChangedAt, arg.FullName, arg.Email, arg.Username, isDeleted, arg.Version, arg.RoleID).
 					WillReturnRows(userQueryRows)
 			},
 			response: func(querier Querier, arg UpdateUserParams) {
@@ -299,7 +328,7 @@ func TestDeleteUser(t *testing.T) {
 				// the CreateUser sql mock
 				mocker.
 					ExpectQuery(regexp.QuoteMeta(deleteUserQuery)).
-					WithArgs(true, t, username, false).
+					WithArgs(true, t, username, false, nil).
 					WillReturnRows(userQueryRows)
 
 				// the GetRoleByUUID sql mock
@@ -308,7 +337,7 @@ func TestDeleteUser(t *testing.T) {
 					WillReturnRows(roleQueryRows)
 			},
 			response: func(querier Querier, deletedAt time.Time) {
-				actualUser, err := querier.DeleteUser(context.Background(), expectedUser.Username, deletedAt)
+				actualUser, err := querier.DeleteUser(context.Background(), expectedUser.Username, deletedAt, sql.NullInt64{})
 				require.NoError(t, err)
 				require.Equal(t, actualUser, expectedUser)
 			},
@@ -321,11 +350,11 @@ func TestDeleteUser(t *testing.T) {
 				// the CreateUser sql mock
 				mocker.
 					ExpectQuery(regexp.QuoteMeta(deleteUserQuery)).
-					WithArgs(true, t, username, false).
+					WithArgs(true, t, username, false, nil).
 					WillReturnRows(userQueryRows)
 			},
 			response: func(querier Querier, deletedAt time.Time) {
-				actualUser, err := querier.DeleteUser(context.Background(), expectedUser.Username, deletedAt)
+				actualUser, err := querier.DeleteUser(context.Background(), expectedUser.Username, deletedAt, sql.NullInt64{})
 				require.Error(t, err)
 				require.Nil(t, actualUser)
 			},
@@ -343,139 +372,107 @@ func TestDeleteUser(t *testing.T) {
 	}
 }
 
-func TestGetAllCustomer(t *testing.T) {
+func TestRestoreUser(t *testing.T) {
 	db, mocker, err := sqlmock.New()
 	require.NoError(t, err)
 	defer func(db *sql.DB) {
 		_ = db.Close()
 	}(db)
-	amountUserToCreate := uint(6)
-	expectedUsers := createMultipleRandomUserWithRole(amountUserToCreate, RoleCustomer, false)
+
+	expectedUser := createRandomUserWithRole(RoleCustomer, false)
 	testCases := []struct {
 		name          string
-		arg           ListUsersParams
 		userQueryRows *sqlmock.Rows
-		mock          func(mocker sqlmock.Sqlmock, userQueryRows *sqlmock.Rows, isDeleted bool, arg ListUsersParams)
-		response      func(querier Querier, arg ListUsersParams)
+		roleQueryRows *sqlmock.Rows
+		mock          func(userQueryRows *sqlmock.Rows, roleQueryRows *sqlmock.Rows, username string, roleId uuid.UUID)
+		response      func(querier Querier)
 	}{
 		{
-			name: "OK FullName",
-			arg: ListUsersParams{
-				Limit:  int32(amountUserToCreate),
-				Offset: 1,
-			},
-			userQueryRows: getMultipleMockedExpectedUserRows(expectedUsers),
-			mock: func(mocker sqlmock.Sqlmock, userQueryRows *sqlmock.Rows, isDeleted bool, arg ListUsersParams) {
-				// mocking CreateUser
+			name:          "OK",
+			userQueryRows: getMockedExpectedCreateUserRows(expectedUser),
+			roleQueryRows: getMockedExpectedRoleRows(expectedUser.Role),
+			mock: func(userQueryRows *sqlmock.Rows, roleQueryRows *sqlmock.Rows, username string, roleId uuid.UUID) {
 				mocker.
-					ExpectQuery(regexp.QuoteMeta(getAllUserQuery)).
-					WithArgs(RoleCustomer, isDeleted, arg.Limit, arg.Offset).
+					ExpectQuery(regexp.QuoteMeta(restoreUserQuery)).
+					WithArgs(false, time.Time{}, username, true).
 					WillReturnRows(userQueryRows)
 
-				// mocking GetRoleByUUID
-				for _, user := range expectedUsers {
-					mocker.ExpectQuery(regexp.QuoteMeta(getRoleByUUIDQuery)).
-						WithArgs(user.Role.InternalID).
-						WillReturnRows(getMockedExpectedRoleRows(user.Role))
-				}
+				mocker.ExpectQuery(regexp.QuoteMeta(getRoleByUUIDQuery)).
+					WithArgs(roleId).
+					WillReturnRows(roleQueryRows)
 			},
-			response: func(querier Querier, arg ListUsersParams) {
-				actualUsers, err := querier.GetAllCustomer(context.Background(), arg)
+			response: func(querier Querier) {
+				actualUser, err := querier.RestoreUser(context.Background(), expectedUser.Username)
 				require.NoError(t, err)
-				require.Equal(t, actualUsers, expectedUsers)
+				require.Equal(t, actualUser, expectedUser)
 			},
 		},
 		{
-			name: "No Rows",
-			arg: ListUsersParams{
-				Limit:  int32(amountUserToCreate),
-				Offset: 1,
-			},
-			userQueryRows: getMultipleMockedExpectedUserRows(expectedUsers),
-			mock: func(mocker sqlmock.Sqlmock, userQueryRows *sqlmock.Rows, isDeleted bool, arg ListUsersParams) {
-				// mocking CreateUser
+			name: "NotDeleted",
+			mock: func(userQueryRows *sqlmock.Rows, roleQueryRows *sqlmock.Rows, username string, roleId uuid.UUID) {
 				mocker.
-					ExpectQuery(regexp.QuoteMeta(getAllUserQuery)).
-					WithArgs(RoleCustomer, isDeleted, arg.Limit).
-					WillReturnRows(userQueryRows)
+					ExpectQuery(regexp.QuoteMeta(restoreUserQuery)).
+					WithArgs(false, time.Time{}, username, true).
+					WillReturnError(sql.ErrNoRows)
 			},
-			response: func(querier Querier, arg ListUsersParams) {
-				actualUsers, err := querier.GetAllCustomer(context.Background(), arg)
-				require.Error(t, err)
-				require.Nil(t, actualUsers)
+			response: func(querier Querier) {
+				actualUser, err := querier.RestoreUser(context.Background(), expectedUser.Username)
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Nil(t, actualUser)
 			},
 		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockQuery := &Queries{db: db}
+
+			tc.mock(tc.userQueryRows, tc.roleQueryRows, expectedUser.Username, expectedUser.Role.InternalID)
+			tc.response(mockQuery)
+			require.NoError(t, mocker.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	deletedBefore := time.Now().Add(-time.Hour * 720)
+	testCases := []struct {
+		name     string
+		mock     func()
+		response func(querier Querier)
+	}{
 		{
-			name: "Error With Scan Rows",
-			arg: ListUsersParams{
-				Limit:  int32(amountUserToCreate),
-				Offset: 1,
-			},
-			userQueryRows: getMultipleWrongMockedExpectedUserRows(expectedUsers),
-			mock: func(mocker sqlmock.Sqlmock, userQueryRows *sqlmock.Rows, isDeleted bool, arg ListUsersParams) {
-				// mocking CreateUser
+			name: "OK",
+			mock: func() {
 				mocker.
-					ExpectQuery(regexp.QuoteMeta(getAllUserQuery)).
-					WithArgs(RoleCustomer, isDeleted, arg.Limit, arg.Offset).
-					WillReturnRows(userQueryRows)
+					ExpectExec(regexp.QuoteMeta(purgeDeletedUsersQuery)).
+					WithArgs(true, deletedBefore).
+					WillReturnResult(sqlmock.NewResult(0, 3))
 			},
-			response: func(querier Querier, arg ListUsersParams) {
-				actualUsers, err := querier.GetAllCustomer(context.Background(), arg)
-				require.Error(t, err)
-				require.Nil(t, actualUsers)
+			response: func(querier Querier) {
+				purged, err := querier.PurgeDeletedUsers(context.Background(), deletedBefore)
+				require.NoError(t, err)
+				require.Equal(t, int64(3), purged)
 			},
 		},
 		{
-			name: "Wrong Role ID",
-			arg: ListUsersParams{
-				Limit:  int32(amountUserToCreate),
-				Offset: 1,
-			},
-			userQueryRows: getMultipleMockedExpectedUserRows(expectedUsers),
-			mock: func(mocker sqlmock.Sqlmock, userQueryRows *sqlmock.Rows, isDeleted bool, arg ListUsersParams) {
-				// mocking CreateUser
+			name: "Error",
+			mock: func() {
 				mocker.
-					ExpectQuery(regexp.QuoteMeta(getAllUserQuery)).
-					WithArgs(RoleCustomer, isDeleted, arg.Limit, arg.Offset).
-					WillReturnRows(userQueryRows)
-
-				user := createRandomUserWithRole(RoleCustomer, false)
-				// mocking GetRoleByUUID
-				mocker.ExpectQuery(regexp.QuoteMeta(getRoleByUUIDQuery)).
-					WithArgs(user.Role.InternalID).
-					WillReturnRows(getMockedExpectedRoleRows(user.Role))
+					ExpectExec(regexp.QuoteMeta(purgeDeletedUsersQuery)).
+					WithArgs(true, deletedBefore).
+					WillReturnError(sql.ErrConnDone)
 			},
-			response: func(querier Querier, arg ListUsersParams) {
-				actualUsers, err := querier.GetAllCustomer(context.Background(), arg)
+			response: func(querier Querier) {
+				purged, err := querier.PurgeDeletedUsers(context.Background(), deletedBefore)
 				require.Error(t, err)
-				require.Nil(t, actualUsers)
-			},
-		},
-		{
-			name: "Rows Error",
-			arg: ListUsersParams{
-				Limit:  int32(amountUserToCreate),
-				Offset: 1,
-			},
-			userQueryRows: getMultipleMockedExpectedUserRows(expectedUsers),
-			mock: func(mocker sqlmock.Sqlmock, userQueryRows *sqlmock.Rows, isDeleted bool, arg ListUsersParams) {
-				// mocking CreateUser
-				mocker.
-					ExpectQuery(regexp.QuoteMeta(getAllUserQuery)).
-					WithArgs(RoleCustomer, isDeleted, arg.Limit, arg.Offset).
-					WillReturnRows(userQueryRows.CloseError(fmt.Errorf("close error")))
-
-				// mocking GetRoleByUUID
-				for _, user := range expectedUsers {
-					mocker.ExpectQuery(regexp.QuoteMeta(getRoleByUUIDQuery)).
-						WithArgs(user.Role.InternalID).
-						WillReturnRows(getMockedExpectedRoleRows(user.Role))
-				}
-			},
-			response: func(querier Querier, arg ListUsersParams) {
-				actualUsers, err := querier.GetAllCustomer(context.Background(), arg)
-				require.Error(t, err)
-				require.Nil(t, actualUsers)
+				require.Zero(t, purged)
 			},
 		},
 	}
@@ -484,13 +481,14 @@ func TestGetAllCustomer(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			mockQuery := &Queries{db: db}
 
-			tc.mock(mocker, tc.userQueryRows, false, tc.arg)
-			tc.response(mockQuery, tc.arg)
+			tc.mock()
+			tc.response(mockQuery)
+			require.NoError(t, mocker.ExpectationsWereMet())
 		})
 	}
 }
 
-func TestGetAllAdmin(t *testing.T) {
+func TestSearchUsers(t *testing.T) {
 	db, mocker, err := sqlmock.New()
 	require.NoError(t, err)
 	defer func(db *sql.DB) {
@@ -498,39 +496,130 @@ func TestGetAllAdmin(t *testing.T) {
 	}(db)
 
 	amountUserToCreate := uint(6)
-	expectedUsers := createMultipleRandomUserWithRole(amountUserToCreate, RoleAdmin, false)
+	expectedUsers := createMultipleRandomUserWithRole(amountUserToCreate, RoleCustomer, false)
+	const fromClause = "FROM users INNER JOIN role r ON users.role_id = r.internal_id"
 	testCases := []struct {
 		name          string
-		arg           ListUsersParams
+		arg           SearchUsersParams
 		userQueryRows *sqlmock.Rows
-		mock          func(userQueryRows *sqlmock.Rows, isDeleted bool, arg ListUsersParams)
-		response      func(querier Querier, arg ListUsersParams)
+		mock          func(userQueryRows *sqlmock.Rows, arg SearchUsersParams)
+		response      func(querier Querier, arg SearchUsersParams)
 	}{
 		{
-			name: "OK FullName",
-			arg: ListUsersParams{
-				Limit:  int32(amountUserToCreate),
-				Offset: 1,
+			name: "OK",
+			arg: SearchUsersParams{
+				LimitOffset: LimitOffset{Limit: int32(amountUserToCreate), Offset: 1},
+				Roles:       []string{RoleCustomer},
 			},
 			userQueryRows: getMultipleMockedExpectedUserRows(expectedUsers),
-			mock: func(userQueryRows *sqlmock.Rows, isDeleted bool, arg ListUsersParams) {
-				// mocking CreateUser
+			mock: func(userQueryRows *sqlmock.Rows, arg SearchUsersParams) {
+				mocker.
+					ExpectQuery(regexp.QuoteMeta("SELECT count(*) "+fromClause+" WHERE users.is_deleted = $1 AND r.name = ANY($2);")).
+					WithArgs(false, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(20)))
+
 				mocker.
-					ExpectQuery(regexp.QuoteMeta(getAllUserQuery)).
-					WithArgs(RoleAdmin, isDeleted, arg.Limit, arg.Offset).
+					ExpectQuery(regexp.QuoteMeta(fromClause+" WHERE users.is_deleted = $1 AND r.name = ANY($2) "+
+						"ORDER BY users.created_at ASC, users.username ASC LIMIT $3 OFFSET $4;")).
+					WithArgs(false, sqlmock.AnyArg(), arg.Limit, arg.Offset).
 					WillReturnRows(userQueryRows)
+			},
+			response: func(querier Querier, arg SearchUsersParams) {
+				result, err := querier.SearchUsers(context.Background(), arg)
+				require.NoError(t, err)
+				require.Equal(t, int64(20), result.Total)
+				require.Equal(t, expectedUsers, result.Users)
+			},
+		},
+		{
+			name: "FilterAndSort",
+			arg: SearchUsersParams{
+				LimitOffset: LimitOffset{Limit: int32(amountUserToCreate), Offset: 0},
+				Query:       sql.NullString{String: "50%_off", Valid: true},
+				IsDeleted:   true,
+				PropertyID:  sql.NullString{String: "PRO101", Valid: true},
+				SortBy:      "email",
+				SortDesc:    true,
+			},
+			userQueryRows: getMultipleMockedExpectedUserRows(expectedUsers),
+			mock: func(userQueryRows *sqlmock.Rows, arg SearchUsersParams) {
+				pattern := `%50\%\_off%`
+				mocker.
+					ExpectQuery(regexp.QuoteMeta("SELECT count(*) "+fromClause+" WHERE users.is_deleted = $1 "+
+						"AND (users.username ILIKE $2 OR users.email ILIKE $3 OR users.full_name ILIKE $4) AND EXISTS")).
+					WithArgs(true, pattern, pattern, pattern, "PRO101").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(6)))
 
-				// mocking GetRoleByUUID
-				for _, user := range expectedUsers {
-					mocker.ExpectQuery(regexp.QuoteMeta(getRoleByUUIDQuery)).
-						WithArgs(user.Role.InternalID).
-						WillReturnRows(getMockedExpectedRoleRows(user.Role))
-				}
+				mocker.
+					ExpectQuery(regexp.QuoteMeta("ORDER BY users.email DESC, users.username DESC LIMIT $6 OFFSET $7;")).
+					WithArgs(true, pattern, pattern, pattern, "PRO101", arg.Limit, arg.Offset).
+					WillReturnRows(userQueryRows)
 			},
-			response: func(querier Querier, arg ListUsersParams) {
-				actualUsers, err := querier.GetAllAdmin(context.Background(), arg)
+			response: func(querier Querier, arg SearchUsersParams) {
+				result, err := querier.SearchUsers(context.Background(), arg)
 				require.NoError(t, err)
-				require.Equal(t, actualUsers, expectedUsers)
+				require.Equal(t, int64(6), result.Total)
+				require.Len(t, result.Users, len(expectedUsers))
+			},
+		},
+		{
+			name: "CountError",
+			arg: SearchUsersParams{
+				LimitOffset: LimitOffset{Limit: int32(amountUserToCreate), Offset: 1},
+			},
+			mock: func(userQueryRows *sqlmock.Rows, arg SearchUsersParams) {
+				mocker.
+					ExpectQuery(regexp.QuoteMeta("SELECT count(*)")).
+					WillReturnError(sql.ErrConnDone)
+			},
+			response: func(querier Querier, arg SearchUsersParams) {
+				result, err := querier.SearchUsers(context.Background(), arg)
+				require.Error(t, err)
+				require.Nil(t, result)
+			},
+		},
+		{
+			name: "Error With Scan Rows",
+			arg: SearchUsersParams{
+				LimitOffset: LimitOffset{Limit: int32(amountUserToCreate), Offset: 1},
+			},
+			userQueryRows: getMultipleWrongMockedExpectedUserRows(expectedUsers),
+			mock: func(userQueryRows *sqlmock.Rows, arg SearchUsersParams) {
+				mocker.
+					ExpectQuery(regexp.QuoteMeta("SELECT count(*)")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(6)))
+
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(fromClause)).
+					WithArgs(false, arg.Limit, arg.Offset).
+					WillReturnRows(userQueryRows)
+			},
+			response: func(querier Querier, arg SearchUsersParams) {
+				result, err := querier.SearchUsers(context.Background(), arg)
+				require.Error(t, err)
+				require.Nil(t, result)
+			},
+		},
+		{
+			name: "Rows Error",
+			arg: SearchUsersParams{
+				LimitOffset: LimitOffset{Limit: int32(amountUserToCreate), Offset: 1},
+			},
+			userQueryRows: getMultipleMockedExpectedUserRows(expectedUsers),
+			mock: func(userQueryRows *sqlmock.Rows, arg SearchUsersParams) {
+				mocker.
+					ExpectQuery(regexp.QuoteMeta("SELECT count(*)")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(6)))
+
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(fromClause)).
+					WithArgs(false, arg.Limit, arg.Offset).
+					WillReturnRows(userQueryRows.RowError(2, fmt.Errorf("row error")))
+			},
+			response: func(querier Querier, arg SearchUsersParams) {
+				result, err := querier.SearchUsers(context.Background(), arg)
+				require.Error(t, err)
+				require.Nil(t, result)
 			},
 		},
 	}
@@ -539,8 +628,9 @@ func TestGetAllAdmin(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			mockQuery := &Queries{db: db}
 
-			tc.mock(tc.userQueryRows, false, tc.arg)
+			tc.mock(tc.userQueryRows, tc.arg)
 			tc.response(mockQuery, tc.arg)
+			require.NoError(t, mocker.ExpectationsWereMet())
 		})
 	}
 }
@@ -614,3 +704,156 @@ func TestGetUserByEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestSQLStore_UpdateUserAndBlockSessions(t *testing.T) {
+	user := createRandomUserWithRole(RoleCustomer, false)
+	session := createSession(createSessionParams())
+	session.Username = user.Username
+	blockedAt := time.Now()
+	arg := UpdateUserParams{
+		Username:          user.Username,
+		HashedPassword:    sql.NullString{String: user.HashedPassword, Valid: true},
+		PasswordChangedAt: sql.NullTime{Time: blockedAt, Valid: true},
+	}
+	userEvent := &Event{ID: 1, Type: EventUserUpdated, AggregateType: AggregateUser, AggregateID: user.Username, Payload: []byte(`{}`)}
+	sessionEvent := &Event{ID: 2, Type: EventSessionBlocked, AggregateType: AggregateSession, AggregateID: session.ID.String(), Payload: []byte(`{}`)}
+
+	// expectUpdate expects the user to be updated, along with its event, in a transaction.
+	expectUpdate := func(mocker sqlmock.Sqlmock) {
+		mocker.ExpectBegin()
+		mocker.
+			ExpectQuery(regexp.QuoteMeta(updateUserQuery)).
+			WithArgs(arg.HashedPassword, arg.PasswordChangedAt, arg.FullName, arg.Email, arg.Username, false, arg.Version, arg.RoleID).
+			WillReturnRows(getMockedExpectedUpdateUserRows(user))
+		mocker.
+			ExpectQuery(regexp.QuoteMeta(getRoleByUUIDQuery)).
+			WithArgs(user.Role.InternalID).
+			WillReturnRows(getMockedExpectedRoleRows(user.Role))
+		mocker.
+			ExpectQuery(regexp.QuoteMeta(createEventQuery)).
+			WithArgs(EventUserUpdated, AggregateUser, user.Username, sqlmock.AnyArg()).
+			WillReturnRows(getMockedExpectedEventRows(userEvent))
+	}
+
+	testCases := []struct {
+		name     string
+		mock     func(mocker sqlmock.Sqlmock)
+		response func(update *UserSessionsUpdate, err error)
+	}{
+		{
+			name: "OK",
+			mock: func(mocker sqlmock.Sqlmock) {
+				expectUpdate(mocker)
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(blockUserSessionsQuery)).
+					WithArgs(true, blockedAt, user.Username, false).
+					WillReturnRows(getMockedExpectedCreateSession(session))
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(createEventQuery)).
+					WithArgs(EventSessionBlocked, AggregateSession, session.ID.String(), sqlmock.AnyArg()).
+					WillReturnRows(getMockedExpectedEventRows(sessionEvent))
+				mocker.ExpectCommit()
+			},
+			response: func(update *UserSessionsUpdate, err error) {
+				require.NoError(t, err)
+				require.Equal(t, user.Username, update.User.Username)
+				require.Len(t, update.BlockedSessions, 1)
+				require.Equal(t, session.ID, update.BlockedSessions[0].ID)
+			},
+		},
+		{
+			// the new password is not committed without the sessions obtained with the old one
+			// being blocked
+			name: "BlockFails",
+			mock: func(mocker sqlmock.Sqlmock) {
+				expectUpdate(mocker)
+				mocker.
+					ExpectQuery(regexp.QuoteMeta(blockUserSessionsQuery)).
+					WithArgs(true, blockedAt, user.Username, false).
+					WillReturnError(sql.ErrConnDone)
+				mocker.ExpectRollback()
+			},
+			response: func(update *UserSessionsUpdate, err error) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+				require.Nil(t, update)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mocker, err := sqlmock.New()
+			require.NoError(t, err)
+			defer func(db *sql.DB) {
+				_ = db.Close()
+			}(db)
+
+			tc.mock(mocker)
+			tc.response(NewStore(db).UpdateUserAndBlockSessions(context.Background(), arg, blockedAt))
+			require.NoError(t, mocker.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSQLStore_SearchUsers(t *testing.T) {
+	expectedUsers := createMultipleRandomUserWithRole(3, RoleCustomer, false)
+	arg := SearchUsersParams{LimitOffset: LimitOffset{Limit: 3, Offset: 0}}
+
+	testCases := []struct {
+		name     string
+		mock     func(mocker sqlmock.Sqlmock)
+		response func(result *SearchUsersResult, err error)
+	}{
+		{
+			// the total and the page are read in one transaction
+			name: "OK",
+			mock: func(mocker sqlmock.Sqlmock) {
+				mocker.ExpectBegin()
+				mocker.
+					ExpectQuery(regexp.QuoteMeta("SELECT count(*)")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(3)))
+				mocker.
+					ExpectQuery(regexp.QuoteMeta("LIMIT $2 OFFSET $3;")).
+					WithArgs(false, arg.Limit, arg.Offset).
+					WillReturnRows(getMultipleMockedExpectedUserRows(expectedUsers))
+				mocker.ExpectCommit()
+			},
+			response: func(result *SearchUsersResult, err error) {
+				require.NoError(t, err)
+				require.Equal(t, int64(3), result.Total)
+				require.Equal(t, expectedUsers, result.Users)
+			},
+		},
+		{
+			name: "PageError",
+			mock: func(mocker sqlmock.Sqlmock) {
+				mocker.ExpectBegin()
+				mocker.
+					ExpectQuery(regexp.QuoteMeta("SELECT count(*)")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(3)))
+				mocker.
+					ExpectQuery(regexp.QuoteMeta("LIMIT $2 OFFSET $3;")).
+					WillReturnError(sql.ErrConnDone)
+				mocker.ExpectRollback()
+			},
+			response: func(result *SearchUsersResult, err error) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+				require.Nil(t, result)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mocker, err := sqlmock.New()
+			require.NoError(t, err)
+			defer func(db *sql.DB) {
+				_ = db.Close()
+			}(db)
+
+			tc.mock(mocker)
+			tc.response(NewStore(db).SearchUsers(context.Background(), arg))
+			require.NoError(t, mocker.ExpectationsWereMet())
+		})
+	}
+}
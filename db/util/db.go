@@ -1,20 +0,0 @@
-package util
-
-import (
-	"errors"
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/rs/zerolog/log"
-)
-
-func RunDBMigration(migrationURL string, dbSource string) {
-	migration, err := migrate.New(migrationURL, dbSource)
-	if err != nil {
-		log.Fatal().Msg("cannot create new migrate instances")
-	}
-
-	if err := migration.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		log.Fatal().Msg("failed to run migration up")
-	}
-
-	log.Info().Msg("db migration successfully")
-}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrVersionMismatch is returned when a row was modified since the version the caller based
+// its change on.
+var ErrVersionMismatch = errors.New("the row was modified by another request")
+
+// versionMismatch tells apart the two reasons a conditional write can match no row: the row
+// does not exist, or its version moved on. versionQuery selects the current version of the
+// live row identified by key.
+func (q *Queries) versionMismatch(ctx context.Context, err error, expected sql.NullInt64, versionQuery string, key string) error {
+	if !expected.Valid || !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	var current int64
+	if scanErr := q.db.QueryRowContext(ctx, versionQuery, key, false).Scan(&current); scanErr != nil {
+		return scanErr
+	}
+	if current != expected.Int64 {
+		return ErrVersionMismatch
+	}
+	return err
+}
@@ -0,0 +1,309 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookAllEvents subscribes a webhook to every event type.
+const WebhookAllEvents = "*"
+
+const webhookSubscriptionColumns = `id, url, event_types, secret, is_active, created_at, updated_at`
+
+const createWebhookSubscriptionQuery = `
+INSERT INTO webhook_subscriptions (url, event_types, secret)
+VALUES ($1, $2, $3)
+RETURNING ` + webhookSubscriptionColumns + `;`
+
+type CreateWebhookSubscriptionParams struct {
+	URL        string
+	EventTypes []string
+	Secret     string
+}
+
+func (q *Queries) CreateWebhookSubscription(ctx context.Context, arg CreateWebhookSubscriptionParams) (*WebhookSubscription, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookSubscriptionQuery, arg.URL, pq.Array(arg.EventTypes), arg.Secret)
+	return scanWebhookSubscription(row)
+}
+
+const getWebhookSubscriptionQuery = `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1;`
+
+func (q *Queries) GetWebhookSubscription(ctx context.Context, id int64) (*WebhookSubscription, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookSubscriptionQuery, id)
+	return scanWebhookSubscription(row)
+}
+
+const listWebhookSubscriptionsQuery = `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions ORDER BY id LIMIT $1 OFFSET $2;`
+
+func (q *Queries) ListWebhookSubscriptions(ctx context.Context, arg LimitOffset) ([]*WebhookSubscription, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookSubscriptionsQuery, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookSubscriptions(rows)
+}
+
+const listWebhookSubscriptionsForEventQuery = `
+SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions
+WHERE is_active = $1 AND ($2 = ANY(event_types) OR $3 = ANY(event_types))
+ORDER BY id;
+`
+
+// ListWebhookSubscriptionsForEvent returns the active subscriptions to eventType.
+func (q *Queries) ListWebhookSubscriptionsForEvent(ctx context.Context, eventType string) ([]*WebhookSubscription, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookSubscriptionsForEventQuery, true, eventType, WebhookAllEvents)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookSubscriptions(rows)
+}
+
+const updateWebhookSubscriptionQuery = `
+UPDATE webhook_subscriptions
+SET url = coalesce($1, url),
+    event_types = coalesce($2, event_types),
+    is_active = coalesce($3, is_active),
+    updated_at = $4
+WHERE id = $5
+RETURNING ` + webhookSubscriptionColumns + `;`
+
+type UpdateWebhookSubscriptionParams struct {
+	ID         int64
+	URL        sql.NullString
+	EventTypes []string
+	IsActive   sql.NullBool
+	UpdatedAt  time.Time
+}
+
+// UpdateWebhookSubscription changes the fields that are set in arg. A nil EventTypes keeps
+// the current event types.
+func (q *Queries) UpdateWebhookSubscription(ctx context.Context, arg UpdateWebhookSubscriptionParams) (*WebhookSubscription, error) {
+	var eventTypes any
+	if arg.EventTypes != nil {
+		eventTypes = pq.Array(arg.EventTypes)
+	}
+	row := q.db.QueryRowContext(ctx, updateWebhookSubscriptionQuery, arg.URL, eventTypes, arg.IsActive, arg.UpdatedAt, arg.ID)
+	return scanWebhookSubscription(row)
+}
+
+const deleteWebhookSubscriptionQuery = `DELETE FROM webhook_subscriptions WHERE id = $1 RETURNING ` + webhookSubscriptionColumns + `;`
+
+// DeleteWebhookSubscription removes a subscription along with its delivery log.
+func (q *Queries) DeleteWebhookSubscription(ctx context.Context, id int64) (*WebhookSubscription, error) {
+	row := q.db.QueryRowContext(ctx, deleteWebhookSubscriptionQuery, id)
+	return scanWebhookSubscription(row)
+}
+
+func scanWebhookSubscriptions(rows *sql.Rows) ([]*WebhookSubscription, error) {
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	subscriptions := []*WebhookSubscription{}
+	for rows.Next() {
+		subscription, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+func scanWebhookSubscription(row rowScanner) (*WebhookSubscription, error) {
+	var subscription WebhookSubscription
+	err := row.Scan(
+		&subscription.ID,
+		&subscription.URL,
+		pq.Array(&subscription.EventTypes),
+		&subscription.Secret,
+		&subscription.IsActive,
+		&subscription.CreatedAt,
+		&subscription.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+const webhookDeliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, response_status,
+       last_error, next_attempt_at, created_at, delivered_at`
+
+const createWebhookDeliveryQuery = `
+INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, next_attempt_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (subscription_id, event_id) DO NOTHING;
+`
+
+type CreateWebhookDeliveryParams struct {
+	SubscriptionID int64
+	EventID        int64
+	EventType      string
+	Payload        json.RawMessage
+	NextAttemptAt  time.Time
+}
+
+// CreateWebhookDelivery schedules the delivery of an event to a subscription. Scheduling the
+// same event twice for a subscription is a no-op.
+func (q *Queries) CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) error {
+	_, err := q.db.ExecContext(ctx, createWebhookDeliveryQuery,
+		arg.SubscriptionID,
+		arg.EventID,
+		arg.EventType,
+		string(arg.Payload),
+		arg.NextAttemptAt,
+	)
+	return err
+}
+
+const claimWebhookDeliveriesQuery = `
+UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = $1
+WHERE id IN (SELECT id FROM webhook_deliveries
+             WHERE status = $2 AND next_attempt_at <= $3
+             ORDER BY next_attempt_at, id
+             LIMIT $4 FOR UPDATE SKIP LOCKED)
+RETURNING ` + webhookDeliveryColumns + `;`
+
+type ClaimWebhookDeliveriesParams struct {
+	Now        time.Time
+	LeaseUntil time.Time
+	Limit      int32
+}
+
+// ClaimWebhookDeliveries leases the pending deliveries that are due, the same way
+// ClaimEvents leases outbox events.
+func (q *Queries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]*WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, claimWebhookDeliveriesQuery, arg.LeaseUntil, WebhookDeliveryPending, arg.Now, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+const recordWebhookDeliveryAttemptQuery = `
+UPDATE webhook_deliveries
+SET status = $1, response_status = $2, last_error = $3, next_attempt_at = $4, delivered_at = $5
+WHERE id = $6;
+`
+
+type RecordWebhookDeliveryAttemptParams struct {
+	ID             int64
+	Status         string
+	ResponseStatus int32
+	LastError      string
+	NextAttemptAt  time.Time
+	DeliveredAt    sql.NullTime
+}
+
+// RecordWebhookDeliveryAttempt stores the outcome of the latest attempt to deliver a webhook.
+func (q *Queries) RecordWebhookDeliveryAttempt(ctx context.Context, arg RecordWebhookDeliveryAttemptParams) error {
+	_, err := q.db.ExecContext(ctx, recordWebhookDeliveryAttemptQuery,
+		arg.Status,
+		arg.ResponseStatus,
+		arg.LastError,
+		arg.NextAttemptAt,
+		arg.DeliveredAt,
+		arg.ID,
+	)
+	return err
+}
+
+const listWebhookDeliveriesQuery = `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries
+`
+
+// webhookDeliverySortColumns lists the columns the delivery log can be sorted by.
+var webhookDeliverySortColumns = map[string]string{
+	"created_at": "created_at",
+}
+
+type ListWebhookDeliveriesParams struct {
+	LimitOffset
+	SubscriptionID int64
+	Status         sql.NullString
+}
+
+// ListWebhookDeliveries returns the delivery log of a subscription, most recent first.
+func (q *Queries) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]*WebhookDelivery, error) {
+	builder := newQueryBuilder(listWebhookDeliveriesQuery).Where("subscription_id = ?", arg.SubscriptionID)
+	if arg.Status.Valid {
+		builder.Where("status = ?", arg.Status.String)
+	}
+	query, args := builder.
+		OrderBy(webhookDeliverySortColumns, "created_at", "created_at", true, "id").
+		Page(arg.Limit, arg.Offset).
+		Build()
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+const redeliverWebhookDeliveryQuery = `
+UPDATE webhook_deliveries SET status = $1, attempts = 0, last_error = '', next_attempt_at = $2, delivered_at = NULL
+WHERE id = $3 AND subscription_id = $4
+RETURNING ` + webhookDeliveryColumns + `;`
+
+// RedeliverWebhookDelivery schedules a delivery to be sent again at nextAttemptAt with a
+// fresh set of retries, whatever the outcome of its previous attempts.
+func (q *Queries) RedeliverWebhookDelivery(ctx context.Context, subscriptionID int64, id int64, nextAttemptAt time.Time) (*WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, redeliverWebhookDeliveryQuery, WebhookDeliveryPending, nextAttemptAt, id, subscriptionID)
+	return scanWebhookDelivery(row)
+}
+
+func scanWebhookDeliveries(rows *sql.Rows) ([]*WebhookDelivery, error) {
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func scanWebhookDelivery(row rowScanner) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var payload []byte
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.SubscriptionID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.ResponseStatus,
+		&delivery.LastError,
+		&delivery.NextAttemptAt,
+		&delivery.CreatedAt,
+		&delivery.DeliveredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload = payload
+	return &delivery, nil
+}
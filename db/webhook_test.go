@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var webhookSubscriptionRowColumns = []string{"id", "url", "event_types", "secret", "is_active", "created_at", "updated_at"}
+
+var webhookDeliveryRowColumns = []string{"id", "subscription_id", "event_id", "event_type", "payload", "status", "attempts", "response_status",
+	"last_error", "next_attempt_at", "created_at", "delivered_at"}
+
+func TestCreateWebhookSubscription(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	now := time.Now()
+	arg := CreateWebhookSubscriptionParams{
+		URL:        "https://partner.example.com/hooks",
+		EventTypes: []string{EventPropertyCreated, EventUserCreated},
+		Secret:     "whsec_0123456789abcdef",
+	}
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(createWebhookSubscriptionQuery)).
+		WithArgs(arg.URL, "{\"property.created\",\"user.created\"}", arg.Secret).
+		WillReturnRows(sqlmock.NewRows(webhookSubscriptionRowColumns).
+			AddRow(int64(1), arg.URL, []byte("{property.created,user.created}"), arg.Secret, true, now, now))
+
+	subscription, err := q.CreateWebhookSubscription(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), subscription.ID)
+	require.Equal(t, arg.EventTypes, subscription.EventTypes)
+	require.Equal(t, arg.Secret, subscription.Secret)
+	require.True(t, subscription.IsActive)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestListWebhookSubscriptionsForEvent(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	now := time.Now()
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(listWebhookSubscriptionsForEventQuery)).
+		WithArgs(true, EventUserCreated, WebhookAllEvents).
+		WillReturnRows(sqlmock.NewRows(webhookSubscriptionRowColumns).
+			AddRow(int64(1), "https://a.example.com", []byte("{user.created}"), "s1", true, now, now).
+			AddRow(int64(2), "https://b.example.com", []byte("{*}"), "s2", true, now, now))
+
+	subscriptions, err := q.ListWebhookSubscriptionsForEvent(context.Background(), EventUserCreated)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 2)
+	require.Equal(t, []string{WebhookAllEvents}, subscriptions[1].EventTypes)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestUpdateWebhookSubscription(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	now := time.Now()
+	arg := UpdateWebhookSubscriptionParams{
+		ID:        1,
+		IsActive:  sql.NullBool{Bool: false, Valid: true},
+		UpdatedAt: now,
+	}
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(updateWebhookSubscriptionQuery)).
+		WithArgs(arg.URL, nil, arg.IsActive, arg.UpdatedAt, arg.ID).
+		WillReturnRows(sqlmock.NewRows(webhookSubscriptionRowColumns).
+			AddRow(int64(1), "https://a.example.com", []byte("{user.created}"), "s1", false, now, now))
+
+	subscription, err := q.UpdateWebhookSubscription(context.Background(), arg)
+	require.NoError(t, err)
+	require.False(t, subscription.IsActive)
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(updateWebhookSubscriptionQuery)).
+		WithArgs(arg.URL, nil, arg.IsActive, arg.UpdatedAt, arg.ID).
+		WillReturnError(sql.ErrNoRows)
+
+	subscription, err = q.UpdateWebhookSubscription(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.Nil(t, subscription)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestListWebhookDeliveries(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	now := time.Now()
+	arg := ListWebhookDeliveriesParams{
+		LimitOffset:    LimitOffset{Limit: 10, Offset: 0},
+		SubscriptionID: 3,
+		Status:         sql.NullString{String: WebhookDeliveryFailed, Valid: true},
+	}
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta("FROM webhook_deliveries WHERE subscription_id = $1 AND status = $2 "+
+			"ORDER BY created_at DESC, id DESC LIMIT $3 OFFSET $4;")).
+		WithArgs(int64(3), WebhookDeliveryFailed, int32(10), int32(0)).
+		WillReturnRows(sqlmock.NewRows(webhookDeliveryRowColumns).
+			AddRow(int64(9), int64(3), int64(42), EventPropertyCreated, []byte(`{"id":42}`), WebhookDeliveryFailed, int32(10),
+				int32(500), "the receiver responded with status 500", now, now, nil))
+
+	deliveries, err := q.ListWebhookDeliveries(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, int64(42), deliveries[0].EventID)
+	require.Equal(t, int32(500), deliveries[0].ResponseStatus)
+	require.False(t, deliveries[0].DeliveredAt.Valid)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
+
+func TestRedeliverWebhookDelivery(t *testing.T) {
+	db, mocker, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	q := New(db)
+	now := time.Now()
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(redeliverWebhookDeliveryQuery)).
+		WithArgs(WebhookDeliveryPending, now, int64(9), int64(3)).
+		WillReturnRows(sqlmock.NewRows(webhookDeliveryRowColumns).
+			AddRow(int64(9), int64(3), int64(42), EventPropertyCreated, []byte(`{"id":42}`), WebhookDeliveryPending, int32(0),
+				int32(500), "", now, now, nil))
+
+	delivery, err := q.RedeliverWebhookDelivery(context.Background(), 3, 9, now)
+	require.NoError(t, err)
+	require.Equal(t, WebhookDeliveryPending, delivery.Status)
+	require.Equal(t, int32(0), delivery.Attempts)
+
+	mocker.
+		ExpectQuery(regexp.QuoteMeta(redeliverWebhookDeliveryQuery)).
+		WithArgs(WebhookDeliveryPending, now, int64(9), int64(4)).
+		WillReturnError(sql.ErrNoRows)
+
+	delivery, err = q.RedeliverWebhookDelivery(context.Background(), 4, 9, now)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.Nil(t, delivery)
+	require.NoError(t, mocker.ExpectationsWereMet())
+}
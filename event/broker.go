@@ -0,0 +1,99 @@
+package event
+
+import (
+	"context"
+	"github.com/newbri/posadamissportia/db"
+	"sync"
+)
+
+// Broker hands the events published on the bus to the clients currently listening, such as
+// the admin event streams. It never blocks the bus: a subscriber that does not keep up with
+// the events is dropped, and has to catch up from the outbox when it subscribes again.
+type Broker struct {
+	mu          sync.Mutex
+	buffer      int
+	closed      bool
+	subscribers map[*Subscriber]struct{}
+}
+
+// Subscriber receives the events published after it subscribed.
+type Subscriber struct {
+	events chan *db.Event
+	lagged bool
+}
+
+func NewBroker(buffer int) *Broker {
+	if buffer <= 0 {
+		buffer = 1
+	}
+	return &Broker{buffer: buffer, subscribers: map[*Subscriber]struct{}{}}
+}
+
+// Subscribe registers a new subscriber. The events of a subscriber that registers after
+// Close are closed straight away.
+func (broker *Broker) Subscribe() *Subscriber {
+	subscriber := &Subscriber{events: make(chan *db.Event, broker.buffer)}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if broker.closed {
+		close(subscriber.events)
+		return subscriber
+	}
+	broker.subscribers[subscriber] = struct{}{}
+	return subscriber
+}
+
+func (broker *Broker) Unsubscribe(subscriber *Subscriber) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	broker.drop(subscriber)
+}
+
+// Close drops every subscriber, letting the clients listening finish their requests when
+// the server shuts down.
+func (broker *Broker) Close() {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	broker.closed = true
+	for subscriber := range broker.subscribers {
+		broker.drop(subscriber)
+	}
+}
+
+// Handle implements Handler and never fails, so that a slow listener cannot cause the event
+// to be dispatched again to the other subscribers of the bus.
+func (broker *Broker) Handle(ctx context.Context, evt *db.Event) error {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	for subscriber := range broker.subscribers {
+		select {
+		case subscriber.events <- evt:
+		default:
+			subscriber.lagged = true
+			broker.drop(subscriber)
+		}
+	}
+	return nil
+}
+
+// drop must be called with the lock held.
+func (broker *Broker) drop(subscriber *Subscriber) {
+	if _, ok := broker.subscribers[subscriber]; ok {
+		delete(broker.subscribers, subscriber)
+		close(subscriber.events)
+	}
+}
+
+// Events is closed once the subscriber is dropped or unsubscribed.
+func (subscriber *Subscriber) Events() <-chan *db.Event {
+	return subscriber.events
+}
+
+// Lagged reports whether the subscriber was dropped for falling behind. It is only meaningful
+// once Events is closed.
+func (subscriber *Subscriber) Lagged() bool {
+	return subscriber.lagged
+}
@@ -0,0 +1,55 @@
+package event
+
+import (
+	"context"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBroker(t *testing.T) {
+	broker := NewBroker(2)
+	fast := broker.Subscribe()
+	slow := broker.Subscribe()
+
+	require.NoError(t, broker.Handle(context.Background(), &db.Event{ID: 1}))
+	require.Equal(t, int64(1), (<-fast.Events()).ID)
+
+	require.NoError(t, broker.Handle(context.Background(), &db.Event{ID: 2}))
+	require.Equal(t, int64(2), (<-fast.Events()).ID)
+
+	// the slow subscriber never read and its buffer of two is now full
+	require.NoError(t, broker.Handle(context.Background(), &db.Event{ID: 3}))
+	require.Equal(t, int64(3), (<-fast.Events()).ID)
+
+	var received []int64
+	for evt := range slow.Events() {
+		received = append(received, evt.ID)
+	}
+	require.Equal(t, []int64{1, 2}, received)
+	require.True(t, slow.Lagged())
+
+	broker.Unsubscribe(fast)
+	_, open := <-fast.Events()
+	require.False(t, open)
+	require.False(t, fast.Lagged())
+
+	// unsubscribing twice or publishing without subscribers is harmless
+	broker.Unsubscribe(fast)
+	require.NoError(t, broker.Handle(context.Background(), &db.Event{ID: 4}))
+}
+
+func TestBrokerClose(t *testing.T) {
+	broker := NewBroker(2)
+	subscriber := broker.Subscribe()
+
+	broker.Close()
+	_, open := <-subscriber.Events()
+	require.False(t, open)
+	require.False(t, subscriber.Lagged())
+
+	late := broker.Subscribe()
+	_, open = <-late.Events()
+	require.False(t, open)
+	require.NoError(t, broker.Handle(context.Background(), &db.Event{ID: 1}))
+}
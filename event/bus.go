@@ -0,0 +1,61 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/newbri/posadamissportia/db"
+	"sync"
+)
+
+// AllEvents subscribes a handler to every event type.
+const AllEvents = "*"
+
+// Handler reacts to a domain event. Events are delivered at least once, so a handler may
+// see the same event again after a failure and must be idempotent.
+type Handler func(ctx context.Context, event *db.Event) error
+
+// Bus delivers the events read from the outbox to the in-process subscribers.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: map[string][]Handler{}}
+}
+
+// Subscribe registers handler for eventType, or for every event when eventType is AllEvents.
+func (bus *Bus) Subscribe(eventType string, handler Handler) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.handlers[eventType] = append(bus.handlers[eventType], handler)
+}
+
+// Publish hands event to each of its subscribers and returns their joined errors. Every
+// subscriber is called even when an earlier one fails.
+func (bus *Bus) Publish(ctx context.Context, event *db.Event) error {
+	bus.mu.RLock()
+	handlers := make([]Handler, 0, len(bus.handlers[event.Type])+len(bus.handlers[AllEvents]))
+	handlers = append(handlers, bus.handlers[event.Type]...)
+	handlers = append(handlers, bus.handlers[AllEvents]...)
+	bus.mu.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := call(ctx, handler, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// call turns a panicking handler into an error so it cannot take the dispatcher down.
+func call(ctx context.Context, handler Handler, event *db.Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("event handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, event)
+}
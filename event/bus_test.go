@@ -0,0 +1,93 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBus_Publish(t *testing.T) {
+	errHandler := errors.New("handler failed")
+
+	testCases := []struct {
+		name      string
+		subscribe func(bus *Bus, calls *[]string)
+		event     *db.Event
+		response  func(t *testing.T, calls []string, err error)
+	}{
+		{
+			name: "OK",
+			subscribe: func(bus *Bus, calls *[]string) {
+				bus.Subscribe(db.EventUserCreated, func(ctx context.Context, event *db.Event) error {
+					*calls = append(*calls, "user")
+					return nil
+				})
+				bus.Subscribe(AllEvents, func(ctx context.Context, event *db.Event) error {
+					*calls = append(*calls, "all")
+					return nil
+				})
+				bus.Subscribe(db.EventRoleCreated, func(ctx context.Context, event *db.Event) error {
+					*calls = append(*calls, "role")
+					return nil
+				})
+			},
+			event: &db.Event{ID: 1, Type: db.EventUserCreated},
+			response: func(t *testing.T, calls []string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, []string{"user", "all"}, calls)
+			},
+		},
+		{
+			name: "NoSubscribers",
+			subscribe: func(bus *Bus, calls *[]string) {
+			},
+			event: &db.Event{ID: 1, Type: db.EventUserCreated},
+			response: func(t *testing.T, calls []string, err error) {
+				require.NoError(t, err)
+				require.Empty(t, calls)
+			},
+		},
+		{
+			name: "HandlerError",
+			subscribe: func(bus *Bus, calls *[]string) {
+				bus.Subscribe(db.EventUserCreated, func(ctx context.Context, event *db.Event) error {
+					return errHandler
+				})
+				bus.Subscribe(db.EventUserCreated, func(ctx context.Context, event *db.Event) error {
+					*calls = append(*calls, "second")
+					return nil
+				})
+			},
+			event: &db.Event{ID: 1, Type: db.EventUserCreated},
+			response: func(t *testing.T, calls []string, err error) {
+				require.ErrorIs(t, err, errHandler)
+				require.Equal(t, []string{"second"}, calls)
+			},
+		},
+		{
+			name: "HandlerPanic",
+			subscribe: func(bus *Bus, calls *[]string) {
+				bus.Subscribe(db.EventUserCreated, func(ctx context.Context, event *db.Event) error {
+					panic("boom")
+				})
+			},
+			event: &db.Event{ID: 1, Type: db.EventUserCreated},
+			response: func(t *testing.T, calls []string, err error) {
+				require.ErrorContains(t, err, "boom")
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bus := NewBus()
+			var calls []string
+			tc.subscribe(bus, &calls)
+
+			err := bus.Publish(context.Background(), tc.event)
+			tc.response(t, calls, err)
+		})
+	}
+}
@@ -1,51 +1,199 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/joho/godotenv"
 	"github.com/newbri/posadamissportia/api"
 	"github.com/newbri/posadamissportia/configuration"
 	"github.com/newbri/posadamissportia/db"
-	"github.com/newbri/posadamissportia/db/util"
+	"github.com/newbri/posadamissportia/db/migrator"
+	"github.com/newbri/posadamissportia/db/seed"
+	"github.com/newbri/posadamissportia/event"
 	"github.com/newbri/posadamissportia/token"
+	"github.com/newbri/posadamissportia/tracing"
+	"github.com/newbri/posadamissportia/webhook"
+	"github.com/newbri/posadamissportia/worker"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 )
 
+// main serves the API unless the first argument is a command:
+//
+//	migrate up|down [N]|to N|status|force N    migrates the database, see migrator.Run
+//	seed                                       creates the missing roles and demo users
+//
+// The flags overriding the settings are only read when serving.
 func main() {
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatal().Msg("Error loading .env file")
 	}
 
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	flags := args
+	if command != "serve" {
+		flags = nil
+	}
+
 	env := os.Getenv("POSADA_ENV")
-	yamlConfig := configuration.NewYAMLConfiguration("app.yaml", env)
+	// the settings of app.yaml are overridden by the POSADA_* variables and the flags
+	config, err := configuration.NewLayeredConfiguration("app.yaml", env, flags)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load the configuration")
+	}
 
-	if yamlConfig.GetConfig().Name == "development" {
+	if config.GetConfig().Name == "development" {
 		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 	}
 
-	conn, err := sql.Open(yamlConfig.GetConfig().DBDriver, yamlConfig.GetConfig().DBSource)
+	switch command {
+	case "serve":
+		serve(config)
+	case "migrate":
+		if err = migrateDatabase(config, args); err != nil {
+			log.Fatal().Err(err).Msg("cannot migrate the database")
+		}
+	case "seed":
+		if err = seedDatabase(config); err != nil {
+			log.Fatal().Err(err).Msg("cannot seed the database")
+		}
+	default:
+		log.Fatal().Str("command", command).Msg("unknown command, expected serve, migrate or seed")
+	}
+}
+
+func migrateDatabase(config *configuration.LayeredConfiguration, args []string) error {
+	m, err := migrator.New(config.GetConfig().DBSource)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	return migrator.Run(m, args, os.Stdout)
+}
+
+func seedDatabase(config *configuration.LayeredConfiguration) error {
+	conn, err := sql.Open(config.GetConfig().DBDriver, config.GetConfig().DBSource)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return seed.Run(context.Background(), db.NewStore(conn), config.GetConfig())
+}
+
+// prepareDatabase migrates and seeds the database, or only checks its version, as
+// migration_mode says.
+func prepareDatabase(config *configuration.LayeredConfiguration, store db.Store) error {
+	mode := config.GetConfig().MigrationMode
+	if mode == configuration.MigrationModeOff {
+		return nil
+	}
+
+	m, err := migrator.New(config.GetConfig().DBSource)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	if mode == configuration.MigrationModeCheck {
+		return migrator.Check(m)
+	}
+
+	if err = m.Up(); err != nil {
+		return err
+	}
+	log.Info().Uint("version", db.SchemaVersion).Msg("database migrated")
+	return seed.Run(context.Background(), store, config.GetConfig())
+}
+
+func serve(config *configuration.LayeredConfiguration) {
+	conn, err := sql.Open(config.GetConfig().DBDriver, config.GetConfig().DBSource)
 	if err != nil {
 		log.Fatal().Msg("could not connect to the database")
 	}
 
-	util.RunDBMigration(yamlConfig.GetConfig().MigrationURL, yamlConfig.GetConfig().DBSource)
+	prometheus.MustRegister(collectors.NewDBStatsCollector(conn, "posada"))
+
+	store := db.NewTracedStore(db.NewStore(conn))
 
-	store := db.NewStore(conn)
+	if err = prepareDatabase(config, store); err != nil {
+		log.Fatal().Err(err).Msg("cannot prepare the database")
+	}
 
-	tokenMaker, err := token.NewPasetoMaker(yamlConfig.GetConfig().TokenSymmetricKey)
+	tokenMaker, err := token.NewPasetoMaker(config.GetConfig().TokenSymmetricKey)
 	if err != nil {
 		log.Fatal().Msg("cannot create token paseto")
 	}
 
-	server := api.NewServer(store, tokenMaker, yamlConfig)
-	err = server.Start(yamlConfig.GetConfig().HTTPServerAddress)
+	// the server drains and the workers stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, config)
 	if err != nil {
-		log.Fatal().Msg("cannot start server")
+		log.Fatal().Err(err).Msg("cannot set up tracing")
+	}
+
+	var workers sync.WaitGroup
+	runWorker := func(run func(ctx context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(ctx)
+		}()
+	}
+
+	// the settings that can change at runtime are reloaded when app.yaml changes or on SIGHUP
+	config.Subscribe(configuration.LogDurationChanges)
+	runWorker(config.Watch)
+	runWorker(worker.NewUserPurger(store, config).Run)
+	runWorker(worker.NewIdempotencyKeyPurger(store, config).Run)
+	runWorker(worker.NewOutboxPurger(store, config).Run)
+
+	server := api.NewServer(store, tokenMaker, config)
+
+	bus := event.NewBus()
+	bus.Subscribe(event.AllEvents, webhook.NewFanout(store).Handle)
+	bus.Subscribe(event.AllEvents, server.HandleEvent)
+	runWorker(worker.NewOutboxDispatcher(store, bus, config).Run)
+	runWorker(worker.NewWebhookDeliverer(store, config).Run)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Start(config.GetConfig().HTTPServerAddress)
+	}()
+
+	select {
+	case err = <-serverErr:
+		// Start only returns early when the server could not listen
+		log.Fatal().Err(err).Msg("cannot start server")
+	case <-ctx.Done():
+		log.Info().Msg("shutting down")
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.GetConfig().ShutdownTimeout)
+	defer cancel()
+	if err = server.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("cannot drain the connections")
+	}
+
+	workers.Wait()
+	if err = shutdownTracing(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("cannot flush the spans")
+	}
+	if err = conn.Close(); err != nil {
+		log.Error().Err(err).Msg("cannot close the database")
 	}
+	log.Info().Msg("server stopped")
 }
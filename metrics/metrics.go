@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"strconv"
+	"time"
+)
+
+const namespace = "posada"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled, by route template, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency, by route template, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Database query latency, by query.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query"})
+
+	dbQueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_errors_total",
+		Help:      "Database queries that failed, by query.",
+	}, []string{"query"})
+
+	// Logins counts the successful logins.
+	Logins = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "logins_total",
+		Help:      "Successful logins.",
+	})
+
+	// FailedPasswords counts the logins rejected because of a wrong password.
+	FailedPasswords = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "failed_passwords_total",
+		Help:      "Logins rejected because of a wrong password.",
+	})
+
+	// TokenRenewals counts the access tokens renewed from a refresh token.
+	TokenRenewals = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "token_renewals_total",
+		Help:      "Access tokens renewed from a refresh token.",
+	})
+
+	// RefusedRenewals counts the renewals refused because the session is blocked. A blocked
+	// session retrying its renewal is counted on every attempt.
+	RefusedRenewals = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "refused_renewals_total",
+		Help:      "Token renewals refused because the session is blocked, counted per attempt.",
+	})
+)
+
+// ObserveRequest records a handled HTTP request. The route is the template the request
+// matched, such as /api/v1/auth/admin/role/:id, so the label set stays bounded.
+func ObserveRequest(route, method string, status int, elapsed time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpRequestDuration.WithLabelValues(route, method, code).Observe(elapsed.Seconds())
+}
+
+// ObserveQuery records a database query and whether it failed.
+func ObserveQuery(query string, elapsed time.Duration, err error) {
+	dbQueryDuration.WithLabelValues(query).Observe(elapsed.Seconds())
+	if err != nil {
+		dbQueryErrors.WithLabelValues(query).Inc()
+	}
+}
@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type staticConfiguration configuration.Config
+
+func (c *staticConfiguration) GetConfig() *configuration.Config {
+	return (*configuration.Config)(c)
+}
+
+func TestSetup(t *testing.T) {
+	testCases := []struct {
+		name     string
+		exporter string
+		fails    bool
+	}{
+		{name: "Disabled", exporter: configuration.TracingExporterNone},
+		{name: "Unset", exporter: ""},
+		{name: "Stdout", exporter: configuration.TracingExporterStdout},
+		{name: "OTLP", exporter: configuration.TracingExporterOTLP},
+		{name: "Unknown", exporter: "zipkin", fails: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &staticConfiguration{
+				Name:               "test",
+				TracingExporter:    tc.exporter,
+				TracingEndpoint:    "localhost:4318",
+				TracingInsecure:    true,
+				TracingSampleRatio: 1,
+			}
+
+			shutdown, err := Setup(context.Background(), config)
+			if tc.fails {
+				require.ErrorContains(t, err, tc.exporter)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, shutdown(context.Background()))
+		})
+	}
+}
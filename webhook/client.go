@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var ErrForbiddenAddress = errors.New("the webhook receiver is not on a public address")
+
+// forbiddenPrefixes are the ranges the net/netip predicates do not cover: "this network" and
+// the carrier-grade NAT range some clouds serve their metadata from.
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// NewClient returns the HTTP client deliveries are sent with. Receivers are registered by
+// administrators, so the client refuses to connect to loopback, private, link-local (such as
+// the 169.254.169.254 cloud metadata endpoint) and other non-public addresses. The address is
+// checked once resolved, right before dialing, so a DNS answer changing after the url was
+// registered cannot get around it. Redirects are not followed: a redirect is reported as the
+// receiver's response.
+func NewClient(timeout time.Duration) *http.Client {
+	return newClient(timeout, checkDialedAddress)
+}
+
+func newClient(timeout time.Duration, control func(network, address string, conn syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second, Control: control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// a proxy would connect to the receiver on our behalf, out of reach of the check
+	transport.Proxy = nil
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: otelhttp.NewTransport(transport),
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func checkDialedAddress(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsPublicAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+// IsPublicAddress tells whether addr can be reached by a webhook delivery.
+func IsPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/newbri/posadamissportia/db"
+	"time"
+)
+
+// Envelope is the body of every webhook delivery.
+type Envelope struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Fanout schedules a delivery of each event to every active subscription interested in it.
+// It is subscribed to the event bus; the deliveries themselves are sent by the webhook
+// delivery worker.
+type Fanout struct {
+	store db.Store
+	now   func() time.Time
+}
+
+func NewFanout(store db.Store) *Fanout {
+	return &Fanout{store: store, now: time.Now}
+}
+
+// Handle implements event.Handler. It is safe to call again for an event it has already
+// handled, since a delivery is only scheduled once per subscription and event.
+func (fanout *Fanout) Handle(ctx context.Context, evt *db.Event) error {
+	subscriptions, err := fanout.store.ListWebhookSubscriptionsForEvent(ctx, evt.Type)
+	if err != nil {
+		return err
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(Envelope{ID: evt.ID, Type: evt.Type, CreatedAt: evt.CreatedAt, Data: evt.Payload})
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		err = fanout.store.CreateWebhookDelivery(ctx, db.CreateWebhookDeliveryParams{
+			SubscriptionID: subscription.ID,
+			EventID:        evt.ID,
+			EventType:      evt.Type,
+			Payload:        payload,
+			NextAttemptAt:  fanout.now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
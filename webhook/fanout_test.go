@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestFanout_Handle(t *testing.T) {
+	now := time.Now()
+	evt := &db.Event{
+		ID:        42,
+		Type:      db.EventPropertyActivated,
+		Payload:   json.RawMessage(`{"external_id":"PRO101"}`),
+		CreatedAt: now,
+	}
+
+	testCases := []struct {
+		name     string
+		mock     func(store *mocker.TestMocker)
+		expected error
+	}{
+		{
+			name: "OK",
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("ListWebhookSubscriptionsForEvent", mock.Anything, evt.Type).
+					Times(1).
+					Return([]*db.WebhookSubscription{{ID: 1}, {ID: 2}}, nil)
+				for _, id := range []int64{1, 2} {
+					id := id
+					store.
+						On("CreateWebhookDelivery", mock.Anything, mock.MatchedBy(func(arg db.CreateWebhookDeliveryParams) bool {
+							var envelope Envelope
+							return arg.SubscriptionID == id && arg.EventID == evt.ID && arg.EventType == evt.Type &&
+								arg.NextAttemptAt.Equal(now) &&
+								json.Unmarshal(arg.Payload, &envelope) == nil &&
+								envelope.ID == evt.ID && string(envelope.Data) == string(evt.Payload)
+						})).
+						Times(1).
+						Return(nil)
+				}
+			},
+		},
+		{
+			name: "NoSubscription",
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("ListWebhookSubscriptionsForEvent", mock.Anything, evt.Type).
+					Times(1).
+					Return([]*db.WebhookSubscription{}, nil)
+			},
+		},
+		{
+			name: "ScheduleError",
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("ListWebhookSubscriptionsForEvent", mock.Anything, evt.Type).
+					Times(1).
+					Return([]*db.WebhookSubscription{{ID: 1}}, nil)
+				store.
+					On("CreateWebhookDelivery", mock.Anything, mock.Anything).
+					Times(1).
+					Return(sql.ErrConnDone)
+			},
+			expected: sql.ErrConnDone,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := new(mocker.TestMocker)
+			tc.mock(store)
+
+			fanout := NewFanout(store)
+			fanout.now = func() time.Time { return now }
+
+			err := fanout.Handle(context.Background(), evt)
+			if tc.expected == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tc.expected)
+			}
+			store.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeaderKey = "X-Posada-Signature"
+	EventHeaderKey     = "X-Posada-Event"
+	DeliveryHeaderKey  = "X-Posada-Delivery"
+
+	secretPrefix = "whsec_"
+)
+
+var (
+	ErrInvalidSignature = errors.New("the webhook signature is invalid")
+	ErrStaleSignature   = errors.New("the webhook signature is too old")
+)
+
+// Sign returns the signature header value of a delivery body sent at timestamp. The HMAC-SHA256
+// covers the timestamp as well as the body, so that a captured delivery cannot be replayed later
+// with a fresh timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := timestamp.Unix()
+	return fmt.Sprintf("t=%d,v1=%s", unix, signature(secret, unix, body))
+}
+
+// Verify checks a signature header produced by Sign and rejects the ones older than tolerance.
+// Receivers written in Go can use it as is.
+func Verify(secret string, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var unix int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return ErrInvalidSignature
+		}
+		switch key {
+		case "t":
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidSignature
+			}
+			unix = parsed
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if unix == 0 || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	if now.Sub(time.Unix(unix, 0)).Abs() > tolerance {
+		return ErrStaleSignature
+	}
+
+	expected := signature(secret, unix, body)
+	for _, candidate := range signatures {
+		if hmac.Equal([]byte(candidate), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func signature(secret string, unix int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(unix, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret generates a random signing secret for a subscription.
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return secretPrefix + hex.EncodeToString(buf), nil
+}
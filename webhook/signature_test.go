@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	const secret = "whsec_0123456789abcdef"
+	body := []byte(`{"id":1,"type":"user.created"}`)
+	sentAt := time.Unix(1700000000, 0)
+	header := Sign(secret, sentAt, body)
+	require.True(t, strings.HasPrefix(header, "t=1700000000,v1="))
+
+	testCases := []struct {
+		name     string
+		secret   string
+		header   string
+		body     []byte
+		now      time.Time
+		expected error
+	}{
+		{
+			name:   "OK",
+			secret: secret,
+			header: header,
+			body:   body,
+			now:    sentAt.Add(time.Minute),
+		},
+		{
+			name:     "TamperedBody",
+			secret:   secret,
+			header:   header,
+			body:     []byte(`{"id":2,"type":"user.created"}`),
+			now:      sentAt,
+			expected: ErrInvalidSignature,
+		},
+		{
+			name:     "WrongSecret",
+			secret:   "whsec_another",
+			header:   header,
+			body:     body,
+			now:      sentAt,
+			expected: ErrInvalidSignature,
+		},
+		{
+			name:     "ReplayedTimestamp",
+			secret:   secret,
+			header:   strings.Replace(header, "t=1700000000", "t=1700000600", 1),
+			body:     body,
+			now:      sentAt.Add(10 * time.Minute),
+			expected: ErrInvalidSignature,
+		},
+		{
+			name:     "Stale",
+			secret:   secret,
+			header:   header,
+			body:     body,
+			now:      sentAt.Add(time.Hour),
+			expected: ErrStaleSignature,
+		},
+		{
+			name:     "Malformed",
+			secret:   secret,
+			header:   "v1",
+			body:     body,
+			now:      sentAt,
+			expected: ErrInvalidSignature,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Verify(tc.secret, tc.header, tc.body, 5*time.Minute, tc.now)
+			if tc.expected == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tc.expected)
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	first, err := NewSecret()
+	require.NoError(t, err)
+	second, err := NewSecret()
+	require.NoError(t, err)
+
+	require.True(t, strings.HasPrefix(first, secretPrefix))
+	require.Len(t, first, len(secretPrefix)+64)
+	require.NotEqual(t, first, second)
+}
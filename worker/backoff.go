@@ -0,0 +1,15 @@
+package worker
+
+import "time"
+
+// exponentialBackoff doubles base for every failed attempt after the first one, up to max.
+func exponentialBackoff(base time.Duration, max time.Duration, attempts int32) time.Duration {
+	delay := base
+	for i := int32(1); i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
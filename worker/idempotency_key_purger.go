@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"context"
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// IdempotencyKeyPurger periodically deletes the expired idempotency keys, which are otherwise
+// only reclaimed when a client reuses the same key.
+type IdempotencyKeyPurger struct {
+	store  db.Store
+	config configuration.Configuration
+	now    func() time.Time
+}
+
+func NewIdempotencyKeyPurger(store db.Store, config configuration.Configuration) *IdempotencyKeyPurger {
+	return &IdempotencyKeyPurger{store: store, config: config, now: time.Now}
+}
+
+// Run purges once right away and then on every purge interval until ctx is cancelled.
+// A zero interval disables the job.
+func (purger *IdempotencyKeyPurger) Run(ctx context.Context) {
+	interval := purger.config.GetConfig().IdempotencyKeyPurgeInterval
+	if interval <= 0 {
+		log.Info().Msg("idempotency key purge job is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purger.Purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge removes the keys that have expired and returns how many were removed.
+func (purger *IdempotencyKeyPurger) Purge(ctx context.Context) int64 {
+	expiredBefore := purger.now()
+	purged, err := purger.store.PurgeExpiredIdempotencyKeys(ctx, expiredBefore)
+	if err != nil {
+		log.Error().Err(err).Msg("cannot purge expired idempotency keys")
+		return 0
+	}
+
+	if purged > 0 {
+		log.Info().Int64("purged", purged).Time("expired_before", expiredBefore).Msg("expired idempotency keys purged")
+	}
+	return purged
+}
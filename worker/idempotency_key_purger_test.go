@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeyPurger_Purge(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name     string
+		mock     func(store *mocker.TestMocker)
+		expected int64
+	}{
+		{
+			name: "OK",
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("PurgeExpiredIdempotencyKeys", mock.Anything, now).
+					Times(1).
+					Return(int64(5), nil)
+			},
+			expected: 5,
+		},
+		{
+			name: "Error",
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("PurgeExpiredIdempotencyKeys", mock.Anything, mock.Anything).
+					Times(1).
+					Return(int64(0), sql.ErrConnDone)
+			},
+			expected: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := new(mocker.TestMocker)
+			tc.mock(store)
+
+			purger := NewIdempotencyKeyPurger(store, store)
+			purger.now = func() time.Time { return now }
+
+			require.Equal(t, tc.expected, purger.Purge(context.Background()))
+			store.AssertExpectations(t)
+		})
+	}
+}
+
+func TestIdempotencyKeyPurger_RunDisabled(t *testing.T) {
+	store := new(mocker.TestMocker)
+	store.On("GetConfig").Return(&configuration.Config{})
+
+	done := make(chan struct{})
+	go func() {
+		NewIdempotencyKeyPurger(store, store).Run(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a disabled purge job must return right away")
+	}
+	store.AssertNotCalled(t, "PurgeExpiredIdempotencyKeys", mock.Anything, mock.Anything)
+}
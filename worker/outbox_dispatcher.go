@@ -0,0 +1,110 @@
+package worker
+
+import (
+	"context"
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/event"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// OutboxDispatcher delivers the events recorded in the outbox to the subscribers of the bus.
+// An event is only marked as dispatched once every subscriber handled it; otherwise it is
+// retried with an exponential backoff, so subscribers see each event at least once. An event
+// still failing after the maximum number of attempts is marked as failed and no longer retried.
+type OutboxDispatcher struct {
+	store  db.Store
+	bus    *event.Bus
+	config configuration.Configuration
+	now    func() time.Time
+}
+
+func NewOutboxDispatcher(store db.Store, bus *event.Bus, config configuration.Configuration) *OutboxDispatcher {
+	return &OutboxDispatcher{store: store, bus: bus, config: config, now: time.Now}
+}
+
+// Run dispatches the pending events on every poll interval until ctx is cancelled. A full
+// batch is followed by another one right away so that a backlog drains without waiting.
+// A zero interval or batch size disables the dispatcher.
+func (dispatcher *OutboxDispatcher) Run(ctx context.Context) {
+	config := dispatcher.config.GetConfig()
+	if config.OutboxPollInterval <= 0 || config.OutboxBatchSize <= 0 {
+		log.Info().Msg("outbox dispatcher is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(config.OutboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if dispatcher.Dispatch(ctx) == int(dispatcher.config.GetConfig().OutboxBatchSize) && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch claims a batch of due events, publishes them and returns how many were claimed.
+func (dispatcher *OutboxDispatcher) Dispatch(ctx context.Context) int {
+	config := dispatcher.config.GetConfig()
+	now := dispatcher.now()
+	events, err := dispatcher.store.ClaimEvents(ctx, db.ClaimEventsParams{
+		Now:        now,
+		LeaseUntil: now.Add(config.OutboxLease),
+		Limit:      config.OutboxBatchSize,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("cannot claim outbox events")
+		return 0
+	}
+
+	for _, evt := range events {
+		dispatcher.deliver(ctx, evt)
+	}
+	return len(events)
+}
+
+func (dispatcher *OutboxDispatcher) deliver(ctx context.Context, evt *db.Event) {
+	if err := dispatcher.bus.Publish(ctx, evt); err != nil {
+		if evt.Attempts >= dispatcher.config.GetConfig().OutboxMaxAttempts {
+			dispatcher.fail(ctx, evt, err)
+			return
+		}
+
+		availableAt := dispatcher.now().Add(dispatcher.backoff(evt.Attempts))
+		log.Warn().Err(err).Int64("event_id", evt.ID).Str("event_type", evt.Type).
+			Int32("attempts", evt.Attempts).Time("retry_at", availableAt).Msg("cannot dispatch event")
+
+		err = dispatcher.store.RetryEvent(ctx, db.RetryEventParams{ID: evt.ID, AvailableAt: availableAt, LastError: err.Error()})
+		if err != nil {
+			log.Error().Err(err).Int64("event_id", evt.ID).Msg("cannot schedule event retry")
+		}
+		return
+	}
+
+	if err := dispatcher.store.MarkEventDispatched(ctx, evt.ID, dispatcher.now()); err != nil {
+		log.Error().Err(err).Int64("event_id", evt.ID).Msg("cannot mark event as dispatched")
+	}
+}
+
+func (dispatcher *OutboxDispatcher) fail(ctx context.Context, evt *db.Event, err error) {
+	log.Error().Err(err).Int64("event_id", evt.ID).Str("event_type", evt.Type).
+		Int32("attempts", evt.Attempts).Msg("event dispatch failed")
+
+	err = dispatcher.store.MarkEventFailed(ctx, db.MarkEventFailedParams{ID: evt.ID, FailedAt: dispatcher.now(), LastError: err.Error()})
+	if err != nil {
+		log.Error().Err(err).Int64("event_id", evt.ID).Msg("cannot mark event as failed")
+	}
+}
+
+// backoff spaces out the retries of an event that failed attempts times.
+func (dispatcher *OutboxDispatcher) backoff(attempts int32) time.Duration {
+	config := dispatcher.config.GetConfig()
+	return exponentialBackoff(config.OutboxRetryBaseDelay, config.OutboxRetryMaxDelay, attempts)
+}
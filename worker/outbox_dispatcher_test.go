@@ -0,0 +1,156 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/newbri/posadamissportia/event"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestOutboxDispatcher_Dispatch(t *testing.T) {
+	now := time.Now()
+	config := &configuration.Config{
+		OutboxPollInterval:   time.Second,
+		OutboxBatchSize:      10,
+		OutboxLease:          time.Minute,
+		OutboxRetryBaseDelay: time.Second,
+		OutboxRetryMaxDelay:  time.Hour,
+		OutboxMaxAttempts:    5,
+	}
+	claim := db.ClaimEventsParams{Now: now, LeaseUntil: now.Add(config.OutboxLease), Limit: config.OutboxBatchSize}
+	errHandler := errors.New("handler failed")
+
+	testCases := []struct {
+		name      string
+		subscribe func(bus *event.Bus)
+		mock      func(store *mocker.TestMocker)
+		expected  int
+	}{
+		{
+			name: "OK",
+			subscribe: func(bus *event.Bus) {
+				bus.Subscribe(db.EventUserCreated, func(ctx context.Context, event *db.Event) error {
+					return nil
+				})
+			},
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("ClaimEvents", mock.Anything, claim).
+					Times(1).
+					Return([]*db.Event{{ID: 1, Type: db.EventUserCreated, Attempts: 1}, {ID: 2, Type: db.EventRoleCreated, Attempts: 1}}, nil)
+				store.
+					On("MarkEventDispatched", mock.Anything, int64(1), now).
+					Times(1).
+					Return(nil)
+				store.
+					On("MarkEventDispatched", mock.Anything, int64(2), now).
+					Times(1).
+					Return(nil)
+			},
+			expected: 2,
+		},
+		{
+			name: "HandlerErrorIsRetried",
+			subscribe: func(bus *event.Bus) {
+				bus.Subscribe(db.EventUserCreated, func(ctx context.Context, event *db.Event) error {
+					return errHandler
+				})
+			},
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("ClaimEvents", mock.Anything, claim).
+					Times(1).
+					Return([]*db.Event{{ID: 1, Type: db.EventUserCreated, Attempts: 3}}, nil)
+				store.
+					On("RetryEvent", mock.Anything, db.RetryEventParams{ID: 1, AvailableAt: now.Add(4 * time.Second), LastError: errHandler.Error()}).
+					Times(1).
+					Return(nil)
+			},
+			expected: 1,
+		},
+		{
+			name: "FailedAfterMaxAttempts",
+			subscribe: func(bus *event.Bus) {
+				bus.Subscribe(db.EventUserCreated, func(ctx context.Context, event *db.Event) error {
+					return errHandler
+				})
+			},
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("ClaimEvents", mock.Anything, claim).
+					Times(1).
+					Return([]*db.Event{{ID: 1, Type: db.EventUserCreated, Attempts: 5}}, nil)
+				store.
+					On("MarkEventFailed", mock.Anything, db.MarkEventFailedParams{ID: 1, FailedAt: now, LastError: errHandler.Error()}).
+					Times(1).
+					Return(nil)
+			},
+			expected: 1,
+		},
+		{
+			name:      "ClaimError",
+			subscribe: func(bus *event.Bus) {},
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("ClaimEvents", mock.Anything, claim).
+					Times(1).
+					Return(nil, sql.ErrConnDone)
+			},
+			expected: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := new(mocker.TestMocker)
+			store.On("GetConfig").Return(config)
+			tc.mock(store)
+
+			bus := event.NewBus()
+			tc.subscribe(bus)
+
+			dispatcher := NewOutboxDispatcher(store, bus, store)
+			dispatcher.now = func() time.Time { return now }
+
+			require.Equal(t, tc.expected, dispatcher.Dispatch(context.Background()))
+			store.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOutboxDispatcher_Backoff(t *testing.T) {
+	store := new(mocker.TestMocker)
+	store.On("GetConfig").Return(&configuration.Config{OutboxRetryBaseDelay: time.Second, OutboxRetryMaxDelay: time.Minute})
+	dispatcher := NewOutboxDispatcher(store, event.NewBus(), store)
+
+	require.Equal(t, time.Second, dispatcher.backoff(1))
+	require.Equal(t, 2*time.Second, dispatcher.backoff(2))
+	require.Equal(t, 32*time.Second, dispatcher.backoff(6))
+	require.Equal(t, time.Minute, dispatcher.backoff(7))
+	require.Equal(t, time.Minute, dispatcher.backoff(1000))
+}
+
+func TestOutboxDispatcher_RunDisabled(t *testing.T) {
+	store := new(mocker.TestMocker)
+	store.On("GetConfig").Return(&configuration.Config{})
+
+	done := make(chan struct{})
+	go func() {
+		NewOutboxDispatcher(store, event.NewBus(), store).Run(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a disabled dispatcher must return right away")
+	}
+	store.AssertNotCalled(t, "ClaimEvents", mock.Anything, mock.Anything)
+}
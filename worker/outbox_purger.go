@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"context"
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// OutboxPurger periodically deletes the events dispatched longer ago than the outbox retention,
+// which no subscriber needs anymore and no event stream replays.
+type OutboxPurger struct {
+	store  db.Store
+	config configuration.Configuration
+	now    func() time.Time
+}
+
+func NewOutboxPurger(store db.Store, config configuration.Configuration) *OutboxPurger {
+	return &OutboxPurger{store: store, config: config, now: time.Now}
+}
+
+// Run purges once right away and then on every purge interval until ctx is cancelled.
+// A zero interval disables the job.
+func (purger *OutboxPurger) Run(ctx context.Context) {
+	interval := purger.config.GetConfig().OutboxPurgeInterval
+	if interval <= 0 {
+		log.Info().Msg("outbox purge job is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purger.Purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge removes the events dispatched before the retention and returns how many were removed.
+func (purger *OutboxPurger) Purge(ctx context.Context) int64 {
+	dispatchedBefore := purger.now().Add(-purger.config.GetConfig().OutboxRetention)
+	purged, err := purger.store.PurgeDispatchedEvents(ctx, dispatchedBefore)
+	if err != nil {
+		log.Error().Err(err).Msg("cannot purge dispatched outbox events")
+		return 0
+	}
+
+	if purged > 0 {
+		log.Info().Int64("purged", purged).Time("dispatched_before", dispatchedBefore).Msg("dispatched outbox events purged")
+	}
+	return purged
+}
@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestOutboxPurger_Purge(t *testing.T) {
+	now := time.Now()
+	config := &configuration.Config{OutboxRetention: 168 * time.Hour}
+
+	testCases := []struct {
+		name     string
+		mock     func(store *mocker.TestMocker)
+		expected int64
+	}{
+		{
+			name: "OK",
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("PurgeDispatchedEvents", mock.Anything, now.Add(-168*time.Hour)).
+					Times(1).
+					Return(int64(12), nil)
+			},
+			expected: 12,
+		},
+		{
+			name: "Error",
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("PurgeDispatchedEvents", mock.Anything, mock.Anything).
+					Times(1).
+					Return(int64(0), sql.ErrConnDone)
+			},
+			expected: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := new(mocker.TestMocker)
+			store.On("GetConfig").Return(config)
+			tc.mock(store)
+
+			purger := NewOutboxPurger(store, store)
+			purger.now = func() time.Time { return now }
+
+			require.Equal(t, tc.expected, purger.Purge(context.Background()))
+			store.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOutboxPurger_RunDisabled(t *testing.T) {
+	store := new(mocker.TestMocker)
+	store.On("GetConfig").Return(&configuration.Config{})
+
+	done := make(chan struct{})
+	go func() {
+		NewOutboxPurger(store, store).Run(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a disabled purge job must return right away")
+	}
+	store.AssertNotCalled(t, "PurgeDispatchedEvents", mock.Anything, mock.Anything)
+}
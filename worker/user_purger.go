@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"context"
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// UserPurger periodically hard-deletes the users that have been soft-deleted for longer
+// than the configured retention period.
+type UserPurger struct {
+	store  db.Store
+	config configuration.Configuration
+	now    func() time.Time
+}
+
+func NewUserPurger(store db.Store, config configuration.Configuration) *UserPurger {
+	return &UserPurger{store: store, config: config, now: time.Now}
+}
+
+// Run purges once right away and then on every purge interval until ctx is cancelled.
+// A zero interval disables the job.
+func (purger *UserPurger) Run(ctx context.Context) {
+	interval := purger.config.GetConfig().UserPurgeInterval
+	if interval <= 0 {
+		log.Info().Msg("user purge job is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purger.Purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge removes the users deleted before the retention period and returns how many were removed.
+func (purger *UserPurger) Purge(ctx context.Context) int64 {
+	deletedBefore := purger.now().Add(-purger.config.GetConfig().DeletedUserRetention)
+	purged, err := purger.store.PurgeDeletedUsers(ctx, deletedBefore)
+	if err != nil {
+		log.Error().Err(err).Msg("cannot purge deleted users")
+		return 0
+	}
+
+	if purged > 0 {
+		log.Info().Int64("purged", purged).Time("deleted_before", deletedBefore).Msg("deleted users purged")
+	}
+	return purged
+}
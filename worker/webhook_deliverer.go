@@ -0,0 +1,163 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/webhook"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const webhookUserAgent = "posada-webhooks/1"
+
+// WebhookDeliverer sends the pending webhook deliveries to the subscribed receivers. A delivery
+// that is not acknowledged with a 2xx status is retried with an exponential backoff until the
+// maximum number of attempts is reached, after which it is marked as failed.
+type WebhookDeliverer struct {
+	store  db.Store
+	config configuration.Configuration
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewWebhookDeliverer(store db.Store, config configuration.Configuration) *WebhookDeliverer {
+	return &WebhookDeliverer{
+		store:  store,
+		config: config,
+		client: webhook.NewClient(config.GetConfig().WebhookTimeout),
+		now:    time.Now,
+	}
+}
+
+// Run sends the due deliveries on every poll interval until ctx is cancelled. A zero interval
+// or batch size disables the deliverer.
+func (deliverer *WebhookDeliverer) Run(ctx context.Context) {
+	config := deliverer.config.GetConfig()
+	if config.WebhookPollInterval <= 0 || config.WebhookBatchSize <= 0 {
+		log.Info().Msg("webhook deliverer is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(config.WebhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if deliverer.Deliver(ctx) == int(deliverer.config.GetConfig().WebhookBatchSize) && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Deliver claims a batch of due deliveries, sends them and returns how many were claimed.
+func (deliverer *WebhookDeliverer) Deliver(ctx context.Context) int {
+	config := deliverer.config.GetConfig()
+	now := deliverer.now()
+	// the deliveries of a batch are sent one after the other, so the lease has to outlast
+	// every one of them timing out
+	deliveries, err := deliverer.store.ClaimWebhookDeliveries(ctx, db.ClaimWebhookDeliveriesParams{
+		Now:        now,
+		LeaseUntil: now.Add(config.WebhookTimeout * time.Duration(config.WebhookBatchSize)),
+		Limit:      config.WebhookBatchSize,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("cannot claim webhook deliveries")
+		return 0
+	}
+
+	for _, delivery := range deliveries {
+		deliverer.send(ctx, delivery)
+	}
+	return len(deliveries)
+}
+
+func (deliverer *WebhookDeliverer) send(ctx context.Context, delivery *db.WebhookDelivery) {
+	subscription, err := deliverer.store.GetWebhookSubscription(ctx, delivery.SubscriptionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// the subscription was removed along with its deliveries after the claim
+			return
+		}
+		log.Error().Err(err).Int64("delivery_id", delivery.ID).Msg("cannot load webhook subscription")
+		return
+	}
+
+	arg := db.RecordWebhookDeliveryAttemptParams{ID: delivery.ID}
+	if !subscription.IsActive {
+		arg.Status = db.WebhookDeliveryFailed
+		arg.LastError = "the subscription is inactive"
+		arg.NextAttemptAt = deliverer.now()
+	} else {
+		deliverer.post(ctx, subscription, delivery, &arg)
+	}
+
+	if err = deliverer.store.RecordWebhookDeliveryAttempt(ctx, arg); err != nil {
+		log.Error().Err(err).Int64("delivery_id", delivery.ID).Msg("cannot record webhook delivery attempt")
+	}
+}
+
+// post sends delivery to the receiver of subscription and fills arg with the outcome.
+func (deliverer *WebhookDeliverer) post(ctx context.Context, subscription *db.WebhookSubscription, delivery *db.WebhookDelivery, arg *db.RecordWebhookDeliveryAttemptParams) {
+	now := deliverer.now()
+	err := deliverer.do(ctx, subscription, delivery, now, arg)
+	if err == nil {
+		arg.Status = db.WebhookDeliverySucceeded
+		arg.NextAttemptAt = now
+		arg.DeliveredAt = sql.NullTime{Time: now, Valid: true}
+		return
+	}
+
+	arg.LastError = err.Error()
+	config := deliverer.config.GetConfig()
+	if delivery.Attempts >= config.WebhookMaxAttempts {
+		arg.Status = db.WebhookDeliveryFailed
+		arg.NextAttemptAt = now
+		log.Warn().Err(err).Int64("delivery_id", delivery.ID).Int32("attempts", delivery.Attempts).Msg("webhook delivery failed")
+		return
+	}
+
+	arg.Status = db.WebhookDeliveryPending
+	arg.NextAttemptAt = now.Add(exponentialBackoff(config.WebhookRetryBaseDelay, config.WebhookRetryMaxDelay, delivery.Attempts))
+	log.Info().Err(err).Int64("delivery_id", delivery.ID).Time("retry_at", arg.NextAttemptAt).Msg("webhook delivery will be retried")
+}
+
+func (deliverer *WebhookDeliverer) do(ctx context.Context, subscription *db.WebhookSubscription, delivery *db.WebhookDelivery, now time.Time, arg *db.RecordWebhookDeliveryAttemptParams) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", webhookUserAgent)
+	request.Header.Set(webhook.EventHeaderKey, delivery.EventType)
+	request.Header.Set(webhook.DeliveryHeaderKey, strconv.FormatInt(delivery.ID, 10))
+	request.Header.Set(webhook.SignatureHeaderKey, webhook.Sign(subscription.Secret, now, delivery.Payload))
+
+	response, err := deliverer.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(response.Body)
+
+	// only the status is kept: the body of whatever answered is not shown to the administrators
+	arg.ResponseStatus = int32(response.StatusCode)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("the receiver responded with status %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/newbri/posadamissportia/configuration"
+	"github.com/newbri/posadamissportia/db"
+	"github.com/newbri/posadamissportia/db/mocker"
+	"github.com/newbri/posadamissportia/webhook"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookDeliverer_Deliver(t *testing.T) {
+	const secret = "whsec_0123456789abcdef"
+	now := time.Now()
+	config := &configuration.Config{
+		WebhookPollInterval:   time.Second,
+		WebhookBatchSize:      5,
+		WebhookTimeout:        time.Second,
+		WebhookMaxAttempts:    3,
+		WebhookRetryBaseDelay: 30 * time.Second,
+		WebhookRetryMaxDelay:  time.Hour,
+	}
+	claim := db.ClaimWebhookDeliveriesParams{Now: now, LeaseUntil: now.Add(5 * time.Second), Limit: 5}
+	payload := json.RawMessage(`{"id":42,"type":"property.created","data":{"external_id":"PRO101"}}`)
+
+	testCases := []struct {
+		name     string
+		status   int
+		attempts int32
+		active   bool
+		mock     func(store *mocker.TestMocker)
+		received bool
+	}{
+		{
+			name:     "Succeeded",
+			status:   http.StatusNoContent,
+			attempts: 1,
+			active:   true,
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("RecordWebhookDeliveryAttempt", mock.Anything, db.RecordWebhookDeliveryAttemptParams{
+						ID:             9,
+						Status:         db.WebhookDeliverySucceeded,
+						ResponseStatus: http.StatusNoContent,
+						NextAttemptAt:  now,
+						DeliveredAt:    sql.NullTime{Time: now, Valid: true},
+					}).
+					Times(1).
+					Return(nil)
+			},
+			received: true,
+		},
+		{
+			name:     "RetriedWithBackoff",
+			status:   http.StatusServiceUnavailable,
+			attempts: 2,
+			active:   true,
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("RecordWebhookDeliveryAttempt", mock.Anything, db.RecordWebhookDeliveryAttemptParams{
+						ID:             9,
+						Status:         db.WebhookDeliveryPending,
+						ResponseStatus: http.StatusServiceUnavailable,
+						LastError:      "the receiver responded with status 503",
+						NextAttemptAt:  now.Add(time.Minute),
+					}).
+					Times(1).
+					Return(nil)
+			},
+			received: true,
+		},
+		{
+			name:     "FailedAfterMaxAttempts",
+			status:   http.StatusInternalServerError,
+			attempts: 3,
+			active:   true,
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("RecordWebhookDeliveryAttempt", mock.Anything, mock.MatchedBy(func(arg db.RecordWebhookDeliveryAttemptParams) bool {
+						return arg.Status == db.WebhookDeliveryFailed && arg.ResponseStatus == http.StatusInternalServerError && !arg.DeliveredAt.Valid
+					})).
+					Times(1).
+					Return(nil)
+			},
+			received: true,
+		},
+		{
+			name:     "InactiveSubscription",
+			attempts: 1,
+			active:   false,
+			mock: func(store *mocker.TestMocker) {
+				store.
+					On("RecordWebhookDeliveryAttempt", mock.Anything, db.RecordWebhookDeliveryAttemptParams{
+						ID:            9,
+						Status:        db.WebhookDeliveryFailed,
+						LastError:     "the subscription is inactive",
+						NextAttemptAt: now,
+					}).
+					Times(1).
+					Return(nil)
+			},
+			received: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			received := false
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = true
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				require.JSONEq(t, string(payload), string(body))
+				require.Equal(t, db.EventPropertyCreated, r.Header.Get(webhook.EventHeaderKey))
+				require.Equal(t, "9", r.Header.Get(webhook.DeliveryHeaderKey))
+				require.NoError(t, webhook.Verify(secret, r.Header.Get(webhook.SignatureHeaderKey), body, time.Minute, now))
+
+				w.WriteHeader(tc.status)
+				if tc.status == http.StatusServiceUnavailable {
+					_, _ = w.Write([]byte("busy"))
+				}
+			}))
+			defer receiver.Close()
+
+			store := new(mocker.TestMocker)
+			store.On("GetConfig").Return(config)
+			store.
+				On("ClaimWebhookDeliveries", mock.Anything, claim).
+				Times(1).
+				Return([]*db.WebhookDelivery{{ID: 9, SubscriptionID: 3, EventID: 42, EventType: db.EventPropertyCreated, Payload: payload, Attempts: tc.attempts}}, nil)
+			store.
+				On("GetWebhookSubscription", mock.Anything, int64(3)).
+				Times(1).
+				Return(&db.WebhookSubscription{ID: 3, URL: receiver.URL, Secret: secret, IsActive: tc.active}, nil)
+			tc.mock(store)
+
+			deliverer := newLoopbackDeliverer(store)
+			deliverer.now = func() time.Time { return now }
+
+			require.Equal(t, 1, deliverer.Deliver(context.Background()))
+			require.Equal(t, tc.received, received)
+			store.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWebhookDeliverer_UnreachableReceiver(t *testing.T) {
+	now := time.Now()
+	config := &configuration.Config{
+		WebhookBatchSize:      1,
+		WebhookTimeout:        time.Second,
+		WebhookMaxAttempts:    3,
+		WebhookRetryBaseDelay: 30 * time.Second,
+		WebhookRetryMaxDelay:  time.Hour,
+	}
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := receiver.URL
+	receiver.Close()
+
+	store := new(mocker.TestMocker)
+	store.On("GetConfig").Return(config)
+	store.
+		On("ClaimWebhookDeliveries", mock.Anything, mock.Anything).
+		Times(1).
+		Return([]*db.WebhookDelivery{{ID: 9, SubscriptionID: 3, Payload: json.RawMessage(`{}`), Attempts: 1}}, nil)
+	store.
+		On("GetWebhookSubscription", mock.Anything, int64(3)).
+		Times(1).
+		Return(&db.WebhookSubscription{ID: 3, URL: url, IsActive: true}, nil)
+	store.
+		On("RecordWebhookDeliveryAttempt", mock.Anything, mock.MatchedBy(func(arg db.RecordWebhookDeliveryAttemptParams) bool {
+			return arg.Status == db.WebhookDeliveryPending && arg.ResponseStatus == 0 && len(arg.LastError) > 0 &&
+				arg.NextAttemptAt.Equal(now.Add(30*time.Second))
+		})).
+		Times(1).
+		Return(nil)
+
+	deliverer := newLoopbackDeliverer(store)
+	deliverer.now = func() time.Time { return now }
+
+	require.Equal(t, 1, deliverer.Deliver(context.Background()))
+	store.AssertExpectations(t)
+}
+
+func TestWebhookDeliverer_PrivateReceiver(t *testing.T) {
+	now := time.Now()
+	config := &configuration.Config{
+		WebhookBatchSize:      1,
+		WebhookTimeout:        time.Second,
+		WebhookMaxAttempts:    3,
+		WebhookRetryBaseDelay: 30 * time.Second,
+		WebhookRetryMaxDelay:  time.Hour,
+	}
+
+	received := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+	}))
+	defer receiver.Close()
+
+	store := new(mocker.TestMocker)
+	store.On("GetConfig").Return(config)
+	store.
+		On("ClaimWebhookDeliveries", mock.Anything, mock.Anything).
+		Times(1).
+		Return([]*db.WebhookDelivery{{ID: 9, SubscriptionID: 3, Payload: json.RawMessage(`{}`), Attempts: 1}}, nil)
+	store.
+		On("GetWebhookSubscription", mock.Anything, int64(3)).
+		Times(1).
+		Return(&db.WebhookSubscription{ID: 3, URL: receiver.URL, IsActive: true}, nil)
+	store.
+		On("RecordWebhookDeliveryAttempt", mock.Anything, mock.MatchedBy(func(arg db.RecordWebhookDeliveryAttemptParams) bool {
+			return arg.Status == db.WebhookDeliveryPending && arg.ResponseStatus == 0 &&
+				strings.Contains(arg.LastError, webhook.ErrForbiddenAddress.Error())
+		})).
+		Times(1).
+		Return(nil)
+
+	deliverer := NewWebhookDeliverer(store, store)
+	deliverer.now = func() time.Time { return now }
+
+	require.Equal(t, 1, deliverer.Deliver(context.Background()))
+	require.False(t, received)
+	store.AssertExpectations(t)
+}
+
+// newLoopbackDeliverer lets the deliverer reach the receivers httptest starts on the loopback
+// interface, which the client of NewWebhookDeliverer refuses.
+func newLoopbackDeliverer(store *mocker.TestMocker) *WebhookDeliverer {
+	deliverer := NewWebhookDeliverer(store, store)
+	deliverer.client = &http.Client{Timeout: time.Second}
+	return deliverer
+}